@@ -48,9 +48,16 @@ func DoSetup() {
 
 	utils.CheckGpexpandRunning(utils.BackupPreventedByGpexpandMessage)
 	timestamp := history.CurrentTimestamp()
+	if isResumedBackup() {
+		timestamp = MustGetFlagString(options.RESUME)
+	}
 	createBackupLockFile(timestamp)
 	initializeConnectionPool(timestamp)
 	gplog.Info("Greenplum Database Version = %s", connectionPool.Version.VersionString)
+	if isResumedBackup() {
+		setupResume(timestamp)
+		return
+	}
 
 	gplog.Info("Starting backup of database %s", MustGetFlagString(options.DBNAME))
 	opts, err := options.NewOptions(cmdFlags)
@@ -79,9 +86,31 @@ func DoSetup() {
 	} else {
 		createBackupDirectoriesOnAllHosts()
 	}
+	if MustGetFlagString(options.CONFIG) != "" {
+		// The options are recorded for audit, before the plugin config path is replaced below
+		err = options.WriteOptionsFile(cmdFlags, globalFPInfo.GetBackupOptionsFilePath())
+		if err != nil {
+			gplog.Warn("%v", err)
+		}
+	}
 	globalTOC = &toc.TOC{}
 	globalTOC.InitializeMetadataEntryMap()
 	utils.InitializePipeThroughParameters(!MustGetFlagBool(options.NO_COMPRESSION), MustGetFlagString(options.COMPRESSION_TYPE), MustGetFlagInt(options.COMPRESSION_LEVEL))
+	encryptionKey, err := utils.ReadEncryptionKey(MustGetFlagString(options.ENCRYPTION_KEY_FILE),
+		MustGetFlagString(options.ENCRYPTION_KEY_ENV), MustGetFlagString(options.ENCRYPTION_KEY_CMD), "")
+	gplog.FatalOnError(err)
+	if encryptionKey != nil {
+		gplog.Info("Backup files will be encrypted with key %s", encryptionKey.ID)
+		utils.SetEncryptionKey(encryptionKey)
+	}
+	if rowFilterFile := MustGetFlagString(options.ROW_FILTER_FILE); rowFilterFile != "" {
+		rowFilters, err = options.ReadRowFilterFile(rowFilterFile)
+		gplog.FatalOnError(err)
+	}
+	if maskingRulesFile := MustGetFlagString(options.MASKING_RULES_FILE); maskingRulesFile != "" {
+		maskingRules, err = options.ReadMaskingRulesFile(maskingRulesFile)
+		gplog.FatalOnError(err)
+	}
 	getQuotedRoleNames(connectionPool)
 
 	pluginConfigFlag := MustGetFlagString(options.PLUGIN_CONFIG)
@@ -109,6 +138,10 @@ func DoBackup() {
 	gplog.Info("Backup Timestamp = %s", globalFPInfo.Timestamp)
 	gplog.Info("Backup Database = %s", connectionPool.DBName)
 	gplog.Verbose("Backup Parameters: {%s}", strings.ReplaceAll(backupReport.BackupParamsString, "\n", ", "))
+	if isResumedBackup() {
+		resumeBackup()
+		return
+	}
 
 	pluginConfigFlag := MustGetFlagString(options.PLUGIN_CONFIG)
 	targetBackupTimestamp := ""
@@ -130,6 +163,9 @@ func DoBackup() {
 	gplog.Info("Gathering table state information")
 	metadataTables, dataTables := RetrieveAndProcessTables()
 	dataTables, numExtOrForeignTables := GetBackupDataSet(dataTables)
+	if len(rowFilters) > 0 || len(maskingRules) > 0 {
+		ValidateRowFiltersAndMaskingRules(dataTables, GetExternalPartitionParents(connectionPool), GetPartitionKeyColumns(connectionPool))
+	}
 	if len(dataTables) == 0 && !backupReport.MetadataOnly {
 		gplog.Warn("No tables in backup set contain data. Performing metadata-only backup instead.")
 		backupReport.MetadataOnly = true
@@ -187,6 +223,7 @@ func DoBackup() {
 		isFilteredBackup := !isFullBackup
 		backupPredata(metadataFile, metadataTables, isFilteredBackup)
 		backupPostdata(metadataFile)
+		filterMetadataByObjectType(metadataFile)
 	}
 
 	if !backupReport.MetadataOnly {
@@ -208,6 +245,13 @@ func DoBackup() {
 		}
 	}
 	metadataFile.Close()
+	// The TOC and config files are encrypted as they are written, but the metadata and statistics files are written incrementally
+	err := utils.EncryptBackupFile(metadataFilename)
+	gplog.FatalOnError(err)
+	if MustGetFlagBool(options.WITH_STATS) && utils.FileExists(globalFPInfo.GetStatisticsFilePath()) {
+		err = utils.EncryptBackupFile(globalFPInfo.GetStatisticsFilePath())
+		gplog.FatalOnError(err)
+	}
 	if pluginConfigFlag != "" {
 		pluginConfig.MustBackupFile(metadataFilename)
 		pluginConfig.MustBackupFile(globalFPInfo.GetTOCFilePath())
@@ -299,6 +343,11 @@ func backupData(tables []Table) {
 		gplog.Info("Data backup complete")
 		return
 	}
+	globalTOC.DataFileExtension = utils.GetPipeThroughProgram().Extension
+	if connectionPool.NumConns > 2 {
+		gplog.Verbose("Getting table sizes to back up the largest tables first")
+		SortTablesBySize(tables, GetTableDataSizes(connectionPool, tables))
+	}
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
 		gplog.Verbose("Initializing pipes and gpbackup_helper on segments for single data file backup")
 		utils.VerifyHelperVersionOnSegments(version, globalCluster)
@@ -307,7 +356,16 @@ func backupData(tables []Table) {
 			oidList = append(oidList, fmt.Sprintf("%d", table.Oid))
 		}
 		utils.WriteOidListToSegments(oidList, globalCluster, globalFPInfo, "oid")
+		if utils.GetEncryptionKey() != nil {
+			utils.WriteEncryptionKeyToSegments(globalCluster, globalFPInfo)
+		}
 		compressStr := fmt.Sprintf(" --compression-level %d --compression-type %s", MustGetFlagInt(options.COMPRESSION_LEVEL), MustGetFlagString(options.COMPRESSION_TYPE))
+		if MustGetFlagInt(options.COMPRESSION_THREADS) > 0 {
+			compressStr += fmt.Sprintf(" --compression-threads %d", MustGetFlagInt(options.COMPRESSION_THREADS))
+		}
+		if MustGetFlagInt(options.COMPRESSION_WINDOW) > 0 {
+			compressStr += fmt.Sprintf(" --compression-window %d", MustGetFlagInt(options.COMPRESSION_WINDOW))
+		}
 		if MustGetFlagBool(options.NO_COMPRESSION) {
 			compressStr = " --compression-level 0"
 		}
@@ -315,16 +373,49 @@ func backupData(tables []Table) {
 		// Do not pass through the --on-error-continue flag or the resizeClusterMap because neither apply to gpbackup
 		utils.StartGpbackupHelpers(globalCluster, globalFPInfo, "--backup-agent",
 			MustGetFlagString(options.PLUGIN_CONFIG), compressStr, false, false, &wasTerminated, initialPipes, true, false, 0, 0, gplog.GetVerbosity())
+	} else if MustGetFlagString(options.PLUGIN_CONFIG) == "" {
+		// Multi-file backups use gpbackup_helper to compute table checksums and to encrypt table data
+		utils.VerifyHelperVersionOnSegments(version, globalCluster)
+		if utils.GetEncryptionKey() != nil {
+			utils.WriteEncryptionKeyToSegments(globalCluster, globalFPInfo)
+		}
+	}
+	if !MustGetFlagBool(options.SINGLE_DATA_FILE) {
+		utils.VerifyCompressionProgramOnSegments(globalCluster, utils.GetPipeThroughProgram().OutputCommand)
 	}
 	gplog.Info("Writing data to file")
+	startDataBackup(tables)
+	startBackupMetricsUpdates(len(tables))
+	defer stopMetricsUpdates()
 	rowsCopiedMaps := BackupDataForAllTables(tables)
 	AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) && MustGetFlagString(options.PLUGIN_CONFIG) != "" {
 		pluginConfig.BackupSegmentTOCs(globalCluster, globalFPInfo)
 	}
+	if !MustGetFlagBool(options.SINGLE_DATA_FILE) && MustGetFlagString(options.PLUGIN_CONFIG) == "" && !wasTerminated {
+		writeChecksumManifests(len(globalTOC.DataEntries))
+	}
+	if !wasTerminated {
+		addTableDataSizesToTOC()
+	}
 	logCompletionMessage("Data backup")
 }
 
+/*
+ * Tables whose data is not distributed to every segment are not backed up on
+ * the remaining segments, so a segment may record fewer checksums than there
+ * are tables.  The data of those tables simply cannot be verified on restore.
+ */
+func writeChecksumManifests(numTables int) {
+	gplog.Verbose("Writing table checksum manifests on segments")
+	numChecksums := utils.WriteChecksumManifestsOnSegments(globalCluster, globalFPInfo)
+	for contentID, numRecorded := range numChecksums {
+		if numRecorded < numTables {
+			gplog.Warn("Recorded checksums for %d of %d tables on segment %d; the data of the remaining tables cannot be verified", numRecorded, numTables, contentID)
+		}
+	}
+}
+
 func backupPostdata(metadataFile *utils.FileWithByteCount) {
 	if wasTerminated {
 		return
@@ -416,6 +507,7 @@ func DoTeardown() {
 		}
 		historyFileLegacyName := globalFPInfo.GetBackupHistoryFilePath()
 		reportFilename := globalFPInfo.GetBackupReportFilePath()
+		jsonReportFilename := globalFPInfo.GetBackupJSONReportFilePath()
 		configFilename := globalFPInfo.GetConfigFilePath()
 
 		time.Sleep(time.Second) // We sleep for 1 second to ensure multiple backups do not start within the same second.
@@ -433,12 +525,19 @@ func DoTeardown() {
 				backupReport.BackupConfig.Status = history.BackupStatusSucceed
 			}
 			backupReport.ConstructBackupParamsString()
+			if isResumedBackup() {
+				// The config and report of the backup being resumed are replaced
+				_ = utils.RemoveFileIfExists(configFilename)
+				_ = utils.RemoveFileIfExists(reportFilename)
+				_ = utils.RemoveFileIfExists(jsonReportFilename)
+			}
 
 			history.WriteConfigFile(&backupReport.BackupConfig, configFilename)
 			// We always want to override the initial end time set by the call to StoreBackupHistory
 			backupReport.BackupConfig.EndTime = history.CurrentTimestamp()
 			endtime, _ := time.ParseInLocation("20060102150405", backupReport.BackupConfig.EndTime, operating.System.Local)
-			backupReport.WriteBackupReportFile(reportFilename, globalFPInfo.Timestamp, endtime, objectCounts, errMsg)
+			backupReport.WriteBackupReportFile(reportFilename, globalFPInfo.Timestamp, endtime, objectCounts, globalTOC.DataEntries, errMsg)
+			backupReport.WriteBackupJSONReportFile(jsonReportFilename, globalFPInfo.Timestamp, endtime, objectCounts, getTableReports(), errMsg)
 			report.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gpbackup", !backupFailed, backupReport.BackupConfig.DatabaseName)
 			if pluginConfig != nil {
 				err = pluginConfig.BackupFile(configFilename)
@@ -451,6 +550,18 @@ func DoTeardown() {
 					gplog.Error(fmt.Sprintf("%v", err))
 					return
 				}
+				err = pluginConfig.BackupFile(jsonReportFilename)
+				if err != nil {
+					gplog.Error(fmt.Sprintf("%v", err))
+					return
+				}
+				if optionsFilename := globalFPInfo.GetBackupOptionsFilePath(); utils.FileExists(optionsFilename) {
+					err = pluginConfig.BackupFile(optionsFilename)
+					if err != nil {
+						gplog.Error(fmt.Sprintf("%v", err))
+						return
+					}
+				}
 			}
 		}
 		if pluginConfig != nil {
@@ -460,6 +571,30 @@ func DoTeardown() {
 	}
 }
 
+/*
+ * The notifications are sent during cleanup rather than along with the report,
+ * so that a backup that fails before its report is written, or is cancelled,
+ * is notified as well.
+ */
+func sendBackupNotifications() {
+	reportFilename := ""
+	if globalFPInfo.Timestamp != "" && utils.FileExists(globalFPInfo.GetBackupReportFilePath()) {
+		reportFilename = globalFPInfo.GetBackupReportFilePath()
+	}
+	report.SendNotifications(globalCluster, globalFPInfo.Timestamp, reportFilename, "gpbackup", MustGetFlagString(options.DBNAME), wasTerminated)
+}
+
+func getTableReports() []report.TableReport {
+	tables := make([]report.TableReport, 0)
+	if globalTOC == nil {
+		return tables
+	}
+	for _, entry := range globalTOC.DataEntries {
+		tables = append(tables, report.NewTableReport(entry))
+	}
+	return tables
+}
+
 func DoCleanup(backupFailed bool) {
 	cleanupTimeout := 60 * time.Second
 
@@ -497,7 +632,16 @@ func DoCleanup(backupFailed bool) {
 				gplog.Error(err.Error())
 			}
 		}
+	} else if globalFPInfo.Timestamp != "" && utils.GetEncryptionKey() != nil && !MustGetFlagBool(options.METADATA_ONLY) {
+		// Multi-file backups leave only the encryption key file behind on the segments
+		utils.CleanUpHelperFilesOnAllHosts(globalCluster, globalFPInfo, cleanupTimeout)
+	}
+
+	if backupFailed {
+		writeIncompleteTOC()
 	}
+	writeBackupMetrics(backupFailed)
+	sendBackupNotifications()
 
 	// The gpbackup_history entry is written to the DB with an "In Progress" status and a preliminary EndTime value
 	// very early on.  If we get to cleanup and the backup succeeded, mark it as a success, otherwise mark it as a
@@ -618,11 +762,23 @@ type TableLocks struct {
 	Pid         string
 }
 
-func getTableLocks(table Table) []TableLocks {
+/*
+ * The locks are only reported to help find whoever is blocking the backup, so
+ * a failure to query them is logged rather than failing the backup.  The
+ * tables are matched by name rather than cast to regclass, as a table that
+ * has been dropped since it was listed cannot be cast.
+ */
+func getTableLocks(tableFQNs []string) []TableLocks {
+	locksResults := make([]TableLocks, 0)
 	conn := dbconn.NewDBConnFromEnvironment(MustGetFlagString(options.DBNAME))
-	conn.MustConnect(1)
+	err := conn.Connect(1)
+	if err != nil {
+		gplog.Warn("Unable to query the locks held on tables: %v", err)
+		return locksResults
+	}
 	var query string
 	defer conn.Close()
+	relationList := utils.SliceToQuotedString(tableFQNs)
 	if conn.Version.Before("6") {
 		query = fmt.Sprintf(`
 		SELECT c.oid as oid,
@@ -639,10 +795,10 @@ func getTableLocks(table Table) []TableLocks {
 		JOIN pg_namespace n on n.oid=c.relnamespace
 		WHERE (a.datname = '%s' OR a.datname IS NULL)
 		AND NOT a.procpid = pg_backend_pid()
-		AND relation = '%s'::regclass
+		AND quote_ident(n.nspname) || '.' || quote_ident(c.relname) IN (%s)
 		AND mode = 'AccessExclusiveLock'
 		ORDER BY a.query_start;
-		`, conn.DBName, table.FQN())
+		`, conn.DBName, relationList)
 	} else {
 		query = fmt.Sprintf(`
 		SELECT c.oid as oid,
@@ -659,23 +815,56 @@ func getTableLocks(table Table) []TableLocks {
 		JOIN pg_namespace n on n.oid=c.relnamespace
 		WHERE (a.datname = '%s' OR a.datname IS NULL)
 		AND NOT a.pid = pg_backend_pid()
-		AND relation = '%s'::regclass
+		AND quote_ident(n.nspname) || '.' || quote_ident(c.relname) IN (%s)
 		AND mode = 'AccessExclusiveLock'
 		ORDER BY a.query_start;
-		`, conn.DBName, table.FQN())
+		`, conn.DBName, relationList)
 	}
 
-	locksResults := make([]TableLocks, 0)
-	err := conn.Select(&locksResults, query)
+	err = conn.Select(&locksResults, query)
 	if err != nil {
-		gplog.FatalOnError(err)
+		gplog.Warn("Unable to query the locks held on tables: %v", err)
 	}
 
 	return locksResults
 }
 
 func logTableLocks(table Table, whichConn int) {
-	locks := getTableLocks(table)
+	locks := getTableLocks([]string{table.FQN()})
 	jsonData, _ := json.Marshal(&locks)
 	gplog.Warn("Locks held on table %s: %s", table.FQN(), jsonData)
 }
+
+/*
+ * The sessions holding or waiting for ACCESS EXCLUSIVE locks on the tables
+ * that could not be locked in time are logged and listed in the backup
+ * report, so that whoever is blocking the backup can be found.  A session
+ * that blocks several attempts to lock the tables is listed only once.
+ */
+func reportBlockingLocks(tableFQNs []string) {
+	locks := queryTableLocks(tableFQNs)
+	jsonData, _ := json.Marshal(&locks)
+	gplog.Warn("Locks held on tables waited for: %s", jsonData)
+	if backupReport == nil {
+		return
+	}
+	reported := make(map[report.BlockingLock]bool, len(backupReport.BlockingLocks))
+	for _, lock := range backupReport.BlockingLocks {
+		reported[lock] = true
+	}
+	for _, lock := range locks {
+		blockingLock := report.BlockingLock{
+			Relation:    lock.Relation,
+			Mode:        lock.Mode,
+			Granted:     lock.Granted,
+			Application: lock.Application,
+			User:        lock.User,
+			Pid:         lock.Pid,
+		}
+		if reported[blockingLock] {
+			continue
+		}
+		backupReport.BlockingLocks = append(backupReport.BlockingLocks, blockingLock)
+		reported[blockingLock] = true
+	}
+}
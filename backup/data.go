@@ -5,8 +5,8 @@ package backup
  */
 
 import (
-	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -14,16 +14,30 @@ import (
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/jackc/pgconn"
+	"github.com/pkg/errors"
 	"gopkg.in/cheggaaa/pb.v1"
+	"gopkg.in/yaml.v2"
 )
 
 var (
 	tableDelim = ","
+
+	// The times at which the data of each table started and finished being backed up, and the worker that backed it up
+	tableDataTimes     map[uint32]tableDataTime
+	tableDataTimesLock sync.Mutex
 )
 
+type tableDataTime struct {
+	start  time.Time
+	end    time.Time
+	worker int
+}
+
 func ConstructTableAttributesList(columnDefs []ColumnDefinition) string {
 	// this attribute list used ONLY by CopyTableIn on the restore side
 	// columns where data should not be copied out and back in are excluded from this string.
@@ -41,6 +55,10 @@ func ConstructTableAttributesList(columnDefs []ColumnDefinition) string {
 }
 
 func AddTableDataEntriesToTOC(tables []Table, rowsCopiedMaps []map[uint32]int64) {
+	addTableDataEntries(globalTOC, tables, rowsCopiedMaps)
+}
+
+func addTableDataEntries(tocfile *toc.TOC, tables []Table, rowsCopiedMaps []map[uint32]int64) {
 	for _, table := range tables {
 		if !table.SkipDataBackup() {
 			var rowsCopied int64
@@ -51,17 +69,132 @@ func AddTableDataEntriesToTOC(tables []Table, rowsCopiedMaps []map[uint32]int64)
 				}
 			}
 			attributes := ConstructTableAttributesList(table.ColumnDefs)
-			globalTOC.AddCoordinatorDataEntry(table.Schema, table.Name, table.Oid, attributes, rowsCopied, table.PartitionLevelInfo.RootName, table.DistPolicy.Policy, table.DistPolicy.DistByEnum)
+			tocfile.AddCoordinatorDataEntry(table.Schema, table.Name, table.Oid, attributes, rowsCopied, table.PartitionLevelInfo.RootName, table.DistPolicy.Policy, table.DistPolicy.DistByEnum)
+			entry := &tocfile.DataEntries[len(tocfile.DataEntries)-1]
+			entry.RowFilter = rowFilters[table.FQN()]
+			tableDataTimesLock.Lock()
+			if times, ok := tableDataTimes[table.Oid]; ok {
+				entry.StartTime = times.start
+				entry.EndTime = times.end
+				entry.Worker = times.worker
+			}
+			tableDataTimesLock.Unlock()
 		}
 	}
 }
 
+func recordTableDataTime(oid uint32, start time.Time, end time.Time, worker int) {
+	tableDataTimesLock.Lock()
+	defer tableDataTimesLock.Unlock()
+	if tableDataTimes == nil {
+		tableDataTimes = make(map[uint32]tableDataTime)
+	}
+	tableDataTimes[oid] = tableDataTime{start: start, end: end, worker: worker}
+}
+
+/*
+ * The number of bytes of each table's data on each segment is read from the
+ * segment TOCs of a single data file backup, and from the size files written
+ * by the checksum agent and the sizes of the data files of a multi-file
+ * backup.  The data files of a multi-file backup to a plugin are not on the
+ * segments, so no sizes are recorded for it.
+ */
+func addTableDataSizesToTOC() {
+	segmentSizes := make(map[int]map[uint32]toc.TableDataSize)
+	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
+		for contentID, contents := range utils.ReadSegmentTOCFilesOnSegments(globalCluster, globalFPInfo) {
+			segmentTOC := toc.SegmentTOC{}
+			err := yaml.Unmarshal(contents, &segmentTOC)
+			if err != nil {
+				gplog.Warn("Unable to parse segment TOC file on segment %d: %v", contentID, err)
+				continue
+			}
+			tableSizes := make(map[uint32]toc.TableDataSize, len(segmentTOC.DataEntries))
+			for oid, entry := range segmentTOC.DataEntries {
+				tableSizes[uint32(oid)] = toc.TableDataSize{
+					UncompressedBytes: int64(entry.EndByte - entry.StartByte),
+					CompressedBytes:   int64(entry.CompressedBytes),
+				}
+			}
+			segmentSizes[contentID] = tableSizes
+		}
+	} else if MustGetFlagString(options.PLUGIN_CONFIG) == "" {
+		uncompressedSizes := utils.CollectTableSizeFilesOnSegments(globalCluster, globalFPInfo)
+		compressedSizes := utils.GetTableDataFileSizesOnSegments(globalCluster, globalFPInfo)
+		for contentID, tableSizes := range compressedSizes {
+			segmentSizes[contentID] = make(map[uint32]toc.TableDataSize, len(tableSizes))
+			for oid, compressedBytes := range tableSizes {
+				segmentSizes[contentID][oid] = toc.TableDataSize{
+					UncompressedBytes: uncompressedSizes[contentID][oid],
+					CompressedBytes:   compressedBytes,
+				}
+			}
+		}
+	} else {
+		return
+	}
+	globalTOC.AddDataEntrySizes(segmentSizes)
+}
+
 type BackupProgressCounters struct {
 	NumRegTables   int64
 	TotalRegTables int64
 	ProgressBar    utils.ProgressBar
 }
 
+/*
+ * The data of a table given in the --row-filter-file or --masking-rules-file
+ * is copied out with a query, so that only the rows satisfying its predicate
+ * are backed up and the expressions of its masked columns are backed up in
+ * place of their data.  The columns are selected in the order of the attribute
+ * list recorded in the table of contents, which is the order in which they
+ * are restored.
+ */
+func isCopiedWithQuery(table Table) bool {
+	_, isFiltered := rowFilters[table.FQN()]
+	_, isMasked := maskingRules[table.FQN()]
+	return isFiltered || isMasked
+}
+
+func constructCopySource(connectionPool *dbconn.DBConn, table Table) string {
+	columnNames := ""
+	if connectionPool.Version.AtLeast("7") {
+		// process column names to exclude generated columns from data copy out
+		columnNames = ConstructTableAttributesList(table.ColumnDefs)
+	}
+	if !isCopiedWithQuery(table) {
+		return table.FQN() + columnNames
+	}
+	rowFilter, isFiltered := rowFilters[table.FQN()]
+	columnMasks, isMasked := maskingRules[table.FQN()]
+	selectList := "*"
+	if isMasked {
+		selectList = constructMaskedSelectList(table.ColumnDefs, columnMasks)
+	} else if columnNames != "" {
+		selectList = strings.Trim(columnNames, "()")
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", selectList, table.FQN())
+	if isFiltered {
+		query += fmt.Sprintf(" WHERE %s", rowFilter)
+	}
+	return fmt.Sprintf("(%s)", query)
+}
+
+func constructMaskedSelectList(columnDefs []ColumnDefinition, columnMasks map[string]string) string {
+	columns := make([]string, 0, len(columnDefs))
+	for _, col := range columnDefs {
+		if col.AttGenerated != "" {
+			continue
+		}
+		if expression, ok := columnMasks[col.Name]; ok {
+			columns = append(columns, fmt.Sprintf("%s AS %s", expression, col.Name))
+		} else {
+			columns = append(columns, col.Name)
+		}
+	}
+	return strings.Join(columns, ",")
+}
+
 func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite string, connNum int) (int64, error) {
 	if wasTerminated {
 		return -1, nil
@@ -80,21 +213,28 @@ func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite
 		customPipeThroughCommand = utils.DefaultPipeThroughProgram
 	} else if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
 		sendToDestinationCommand = fmt.Sprintf("| %s backup_data %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath)
+	} else {
+		// The checksum is computed before compression, as it is for single data file backups
+		checksumFile := globalFPInfo.GetTableChecksumFilePathForCopyCommand(table.Oid)
+		sizeFile := globalFPInfo.GetTableSizeFilePathForCopyCommand(table.Oid)
+		customPipeThroughCommand = fmt.Sprintf("%s | %s", utils.GetChecksumAgentCommand(globalFPInfo, checksumFile, sizeFile, table.Oid, false), customPipeThroughCommand)
+		if utils.GetEncryptionKey() != nil {
+			// Compressed data is encrypted, as encrypted data does not compress
+			customPipeThroughCommand = fmt.Sprintf("%s | %s", customPipeThroughCommand, utils.GetEncryptionAgentCommand(globalFPInfo, false))
+		}
 	}
 
 	copyCommand := fmt.Sprintf("PROGRAM '%s%s %s %s'", checkPipeExistsCommand, customPipeThroughCommand, sendToDestinationCommand, destinationToWrite)
 
-	columnNames := ""
-	if connectionPool.Version.AtLeast("7") {
-		// process column names to exclude generated columns from data copy out
-		columnNames = ConstructTableAttributesList(table.ColumnDefs)
-	}
-
 	workerInfo := ""
 	if gplog.GetVerbosity() >= gplog.LOGVERBOSE {
 		workerInfo = fmt.Sprintf("Worker %d: ", connNum)
 	}
-	query := fmt.Sprintf("COPY %s%s TO %s WITH CSV DELIMITER '%s' ON SEGMENT IGNORE EXTERNAL PARTITIONS;", table.FQN(), columnNames, copyCommand, tableDelim)
+	query := fmt.Sprintf("COPY %s TO %s WITH CSV DELIMITER '%s' ON SEGMENT", constructCopySource(connectionPool, table), copyCommand, tableDelim)
+	if !isCopiedWithQuery(table) {
+		query += " IGNORE EXTERNAL PARTITIONS"
+	}
+	query += ";"
 	if connectionPool.Version.AtLeast("7") {
 		utils.LogProgress(`%sExecuting "%s" on coordinator`, workerInfo, query)
 	} else {
@@ -125,15 +265,179 @@ func BackupSingleTableData(table Table, rowsCopiedMap map[uint32]int64, counters
 	} else {
 		destinationToWrite = globalFPInfo.GetTableBackupFilePathForCopyCommand(table.Oid, utils.GetPipeThroughProgram().Extension, false)
 	}
+	start := operating.System.Now()
 	rowsCopied, err := CopyTableOut(connectionPool, table, destinationToWrite, whichConn)
 	if err != nil {
 		return err
 	}
+	recordTableDataTime(table.Oid, start, operating.System.Now(), whichConn)
 	rowsCopiedMap[table.Oid] = rowsCopied
+	recordCompletedTable(table.Oid, rowsCopied)
 	counters.ProgressBar.Increment()
 	return nil
 }
 
+/*
+ * Tables are backed up largest first, so that a worker that finishes a table
+ * takes the largest of those left and the largest tables do not keep a few
+ * workers busy long after the others have finished.
+ */
+func SortTablesBySize(tables []Table, sizes map[uint32]int64) {
+	sort.SliceStable(tables, func(i int, j int) bool {
+		return sizes[tables[i].Oid] > sizes[tables[j].Oid]
+	})
+}
+
+/*
+ * Each table given with --pin-table is backed up by a worker of its own, which
+ * backs up no other table, starting with worker 1.
+ */
+func AssignPinnedTables(tables []Table, pinnedTableFQNs []string) map[uint32]int {
+	tableOids := make(map[string]uint32, len(tables))
+	for _, table := range tables {
+		tableOids[table.FQN()] = table.Oid
+	}
+	pinnedWorkers := make(map[uint32]int, len(pinnedTableFQNs))
+	for _, fqn := range pinnedTableFQNs {
+		oid, ok := tableOids[fqn]
+		if !ok {
+			gplog.Warn("Table %s to pin to a worker has no data to back up", fqn)
+			continue
+		}
+		if _, ok := pinnedWorkers[oid]; ok {
+			continue
+		}
+		pinnedWorkers[oid] = len(pinnedWorkers) + 1
+	}
+	return pinnedWorkers
+}
+
+/*
+ * The data of a filtered or masked table is copied out with a query, which
+ * would also read the data of the external partitions of the table, so such a
+ * table must be filtered or masked one leaf partition at a time instead.
+ */
+func ValidateRowFiltersAndMaskingRules(tables []Table, externalPartitionParents map[uint32]bool, partitionKeyColumns map[uint32][]string) {
+	validateRowFilterTables(tables)
+	validateMaskingRules(tables, partitionKeyColumns)
+	for _, table := range tables {
+		if isCopiedWithQuery(table) && externalPartitionParents[table.Oid] {
+			gplog.Fatal(errors.Errorf("Table %s has external partitions, so its data cannot be filtered or masked; use --leaf-partition-data to filter or mask the data of its leaf partitions instead", table.FQN()), "")
+		}
+	}
+}
+
+/*
+ * A table given in the --row-filter-file whose data would not be backed up is
+ * most likely a partition table backed up with --leaf-partition-data, whose
+ * leaf partitions would then be backed up unfiltered.
+ */
+func validateRowFilterTables(tables []Table) {
+	tableFQNs := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		tableFQNs[table.FQN()] = true
+	}
+	filteredTableFQNs := make([]string, 0, len(rowFilters))
+	for fqn := range rowFilters {
+		filteredTableFQNs = append(filteredTableFQNs, fqn)
+	}
+	sort.Strings(filteredTableFQNs)
+	for _, fqn := range filteredTableFQNs {
+		if !tableFQNs[fqn] {
+			gplog.Fatal(errors.Errorf("Table %s in the row filter file has no data to back up", fqn), "")
+		}
+	}
+}
+
+/*
+ * Returns the quoted names of the columns of a "DISTRIBUTED BY (...)" policy,
+ * without their operator classes.
+ */
+func getDistributionKeyColumns(policy string) []string {
+	if !strings.HasPrefix(policy, "DISTRIBUTED BY (") {
+		return []string{}
+	}
+	keyColumns := make([]string, 0)
+	keyList := strings.TrimSuffix(strings.TrimPrefix(policy, "DISTRIBUTED BY ("), ")")
+	for len(keyList) > 0 {
+		end := 0
+		if keyList[0] == '"' {
+			for end = 1; end < len(keyList); end++ {
+				if keyList[end] == '"' {
+					if end+1 < len(keyList) && keyList[end+1] == '"' {
+						end++
+						continue
+					}
+					end++
+					break
+				}
+			}
+		} else {
+			end = strings.IndexAny(keyList, " ,")
+			if end == -1 {
+				end = len(keyList)
+			}
+		}
+		keyColumns = append(keyColumns, keyList[:end])
+		// Skip the operator class of the column, if any
+		next := strings.Index(keyList[end:], ",")
+		if next == -1 {
+			break
+		}
+		keyList = strings.TrimLeft(keyList[end+next+1:], " ")
+	}
+	return keyColumns
+}
+
+/*
+ * A masked column that is not backed up would leave the data of the column it
+ * was meant to mask, such as one whose name is misspelled in the file, in the
+ * backup unmasked.  The distribution and partition key columns of a table
+ * cannot be masked either, as its masked rows would be restored to segments
+ * or partitions that do not match their masked values.
+ */
+func validateMaskingRules(tables []Table, partitionKeyColumns map[uint32][]string) {
+	tablesByFQN := make(map[string]Table, len(tables))
+	for _, table := range tables {
+		tablesByFQN[table.FQN()] = table
+	}
+	maskedTableFQNs := make([]string, 0, len(maskingRules))
+	for fqn := range maskingRules {
+		maskedTableFQNs = append(maskedTableFQNs, fqn)
+	}
+	sort.Strings(maskedTableFQNs)
+	for _, fqn := range maskedTableFQNs {
+		table, ok := tablesByFQN[fqn]
+		if !ok {
+			gplog.Fatal(errors.Errorf("Table %s in the masking rules file has no data to back up", fqn), "")
+		}
+		columnNames := make(map[string]bool, len(table.ColumnDefs))
+		for _, col := range table.ColumnDefs {
+			if col.AttGenerated == "" {
+				columnNames[col.Name] = true
+			}
+		}
+		maskedColumns := make([]string, 0, len(maskingRules[fqn]))
+		for column := range maskingRules[fqn] {
+			maskedColumns = append(maskedColumns, column)
+		}
+		sort.Strings(maskedColumns)
+		distributionKeyColumns := utils.NewSet(getDistributionKeyColumns(table.DistPolicy.Policy))
+		tablePartitionKeyColumns := utils.NewSet(partitionKeyColumns[table.Oid])
+		for _, column := range maskedColumns {
+			if !columnNames[column] {
+				gplog.Fatal(errors.Errorf("Column %s of table %s in the masking rules file has no data to back up", column, fqn), "")
+			}
+			if distributionKeyColumns.MatchesFilter(column) {
+				gplog.Fatal(errors.Errorf("Column %s of table %s in the masking rules file is a distribution key column, so its data cannot be masked", column, fqn), "")
+			}
+			if tablePartitionKeyColumns.MatchesFilter(column) {
+				gplog.Fatal(errors.Errorf("Column %s of table %s in the masking rules file is a partition key column, so its data cannot be masked", column, fqn), "")
+			}
+		}
+	}
+}
+
 /*
 * Iterate through tables, backup data from each table in set.
 * If supported by the database, a synchronized database snapshot is used to sync
@@ -149,6 +453,9 @@ func BackupSingleTableData(table Table, rowsCopiedMap map[uint32]int64, counters
 * another without, then extract common portions into their own functions.
  */
 func BackupDataForAllTables(tables []Table) []map[uint32]int64 {
+	tableDataTimesLock.Lock()
+	tableDataTimes = make(map[uint32]tableDataTime, len(tables))
+	tableDataTimesLock.Unlock()
 	counters := BackupProgressCounters{NumRegTables: 0, TotalRegTables: int64(len(tables))}
 	counters.ProgressBar = utils.NewProgressBar(int(counters.TotalRegTables), "Tables backed up: ", utils.PB_INFO)
 	counters.ProgressBar.Start()
@@ -159,14 +466,27 @@ func BackupDataForAllTables(tables []Table) []map[uint32]int64 {
 	 * in progress if they don't finish on their own.
 	 */
 	tasks := make(chan Table, len(tables))
+	pinnedWorkers := AssignPinnedTables(tables, MustGetFlagStringArray(options.PIN_TABLE))
+	workerTasks := make([]chan Table, connectionPool.NumConns)
+	for connNum := 1; connNum < connectionPool.NumConns; connNum++ {
+		if connNum <= len(pinnedWorkers) {
+			workerTasks[connNum] = make(chan Table, 1)
+		} else {
+			workerTasks[connNum] = tasks
+		}
+	}
 	var oidMap sync.Map
 	var isErroredBackup atomic.Bool
 	var workerPool sync.WaitGroup
 	// Record and track tables in a hashmap of oids and table states (preloaded with value Unknown).
-	// The tables are loaded into the tasks channel for the subsequent goroutines to work on.
+	// The tables are loaded into the tasks channels for the subsequent goroutines to work on.
 	for _, table := range tables {
 		oidMap.Store(table.Oid, Unknown)
-		tasks <- table
+		if worker, ok := pinnedWorkers[table.Oid]; ok {
+			workerTasks[worker] <- table
+		} else {
+			tasks <- table
+		}
 	}
 
 	/*
@@ -193,7 +513,7 @@ func BackupDataForAllTables(tables []Table) []map[uint32]int64 {
 			 * Large partition hierarchies result in a large number of locks being held until the
 			 * transaction commits and the locks are released.
 			 */
-			for table := range tasks {
+			for table := range workerTasks[whichConn] {
 				if wasTerminated || isErroredBackup.Load() {
 					counters.ProgressBar.(*pb.ProgressBar).NotPrint = true
 					return
@@ -300,6 +620,9 @@ func BackupDataForAllTables(tables []Table) []map[uint32]int64 {
 		deferredWorkerDone <- true
 	}()
 
+	for worker := 1; worker <= len(pinnedWorkers); worker++ {
+		close(workerTasks[worker])
+	}
 	close(tasks)
 	workerPool.Wait()
 
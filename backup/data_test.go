@@ -2,10 +2,15 @@ package backup_test
 
 import (
 	"fmt"
+	"os"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/report"
@@ -57,6 +62,14 @@ var _ = Describe("backup/data tests", func() {
 			expectedDataEntries := []toc.CoordinatorDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)"}}
 			Expect(tocfile.DataEntries).To(Equal(expectedDataEntries))
 		})
+		It("records the predicate of a table whose rows are filtered in its entry", func() {
+			backup.SetRowFilters(map[string]string{"public.table": "a > 10"})
+			defer backup.SetRowFilters(nil)
+			tables := []backup.Table{table}
+			backup.AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
+			expectedDataEntries := []toc.CoordinatorDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)", RowFilter: "a > 10"}}
+			Expect(tocfile.DataEntries).To(Equal(expectedDataEntries))
+		})
 		It("does not add an entry for an external table to the TOC", func() {
 			table.IsExternal = true
 			tables := []backup.Table{table}
@@ -73,9 +86,13 @@ var _ = Describe("backup/data tests", func() {
 	})
 	Describe("CopyTableOut", func() {
 		testTable := backup.Table{Relation: backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo"}}
+		checksumCommand := fmt.Sprintf("%s/bin/gpbackup_helper --checksum-agent --oid 3456 --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456_checksum --size-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456_size --content <SEGID>", os.Getenv("GPHOME"))
+		BeforeEach(func() {
+			backup.SetFPInfo(filepath.FilePathInfo{BaseDataDir: "<SEG_DATA_DIR>", Timestamp: "20170101010101"})
+		})
 		It("will back up a table to its own file with gzip compression", func() {
 			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -8", InputCommand: "gzip -d -c", Extension: ".gz"})
-			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'gzip -c -8 > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM '" + checksumCommand + " | gzip -c -8 > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
 
@@ -98,7 +115,7 @@ var _ = Describe("backup/data tests", func() {
 		})
 		It("will back up a table to its own file with zstd compression", func() {
 			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "zstd", OutputCommand: "zstd --compress -3 -c", InputCommand: "zstd --decompress -c", Extension: ".zst"})
-			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'zstd --compress -3 -c > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.zst' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM '" + checksumCommand + " | zstd --compress -3 -c > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.zst' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.zst"
 
@@ -106,6 +123,31 @@ var _ = Describe("backup/data tests", func() {
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
+		It("will back up a table to its own file with lz4 compression", func() {
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "lz4", OutputCommand: "lz4 -c -1", InputCommand: "lz4 -d -c", Extension: ".lz4"})
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM '" + checksumCommand + " | lz4 -c -1 > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.lz4' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.lz4"
+
+			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("will back up a table to its own file with gzip compression and encryption", func() {
+			encryptionKey, _ := utils.NewEncryptionKey(strings.Repeat("ab", 32))
+			utils.SetEncryptionKey(encryptionKey)
+			defer utils.SetEncryptionKey(nil)
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -8", InputCommand: "gzip -d -c", Extension: ".gz"})
+			encryptedChecksumCommand := strings.Replace(checksumCommand, " --content", " --encryption-key-file <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_key_0 --content", 1)
+			encryptionCommand := fmt.Sprintf("%s/bin/gpbackup_helper --encrypt-agent --encryption-key-file <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_key_0 --content <SEGID>", os.Getenv("GPHOME"))
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM '" + encryptedChecksumCommand + " | gzip -c -8 | " + encryptionCommand + " > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
+
+			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
 		It("will back up a table to its own file with zstd compression using a plugin", func() {
 			_ = cmdFlags.Set(options.PLUGIN_CONFIG, "/tmp/plugin_config")
 			pluginConfig := utils.PluginConfig{ExecutablePath: "/tmp/fake-plugin.sh", ConfigPath: "/tmp/plugin_config"}
@@ -121,7 +163,7 @@ var _ = Describe("backup/data tests", func() {
 		})
 		It("will back up a table to its own file without compression", func() {
 			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""})
-			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'cat - > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM '" + checksumCommand + " | cat - > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
 
@@ -152,6 +194,26 @@ var _ = Describe("backup/data tests", func() {
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
+		DescribeTable("will back up filtered and masked tables with a query", func(rowFilters map[string]string, maskingRules map[string]map[string]string, query string) {
+			maskedTable := testTable
+			maskedTable.ColumnDefs = []backup.ColumnDefinition{{Oid: 1, Name: "id"}, {Oid: 2, Name: "email"}, {Oid: 3, Name: "phone"}}
+			backup.SetRowFilters(rowFilters)
+			defer backup.SetRowFilters(nil)
+			backup.SetMaskingRules(maskingRules)
+			defer backup.SetMaskingRules(nil)
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -8", InputCommand: "gzip -d -c", Extension: ".gz"})
+			execStr := regexp.QuoteMeta("COPY (" + query + ") TO PROGRAM '" + checksumCommand + " | gzip -c -8 > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz' WITH CSV DELIMITER ',' ON SEGMENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
+
+			_, err := backup.CopyTableOut(connectionPool, maskedTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		},
+			Entry("only the rows satisfying the predicate of a filtered table", map[string]string{"public.foo": "created_at > now() - interval '90 days'"}, nil, "SELECT * FROM public.foo WHERE created_at > now() - interval '90 days'"),
+			Entry("the expressions of masked columns in place of their data", nil, map[string]map[string]string{"public.foo": {"email": "md5(email)", "phone": "NULL"}}, "SELECT id,md5(email) AS email,NULL AS phone FROM public.foo"),
+			Entry("the masked rows satisfying the predicate of a filtered and masked table", map[string]string{"public.foo": "id > 10"}, map[string]map[string]string{"public.foo": {"email": "md5(email)", "phone": "NULL"}}, "SELECT id,md5(email) AS email,NULL AS phone FROM public.foo WHERE id > 10"),
+		)
 	})
 	Describe("BackupSingleTableData", func() {
 		var (
@@ -196,6 +258,97 @@ var _ = Describe("backup/data tests", func() {
 			Expect(rowsCopiedMap[0]).To(Equal(int64(10)))
 			Expect(counters.NumRegTables).To(Equal(int64(1)))
 		})
+		It("records the times at which the data of the table started and finished being backed up in its TOC entry", func() {
+			before := time.Now()
+			tocfile := &toc.TOC{}
+			backup.SetTOC(tocfile)
+			testTable.Oid = 4567
+
+			mock.ExpectExec("COPY (.*)").WillReturnResult(sqlmock.NewResult(0, 10))
+			err := backup.BackupSingleTableData(testTable, rowsCopiedMap, &counters, 0)
+			Expect(err).ShouldNot(HaveOccurred())
+			backup.AddTableDataEntriesToTOC([]backup.Table{testTable}, []map[uint32]int64{rowsCopiedMap})
+
+			Expect(tocfile.DataEntries).To(HaveLen(1))
+			Expect(tocfile.DataEntries[0].RowsCopied).To(Equal(int64(10)))
+			Expect(tocfile.DataEntries[0].StartTime).To(BeTemporally(">=", before))
+			Expect(tocfile.DataEntries[0].EndTime).To(BeTemporally(">=", tocfile.DataEntries[0].StartTime))
+			Expect(tocfile.DataEntries[0].EndTime).To(BeTemporally("<=", time.Now()))
+		})
+	})
+	Describe("SortTablesBySize", func() {
+		It("sorts the tables largest first, keeping the order of tables of the same size", func() {
+			tables := []backup.Table{
+				{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "small"}},
+				{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "big"}},
+				{Relation: backup.Relation{Oid: 3, Schema: "public", Name: "empty"}},
+				{Relation: backup.Relation{Oid: 4, Schema: "public", Name: "small2"}},
+			}
+
+			backup.SortTablesBySize(tables, map[uint32]int64{1: 10, 2: 1000, 4: 10})
+
+			Expect([]uint32{tables[0].Oid, tables[1].Oid, tables[2].Oid, tables[3].Oid}).To(Equal([]uint32{2, 1, 4, 3}))
+		})
+	})
+	Describe("AssignPinnedTables", func() {
+		tables := []backup.Table{
+			{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "dim"}},
+			{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "fact"}},
+			{Relation: backup.Relation{Oid: 3, Schema: "public", Name: "fact2"}},
+		}
+		It("assigns each pinned table a worker of its own, starting with worker 1", func() {
+			pinnedWorkers := backup.AssignPinnedTables(tables, []string{"public.fact2", "public.fact"})
+
+			Expect(pinnedWorkers).To(Equal(map[uint32]int{3: 1, 2: 2}))
+		})
+		It("does not assign a worker to a pinned table whose data is not backed up", func() {
+			pinnedWorkers := backup.AssignPinnedTables(tables, []string{"public.missing", "public.fact"})
+
+			Expect(pinnedWorkers).To(Equal(map[uint32]int{2: 1}))
+			Expect(string(logfile.Contents())).To(ContainSubstring("Table public.missing to pin to a worker has no data to back up"))
+		})
+	})
+	Describe("ValidateRowFiltersAndMaskingRules", func() {
+		tables := []backup.Table{
+			{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "events"}},
+			{
+				Relation: backup.Relation{Oid: 2, Schema: "public", Name: "customers"},
+				TableDefinition: backup.TableDefinition{
+					ColumnDefs: []backup.ColumnDefinition{{Oid: 1, Name: "id"}, {Oid: 2, Name: "email"}, {Oid: 3, Name: `"Tenant, Id"`}, {Oid: 4, Name: "region"}},
+					DistPolicy: backup.DistPolicy{Policy: `DISTRIBUTED BY (id, "Tenant, Id" int4_ops)`},
+				},
+			},
+			{
+				Relation:        backup.Relation{Oid: 3, Schema: "public", Name: "orders"},
+				TableDefinition: backup.TableDefinition{ColumnDefs: []backup.ColumnDefinition{{Oid: 1, Name: "id"}}},
+			},
+		}
+		externalPartitionParents := map[uint32]bool{3: true}
+		partitionKeyColumns := map[uint32][]string{2: {"region"}}
+		AfterEach(func() {
+			backup.SetRowFilters(nil)
+			backup.SetMaskingRules(nil)
+		})
+		DescribeTable("validates the tables and columns to filter or mask", func(rowFilters map[string]string, maskingRules map[string]map[string]string, expectedMessage string) {
+			backup.SetRowFilters(rowFilters)
+			backup.SetMaskingRules(maskingRules)
+			if expectedMessage != "" {
+				defer testhelper.ShouldPanicWithMessage(expectedMessage)
+			}
+
+			backup.ValidateRowFiltersAndMaskingRules(tables, externalPartitionParents, partitionKeyColumns)
+		},
+			Entry("does not panic if the data of every filtered table and masked column is backed up", map[string]string{"public.events": "id > 10"}, map[string]map[string]string{"public.customers": {"email": "md5(email)"}}, ""),
+			Entry("does not panic if a table with external partitions is neither filtered nor masked", map[string]string{"public.events": "id > 10"}, nil, ""),
+			Entry("panics if the data of a filtered table is not backed up", map[string]string{"public.events": "id > 10", "public.sales": "region = 'EMEA'"}, nil, "Table public.sales in the row filter file has no data to back up"),
+			Entry("panics if the data of a masked table is not backed up", nil, map[string]map[string]string{"public.accounts": {"iban": "NULL"}}, "Table public.accounts in the masking rules file has no data to back up"),
+			Entry("panics if a masked column is not a column of its table", nil, map[string]map[string]string{"public.customers": {"e_mail": "md5(email)"}}, "Column e_mail of table public.customers in the masking rules file has no data to back up"),
+			Entry("panics if a masked column is a distribution key column", nil, map[string]map[string]string{"public.customers": {"id": "NULL"}}, "Column id of table public.customers in the masking rules file is a distribution key column, so its data cannot be masked"),
+			Entry("panics if a masked column with a quoted name is a distribution key column", nil, map[string]map[string]string{"public.customers": {`"Tenant, Id"`: "0"}}, `Column "Tenant, Id" of table public.customers in the masking rules file is a distribution key column, so its data cannot be masked`),
+			Entry("panics if a masked column is a partition key column", nil, map[string]map[string]string{"public.customers": {"region": "NULL"}}, "Column region of table public.customers in the masking rules file is a partition key column, so its data cannot be masked"),
+			Entry("panics if a filtered table has external partitions", map[string]string{"public.orders": "id > 10"}, nil, "Table public.orders has external partitions, so its data cannot be filtered or masked"),
+			Entry("panics if a masked table has external partitions", nil, map[string]map[string]string{"public.orders": {"id": "NULL"}}, "Table public.orders has external partitions, so its data cannot be filtered or masked"),
+		)
 	})
 	Describe("GetBackupDataSet", func() {
 		config := history.BackupConfig{}
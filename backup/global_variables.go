@@ -2,6 +2,7 @@ package backup
 
 import (
 	"sync"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
@@ -27,6 +28,7 @@ const (
 	Deferred
 	Complete
 	PG_LOCK_NOT_AVAILABLE = "55P03"
+	PG_QUERY_CANCELED     = "57014"
 	ENUM_TYPE_OID = 3500
 )
 
@@ -48,6 +50,11 @@ var (
 	filterRelationClause string
 	quotedRoleNames      map[string]string
 	backupSnapshot       string
+	rowFilters           map[string]string
+	maskingRules         map[string]map[string]string
+	// The locks blocking the backup are queried on a connection of their own, and the waits between lock retries are long
+	queryTableLocks = getTableLocks
+	lockRetrySleep  = time.Sleep
 	/*
 	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
 	 * and then wait for at least one DoCleanup to finish, either in DoTeardown
@@ -126,6 +133,22 @@ func SetQuotedRoleNames(quotedRoles map[string]string) {
 	quotedRoleNames = quotedRoles
 }
 
+func SetRowFilters(filters map[string]string) {
+	rowFilters = filters
+}
+
+func SetMaskingRules(rules map[string]map[string]string) {
+	maskingRules = rules
+}
+
+func SetTableLocksQuery(query func(tableFQNs []string) []TableLocks) {
+	queryTableLocks = query
+}
+
+func SetLockRetrySleep(sleep func(time.Duration)) {
+	lockRetrySleep = sleep
+}
+
 // Util functions to enable ease of access to global flag values
 
 func FlagChanged(flagName string) bool {
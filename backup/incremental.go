@@ -124,11 +124,17 @@ func matchesIncrementalFlags(backupConfig *history.BackupConfig, currentBackupCo
 		pluginBinaryName == currentBackupConfig.Plugin &&
 		backupConfig.SingleDataFile == MustGetFlagBool(options.SINGLE_DATA_FILE) &&
 		backupConfig.Compressed == currentBackupConfig.Compressed &&
+		// A backup set must be encrypted with a single key so that it can be restored with that key
+		backupConfig.EncryptionKeyID == currentBackupConfig.EncryptionKeyID &&
+		// The tables of a backup with filtered rows or masked columns must be backed up in full by the backups based on it
+		!backupConfig.RowFiltered && !backupConfig.Masked &&
 		// Expanding of the include list happens before this now so we must compare again current backup config
 		utils.NewIncludeSet(backupConfig.IncludeRelations).Equals(utils.NewIncludeSet(currentBackupConfig.IncludeRelations)) &&
 		utils.NewIncludeSet(backupConfig.IncludeSchemas).Equals(utils.NewIncludeSet(MustGetFlagStringArray(options.INCLUDE_SCHEMA))) &&
 		utils.NewIncludeSet(backupConfig.ExcludeRelations).Equals(utils.NewIncludeSet(MustGetFlagStringArray(options.EXCLUDE_RELATION))) &&
-		utils.NewIncludeSet(backupConfig.ExcludeSchemas).Equals(utils.NewIncludeSet(MustGetFlagStringArray(options.EXCLUDE_SCHEMA)))
+		utils.NewIncludeSet(backupConfig.ExcludeSchemas).Equals(utils.NewIncludeSet(MustGetFlagStringArray(options.EXCLUDE_SCHEMA))) &&
+		utils.NewIncludeSet(backupConfig.IncludeObjectTypes).Equals(utils.NewIncludeSet(currentBackupConfig.IncludeObjectTypes)) &&
+		utils.NewIncludeSet(backupConfig.ExcludeObjectTypes).Equals(utils.NewIncludeSet(currentBackupConfig.ExcludeObjectTypes))
 }
 
 func PopulateRestorePlan(changedTables []Table,
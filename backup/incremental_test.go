@@ -84,43 +84,89 @@ var _ = Describe("backup/incremental tests", func() {
 		historyDBPath := "/tmp/hist.db"
 		contents := []history.BackupConfig{
 			{
-				DatabaseName:     "test2",
-				Timestamp:        "timestamp4",
-				Status:           history.BackupStatusFailed,
-				ExcludeRelations: []string{},
-				ExcludeSchemas:   []string{},
-				IncludeRelations: []string{},
-				IncludeSchemas:   []string{},
-				RestorePlan:      []history.RestorePlanEntry{},
+				DatabaseName:       "test2",
+				Timestamp:          "timestamp4",
+				Status:             history.BackupStatusFailed,
+				ExcludeObjectTypes: []string{},
+				ExcludeRelations:   []string{},
+				ExcludeSchemas:     []string{},
+				IncludeObjectTypes: []string{},
+				IncludeRelations:   []string{},
+				IncludeSchemas:     []string{},
+				RestorePlan:        []history.RestorePlanEntry{},
 			},
 			{
-				DatabaseName:     "test1",
-				Timestamp:        "timestamp3",
-				Status:           history.BackupStatusSucceed,
-				ExcludeRelations: []string{},
-				ExcludeSchemas:   []string{},
-				IncludeRelations: []string{},
-				IncludeSchemas:   []string{},
-				RestorePlan:      []history.RestorePlanEntry{}},
+				DatabaseName:       "test1",
+				Timestamp:          "timestamp3",
+				Status:             history.BackupStatusSucceed,
+				ExcludeObjectTypes: []string{},
+				ExcludeRelations:   []string{},
+				ExcludeSchemas:     []string{},
+				IncludeObjectTypes: []string{},
+				IncludeRelations:   []string{},
+				IncludeSchemas:     []string{},
+				RestorePlan:        []history.RestorePlanEntry{}},
 			{
-				DatabaseName:     "test2",
-				Timestamp:        "timestamp2",
-				Status:           history.BackupStatusSucceed,
-				ExcludeRelations: []string{},
-				ExcludeSchemas:   []string{},
-				IncludeRelations: []string{},
-				IncludeSchemas:   []string{},
-				RestorePlan:      []history.RestorePlanEntry{},
+				DatabaseName:       "test2",
+				Timestamp:          "timestamp2",
+				Status:             history.BackupStatusSucceed,
+				ExcludeObjectTypes: []string{},
+				ExcludeRelations:   []string{},
+				ExcludeSchemas:     []string{},
+				IncludeObjectTypes: []string{},
+				IncludeRelations:   []string{},
+				IncludeSchemas:     []string{},
+				RestorePlan:        []history.RestorePlanEntry{},
 			},
 			{
-				DatabaseName:     "test1",
-				Timestamp:        "timestamp1",
-				Status:           history.BackupStatusSucceed,
-				ExcludeRelations: []string{},
-				ExcludeSchemas:   []string{},
-				IncludeRelations: []string{},
-				IncludeSchemas:   []string{},
-				RestorePlan:      []history.RestorePlanEntry{},
+				DatabaseName:       "test1",
+				Timestamp:          "timestamp1",
+				Status:             history.BackupStatusSucceed,
+				ExcludeObjectTypes: []string{},
+				ExcludeRelations:   []string{},
+				ExcludeSchemas:     []string{},
+				IncludeObjectTypes: []string{},
+				IncludeRelations:   []string{},
+				IncludeSchemas:     []string{},
+				RestorePlan:        []history.RestorePlanEntry{},
+			},
+			{
+				DatabaseName:       "test1",
+				Timestamp:          "timestamp5",
+				Status:             history.BackupStatusSucceed,
+				ExcludeObjectTypes: []string{"TRIGGER"},
+				ExcludeRelations:   []string{},
+				ExcludeSchemas:     []string{},
+				IncludeObjectTypes: []string{},
+				IncludeRelations:   []string{},
+				IncludeSchemas:     []string{},
+				RestorePlan:        []history.RestorePlanEntry{},
+			},
+			{
+				DatabaseName:       "test1",
+				Timestamp:          "timestamp6",
+				Status:             history.BackupStatusSucceed,
+				RowFiltered:        true,
+				ExcludeObjectTypes: []string{},
+				ExcludeRelations:   []string{},
+				ExcludeSchemas:     []string{},
+				IncludeObjectTypes: []string{},
+				IncludeRelations:   []string{},
+				IncludeSchemas:     []string{},
+				RestorePlan:        []history.RestorePlanEntry{},
+			},
+			{
+				DatabaseName:       "test1",
+				Timestamp:          "timestamp7",
+				Status:             history.BackupStatusSucceed,
+				Masked:             true,
+				ExcludeObjectTypes: []string{},
+				ExcludeRelations:   []string{},
+				ExcludeSchemas:     []string{},
+				IncludeObjectTypes: []string{},
+				IncludeRelations:   []string{},
+				IncludeSchemas:     []string{},
+				RestorePlan:        []history.RestorePlanEntry{},
 			},
 		}
 		BeforeEach(func() {
@@ -149,6 +195,26 @@ var _ = Describe("backup/incremental tests", func() {
 			contents[2].EndTime = latestBackupHistoryEntry.EndTime
 			structmatcher.ExpectStructsToMatch(contents[2], latestBackupHistoryEntry)
 		})
+		It("should not return a backup whose table rows were filtered", func() {
+			currentBackupConfig := history.BackupConfig{DatabaseName: "test1"}
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(historyDBPath, &currentBackupConfig)
+			Expect(latestBackupHistoryEntry.Timestamp).To(Equal("timestamp3"))
+		})
+		It("should not return a backup whose table columns were masked", func() {
+			currentBackupConfig := history.BackupConfig{DatabaseName: "test1"}
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(historyDBPath, &currentBackupConfig)
+			Expect(latestBackupHistoryEntry.Timestamp).To(Equal("timestamp3"))
+		})
+		It("should not return a backup whose object types were filtered differently", func() {
+			currentBackupConfig := history.BackupConfig{DatabaseName: "test1"}
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(historyDBPath, &currentBackupConfig)
+			Expect(latestBackupHistoryEntry.Timestamp).To(Equal("timestamp3"))
+		})
+		It("should return a backup whose object types were filtered the same way", func() {
+			currentBackupConfig := history.BackupConfig{DatabaseName: "test1", ExcludeObjectTypes: []string{"TRIGGER"}}
+			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(historyDBPath, &currentBackupConfig)
+			Expect(latestBackupHistoryEntry.Timestamp).To(Equal("timestamp5"))
+		})
 		It("should return nil with no matching Dbname", func() {
 			currentBackupConfig := history.BackupConfig{DatabaseName: "test3"}
 			latestBackupHistoryEntry := backup.GetLatestMatchingBackupConfig(historyDBPath, &currentBackupConfig)
@@ -0,0 +1,76 @@
+package backup
+
+/*
+ * This file contains functions for writing the metrics of a backup to the
+ * file given with --metrics-file.
+ */
+
+import (
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+)
+
+var (
+	metricsUpdateInterval = 15 * time.Second
+	stopMetricsUpdates    = func() {}
+)
+
+func getBackupStartTime() time.Time {
+	startTime, _ := time.ParseInLocation("20060102150405", globalFPInfo.Timestamp, operating.System.Local)
+	return startTime
+}
+
+func startBackupMetricsUpdates(numTables int) {
+	metricsFilename := MustGetFlagString(options.METRICS_FILE)
+	if metricsFilename == "" {
+		return
+	}
+	startTime := getBackupStartTime()
+	stopMetricsUpdates = report.StartMetricsUpdates(metricsFilename, metricsUpdateInterval, func() report.Metrics {
+		completedTablesLock.Lock()
+		defer completedTablesLock.Unlock()
+		return report.Metrics{
+			Utility:         "gpbackup",
+			DatabaseName:    MustGetFlagString(options.DBNAME),
+			InProgress:      true,
+			StartTime:       startTime,
+			TablesCompleted: int64(len(completedTableRows)),
+			TablesTotal:     int64(numTables),
+		}
+	})
+}
+
+/*
+ * The metrics are written during cleanup, so that a backup that is cancelled
+ * is recorded as having failed as well.
+ */
+func writeBackupMetrics(backupFailed bool) {
+	stopMetricsUpdates()
+	metricsFilename := MustGetFlagString(options.METRICS_FILE)
+	if metricsFilename == "" {
+		return
+	}
+	var metrics report.Metrics
+	if backupReport != nil {
+		metrics = backupReport.NewBackupMetrics(globalFPInfo.Timestamp, operating.System.Now(), getTableReports(), backupFailed)
+	} else {
+		// The backup failed before its config was created
+		metrics = report.Metrics{
+			Utility:      "gpbackup",
+			DatabaseName: MustGetFlagString(options.DBNAME),
+			EndTime:      operating.System.Now(),
+			Errors:       1,
+		}
+		if globalFPInfo.Timestamp != "" {
+			metrics.StartTime = getBackupStartTime()
+		}
+	}
+	err := report.WriteMetricsFile(metricsFilename, metrics)
+	if err != nil {
+		gplog.Warn("%v", err)
+	}
+}
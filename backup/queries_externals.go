@@ -214,3 +214,35 @@ func GetExternalPartitionInfo(connectionPool *dbconn.DBConn) ([]PartitionInfo, m
 
 	return extPartitions, partInfoMap
 }
+
+/*
+ * The data of a table with external partitions is copied out with IGNORE
+ * EXTERNAL PARTITIONS, which cannot be given when the data is copied out with
+ * a query, so the tables with external partitions are found to keep their
+ * rows from being filtered or their columns from being masked.
+ */
+func GetExternalPartitionParents(connectionPool *dbconn.DBConn) map[uint32]bool {
+	query := `
+	SELECT DISTINCT p.parrelid AS oid
+	FROM pg_partition p
+		JOIN pg_partition_rule r ON p.oid = r.paroid
+		JOIN pg_exttable e ON e.reloid = r.parchildrelid
+	WHERE NOT p.paristemplate`
+	if connectionPool.Version.AtLeast("7") {
+		query = `
+	SELECT DISTINCT pg_partition_root(c.oid) AS oid
+	FROM pg_class c
+	WHERE c.relispartition
+		AND c.relkind = 'f'`
+	}
+
+	results := make([]struct{ Oid uint32 }, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+
+	parents := make(map[uint32]bool, len(results))
+	for _, result := range results {
+		parents[result.Oid] = true
+	}
+	return parents
+}
@@ -4,13 +4,19 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/greenplum-db/gp-common-go-libs/structmatcher"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/jackc/pgconn"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("backup internal tests", func() {
@@ -36,6 +42,112 @@ var _ = Describe("backup internal tests", func() {
 			Expect(len(lockQueries)).To(Equal(3))
 		})
 	})
+	Describe("LockTables", func() {
+		tables := []backup.Relation{{Schema: "public", Name: "foo"}, {Schema: "public", Name: "bar"}}
+		AfterEach(func() {
+			_ = cmdFlags.Set(options.LOCK_WAIT_TIMEOUT, "0")
+		})
+		It("locks the tables without a timeout by default", func() {
+			mock.ExpectExec("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE").WillReturnResult(sqlmock.NewResult(0, 0))
+
+			backup.LockTables(connectionPool, tables)
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("locks the tables in a savepoint with the lock wait timeout", func() {
+			_ = cmdFlags.Set(options.LOCK_WAIT_TIMEOUT, "30")
+			mock.ExpectExec("SET (.*) = 30000").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RESET (.*)").WillReturnResult(sqlmock.NewResult(0, 0))
+
+			backup.LockTables(connectionPool, tables)
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		Context("when the tables cannot be locked in time", func() {
+			blockingLock := backup.TableLocks{Relation: "public.foo", Mode: "AccessExclusiveLock", Granted: "true", Application: "etl", User: "loader", Pid: "1234"}
+			var backupReport *report.Report
+			var sleeps []time.Duration
+			BeforeEach(func() {
+				_ = cmdFlags.Set(options.LOCK_WAIT_TIMEOUT, "30")
+				backupReport = &report.Report{}
+				backup.SetReport(backupReport)
+				backup.SetTableLocksQuery(func(tableFQNs []string) []backup.TableLocks {
+					Expect(tableFQNs).To(Equal([]string{"public.foo", "public.bar"}))
+					return []backup.TableLocks{blockingLock}
+				})
+				sleeps = make([]time.Duration, 0)
+				backup.SetLockRetrySleep(func(backoff time.Duration) {
+					sleeps = append(sleeps, backoff)
+				})
+			})
+			AfterEach(func() {
+				backup.SetReport(nil)
+				backup.SetLockRetrySleep(time.Sleep)
+			})
+			expectFailedLockAttempt := func(errorCode string) {
+				mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE").WillReturnError(&pgconn.PgError{Code: errorCode})
+				mock.ExpectExec("ROLLBACK TO SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			It("rolls back to the savepoint and retries after a lock timeout", func() {
+				_ = cmdFlags.Set(options.LOCK_RETRIES, "2")
+				mock.ExpectExec("SET statement_timeout = 30000").WillReturnResult(sqlmock.NewResult(0, 0))
+				expectFailedLockAttempt(backup.PG_LOCK_NOT_AVAILABLE)
+				expectFailedLockAttempt(backup.PG_LOCK_NOT_AVAILABLE)
+				mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("RESET statement_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+
+				backup.LockTables(connectionPool, tables)
+
+				Expect(mock.ExpectationsWereMet()).To(Succeed())
+				Expect(sleeps).To(Equal([]time.Duration{5 * time.Second, 10 * time.Second}))
+				Expect(logfile).To(Say("Unable to acquire ACCESS SHARE locks on tables within 30 seconds; retrying in 5s"))
+				Expect(backupReport.BlockingLocks).To(Equal([]report.BlockingLock{{Relation: "public.foo", Mode: "AccessExclusiveLock",
+					Granted: "true", Application: "etl", User: "loader", Pid: "1234"}}))
+			})
+			It("fails once the retries are exhausted after a statement timeout", func() {
+				_ = cmdFlags.Set(options.LOCK_RETRIES, "1")
+				mock.ExpectExec("SET statement_timeout = 30000").WillReturnResult(sqlmock.NewResult(0, 0))
+				expectFailedLockAttempt(backup.PG_QUERY_CANCELED)
+				expectFailedLockAttempt(backup.PG_QUERY_CANCELED)
+
+				defer func() {
+					Expect(mock.ExpectationsWereMet()).To(Succeed())
+					Expect(sleeps).To(Equal([]time.Duration{5 * time.Second}))
+					Expect(backupReport.BlockingLocks).To(HaveLen(1))
+				}()
+				defer testhelper.ShouldPanicWithMessage("Unable to acquire ACCESS SHARE locks on tables within 30 seconds after 2 attempt(s); the locks blocking the backup are listed in the backup report")
+				backup.LockTables(connectionPool, tables)
+			})
+			It("fails without retrying on any other error", func() {
+				_ = cmdFlags.Set(options.LOCK_RETRIES, "1")
+				mock.ExpectExec("SET statement_timeout = 30000").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("SAVEPOINT gpbackup_lock_tables").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE").WillReturnError(&pgconn.PgError{Code: "42P01", Message: "relation does not exist"})
+
+				defer func() {
+					Expect(sleeps).To(BeEmpty())
+					Expect(backupReport.BlockingLocks).To(BeEmpty())
+				}()
+				defer testhelper.ShouldPanicWithMessage("relation does not exist")
+				backup.LockTables(connectionPool, tables)
+			})
+		})
+	})
+	Describe("GetLockRetryBackoff", func() {
+		It("doubles the wait before each retry up to five minutes", func() {
+			Expect(backup.GetLockRetryBackoff(0)).To(Equal(5 * time.Second))
+			Expect(backup.GetLockRetryBackoff(1)).To(Equal(10 * time.Second))
+			Expect(backup.GetLockRetryBackoff(5)).To(Equal(160 * time.Second))
+			Expect(backup.GetLockRetryBackoff(6)).To(Equal(5 * time.Minute))
+			Expect(backup.GetLockRetryBackoff(100)).To(Equal(5 * time.Minute))
+		})
+	})
 	Describe("GetAllViews", func() {
 		It("GetAllViews properly handles NULL view definitions", func() {
 			columnDefHeader := []string{"attrelid", "attnum", "name", "attnotnull", "atthasdef", "type", "encoding", "attstattarget", "storagetype", "defaultval", "comment", "privileges", "kind", "options", "fdwoptions", "collation", "securitylabelprovider", "securitylabel", "attgenerated", "isinherited"}
@@ -10,12 +10,14 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/jackc/pgconn"
 	"github.com/pkg/errors"
 )
 
@@ -158,6 +160,28 @@ func getUserTableRelationsWithIncludeFiltering(connectionPool *dbconn.DBConn, in
 	return results
 }
 
+// The FQNs are those recorded in a backup's restore plan, with quoted identifiers
+func GetRelationsForFQNs(connectionPool *dbconn.DBConn, tableFQNs []string) []Relation {
+	quotedFQNs := make([]string, len(tableFQNs))
+	for idx, fqn := range tableFQNs {
+		quotedFQNs[idx] = fmt.Sprintf("'%s'", utils.EscapeSingleQuotes(fqn))
+	}
+	query := fmt.Sprintf(`
+	SELECT n.oid AS schemaoid,
+		c.oid AS oid,
+		quote_ident(n.nspname) AS schema,
+		quote_ident(c.relname) AS name
+	FROM pg_class c
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+	WHERE quote_ident(n.nspname) || '.' || quote_ident(c.relname) IN (%s)
+	ORDER BY c.oid`, strings.Join(quotedFQNs, ", "))
+
+	results := make([]Relation, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	return results
+}
+
 func GetForeignTableRelations(connectionPool *dbconn.DBConn) []Relation {
 	query := fmt.Sprintf(`
 	SELECT n.oid AS schemaoid,
@@ -493,28 +517,89 @@ func LockTables(connectionPool *dbconn.DBConn, tables []Relation) {
 	} else {
 		lockMode = `IN ACCESS SHARE MODE`
 	}
+	lockWaitTimeout := MustGetFlagInt(options.LOCK_WAIT_TIMEOUT)
+	timeoutGUC := "lock_timeout"
+	if connectionPool.Version.Before("6") {
+		timeoutGUC = "statement_timeout"
+	}
+	if lockWaitTimeout > 0 {
+		connectionPool.MustExec(fmt.Sprintf("SET %s = %d", timeoutGUC, lockWaitTimeout*1000))
+	}
 	// The LOCK TABLE query could block if someone else is holding an
 	// AccessExclusiveLock on the table.  In the case gpbackup is interrupted,
 	// cancelBlockedQueries() will cancel these queries during cleanup.
 	for i, currentBatch := range tableBatches {
-		_, err := connectionPool.Exec(fmt.Sprintf("LOCK TABLE %s %s", currentBatch, lockMode))
-		if err != nil {
-			if wasTerminated {
-				gplog.Warn("Interrupt received while acquiring ACCESS SHARE locks on tables")
-				select {} // wait for cleanup thread to exit gpbackup
-			} else {
-				gplog.FatalOnError(err)
-			}
-		}
 		if i == len(tableBatches)-1 && lastBatchSize > 0 {
 			currentBatchSize = lastBatchSize
 		}
+		lockTableBatch(connectionPool, currentBatch, lockMode, lockWaitTimeout, tables[i*batchSize:i*batchSize+currentBatchSize])
 		progressBar.Add(currentBatchSize)
 	}
+	if lockWaitTimeout > 0 {
+		connectionPool.MustExec(fmt.Sprintf("RESET %s", timeoutGUC))
+	}
 
 	progressBar.Finish()
 }
 
+/*
+ * With --lock-wait-timeout, a batch of tables that cannot be locked in time is
+ * retried up to --lock-retries times, waiting longer before each retry.  Each
+ * attempt is made in a savepoint, so that the transaction, and the locks
+ * already acquired in it, survive a failed attempt.
+ */
+func lockTableBatch(connectionPool *dbconn.DBConn, batch string, lockMode string, lockWaitTimeout int, batchTables []Relation) {
+	lockRetries := MustGetFlagInt(options.LOCK_RETRIES)
+	for attempt := 0; ; attempt++ {
+		if lockWaitTimeout > 0 {
+			connectionPool.MustExec("SAVEPOINT gpbackup_lock_tables")
+		}
+		_, err := connectionPool.Exec(fmt.Sprintf("LOCK TABLE %s %s", batch, lockMode))
+		if err == nil {
+			if lockWaitTimeout > 0 {
+				connectionPool.MustExec("RELEASE SAVEPOINT gpbackup_lock_tables")
+			}
+			return
+		}
+		if wasTerminated {
+			gplog.Warn("Interrupt received while acquiring ACCESS SHARE locks on tables")
+			select {} // wait for cleanup thread to exit gpbackup
+		}
+		if lockWaitTimeout == 0 || !isLockTimeout(err) {
+			gplog.FatalOnError(err)
+		}
+		connectionPool.MustExec("ROLLBACK TO SAVEPOINT gpbackup_lock_tables")
+		tableFQNs := make([]string, 0, len(batchTables))
+		for _, table := range batchTables {
+			tableFQNs = append(tableFQNs, table.FQN())
+		}
+		reportBlockingLocks(tableFQNs)
+		if attempt >= lockRetries {
+			gplog.Fatal(errors.Errorf("Unable to acquire ACCESS SHARE locks on tables within %d seconds after %d attempt(s); the locks blocking the backup are listed in the backup report", lockWaitTimeout, attempt+1), "")
+		}
+		backoff := GetLockRetryBackoff(attempt)
+		gplog.Warn("Unable to acquire ACCESS SHARE locks on tables within %d seconds; retrying in %s", lockWaitTimeout, backoff)
+		lockRetrySleep(backoff)
+	}
+}
+
+func isLockTimeout(err error) bool {
+	pgErr, ok := err.(*pgconn.PgError)
+	return ok && (pgErr.Code == PG_LOCK_NOT_AVAILABLE || pgErr.Code == PG_QUERY_CANCELED)
+}
+
+// The wait before each retry doubles from 5 seconds, up to 5 minutes
+func GetLockRetryBackoff(attempt int) time.Duration {
+	backoff := 5 * time.Second
+	for i := 0; i < attempt && backoff < 5*time.Minute; i++ {
+		backoff *= 2
+	}
+	if backoff > 5*time.Minute {
+		backoff = 5 * time.Minute
+	}
+	return backoff
+}
+
 // GenerateTableBatches batches tables to reduce network congestion and
 // resource contention.  Returns an array of batches where a batch of tables is
 // a single string with comma separated tables
@@ -540,3 +625,48 @@ func GenerateTableBatches(tables []Relation, batchSize int) []string {
 
 	return batches
 }
+
+/*
+ * The data of a partitioned table in GPDB 6 and earlier is backed up along
+ * with that of its leaf partitions unless --leaf-partition-data is given, so
+ * their sizes are included in its own.  The leaf partitions are the rules at
+ * any level that are not the parent of another rule, since pg_partition has a
+ * row for each level of the hierarchy of the partitioned table.
+ */
+func GetTableDataSizes(connectionPool *dbconn.DBConn, tables []Table) map[uint32]int64 {
+	sizes := make(map[uint32]int64, len(tables))
+	if len(tables) == 0 {
+		return sizes
+	}
+	oids := make([]string, 0, len(tables))
+	for _, table := range tables {
+		oids = append(oids, fmt.Sprintf("%d", table.Oid))
+	}
+	partitionSize := ""
+	if connectionPool.Version.Before("7") {
+		partitionSize = `
+		+ coalesce((SELECT sum(pg_relation_size(r.parchildrelid))
+			FROM pg_partition p
+				JOIN pg_partition_rule r ON p.oid = r.paroid
+			WHERE p.parrelid = c.oid
+				AND NOT p.paristemplate
+				AND NOT EXISTS (SELECT 1 FROM pg_partition_rule sub WHERE sub.parparentrule = r.oid)), 0)`
+	}
+	query := fmt.Sprintf(`
+	SELECT c.oid,
+		pg_relation_size(c.oid)%s AS size
+	FROM pg_class c
+	WHERE c.oid IN (%s)`, partitionSize, strings.Join(oids, ", "))
+
+	results := make([]struct {
+		Oid  uint32
+		Size int64
+	}, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+
+	for _, result := range results {
+		sizes[result.Oid] = result.Size
+	}
+	return sizes
+}
@@ -272,6 +272,11 @@ func RenameExchangedPartitionConstraints(connectionPool *dbconn.DBConn, constrai
 	}
 }
 
+// The system schemas, which are never backed up, formatted for use in a WHERE clause
+func systemSchemaFilterClause(namespace string) string {
+	return fmt.Sprintf(`%s.nspname NOT LIKE 'pg_temp_%%' AND %s.nspname NOT LIKE 'pg_toast%%' AND %s.nspname NOT IN ('gp_toolkit', 'information_schema', 'pg_aoseg', 'pg_bitmapindex', 'pg_catalog')`, namespace, namespace, namespace)
+}
+
 // A list of schemas we don't want to back up, formatted for use in a WHERE clause
 func SchemaFilterClause(namespace string) string {
 	schemaFilterClauseStr := ""
@@ -281,7 +286,7 @@ func SchemaFilterClause(namespace string) string {
 	if len(MustGetFlagStringArray(options.EXCLUDE_SCHEMA)) > 0 {
 		schemaFilterClauseStr = fmt.Sprintf("\nAND %s.nspname NOT IN (%s)", namespace, utils.SliceToQuotedString(MustGetFlagStringArray(options.EXCLUDE_SCHEMA)))
 	}
-	return fmt.Sprintf(`%s.nspname NOT LIKE 'pg_temp_%%' AND %s.nspname NOT LIKE 'pg_toast%%' AND %s.nspname NOT IN ('gp_toolkit', 'information_schema', 'pg_aoseg', 'pg_bitmapindex', 'pg_catalog') %s`, namespace, namespace, namespace, schemaFilterClauseStr)
+	return fmt.Sprintf("%s %s", systemSchemaFilterClause(namespace), schemaFilterClauseStr)
 }
 
 /*
@@ -320,7 +325,7 @@ func SchemaFilterClauseWithAlteredPartitionSchemas(namespace string, partitionAl
 			schemaFilterClauseStr = fmt.Sprintf("\nAND %s.nspname NOT IN (%s)", namespace, utils.SliceToQuotedString(excludeSchemaArray))
 		}
 	}
-	return fmt.Sprintf(`%s.nspname NOT LIKE 'pg_temp_%%' AND %s.nspname NOT LIKE 'pg_toast%%' AND %s.nspname NOT IN ('gp_toolkit', 'information_schema', 'pg_aoseg', 'pg_bitmapindex', 'pg_catalog') %s`, namespace, namespace, namespace, schemaFilterClauseStr)
+	return fmt.Sprintf("%s %s", systemSchemaFilterClause(namespace), schemaFilterClauseStr)
 }
 
 func ExtensionFilterClause(namespace string) string {
@@ -730,6 +730,48 @@ func GetTableInheritance(connectionPool *dbconn.DBConn, tables []Relation) map[u
 	return resultMap
 }
 
+/*
+ * Returns the quoted names of the columns by which each partitioned table, and
+ * each of its partitions, is partitioned at any level, as the rows of a
+ * partition must still belong to it once restored.  The columns of expression
+ * partition keys cannot be found this way and are not returned.
+ */
+func GetPartitionKeyColumns(connectionPool *dbconn.DBConn) map[uint32][]string {
+	query := `
+	SELECT DISTINCT rel.oid, quote_ident(a.attname) AS keycolumn
+	FROM (SELECT parrelid AS oid, parrelid AS rootoid FROM pg_partition
+		UNION
+		SELECT r.parchildrelid AS oid, p.parrelid AS rootoid
+		FROM pg_partition_rule r
+			JOIN pg_partition p ON p.oid = r.paroid) rel
+		JOIN pg_partition kp ON kp.parrelid = rel.rootoid AND NOT kp.paristemplate
+		JOIN pg_attribute a ON a.attrelid = rel.rootoid AND a.attnum = ANY(kp.paratts::int2[])
+	ORDER BY rel.oid, keycolumn`
+	if connectionPool.Version.AtLeast("7") {
+		query = `
+	SELECT DISTINCT c.oid, quote_ident(a.attname) AS keycolumn
+	FROM pg_class c
+		CROSS JOIN LATERAL pg_partition_ancestors(c.oid) AS anc(relid)
+		JOIN pg_partitioned_table p ON p.partrelid = anc.relid
+		JOIN pg_attribute a ON a.attrelid = p.partrelid AND a.attnum = ANY(p.partattrs::int2[])
+	WHERE c.relispartition OR c.relkind = 'p'
+	ORDER BY c.oid, keycolumn`
+	}
+
+	results := make([]struct {
+		Oid       uint32
+		KeyColumn string
+	}, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+
+	keyColumns := make(map[uint32][]string)
+	for _, result := range results {
+		keyColumns[result.Oid] = append(keyColumns[result.Oid], result.KeyColumn)
+	}
+	return keyColumns
+}
+
 // Used to contruct root tables for GPDB 7+, because the root partition must be
 // constructed by itself first.
 func GetPartitionKeyDefs(connectionPool *dbconn.DBConn) map[uint32]string {
@@ -0,0 +1,412 @@
+package backup
+
+/*
+ * This file contains functions related to resuming a multi-file backup that
+ * failed or was cancelled while its data was being backed up.
+ */
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	/*
+	 * The tables whose data is being backed up, and the number of rows copied
+	 * for each table whose data has been backed up so far, from which we write
+	 * an incomplete TOC if the backup fails before it completes.
+	 */
+	pendingDataTables   []Table
+	completedTableRows  map[uint32]int64
+	completedTablesLock sync.Mutex
+)
+
+// A resumed backup is taken with the options of the original backup, read from its config
+var resumeFlags = map[string]bool{
+	options.RESUME:              true,
+	options.DBNAME:              true,
+	options.BACKUP_DIR:          true,
+	options.JOBS:                true,
+	options.COMPRESSION_LEVEL:   true,
+	options.NO_HISTORY:          true,
+	options.METRICS_FILE:        true,
+	options.DEBUG:               true,
+	options.QUIET:               true,
+	options.VERBOSE:             true,
+	options.ENCRYPTION_KEY_FILE: true,
+	options.ENCRYPTION_KEY_ENV:  true,
+	options.ENCRYPTION_KEY_CMD:  true,
+}
+
+func validateResumeFlags(flags *pflag.FlagSet) {
+	flags.Visit(func(flag *pflag.Flag) {
+		if !resumeFlags[flag.Name] {
+			gplog.Fatal(errors.Errorf("--%s cannot be used with --resume, as a backup is resumed with the options it was taken with", flag.Name), "")
+		}
+	})
+}
+
+func isResumedBackup() bool {
+	return MustGetFlagString(options.RESUME) != ""
+}
+
+func startDataBackup(tables []Table) {
+	completedTablesLock.Lock()
+	defer completedTablesLock.Unlock()
+	pendingDataTables = tables
+	completedTableRows = make(map[uint32]int64, len(tables))
+}
+
+func recordCompletedTable(oid uint32, rowsCopied int64) {
+	completedTablesLock.Lock()
+	defer completedTablesLock.Unlock()
+	if completedTableRows != nil {
+		completedTableRows[oid] = rowsCopied
+	}
+}
+
+/*
+ * A multi-file backup writes the data of each table to its own files, so if
+ * it fails once it has started to back up data, we write a TOC with the data
+ * entries of the tables whose data was backed up and mark it incomplete.  The
+ * backup can then be resumed with --resume, and gprestore refuses to restore
+ * it until it is.
+ */
+func writeIncompleteTOC() {
+	if globalTOC == nil || backupReport == nil || MustGetFlagBool(options.SINGLE_DATA_FILE) || MustGetFlagString(options.PLUGIN_CONFIG) != "" {
+		return
+	}
+	completedTablesLock.Lock()
+	defer completedTablesLock.Unlock()
+	if completedTableRows == nil {
+		// The backup failed before it started to back up data
+		return
+	}
+
+	tocFilename := globalFPInfo.GetTOCFilePath()
+	if utils.FileExists(tocFilename) {
+		if !isResumedBackup() {
+			// The backup failed after its TOC was written
+			return
+		}
+		// The TOC of the backup being resumed is read-only, so we replace it
+		err := utils.RemoveFileIfExists(tocFilename)
+		if err != nil {
+			gplog.Error(fmt.Sprintf("Unable to replace table of contents %s: %v", tocFilename, err))
+			return
+		}
+	}
+
+	incompleteTOC := *globalTOC
+	incompleteTOC.DataEntries = append([]toc.CoordinatorDataEntry{}, globalTOC.DataEntries...)
+	incompleteTOC.Incomplete = true
+	// The data entries of all tables are added once the data of every table has been backed up
+	hasDataEntry := make(map[uint32]bool, len(incompleteTOC.DataEntries))
+	for _, entry := range incompleteTOC.DataEntries {
+		hasDataEntry[entry.Oid] = true
+	}
+	completedTables := make([]Table, 0, len(completedTableRows))
+	for _, table := range pendingDataTables {
+		if _, ok := completedTableRows[table.Oid]; ok && !hasDataEntry[table.Oid] {
+			completedTables = append(completedTables, table)
+		}
+	}
+	addTableDataEntries(&incompleteTOC, completedTables, []map[uint32]int64{completedTableRows})
+	gplog.Info("Writing incomplete table of contents with data for %d tables; run gpbackup --resume %s to complete the backup",
+		len(incompleteTOC.DataEntries), globalFPInfo.Timestamp)
+	contents, err := yaml.Marshal(&incompleteTOC)
+	if err == nil {
+		err = utils.WriteBackupFileAndMakeReadOnly(tocFilename, contents)
+	}
+	if err != nil {
+		gplog.Error(fmt.Sprintf("Unable to write incomplete table of contents %s: %v", tocFilename, err))
+		return
+	}
+
+	// A cancelled backup does not otherwise write its config, which is needed to resume it
+	configFilename := globalFPInfo.GetConfigFilePath()
+	if !utils.FileExists(configFilename) {
+		backupReport.BackupConfig.Status = history.BackupStatusFailed
+		history.WriteConfigFile(&backupReport.BackupConfig, configFilename)
+	}
+}
+
+/*
+ * To resume a backup we read its config and incomplete TOC from the backup
+ * directory, which is found in the same way as by gprestore.
+ */
+func setupResume(timestamp string) {
+	gplog.Info("Resuming backup of database %s with timestamp %s", MustGetFlagString(options.DBNAME), timestamp)
+
+	clusterConfigConn := dbconn.NewDBConnFromEnvironment(MustGetFlagString(options.DBNAME))
+	clusterConfigConn.MustConnect(1)
+	segConfig := cluster.MustGetSegmentConfiguration(clusterConfigConn)
+	clusterConfigConn.Close()
+	globalCluster = cluster.NewCluster(segConfig)
+
+	segPrefix, singleBackupDir, err := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), timestamp)
+	gplog.FatalOnError(err)
+	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), timestamp, segPrefix, singleBackupDir)
+
+	configFilename := globalFPInfo.GetConfigFilePath()
+	if !utils.FileExists(configFilename) {
+		gplog.Fatal(errors.Errorf("Cannot resume backup %s, as its config file %s does not exist", timestamp, configFilename), "")
+	}
+	initializeResumeEncryptionKey(configFilename)
+	config := history.ReadConfigFile(configFilename)
+	escapedDBName := dbconn.MustSelectString(connectionPool, fmt.Sprintf("select quote_ident(datname) AS string FROM pg_database where datname='%s'", utils.EscapeSingleQuotes(connectionPool.DBName)))
+	validateResumableBackup(config, escapedDBName)
+
+	tocFilename := globalFPInfo.GetTOCFilePath()
+	if !utils.FileExists(tocFilename) {
+		gplog.Fatal(errors.Errorf("Cannot resume backup %s, as it failed before any data was backed up", timestamp), "")
+	}
+	globalTOC = toc.NewTOC(tocFilename)
+	globalTOC.InitializeMetadataEntryMap()
+	if !globalTOC.Incomplete {
+		gplog.Fatal(errors.Errorf("Cannot resume backup %s, as its table of contents is complete", timestamp), "")
+	}
+
+	err = utils.ValidateCompressionTypeAndLevel(config.CompressionType, MustGetFlagInt(options.COMPRESSION_LEVEL))
+	if config.Compressed {
+		gplog.FatalOnError(err)
+	}
+	utils.InitializePipeThroughParameters(config.Compressed, config.CompressionType, MustGetFlagInt(options.COMPRESSION_LEVEL))
+	_ = cmdFlags.Set(options.LEAF_PARTITION_DATA, fmt.Sprintf("%t", config.LeafPartitionData))
+	_ = cmdFlags.Set(options.NO_COMPRESSION, fmt.Sprintf("%t", !config.Compressed))
+	_ = cmdFlags.Set(options.COMPRESSION_TYPE, config.CompressionType)
+	rowFilters = config.RowFilters
+	maskingRules = config.MaskingRules
+	getQuotedRoleNames(connectionPool)
+
+	config.Status = history.BackupStatusInProgress
+	backupReport = &report.Report{BackupConfig: *config}
+	backupReport.ConstructBackupParamsString()
+	if !MustGetFlagBool(options.NO_HISTORY) {
+		updateHistoryStatus(history.BackupStatusInProgress)
+	}
+}
+
+func validateResumableBackup(config *history.BackupConfig, dbName string) {
+	timestamp := globalFPInfo.Timestamp
+	if config.DatabaseName != dbName {
+		gplog.Fatal(errors.Errorf("Cannot resume backup %s of database %s in database %s", timestamp, config.DatabaseName, dbName), "")
+	}
+	if !config.Failed() {
+		gplog.Fatal(errors.Errorf("Cannot resume backup %s, as it did not fail", timestamp), "")
+	}
+	if config.SingleDataFile {
+		gplog.Fatal(errors.Errorf("Cannot resume backup %s, as single-data-file backups cannot be resumed", timestamp), "")
+	}
+	if config.Plugin != "" {
+		gplog.Fatal(errors.Errorf("Cannot resume backup %s, as backups taken with a plugin cannot be resumed", timestamp), "")
+	}
+	if config.MetadataOnly {
+		gplog.Fatal(errors.Errorf("Cannot resume backup %s, as it is a metadata-only backup", timestamp), "")
+	}
+	if config.WithStatistics {
+		gplog.Fatal(errors.Errorf("Cannot resume backup %s, as backups taken with --with-stats cannot be resumed", timestamp), "")
+	}
+	if config.SegmentCount != len(globalCluster.ContentIDs)-1 {
+		gplog.Fatal(errors.Errorf("Cannot resume backup %s of a cluster with %d segments in a cluster with %d segments",
+			timestamp, config.SegmentCount, len(globalCluster.ContentIDs)-1), "")
+	}
+}
+
+/*
+ * The config of an encrypted backup is encrypted, so as with gprestore we read
+ * the ID of its key from the file before reading the key, which must be the
+ * same key so that the whole backup can be restored with it.
+ */
+func initializeResumeEncryptionKey(configFilename string) {
+	keyID, err := utils.GetFileEncryptionKeyID(configFilename)
+	gplog.FatalOnError(err)
+	keyFile := MustGetFlagString(options.ENCRYPTION_KEY_FILE)
+	keyEnvVar := MustGetFlagString(options.ENCRYPTION_KEY_ENV)
+	keyCommand := MustGetFlagString(options.ENCRYPTION_KEY_CMD)
+	keyProvided := keyFile != "" || keyEnvVar != "" || keyCommand != ""
+	if keyID == "" {
+		if keyProvided {
+			gplog.Fatal(errors.Errorf("Cannot encrypt the rest of backup %s, as the backup is not encrypted", globalFPInfo.Timestamp), "")
+		}
+		return
+	}
+	if !keyProvided {
+		gplog.Fatal(errors.Errorf("Backup %s is encrypted with key %s. Please provide the key with --%s, --%s, or --%s.",
+			globalFPInfo.Timestamp, keyID, options.ENCRYPTION_KEY_FILE, options.ENCRYPTION_KEY_ENV, options.ENCRYPTION_KEY_CMD), "")
+	}
+	encryptionKey, err := utils.ReadEncryptionKey(keyFile, keyEnvVar, keyCommand, keyID)
+	gplog.FatalOnError(err)
+	gplog.Info("Backup files will be encrypted with key %s", encryptionKey.ID)
+	utils.SetEncryptionKey(encryptionKey)
+}
+
+func updateHistoryStatus(status string) {
+	historyDB, err := history.InitializeHistoryDatabase(globalFPInfo.GetBackupHistoryDatabasePath())
+	if err != nil {
+		gplog.Error(fmt.Sprintf("Unable to update history database.  Error: %v", err))
+		return
+	}
+	defer historyDB.Close()
+	_, err = historyDB.Exec(fmt.Sprintf("UPDATE backups SET status='%s' WHERE timestamp='%s'", status, globalFPInfo.Timestamp))
+	if err != nil {
+		gplog.Error(fmt.Sprintf("Unable to update history database.  Error: %v", err))
+	}
+}
+
+/*
+ * The data of the remaining tables is backed up in a new transaction, so it
+ * is consistent with itself but not with the data backed up before the backup
+ * failed, nor with the metadata, which is not backed up again.
+ */
+func resumeBackup() {
+	remainingFQNs := GetRemainingTableFQNs(backupReport.RestorePlan, globalTOC, globalFPInfo.Timestamp)
+	backedUp := verifyBackedUpTableFiles()
+	dataEntries := make([]toc.CoordinatorDataEntry, 0, len(globalTOC.DataEntries))
+	for _, entry := range globalTOC.DataEntries {
+		if backedUp[entry.Oid] {
+			dataEntries = append(dataEntries, entry)
+		} else {
+			remainingFQNs = append(remainingFQNs, utils.MakeFQN(entry.Schema, entry.Name))
+		}
+	}
+	globalTOC.DataEntries = dataEntries
+	gplog.Info("Data for %d tables was backed up before the backup failed", len(dataEntries))
+
+	tables := retrieveRemainingTables(remainingFQNs)
+	if len(tables) > 0 {
+		gplog.Warn("The data of the remaining %d tables will be backed up as of now, not as of when the backup started", len(tables))
+	}
+	backupData(tables)
+
+	metadataFilename := globalFPInfo.GetMetadataFilePath()
+	keyID, err := utils.GetFileEncryptionKeyID(metadataFilename)
+	gplog.FatalOnError(err)
+	if utils.GetEncryptionKey() != nil && keyID == "" {
+		// The backup failed before its metadata file was encrypted
+		err = utils.EncryptBackupFile(metadataFilename)
+		gplog.FatalOnError(err)
+	}
+
+	if wasTerminated {
+		return
+	}
+	globalTOC.Incomplete = false
+	tocFilename := globalFPInfo.GetTOCFilePath()
+	err = utils.RemoveFileIfExists(tocFilename)
+	gplog.FatalOnError(err)
+	globalTOC.WriteToFileAndMakeReadOnly(tocFilename)
+	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
+		if connectionPool.Tx[connNum] != nil {
+			connectionPool.MustCommit(connNum)
+		}
+	}
+}
+
+/*
+ * The tables whose data is in the backup are those in the restore plan entry
+ * of the backup itself; those without a data entry in the TOC remain.
+ */
+func GetRemainingTableFQNs(restorePlan []history.RestorePlanEntry, tocfile *toc.TOC, timestamp string) []string {
+	backedUpFQNs := make(map[string]bool, len(tocfile.DataEntries))
+	for _, entry := range tocfile.DataEntries {
+		backedUpFQNs[utils.MakeFQN(entry.Schema, entry.Name)] = true
+	}
+	remainingFQNs := make([]string, 0)
+	for _, restorePlanEntry := range restorePlan {
+		if restorePlanEntry.Timestamp != timestamp {
+			continue
+		}
+		for _, fqn := range restorePlanEntry.TableFQNs {
+			if !backedUpFQNs[fqn] {
+				remainingFQNs = append(remainingFQNs, fqn)
+			}
+		}
+	}
+	return remainingFQNs
+}
+
+/*
+ * A table's data is only recorded in the TOC once its COPY has completed on
+ * every segment, but we check that its data files are still there before
+ * relying on them.  The checksum files of tables that will be backed up again
+ * are removed, as the checksum agent cannot replace read-only files.
+ */
+func verifyBackedUpTableFiles() map[uint32]bool {
+	gplog.Info("Checking data files of backed up tables on segments")
+	segmentFiles := utils.ListBackupFilesOnSegments(globalCluster, globalFPInfo)
+	extension := globalTOC.DataFileExtension
+	backedUp := make(map[uint32]bool, len(globalTOC.DataEntries))
+	for _, entry := range globalTOC.DataEntries {
+		backedUp[entry.Oid] = true
+		for contentID, files := range segmentFiles {
+			dataFile := path.Base(globalFPInfo.GetTableBackupFilePath(contentID, entry.Oid, extension, false))
+			if !files[dataFile] {
+				gplog.Verbose("Data file %s of table %s is missing on segment %d; backing up its data again", dataFile, utils.MakeFQN(entry.Schema, entry.Name), contentID)
+				backedUp[entry.Oid] = false
+				break
+			}
+		}
+	}
+
+	// The checksum and size files of tables to be backed up again are read-only, so they are removed first
+	staleFiles := make(map[int][]string, len(segmentFiles))
+	for contentID, files := range segmentFiles {
+		prefix := fmt.Sprintf("gpbackup_%d_%s_", contentID, globalFPInfo.Timestamp)
+		for file := range files {
+			if !strings.HasPrefix(file, prefix) {
+				continue
+			}
+			for _, suffix := range []string{"_checksum", "_size"} {
+				if !strings.HasSuffix(file, suffix) {
+					continue
+				}
+				var oid uint32
+				_, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(file, prefix), suffix), "%d", &oid)
+				if err == nil && !backedUp[oid] {
+					staleFiles[contentID] = append(staleFiles[contentID], file)
+				}
+			}
+		}
+	}
+	utils.RemoveBackupFilesOnSegments(globalCluster, globalFPInfo, staleFiles)
+	return backedUp
+}
+
+func retrieveRemainingTables(tableFQNs []string) []Table {
+	if len(tableFQNs) == 0 {
+		return []Table{}
+	}
+	relations := GetRelationsForFQNs(connectionPool, tableFQNs)
+	if len(relations) < len(tableFQNs) {
+		found := make(map[string]bool, len(relations))
+		for _, relation := range relations {
+			found[relation.FQN()] = true
+		}
+		for _, fqn := range tableFQNs {
+			if !found[fqn] {
+				gplog.Warn("Table %s no longer exists; its data will not be in the backup", fqn)
+			}
+		}
+	}
+	if len(relations) == 0 {
+		return []Table{}
+	}
+	LockTables(connectionPool, relations)
+	return ConstructDefinitionsForTables(connectionPool, relations)
+}
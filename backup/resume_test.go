@@ -0,0 +1,40 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/resume tests", func() {
+	Describe("GetRemainingTableFQNs", func() {
+		restorePlan := []history.RestorePlanEntry{
+			{Timestamp: "ts0", TableFQNs: []string{"public.ao1", "public.ao2"}},
+			{Timestamp: "ts1", TableFQNs: []string{"public.heap1", "public.ao3", "public.heap2"}},
+		}
+		It("returns the tables of the backup without a data entry in the TOC", func() {
+			tocfile := &toc.TOC{DataEntries: []toc.CoordinatorDataEntry{{Schema: "public", Name: "heap1", Oid: 1}}}
+
+			remaining := backup.GetRemainingTableFQNs(restorePlan, tocfile, "ts1")
+
+			Expect(remaining).To(Equal([]string{"public.ao3", "public.heap2"}))
+		})
+		It("does not return the tables of earlier backups in an incremental backup set", func() {
+			tocfile := &toc.TOC{DataEntries: []toc.CoordinatorDataEntry{}}
+
+			remaining := backup.GetRemainingTableFQNs(restorePlan, tocfile, "ts1")
+
+			Expect(remaining).To(Equal([]string{"public.heap1", "public.ao3", "public.heap2"}))
+		})
+		It("returns no tables if the data of every table was backed up", func() {
+			tocfile := &toc.TOC{DataEntries: []toc.CoordinatorDataEntry{{Schema: "public", Name: "ao1"}, {Schema: "public", Name: "ao2"}}}
+
+			remaining := backup.GetRemainingTableFQNs(restorePlan, tocfile, "ts0")
+
+			Expect(remaining).To(BeEmpty())
+		})
+	})
+})
@@ -8,6 +8,7 @@ import (
 	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
@@ -27,12 +28,63 @@ func ValidateAndProcessFilterLists(opts *options.Options) {
 	IncludedRelationFqns = make([]options.Relation, 0)
 	ExcludedRelationFqns = make([]options.Relation, 0)
 
+	ExpandFilterPatterns(connectionPool, opts)
 	ValidateTablesExist(connectionPool, opts.GetIncludedTables(), false)
 	ValidateTablesExist(connectionPool, opts.GetExcludedTables(), true)
 	ValidateSchemasExist(connectionPool, opts.GetIncludedSchemas(), false)
 	ValidateSchemasExist(connectionPool, opts.GetExcludedSchemas(), true)
 }
 
+/*
+ * Replaces the glob and regex patterns in the filter lists with the names of
+ * the schemas and tables in the database that they match.  Intermediate
+ * partition tables, and leaf partition tables without --leaf-partition-data,
+ * cannot be filtered on, so patterns do not match them.
+ */
+func ExpandFilterPatterns(conn *dbconn.DBConn, opts *options.Options) {
+	if opts.HasSchemaPatterns() {
+		query := fmt.Sprintf("SELECT nspname AS string FROM pg_namespace n WHERE %s", systemSchemaFilterClause("n"))
+		schemaNames := make(map[string]string)
+		for _, schema := range dbconn.MustSelectStringSlice(conn, query) {
+			schemaNames[schema] = schema
+		}
+		err := opts.ExpandSchemaPatterns(cmdFlags, schemaNames)
+		gplog.FatalOnError(err)
+	}
+
+	if opts.HasRelationPatterns() {
+		query := fmt.Sprintf(`
+	SELECT
+		c.oid,
+		n.nspname || '.' || c.relname AS name,
+		quote_ident(n.nspname) || '.' || quote_ident(c.relname) AS quotedname
+	FROM pg_namespace n
+	JOIN pg_class c ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p', 'f', 'v', 'm', 'S')
+	AND %s
+	AND %s`, SchemaFilterClause("n"), ExtensionFilterClause("c"))
+		results := make([]struct {
+			Oid        uint32
+			Name       string
+			QuotedName string
+		}, 0)
+		err := conn.Select(&results, query)
+		gplog.FatalOnError(err, fmt.Sprintf("Query was: %s", query))
+
+		partTableMap := GetPartitionTableMap(conn)
+		relationNames := make(map[string]string)
+		for _, relation := range results {
+			level := partTableMap[relation.Oid].Level
+			if level == "i" || (level == "l" && !MustGetFlagBool(options.LEAF_PARTITION_DATA)) {
+				continue
+			}
+			relationNames[relation.Name] = relation.QuotedName
+		}
+		err = opts.ExpandRelationPatterns(cmdFlags, relationNames)
+		gplog.FatalOnError(err)
+	}
+}
+
 func ValidateSchemasExist(connectionPool *dbconn.DBConn, schemaList []string, excludeSet bool) {
 	if len(schemaList) == 0 {
 		return
@@ -137,6 +189,9 @@ func ValidateTablesExist(conn *dbconn.DBConn, tableList []string, excludeSet boo
 }
 
 func validateFlagCombinations(flags *pflag.FlagSet) {
+	if FlagChanged(options.RESUME) {
+		validateResumeFlags(flags)
+	}
 	options.CheckExclusiveFlags(flags, options.DEBUG, options.QUIET, options.VERBOSE)
 	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.METADATA_ONLY, options.INCREMENTAL)
 	options.CheckExclusiveFlags(flags, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE)
@@ -147,9 +202,22 @@ func validateFlagCombinations(flags *pflag.FlagSet) {
 	options.CheckExclusiveFlags(flags, options.NO_COMPRESSION, options.COMPRESSION_TYPE)
 	options.CheckExclusiveFlags(flags, options.NO_COMPRESSION, options.COMPRESSION_LEVEL)
 	options.CheckExclusiveFlags(flags, options.PLUGIN_CONFIG, options.BACKUP_DIR)
+	options.CheckExclusiveFlags(flags, options.ENCRYPTION_KEY_FILE, options.ENCRYPTION_KEY_ENV, options.ENCRYPTION_KEY_CMD, options.PLUGIN_CONFIG)
+	options.CheckExclusiveFlags(flags, options.NO_COMPRESSION, options.COMPRESSION_THREADS)
+	options.CheckExclusiveFlags(flags, options.NO_COMPRESSION, options.COMPRESSION_WINDOW)
+	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.INCLUDE_OBJECT_TYPE, options.EXCLUDE_OBJECT_TYPE)
+	options.CheckExclusiveFlags(flags, options.ROW_FILTER_FILE, options.METADATA_ONLY, options.INCREMENTAL)
+	options.CheckExclusiveFlags(flags, options.MASKING_RULES_FILE, options.METADATA_ONLY, options.INCREMENTAL)
+	options.CheckExclusiveFlags(flags, options.MASKING_RULES_FILE, options.WITH_STATS)
 	if FlagChanged(options.COPY_QUEUE_SIZE) && !MustGetFlagBool(options.SINGLE_DATA_FILE) {
 		gplog.Fatal(errors.Errorf("--copy-queue-size must be specified with --single-data-file"), "")
 	}
+	if FlagChanged(options.COMPRESSION_THREADS) && !MustGetFlagBool(options.SINGLE_DATA_FILE) {
+		gplog.Fatal(errors.Errorf("--compression-threads must be specified with --single-data-file"), "")
+	}
+	if FlagChanged(options.COMPRESSION_WINDOW) && !MustGetFlagBool(options.SINGLE_DATA_FILE) {
+		gplog.Fatal(errors.Errorf("--compression-window must be specified with --single-data-file"), "")
+	}
 	if MustGetFlagString(options.FROM_TIMESTAMP) != "" && !MustGetFlagBool(options.INCREMENTAL) {
 		gplog.Fatal(errors.Errorf("--from-timestamp must be specified with --incremental"), "")
 	}
@@ -162,6 +230,18 @@ func validateFlagCombinations(flags *pflag.FlagSet) {
 	if FlagChanged(options.SINGLE_BACKUP_DIR) && !FlagChanged(options.BACKUP_DIR) {
 		gplog.Fatal(errors.Errorf("--single-backup-dir must be specified with --backup-dir"), "")
 	}
+	if FlagChanged(options.LOCK_RETRIES) && !FlagChanged(options.LOCK_WAIT_TIMEOUT) {
+		gplog.Fatal(errors.Errorf("--lock-retries must be specified with --lock-wait-timeout"), "")
+	}
+	if FlagChanged(options.PIN_TABLE) {
+		if !FlagChanged(options.JOBS) {
+			gplog.Fatal(errors.Errorf("--pin-table must be specified with --jobs"), "")
+		}
+		// At least one connection must be left to back up the tables that are not pinned
+		if jobs := MustGetFlagInt(options.JOBS); len(MustGetFlagStringArray(options.PIN_TABLE)) >= jobs {
+			gplog.Fatal(errors.Errorf("--pin-table may be specified at most %d time(s) with --jobs %d", jobs-1, jobs), "")
+		}
+	}
 }
 
 func validateFlagValues() {
@@ -169,8 +249,24 @@ func validateFlagValues() {
 	gplog.FatalOnError(err)
 	err = utils.ValidateFullPath(MustGetFlagString(options.PLUGIN_CONFIG))
 	gplog.FatalOnError(err)
+	err = toc.ValidateObjectTypes(append(MustGetFlagStringArray(options.INCLUDE_OBJECT_TYPE), MustGetFlagStringArray(options.EXCLUDE_OBJECT_TYPE)...))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFQNs(MustGetFlagStringArray(options.PIN_TABLE))
+	gplog.FatalOnError(err)
+	if MustGetFlagInt(options.LOCK_WAIT_TIMEOUT) < 0 || MustGetFlagInt(options.LOCK_RETRIES) < 0 {
+		gplog.Fatal(errors.Errorf("--lock-wait-timeout and --lock-retries cannot be negative"), "")
+	}
+	if resumeTimestamp := MustGetFlagString(options.RESUME); resumeTimestamp != "" {
+		if !filepath.IsValidTimestamp(resumeTimestamp) {
+			gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", resumeTimestamp), "")
+		}
+		// The compression level is validated against the compression type of the backup being resumed
+		return
+	}
 	err = utils.ValidateCompressionTypeAndLevel(MustGetFlagString(options.COMPRESSION_TYPE), MustGetFlagInt(options.COMPRESSION_LEVEL))
 	gplog.FatalOnError(err)
+	err = utils.ValidateCompressionThreadsAndWindow(MustGetFlagString(options.COMPRESSION_TYPE), MustGetFlagInt(options.COMPRESSION_THREADS), MustGetFlagInt(options.COMPRESSION_WINDOW))
+	gplog.FatalOnError(err)
 	if MustGetFlagString(options.FROM_TIMESTAMP) != "" && !filepath.IsValidTimestamp(MustGetFlagString(options.FROM_TIMESTAMP)) {
 		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
 			MustGetFlagString(options.FROM_TIMESTAMP)), "")
@@ -191,6 +287,14 @@ func validateFromTimestamp(fromTimestamp string) {
 	}
 	fromBackupConfig := history.ReadConfigFile(fromTimestampFPInfo.GetConfigFilePath())
 
+	if fromBackupConfig.RowFiltered {
+		gplog.Fatal(errors.Errorf("The backup with timestamp = %s cannot be used as the base of an "+
+			"incremental backup, as only some of the rows of its tables were backed up.", fromTimestampFPInfo.Timestamp), "")
+	}
+	if fromBackupConfig.Masked {
+		gplog.Fatal(errors.Errorf("The backup with timestamp = %s cannot be used as the base of an "+
+			"incremental backup, as the data of some of its columns was masked.", fromTimestampFPInfo.Timestamp), "")
+	}
 	if !matchesIncrementalFlags(fromBackupConfig, &backupReport.BackupConfig) {
 		gplog.Fatal(errors.Errorf("The flags of the backup with timestamp = %s does not match "+
 			"that of the current one. Please refer to the report to view the flags supplied for the "+
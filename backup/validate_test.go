@@ -215,6 +215,12 @@ var _ = Describe("backup/validate tests", func() {
 				}
 			},
 			Entry("--backup-dir combo", "--backup-dir /tmp --plugin-config /tmp/config", false),
+			Entry("--resume combo", "--resume 20170101010101 --backup-dir /tmp --jobs 4", true),
+			Entry("--resume combo", "--resume 20170101010101 --compression-level 3 --no-history", true),
+			Entry("--resume combo", "--resume 20170101010101 --single-data-file", false),
+			Entry("--resume combo", "--resume 20170101010101 --include-schema schema1", false),
+			Entry("--resume combo", "--resume 20170101010101 --compression-type zstd", false),
+			Entry("--resume combo", "--resume 2017", false),
 
 			/*
 			 * Below are all the different filter combinations
@@ -282,6 +288,25 @@ var _ = Describe("backup/validate tests", func() {
 			Entry("jobs combos", "--jobs 2 --single-data-file", false),
 			Entry("jobs combos", "--jobs 2 --plugin-config /tmp/file", true),
 			Entry("jobs combos", "--jobs 2 --data-only", true),
+			Entry("lock-retries combos", "--lock-retries 3", false),
+			Entry("lock-retries combos", "--lock-wait-timeout 60 --lock-retries 3", true),
+			Entry("pin-table combos", "--pin-table public.fact", false),
+			Entry("pin-table combos", "--jobs 2 --pin-table public.fact", true),
+			Entry("pin-table combos", "--jobs 2 --pin-table public.fact --pin-table public.fact2", false),
+
+			/*
+			 * Below are various different row filter and masking rule combinations
+			 */
+			Entry("row-filter-file combos", "--row-filter-file /tmp/filters.yaml --leaf-partition-data", true),
+			Entry("row-filter-file combos", "--row-filter-file /tmp/filters.yaml --incremental --leaf-partition-data", false),
+			Entry("row-filter-file combos", "--row-filter-file /tmp/filters.yaml --metadata-only", false),
+			Entry("masking-rules-file combos", "--masking-rules-file /tmp/masking.yaml --leaf-partition-data", true),
+			Entry("masking-rules-file combos", "--masking-rules-file /tmp/masking.yaml --incremental --leaf-partition-data", false),
+			Entry("masking-rules-file combos", "--masking-rules-file /tmp/masking.yaml --metadata-only", false),
+			Entry("masking-rules-file combos", "--masking-rules-file /tmp/masking.yaml --row-filter-file /tmp/filters.yaml", true),
+			Entry("masking-rules-file combos", "--masking-rules-file /tmp/masking.yaml --with-stats", false),
+			Entry("masking-rules-file combos", "--metadata-only --with-stats", true),
+			Entry("masking-rules-file combos", "--incremental --leaf-partition-data --with-stats", true),
 		)
 	})
 })
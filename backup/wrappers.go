@@ -2,6 +2,7 @@ package backup
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"reflect"
@@ -114,21 +115,29 @@ func NewBackupConfig(dbName string, dbVersion string, backupVersion string, plug
 		BackupVersion:         backupVersion,
 		Compressed:            !MustGetFlagBool(options.NO_COMPRESSION),
 		CompressionType:       MustGetFlagString(options.COMPRESSION_TYPE),
+		CompressionThreads:    MustGetFlagInt(options.COMPRESSION_THREADS),
+		CompressionWindow:     MustGetFlagInt(options.COMPRESSION_WINDOW),
 		DatabaseName:          dbName,
 		DatabaseVersion:       dbVersion,
 		DataOnly:              MustGetFlagBool(options.DATA_ONLY),
+		ExcludeObjectTypes:    toc.NormalizeObjectTypes(MustGetFlagStringArray(options.EXCLUDE_OBJECT_TYPE)),
 		ExcludeRelations:      MustGetFlagStringArray(options.EXCLUDE_RELATION),
 		ExcludeSchemaFiltered: len(MustGetFlagStringArray(options.EXCLUDE_SCHEMA)) > 0,
 		ExcludeSchemas:        MustGetFlagStringArray(options.EXCLUDE_SCHEMA),
 		ExcludeTableFiltered:  len(MustGetFlagStringArray(options.EXCLUDE_RELATION)) > 0,
+		IncludeObjectTypes:    toc.NormalizeObjectTypes(MustGetFlagStringArray(options.INCLUDE_OBJECT_TYPE)),
 		IncludeRelations:      opts.GetOriginalIncludedTables(),
 		IncludeSchemaFiltered: len(MustGetFlagStringArray(options.INCLUDE_SCHEMA)) > 0,
 		IncludeSchemas:        MustGetFlagStringArray(options.INCLUDE_SCHEMA),
 		IncludeTableFiltered:  len(opts.GetOriginalIncludedTables()) > 0,
 		Incremental:           MustGetFlagBool(options.INCREMENTAL),
 		LeafPartitionData:     MustGetFlagBool(options.LEAF_PARTITION_DATA),
+		Masked:                len(maskingRules) > 0,
+		MaskingRules:          maskingRules,
 		MetadataOnly:          MustGetFlagBool(options.METADATA_ONLY),
 		Plugin:                plugin,
+		RowFiltered:           len(rowFilters) > 0,
+		RowFilters:            rowFilters,
 		SingleDataFile:        MustGetFlagBool(options.SINGLE_DATA_FILE),
 		Timestamp:             timestamp,
 		WithoutGlobals:        MustGetFlagBool(options.WITHOUT_GLOBALS),
@@ -158,6 +167,9 @@ func initializeBackupReport(opts options.Options) {
 	}
 
 	config.SegmentCount = len(globalCluster.ContentIDs) - 1
+	if encryptionKey := utils.GetEncryptionKey(); encryptionKey != nil {
+		config.EncryptionKeyID = encryptionKey.ID
+	}
 
 	backupReport = &report.Report{
 		DatabaseSize: dbSize,
@@ -746,6 +758,30 @@ func backupExtendedStatistic(metadataFile *utils.FileWithByteCount) {
 	PrintCreateExtendedStatistics(metadataFile, globalTOC, statisticsExt, statisticExtMetadata)
 }
 
+/*
+ * The metadata of every object type is written before it is filtered, since
+ * the objects of most types are written together in dependency order, and the
+ * statements of the filtered object types are then removed from the file.
+ */
+func filterMetadataByObjectType(metadataFile *utils.FileWithByteCount) {
+	includeObjectTypes := MustGetFlagStringArray(options.INCLUDE_OBJECT_TYPE)
+	excludeObjectTypes := MustGetFlagStringArray(options.EXCLUDE_OBJECT_TYPE)
+	if len(includeObjectTypes) == 0 && len(excludeObjectTypes) == 0 {
+		return
+	}
+	gplog.Verbose("Removing filtered object types from metadata file")
+	contents, err := os.ReadFile(metadataFile.Filename)
+	gplog.FatalOnError(err)
+	filtered := globalTOC.FilterMetadataByObjectType(contents, toc.NewObjectTypeFilterSet(includeObjectTypes, excludeObjectTypes))
+	err = metadataFile.File.Truncate(0)
+	gplog.FatalOnError(err)
+	_, err = metadataFile.File.Seek(0, io.SeekStart)
+	gplog.FatalOnError(err)
+	metadataFile.ByteCount = 0
+	metadataFile.MustPrint(string(filtered))
+	gplog.Verbose("Removed %d bytes of metadata for filtered object types", len(contents)-len(filtered))
+}
+
 /*
  * Data wrapper functions
  */
@@ -9,6 +9,7 @@ package filepath
 import (
 	"fmt"
 	"os"
+	"net/url"
 	"path"
 	"regexp"
 	"strconv"
@@ -134,12 +135,37 @@ func (backupFPInfo *FilePathInfo) GetTableBackupFilePathForCopyCommand(tableOid
 	return path.Join(baseDir, "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp, backupFilePath)
 }
 
+/*
+ * Multi-file backups record the checksum of each table's data in a separate
+ * file per table while the table is being backed up, then merge them into a
+ * single manifest per segment once all of the data has been backed up.
+ */
+func (backupFPInfo *FilePathInfo) GetTableChecksumFilePathForCopyCommand(tableOid uint32) string {
+	return backupFPInfo.GetTableBackupFilePathForCopyCommand(tableOid, "_checksum", false)
+}
+
+// The number of bytes of each table's data is recorded alongside its checksum
+func (backupFPInfo *FilePathInfo) GetTableSizeFilePathForCopyCommand(tableOid uint32) string {
+	return backupFPInfo.GetTableBackupFilePathForCopyCommand(tableOid, "_size", false)
+}
+
+func (backupFPInfo *FilePathInfo) GetSegmentChecksumFilePath(contentID int) string {
+	templateFilePath := backupFPInfo.GetSegmentChecksumFilePathForCopyCommand()
+	return backupFPInfo.replaceCopyFormatStringsInPath(templateFilePath, contentID)
+}
+
+func (backupFPInfo *FilePathInfo) GetSegmentChecksumFilePathForCopyCommand() string {
+	return backupFPInfo.GetTableBackupFilePathForCopyCommand(0, "_checksums.yaml", true)
+}
+
 var metadataFilenameMap = map[string]string{
 	"config":                "config.yaml",
 	"metadata":              "metadata.sql",
 	"statistics":            "statistics.sql",
 	"table of contents":     "toc.yaml",
 	"report":                "report",
+	"json_report":           "report.json",
+	"options":               "options.yaml",
 	"plugin_config":         "plugin_config.yaml",
 	"error_tables_metadata": "error_tables_metadata",
 	"error_tables_data":     "error_tables_data",
@@ -175,6 +201,14 @@ func (backupFPInfo *FilePathInfo) GetBackupReportFilePath() string {
 	return backupFPInfo.GetBackupFilePath("report")
 }
 
+func (backupFPInfo *FilePathInfo) GetBackupJSONReportFilePath() string {
+	return backupFPInfo.GetBackupFilePath("json_report")
+}
+
+func (backupFPInfo *FilePathInfo) GetBackupOptionsFilePath() string {
+	return backupFPInfo.GetBackupFilePath("options")
+}
+
 func (backupFPInfo *FilePathInfo) GetRestoreFilePath(restoreTimestamp string, filetype string) string {
 	return path.Join(backupFPInfo.GetReportDirectoryPath(), fmt.Sprintf("gprestore_%s_%s_%s", backupFPInfo.Timestamp, restoreTimestamp, metadataFilenameMap[filetype]))
 }
@@ -183,6 +217,14 @@ func (backupFPInfo *FilePathInfo) GetRestoreReportFilePath(restoreTimestamp stri
 	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "report")
 }
 
+func (backupFPInfo *FilePathInfo) GetRestoreJSONReportFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "json_report")
+}
+
+func (backupFPInfo *FilePathInfo) GetRestoreOptionsFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "options")
+}
+
 func (backupFPInfo *FilePathInfo) GetErrorTablesMetadataFilePath(restoreTimestamp string) string {
 	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "error_tables_metadata")
 }
@@ -191,6 +233,12 @@ func (backupFPInfo *FilePathInfo) GetErrorTablesDataFilePath(restoreTimestamp st
 	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "error_tables_data")
 }
 
+// Restore progress is recorded per backup, so that a failed restore can be resumed by a later run
+// A backup may be restored into several databases at once, each of which has its own state file
+func (backupFPInfo *FilePathInfo) GetRestoreStateFilePath(database string) string {
+	return path.Join(backupFPInfo.GetReportDirectoryPath(), fmt.Sprintf("gprestore_%s_%s_state", backupFPInfo.Timestamp, url.PathEscape(database)))
+}
+
 func (backupFPInfo *FilePathInfo) GetConfigFilePath() string {
 	return backupFPInfo.GetBackupFilePath("config")
 }
@@ -207,6 +255,10 @@ func (backupFPInfo *FilePathInfo) GetSegmentHelperFilePath(contentID int, suffix
 	return path.Join(backupFPInfo.SegDirMap[contentID], fmt.Sprintf("gpbackup_%d_%s_%s_%d", contentID, backupFPInfo.Timestamp, suffix, backupFPInfo.PID))
 }
 
+func (backupFPInfo *FilePathInfo) GetSegmentHelperFilePathForCopyCommand(suffix string) string {
+	return fmt.Sprintf("<SEG_DATA_DIR>/gpbackup_<SEGID>_%s_%s_%d", backupFPInfo.Timestamp, suffix, backupFPInfo.PID)
+}
+
 func (backupFPInfo *FilePathInfo) GetHelperLogPath() string {
 	currentUser, _ := operating.System.CurrentUser()
 	homeDir := currentUser.HomeDir
@@ -217,6 +269,15 @@ func (backupFPInfo *FilePathInfo) GetHelperLogPath() string {
  * Helper functions
  */
 
+// Returned by ParseSegPrefix when the backup directory of the coordinator does not exist
+type BackupDirMissingError struct {
+	BackupDir string
+}
+
+func (err BackupDirMissingError) Error() string {
+	return fmt.Sprintf("Backup directory in %s missing", err.BackupDir)
+}
+
 func ParseSegPrefix(backupDir string, timestamp string) (string, bool, error) {
 	if backupDir == "" || timestamp == "" {
 		return "", false, nil
@@ -238,7 +299,7 @@ func ParseSegPrefix(backupDir string, timestamp string) (string, bool, error) {
 		return "", false, fmt.Errorf("Failure while trying to locate backup directory in %s. Error: %s", backupDir, err.Error())
 	}
 	if len(backupDirForCoordinator) == 0 {
-		return "", false, fmt.Errorf("Backup directory in %s missing", backupDir)
+		return "", false, BackupDirMissingError{BackupDir: backupDir}
 	}
 	if len(backupDirForCoordinator) != 1 {
 		return "", false, fmt.Errorf("Multiple backup directories in %s", backupDir)
@@ -287,7 +348,12 @@ func GetSegPrefix(connectionPool *dbconn.DBConn) string {
 	result := ""
 	err := connectionPool.Get(&result, query)
 	gplog.FatalOnError(err)
-	_, segPrefix := path.Split(result)
+	return GetSegPrefixFromDataDir(result)
+}
+
+// Returns the segment prefix of a cluster given the data directory of its coordinator
+func GetSegPrefixFromDataDir(coordinatorDataDir string) string {
+	_, segPrefix := path.Split(coordinatorDataDir)
 	segPrefix = segPrefix[:len(segPrefix)-2] // Remove "-1" segment ID from string
 	return segPrefix
 }
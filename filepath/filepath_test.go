@@ -157,6 +157,32 @@ var _ = Describe("filepath tests", func() {
 			fpInfo.SingleBackupDir = false
 			Expect(fpInfo.GetRestoreReportFilePath("20200101010101")).To(Equal("/bar/foo/gpseg-1/backups/20170101/20170101010101/gprestore_20170101010101_20200101010101_report"))
 		})
+		It("returns JSON report file paths for backup and restore commands", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg", false)
+			Expect(fpInfo.GetBackupJSONReportFilePath()).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_report.json"))
+			fpInfo.UserSpecifiedReportDir = "/bar/foo"
+			fpInfo.SingleBackupDir = true
+			Expect(fpInfo.GetRestoreJSONReportFilePath("20200101010101")).To(Equal("/bar/foo/gprestore_20170101010101_20200101010101_report.json"))
+		})
+		It("returns options file paths for backup and restore commands", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg", false)
+			Expect(fpInfo.GetBackupOptionsFilePath()).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_options.yaml"))
+			fpInfo.UserSpecifiedReportDir = "/bar/foo"
+			fpInfo.SingleBackupDir = true
+			Expect(fpInfo.GetRestoreOptionsFilePath("20200101010101")).To(Equal("/bar/foo/gprestore_20170101010101_20200101010101_options.yaml"))
+		})
+		It("returns restore state file path based on user specified report path", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg", false)
+			Expect(fpInfo.GetRestoreStateFilePath("testdb")).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gprestore_20170101010101_testdb_state"))
+			fpInfo.UserSpecifiedReportDir = "/bar/foo"
+			fpInfo.SingleBackupDir = true
+			Expect(fpInfo.GetRestoreStateFilePath("testdb")).To(Equal("/bar/foo/gprestore_20170101010101_testdb_state"))
+		})
+		It("returns restore state file paths that differ for each restore database", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg", false)
+			Expect(fpInfo.GetRestoreStateFilePath("otherdb")).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gprestore_20170101010101_otherdb_state"))
+			Expect(fpInfo.GetRestoreStateFilePath("my/db name")).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gprestore_20170101010101_my%2Fdb%20name_state"))
+		})
 	})
 	Describe("GetTableBackupFilePath", func() {
 		It("returns table file path", func() {
@@ -176,6 +202,28 @@ var _ = Describe("filepath tests", func() {
 			Expect(fpInfo.GetTableBackupFilePath(-1, 1234, "", true)).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_-1_20170101010101"))
 		})
 	})
+	Describe("Checksum file paths", func() {
+		It("returns table checksum file path for copy command", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg", false)
+			Expect(fpInfo.GetTableChecksumFilePathForCopyCommand(1234)).To(Equal("<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1234_checksum"))
+			Expect(fpInfo.GetTableSizeFilePathForCopyCommand(1234)).To(Equal("<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1234_size"))
+		})
+		It("returns segment checksum file path for copy command based on user specified path", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg", false)
+			Expect(fpInfo.GetSegmentChecksumFilePathForCopyCommand()).To(Equal("/foo/bar/gpseg<SEGID>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums.yaml"))
+		})
+		It("returns segment checksum file path", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg", false)
+			Expect(fpInfo.GetSegmentChecksumFilePath(-1)).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gpbackup_-1_20170101010101_checksums.yaml"))
+		})
+	})
+	Describe("GetSegmentHelperFilePathForCopyCommand", func() {
+		It("returns helper file path for copy command", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg", false)
+			fpInfo.PID = 1234
+			Expect(fpInfo.GetSegmentHelperFilePathForCopyCommand("key")).To(Equal("<SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_key_1234"))
+		})
+	})
 	Describe("ParseSegPrefix", func() {
 		AfterEach(func() {
 			operating.System.Glob = path.Glob
@@ -0,0 +1,24 @@
+// +build gpbackup_manager
+
+package main
+
+import (
+	"os"
+
+	. "github.com/greenplum-db/gpbackup/manager"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	var rootCmd = &cobra.Command{
+		Use:     "gpbackup_manager",
+		Short:   "gpbackup_manager is a utility for inspecting and maintaining backups taken by gpbackup",
+		Version: GetVersion(),
+	}
+	rootCmd.SetArgs(options.HandleSingleDashes(os.Args[1:]))
+	DoInit(rootCmd)
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(2)
+	}
+}
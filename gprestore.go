@@ -16,6 +16,10 @@ func main() {
 		Short:   "gprestore is the parallel restore utility for Greenplum",
 		Args:    cobra.NoArgs,
 		Version: GetVersion(),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			// Flags are set from a configuration file before required flags are checked
+			return options.ApplyConfigFile(cmd.Flags())
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			defer DoTeardown()
 			DoValidation(cmd)
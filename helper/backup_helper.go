@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync/atomic"
 
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
@@ -19,6 +20,7 @@ import (
 
 func doBackupAgent() error {
 	var lastRead uint64
+	var bytesWritten, lastWritten uint64
 	var (
 		pipeWriter BackupPipeWriterCloser
 		writeCmd   *exec.Cmd
@@ -62,7 +64,7 @@ func doBackupAgent() error {
 			return err
 		}
 		if i == 0 {
-			pipeWriter, writeCmd, err = getBackupPipeWriter()
+			pipeWriter, writeCmd, err = getBackupPipeWriter(&bytesWritten)
 			if err != nil {
 				logError(fmt.Sprintf("Oid %d: Error encountered getting backup pipe writer: %v", oid, err))
 				return err
@@ -70,7 +72,8 @@ func doBackupAgent() error {
 		}
 
 		logInfo(fmt.Sprintf("Oid %d: Backing up table with pipe %s", oid, currentPipe))
-		numBytes, err := io.Copy(pipeWriter, reader)
+		checksum := newChecksum()
+		numBytes, err := io.Copy(pipeWriter, io.TeeReader(reader, checksum))
 		if err != nil {
 			logError(fmt.Sprintf("Oid %d: Error encountered copying bytes from pipeWriter to reader: %v", oid, err))
 			return errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
@@ -78,8 +81,10 @@ func doBackupAgent() error {
 		logInfo(fmt.Sprintf("Oid %d: Read %d bytes\n", oid, numBytes))
 
 		lastProcessed := lastRead + uint64(numBytes)
-		tocfile.AddSegmentDataEntry(uint(oid), lastRead, lastProcessed)
+		written := atomic.LoadUint64(&bytesWritten)
+		tocfile.AddSegmentDataEntry(uint(oid), lastRead, lastProcessed, formatChecksum(checksum), written-lastWritten)
 		lastRead = lastProcessed
+		lastWritten = written
 
 		_ = readHandle.Close()
 		logInfo(fmt.Sprintf("Oid %d: Deleting pipe: %s\n", oid, currentPipe))
@@ -124,7 +129,7 @@ func getBackupPipeReader(currentPipe string) (io.Reader, io.ReadCloser, error) {
 	return reader, readHandle, nil
 }
 
-func getBackupPipeWriter() (pipe BackupPipeWriterCloser, writeCmd *exec.Cmd, err error) {
+func getBackupPipeWriter(bytesWritten *uint64) (pipe BackupPipeWriterCloser, writeCmd *exec.Cmd, err error) {
 	var writeHandle io.WriteCloser
 	if *pluginConfigFile != "" {
 		writeCmd, writeHandle, err = startBackupPluginCommand()
@@ -135,6 +140,14 @@ func getBackupPipeWriter() (pipe BackupPipeWriterCloser, writeCmd *exec.Cmd, err
 		// error logging handled by calling functions
 		return nil, nil, err
 	}
+	writeHandle = countingWriteCloser{WriteCloser: writeHandle, numBytes: bytesWritten}
+	if *encryptionKeyFile != "" {
+		writeHandle, err = newEncryptingWriteHandle(writeHandle)
+		if err != nil {
+			// error logging handled by calling functions
+			return nil, nil, err
+		}
+	}
 
 	if *compressionLevel == 0 {
 		pipe = NewCommonBackupPipeWriterCloser(writeHandle)
@@ -145,8 +158,16 @@ func getBackupPipeWriter() (pipe BackupPipeWriterCloser, writeCmd *exec.Cmd, err
 		pipe, err = NewGZipBackupPipeWriterCloser(writeHandle, *compressionLevel)
 		return
 	}
+	if *compressionType == "pgzip" {
+		pipe, err = NewPGZipBackupPipeWriterCloser(writeHandle, *compressionLevel)
+		return
+	}
 	if *compressionType == "zstd" {
-		pipe, err = NewZSTDBackupPipeWriterCloser(writeHandle, *compressionLevel)
+		pipe, err = NewZSTDBackupPipeWriterCloser(writeHandle, *compressionLevel, *compressionThreads, *compressionWindow)
+		return
+	}
+	if *compressionType == "lz4" {
+		pipe, err = NewLZ4BackupPipeWriterCloser(writeHandle, *compressionLevel)
 		return
 	}
 
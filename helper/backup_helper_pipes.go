@@ -3,9 +3,13 @@ package helper
 import (
 	"bufio"
 	"compress/gzip"
+	"fmt"
 	"io"
+	"sync/atomic"
 
 	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/pierrec/lz4/v4"
 )
 
 type BackupPipeWriterCloser interface {
@@ -13,6 +17,22 @@ type BackupPipeWriterCloser interface {
 	io.Closer
 }
 
+/*
+ * Counts the bytes written to the data file or plugin after compression and
+ * encryption.  Compressors may write from goroutines of their own, so the
+ * count is updated atomically.
+ */
+type countingWriteCloser struct {
+	io.WriteCloser
+	numBytes *uint64
+}
+
+func (w countingWriteCloser) Write(p []byte) (n int, err error) {
+	n, err = w.WriteCloser.Write(p)
+	atomic.AddUint64(w.numBytes, uint64(n))
+	return n, err
+}
+
 type CommonBackupPipeWriterCloser struct {
 	writeHandle io.WriteCloser
 	bufIoWriter *bufio.Writer
@@ -76,11 +96,83 @@ func (zstdPipe ZSTDBackupPipeWriterCloser) Close() error {
 	return zstdPipe.cPipe.Close()
 }
 
-func NewZSTDBackupPipeWriterCloser(writeHandle io.WriteCloser, compressLevel int) (zstdPipe ZSTDBackupPipeWriterCloser, err error) {
+/*
+ * A single data file backup writes one stream per segment, so the number of
+ * threads and the window size, which determines how far back zstd looks for
+ * matches, can be raised for it.  A value of 0 leaves the default in place.
+ */
+func NewZSTDBackupPipeWriterCloser(writeHandle io.WriteCloser, compressLevel int, compressThreads int, compressWindow int) (zstdPipe ZSTDBackupPipeWriterCloser, err error) {
 	zstdPipe.cPipe = NewCommonBackupPipeWriterCloser(writeHandle)
-	zstdPipe.zstdEncoder, err = zstd.NewWriter(zstdPipe.cPipe.bufIoWriter, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(compressLevel)))
+	encoderOptions := []zstd.EOption{zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(compressLevel))}
+	if compressThreads > 0 {
+		encoderOptions = append(encoderOptions, zstd.WithEncoderConcurrency(compressThreads))
+	}
+	if compressWindow > 0 {
+		encoderOptions = append(encoderOptions, zstd.WithWindowSize(1<<compressWindow))
+	}
+	zstdPipe.zstdEncoder, err = zstd.NewWriter(zstdPipe.cPipe.bufIoWriter, encoderOptions...)
 	if err != nil {
 		zstdPipe.cPipe.Close()
 	}
 	return
 }
+
+type PGZipBackupPipeWriterCloser struct {
+	cPipe       CommonBackupPipeWriterCloser
+	pgzipWriter *pgzip.Writer
+}
+
+func (pgzPipe PGZipBackupPipeWriterCloser) Write(p []byte) (n int, err error) {
+	return pgzPipe.pgzipWriter.Write(p)
+}
+
+// Returns errors from underlying common writer only
+func (pgzPipe PGZipBackupPipeWriterCloser) Close() error {
+	_ = pgzPipe.pgzipWriter.Close()
+	return pgzPipe.cPipe.Close()
+}
+
+func NewPGZipBackupPipeWriterCloser(writeHandle io.WriteCloser, compressLevel int) (pgzPipe PGZipBackupPipeWriterCloser, err error) {
+	pgzPipe.cPipe = NewCommonBackupPipeWriterCloser(writeHandle)
+	pgzPipe.pgzipWriter, err = pgzip.NewWriterLevel(pgzPipe.cPipe.bufIoWriter, compressLevel)
+	if err != nil {
+		pgzPipe.cPipe.Close()
+	}
+	return
+}
+
+/*
+ * Level 1 uses the fast lz4 compressor, as the lz4 command line tool does, and
+ * higher levels use the high compression mode of increasing depth.
+ */
+var lz4CompressionLevels = []lz4.CompressionLevel{lz4.Fast, lz4.Level2, lz4.Level3, lz4.Level4,
+	lz4.Level5, lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9}
+
+type LZ4BackupPipeWriterCloser struct {
+	cPipe     CommonBackupPipeWriterCloser
+	lz4Writer *lz4.Writer
+}
+
+func (lz4Pipe LZ4BackupPipeWriterCloser) Write(p []byte) (n int, err error) {
+	return lz4Pipe.lz4Writer.Write(p)
+}
+
+// Returns errors from underlying common writer only
+func (lz4Pipe LZ4BackupPipeWriterCloser) Close() error {
+	_ = lz4Pipe.lz4Writer.Close()
+	return lz4Pipe.cPipe.Close()
+}
+
+func NewLZ4BackupPipeWriterCloser(writeHandle io.WriteCloser, compressLevel int) (lz4Pipe LZ4BackupPipeWriterCloser, err error) {
+	lz4Pipe.cPipe = NewCommonBackupPipeWriterCloser(writeHandle)
+	if compressLevel < 1 || compressLevel > len(lz4CompressionLevels) {
+		lz4Pipe.cPipe.Close()
+		return lz4Pipe, fmt.Errorf("invalid lz4 compression level %d", compressLevel)
+	}
+	lz4Pipe.lz4Writer = lz4.NewWriter(lz4Pipe.cPipe.bufIoWriter)
+	err = lz4Pipe.lz4Writer.Apply(lz4.CompressionLevelOption(lz4CompressionLevels[compressLevel-1]))
+	if err != nil {
+		lz4Pipe.cPipe.Close()
+	}
+	return
+}
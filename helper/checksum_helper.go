@@ -0,0 +1,164 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Checksum specific functions
+ */
+
+var (
+	segmentChecksums map[int]map[uint]string
+)
+
+/*
+ * The checksum of a table is computed over its uncompressed COPY output, so
+ * it is independent of the compression type and of the layout of the data file.
+ * The checksums of an encrypted backup are keyed with the encryption key.
+ */
+func newChecksum() hash.Hash {
+	if encryptionKey != nil {
+		return encryptionKey.NewChecksumHash()
+	}
+	return sha256.New()
+}
+
+func formatChecksum(checksum hash.Hash) string {
+	return fmt.Sprintf("%x", checksum.Sum(nil))
+}
+
+/*
+ * restoreChecksum computes the checksum of the data written to a restore pipe
+ * and tracks whether that data ends inside a quoted CSV field.  A mismatch is
+ * only detected once all of a table's data has been written to the pipe, at
+ * which point COPY has already parsed it, so we end the stream with an
+ * unterminated quoted field to make COPY fail instead of loading bad data,
+ * and the mismatch is returned as the error of the table.
+ */
+type restoreChecksum struct {
+	hash   hash.Hash
+	quotes int64
+}
+
+func newRestoreChecksum() *restoreChecksum {
+	return &restoreChecksum{hash: newChecksum()}
+}
+
+func (c *restoreChecksum) Write(p []byte) (int, error) {
+	c.quotes += int64(bytes.Count(p, []byte{'"'}))
+	return c.hash.Write(p)
+}
+
+func (c *restoreChecksum) verify(oid int, expectedChecksum string) error {
+	if expectedChecksum == "" {
+		// Backups taken before checksums were recorded have nothing to verify
+		return nil
+	}
+	computedChecksum := formatChecksum(c.hash)
+	if computedChecksum == expectedChecksum {
+		return nil
+	}
+	trailer := "\n\""
+	if c.quotes%2 == 1 {
+		trailer = "\"" + trailer
+	}
+	_, _ = writer.WriteString(trailer)
+	return errors.Errorf("Checksum mismatch for oid %d: expected %s, computed %s", oid, expectedChecksum, computedChecksum)
+}
+
+/*
+ * In a multi-file backup the checksums are stored in a manifest per segment
+ * alongside the table data files, which we find using the data file name
+ * passed in by gprestore.  A backup without a manifest predates checksums.
+ */
+func constructChecksumFilename(name string, contentToRestore int) string {
+	name = replaceContentInFilename(name, contentToRestore)
+	name = utils.TrimCompressedFileExtension(name)
+	return name + "_checksums.yaml"
+}
+
+func getTableChecksum(contentToRestore int, oid int) (string, error) {
+	if segmentChecksums == nil {
+		segmentChecksums = make(map[int]map[uint]string)
+	}
+	checksums, ok := segmentChecksums[contentToRestore]
+	if !ok {
+		filename := constructChecksumFilename(*dataFile, contentToRestore)
+		if utils.FileExists(filename) {
+			var err error
+			checksums, err = toc.ReadSegmentChecksums(filename)
+			if err != nil {
+				return "", err
+			}
+		}
+		segmentChecksums[contentToRestore] = checksums
+	}
+	return checksums[uint(oid)], nil
+}
+
+/*
+ * The checksum agent is run as a filter in the COPY ... PROGRAM command of a
+ * multi-file backup or restore, between COPY and the compression program.
+ * During backup it records the checksum of the table's data in the given
+ * file and the number of bytes of the data in the given size file, and during
+ * restore it compares the checksum of the data against the manifest and exits
+ * with an error on a mismatch so that the COPY fails.  As in a single-data-file
+ * restore, a table with no checksum in the manifest is restored unverified.
+ */
+func doChecksumAgent() error {
+	var expectedChecksum string
+	if *verifyChecksum {
+		checksums, err := toc.ReadSegmentChecksums(*checksumFile)
+		if err != nil {
+			logError(fmt.Sprintf("Oid %d: Error encountered reading checksum file %s: %v", *tableOid, *checksumFile, err))
+			return err
+		}
+		var ok bool
+		expectedChecksum, ok = checksums[uint(*tableOid)]
+		if !ok {
+			// A table whose data is not distributed to this segment has no checksum recorded for it
+			logWarn(fmt.Sprintf("Oid %d: No checksum recorded in %s, so its data cannot be verified", *tableOid, *checksumFile))
+		}
+	}
+
+	checksum := newChecksum()
+	numBytes, err := io.Copy(io.MultiWriter(os.Stdout, checksum), os.Stdin)
+	if err != nil {
+		logError(fmt.Sprintf("Oid %d: Error encountered copying data: %v", *tableOid, err))
+		return err
+	}
+	computedChecksum := formatChecksum(checksum)
+	logVerbose(fmt.Sprintf("Oid %d: Computed checksum %s of %d bytes", *tableOid, computedChecksum, numBytes))
+
+	if *verifyChecksum {
+		if expectedChecksum != "" && computedChecksum != expectedChecksum {
+			err = errors.Errorf("Checksum mismatch for oid %d: expected %s, computed %s", *tableOid, expectedChecksum, computedChecksum)
+			logError(err.Error())
+			return err
+		}
+		return nil
+	}
+	err = utils.WriteToFileAndMakeReadOnly(*checksumFile, []byte(fmt.Sprintf("%d: %s\n", *tableOid, computedChecksum)))
+	if err != nil {
+		logError(fmt.Sprintf("Oid %d: Error encountered writing checksum file %s: %v", *tableOid, *checksumFile, err))
+		return err
+	}
+	if *sizeFile != "" {
+		err = utils.WriteToFileAndMakeReadOnly(*sizeFile, []byte(fmt.Sprintf("%d: %d\n", *tableOid, numBytes)))
+		if err != nil {
+			logError(fmt.Sprintf("Oid %d: Error encountered writing size file %s: %v", *tableOid, *sizeFile, err))
+			return err
+		}
+	}
+	return nil
+}
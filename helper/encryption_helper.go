@@ -0,0 +1,89 @@
+package helper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Encryption specific functions
+ */
+
+var (
+	encryptionKey *utils.EncryptionKey
+)
+
+func getEncryptionKey() (*utils.EncryptionKey, error) {
+	if encryptionKey == nil {
+		var err error
+		encryptionKey, err = utils.ReadEncryptionKey(*encryptionKeyFile, "", "", "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return encryptionKey, nil
+}
+
+/*
+ * Data is encrypted after it is compressed, as encrypted data does not
+ * compress, so the encrypting writer wraps the handle of the data file or
+ * plugin and the compression writer in turn wraps it.
+ */
+func newEncryptingWriteHandle(writeHandle io.Writer) (io.WriteCloser, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.NewEncryptingWriter(writeHandle)
+}
+
+func newDecryptingReadHandle(readHandle io.Reader) (io.Reader, error) {
+	key, err := getEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.NewDecryptingReader(readHandle)
+}
+
+/*
+ * The encryption agent is run as a filter in the COPY ... PROGRAM command of a
+ * multi-file backup or restore, after the compression program during backup
+ * and before the decompression program during restore.  If the data cannot be
+ * decrypted it exits with an error so that the COPY fails.
+ */
+func doEncryptionAgent() error {
+	var err error
+	operation := "encrypting"
+	if *decryptAgent {
+		operation = "decrypting"
+	}
+	stdout := bufio.NewWriter(os.Stdout)
+	if *encryptAgent {
+		var writer io.WriteCloser
+		writer, err = newEncryptingWriteHandle(stdout)
+		if err == nil {
+			_, err = io.Copy(writer, bufio.NewReader(os.Stdin))
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+	} else {
+		var reader io.Reader
+		reader, err = newDecryptingReadHandle(bufio.NewReader(os.Stdin))
+		if err == nil {
+			_, err = io.Copy(stdout, reader)
+		}
+	}
+	if err == nil {
+		err = stdout.Flush()
+	}
+	if err != nil {
+		logError(fmt.Sprintf("Error encountered %s data: %v", operation, err))
+		return err
+	}
+	return nil
+}
@@ -38,25 +38,36 @@ var (
  * Command-line flags
  */
 var (
-	backupAgent      *bool
-	compressionLevel *int
-	compressionType  *string
-	content          *int
-	dataFile         *string
-	oidFile          *string
-	onErrorContinue  *bool
-	pipeFile         *string
-	pluginConfigFile *string
-	printVersion     *bool
-	restoreAgent     *bool
-	tocFile          *string
-	isFiltered       *bool
-	copyQueue        *int
-	singleDataFile   *bool
-	isResizeRestore  *bool
-	origSize         *int
-	destSize         *int
-	verbosity        *int
+	backupAgent        *bool
+	checksumAgent      *bool
+	checksumFile       *string
+	compressionLevel   *int
+	compressionThreads *int
+	compressionType    *string
+	compressionWindow  *int
+	content            *int
+	dataFile           *string
+	decryptAgent       *bool
+	encryptAgent       *bool
+	encryptionKeyFile  *string
+	oidFile            *string
+	onErrorContinue    *bool
+	pipeFile           *string
+	pluginConfigFile   *string
+	printVersion       *bool
+	restoreAgent       *bool
+	sizeFile           *string
+	tableOid           *int
+	tocFile            *string
+	isFiltered         *bool
+	copyQueue          *int
+	singleDataFile     *bool
+	isResizeRestore    *bool
+	origSize           *int
+	destSize           *int
+	verbosity          *int
+	verifyAgent        *bool
+	verifyChecksum     *bool
 )
 
 func DoHelper() {
@@ -73,12 +84,28 @@ func DoHelper() {
 	InitializeGlobals()
 	go InitializeSignalHandler()
 
-	if *backupAgent {
-		err = doBackupAgent()
-	} else if *restoreAgent {
-		err = doRestoreAgent()
+	if *encryptionKeyFile != "" {
+		// The key is read up front, as it keys the table checksums as well as encrypting the data
+		_, err = getEncryptionKey()
+		if err != nil {
+			logError(fmt.Sprintf("Error encountered reading encryption key file %s: %v", *encryptionKeyFile, err))
+		}
 	}
-	if err != nil {
+	if err == nil {
+		if *backupAgent {
+			err = doBackupAgent()
+		} else if *restoreAgent {
+			err = doRestoreAgent()
+		} else if *verifyAgent {
+			err = doVerifyAgent()
+		} else if *checksumAgent {
+			err = doChecksumAgent()
+		} else if *encryptAgent || *decryptAgent {
+			err = doEncryptionAgent()
+		}
+	}
+	// The checksum and encryption agents run as part of a COPY command, which reports their errors instead
+	if err != nil && !*checksumAgent && !*encryptAgent && !*decryptAgent {
 		// error logging handled in doBackupAgent and doRestoreAgent
 		errFile := fmt.Sprintf("%s_error", *pipeFile)
 		gplog.Debug("Writing error file %s", errFile)
@@ -98,16 +125,25 @@ func InitializeGlobals() {
 	CleanupGroup.Add(1)
 
 	backupAgent = flag.Bool("backup-agent", false, "Use gpbackup_helper as an agent for backup")
+	checksumAgent = flag.Bool("checksum-agent", false, "Use gpbackup_helper as a filter that computes the checksum of table data passing through it")
+	checksumFile = flag.String("checksum-file", "", "Absolute path to the file to write the table checksum to, or to read it from with --verify-checksum")
 	content = flag.Int("content", -2, "Content ID of the corresponding segment")
 	compressionLevel = flag.Int("compression-level", 0, "The level of compression. O indicates no compression. Range of valid values depends on compression type")
-	compressionType = flag.String("compression-type", "gzip", "The type of compression. Valid values are 'gzip' and 'zstd'")
+	compressionThreads = flag.Int("compression-threads", 0, "The number of threads to use for zstd compression. 0 uses the default of the compression library")
+	compressionType = flag.String("compression-type", "gzip", "The type of compression. Valid values are 'gzip', 'pgzip', 'zstd' and 'lz4'")
+	compressionWindow = flag.Int("compression-window", 0, "The base 2 logarithm of the window size for zstd compression. 0 uses the default window size")
 	dataFile = flag.String("data-file", "", "Absolute path to the data file")
+	decryptAgent = flag.Bool("decrypt-agent", false, "Use gpbackup_helper as a filter that decrypts table data passing through it")
+	encryptAgent = flag.Bool("encrypt-agent", false, "Use gpbackup_helper as a filter that encrypts table data passing through it")
+	encryptionKeyFile = flag.String("encryption-key-file", "", "Absolute path to the file containing the key with which to encrypt or decrypt table data")
 	oidFile = flag.String("oid-file", "", "Absolute path to the file containing a list of oids to restore")
 	onErrorContinue = flag.Bool("on-error-continue", false, "Continue restore even when encountering an error")
 	pipeFile = flag.String("pipe-file", "", "Absolute path to the pipe file")
 	pluginConfigFile = flag.String("plugin-config", "", "The configuration file to use for a plugin")
 	printVersion = flag.Bool("version", false, "Print version number and exit")
 	restoreAgent = flag.Bool("restore-agent", false, "Use gpbackup_helper as an agent for restore")
+	sizeFile = flag.String("size-file", "", "Absolute path to the file to write the number of bytes of table data passed to the checksum agent to")
+	tableOid = flag.Int("oid", 0, "The oid of the table whose data is passed to the checksum agent")
 	tocFile = flag.String("toc-file", "", "Absolute path to the table of contents file")
 	isFiltered = flag.Bool("with-filters", false, "Used with table/schema filters")
 	copyQueue = flag.Int("copy-queue-size", 1, "Used to know how many COPIES are being queued up")
@@ -116,6 +152,8 @@ func InitializeGlobals() {
 	origSize = flag.Int("orig-seg-count", 0, "Used with resize restore.  Gives the segment count of the backup.")
 	destSize = flag.Int("dest-seg-count", 0, "Used with resize restore.  Gives the segment count of the current cluster.")
 	verbosity = flag.Int("verbosity", gplog.LOGINFO, "Log file verbosity")
+	verifyAgent = flag.Bool("verify-agent", false, "Use gpbackup_helper as an agent to verify backup data files without restoring them")
+	verifyChecksum = flag.Bool("verify-checksum", false, "Used with the checksum agent during restore to verify table data against the checksum file")
 
 	flag.Parse()
 	if *printVersion {
@@ -136,6 +174,12 @@ func InitializeGlobals() {
 
 	gplog.InitializeLogging("gpbackup_helper", "")
 	gplog.SetLogFileVerbosity(*verbosity)
+	if *verifyAgent || *checksumAgent || *encryptAgent || *decryptAgent {
+		// The verification results and the table data passed through the
+		// checksum and encryption agents are written to stdout, so
+		// informational messages only go to the log file
+		gplog.SetVerbosity(gplog.LOGERROR)
+	}
 }
 
 func InitializeSignalHandler() {
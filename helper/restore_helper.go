@@ -16,6 +16,7 @@ import (
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
 	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
 )
@@ -71,26 +72,26 @@ func (r *RestoreReader) positionReader(pos uint64, oid int) error {
 	return nil
 }
 
-func (r *RestoreReader) copyData(num int64) (int64, error) {
+func (r *RestoreReader) copyData(num int64, checksum io.Writer) (int64, error) {
 	var bytesRead int64
 	var err error
 	switch r.readerType {
 	case SEEKABLE:
-		bytesRead, err = io.CopyN(writer, r.seekReader, num)
+		bytesRead, err = io.CopyN(io.MultiWriter(writer, checksum), r.seekReader, num)
 	case NONSEEKABLE, SUBSET:
-		bytesRead, err = io.CopyN(writer, r.bufReader, num)
+		bytesRead, err = io.CopyN(io.MultiWriter(writer, checksum), r.bufReader, num)
 	}
 	return bytesRead, err
 }
 
-func (r *RestoreReader) copyAllData() (int64, error) {
+func (r *RestoreReader) copyAllData(checksum io.Writer) (int64, error) {
 	var bytesRead int64
 	var err error
 	switch r.readerType {
 	case SEEKABLE:
-		bytesRead, err = io.Copy(writer, r.seekReader)
+		bytesRead, err = io.Copy(io.MultiWriter(writer, checksum), r.seekReader)
 	case NONSEEKABLE, SUBSET:
-		bytesRead, err = io.Copy(writer, r.bufReader)
+		bytesRead, err = io.Copy(io.MultiWriter(writer, checksum), r.bufReader)
 	}
 	return bytesRead, err
 }
@@ -110,6 +111,8 @@ func doRestoreAgent() error {
 
 	var bytesRead int64
 	var lastError error
+	var checksum *restoreChecksum
+	var expectedChecksum string
 
 	readers := make(map[int]*RestoreReader)
 
@@ -280,19 +283,28 @@ func doRestoreAgent() error {
 		}
 
 		logVerbose(fmt.Sprintf("Oid %d, Batch %d: Start table restore", tableOid, batchNum))
+		checksum = newRestoreChecksum()
+		expectedChecksum = ""
 		if *isResizeRestore {
 			if contentToRestore < *origSize {
 				if *singleDataFile {
-					bytesRead, err = readers[contentToRestore].copyData(int64(end[contentToRestore] - start[contentToRestore]))
+					expectedChecksum = tocEntries[contentToRestore][uint(tableOid)].Checksum
+					bytesRead, err = readers[contentToRestore].copyData(int64(end[contentToRestore]-start[contentToRestore]), checksum)
 				} else {
-					bytesRead, err = readers[contentToRestore].copyAllData()
+					expectedChecksum, err = getTableChecksum(contentToRestore, tableOid)
+					if err != nil {
+						logError(fmt.Sprintf("Oid: %d, Batch %d: Error encountered reading checksum file: %v", tableOid, batchNum, err))
+						return err
+					}
+					bytesRead, err = readers[contentToRestore].copyAllData(checksum)
 				}
 			} else {
 				// Write "empty" data to the pipe for COPY ON SEGMENT to read.
 				bytesRead = 0
 			}
 		} else {
-			bytesRead, err = readers[contentToRestore].copyData(int64(end[contentToRestore] - start[contentToRestore]))
+			expectedChecksum = tocEntries[contentToRestore][uint(tableOid)].Checksum
+			bytesRead, err = readers[contentToRestore].copyData(int64(end[contentToRestore]-start[contentToRestore]), checksum)
 		}
 		if err != nil {
 			// In case COPY FROM or copyN fails in the middle of a load. We
@@ -314,11 +326,20 @@ func doRestoreAgent() error {
 		}
 		logInfo(fmt.Sprintf("Oid %d, Batch %d: Copied %d bytes into the pipe", tableOid, batchNum, bytesRead))
 
+		err = checksum.verify(tableOid, expectedChecksum)
+		if err != nil {
+			goto LoopEnd
+		}
+
 	LoopEnd:
 		logInfo(fmt.Sprintf("Oid %d, Batch %d: Closing pipe %s", tableOid, batchNum, currentPipe))
-		err = flushAndCloseRestoreWriter(currentPipe, tableOid)
-		if err != nil {
-			logVerbose(fmt.Sprintf("Oid %d, Batch %d: Failed to flush and close pipe: %s", tableOid, batchNum, err))
+		// An error copying or verifying the data is reported in preference to the error closing the pipe it causes
+		errClose := flushAndCloseRestoreWriter(currentPipe, tableOid)
+		if errClose != nil {
+			logVerbose(fmt.Sprintf("Oid %d, Batch %d: Failed to flush and close pipe: %s", tableOid, batchNum, errClose))
+			if err == nil {
+				err = errClose
+			}
 		}
 
 		logVerbose(fmt.Sprintf("Oid %d, Batch %d: End batch restore", tableOid, batchNum))
@@ -348,7 +369,7 @@ func constructSingleTableFilename(name string, contentToRestore int, oid int) st
 	name = strings.ReplaceAll(name, fmt.Sprintf("gpbackup_%d", *content), fmt.Sprintf("gpbackup_%d", contentToRestore))
 	nameParts := strings.Split(name, ".")
 	filename := fmt.Sprintf("%s_%d", nameParts[0], oid)
-	if len(nameParts) > 1 { // We only expect filenames ending in ".gz" or ".zst", but they can contain dots so handle arbitrary numbers of dots
+	if len(nameParts) > 1 { // We only expect filenames ending in a compression extension such as ".gz", but they can contain dots so handle arbitrary numbers of dots
 		prefix := strings.Join(nameParts[0:len(nameParts)-1], ".")
 		suffix := nameParts[len(nameParts)-1]
 		filename = fmt.Sprintf("%s_%d.%s", prefix, oid, suffix)
@@ -380,8 +401,8 @@ func getRestoreDataReader(fileToRead string, objToc *toc.SegmentTOC, oidList []i
 			restoreReader.readerType = NONSEEKABLE
 		}
 	} else {
-		if *isFiltered && !strings.HasSuffix(fileToRead, ".gz") && !strings.HasSuffix(fileToRead, ".zst") {
-			// Seekable reader if backup is not compressed and filters are set
+		if *isFiltered && !utils.HasCompressedFileExtension(fileToRead) && *encryptionKeyFile == "" {
+			// Seekable reader if backup is not compressed or encrypted and filters are set
 			restoreReader.fileHandle, err = os.Open(fileToRead)
 			seekHandle = restoreReader.fileHandle
 			restoreReader.readerType = SEEKABLE
@@ -397,6 +418,14 @@ func getRestoreDataReader(fileToRead string, objToc *toc.SegmentTOC, oidList []i
 		// error logging handled by calling functions
 		return nil, err
 	}
+	if *encryptionKeyFile != "" {
+		// The data was encrypted after it was compressed, so it is decrypted before it is decompressed
+		readHandle, err = newDecryptingReadHandle(readHandle)
+		if err != nil {
+			// error logging handled by calling functions
+			return nil, err
+		}
+	}
 
 	// Set the underlying stream reader in restoreReader
 	if restoreReader.readerType == SEEKABLE {
@@ -415,6 +444,8 @@ func getRestoreDataReader(fileToRead string, objToc *toc.SegmentTOC, oidList []i
 			return nil, err
 		}
 		restoreReader.bufReader = bufio.NewReader(zstdReader)
+	} else if strings.HasSuffix(fileToRead, ".lz4") {
+		restoreReader.bufReader = bufio.NewReader(lz4.NewReader(readHandle))
 	} else {
 		restoreReader.bufReader = bufio.NewReader(readHandle)
 	}
@@ -454,7 +485,7 @@ func startRestorePluginCommand(fileToRead string, objToc *toc.SegmentTOC, oidLis
 		return nil, false, err
 	}
 	cmdStr := ""
-	if objToc != nil && pluginConfig.CanRestoreSubset() && *isFiltered && !strings.HasSuffix(fileToRead, ".gz") && !strings.HasSuffix(fileToRead, ".zst") {
+	if objToc != nil && pluginConfig.CanRestoreSubset() && *isFiltered && !utils.HasCompressedFileExtension(fileToRead) {
 		offsetsFile, _ := ioutil.TempFile("/tmp", "gprestore_offsets_")
 		defer func() {
 			offsetsFile.Close()
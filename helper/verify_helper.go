@@ -0,0 +1,210 @@
+package helper
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * Verify specific functions
+ */
+
+/*
+ * rowCounter counts the rows in a stream of COPY ... WITH CSV output.  A
+ * newline only ends a row if it is not inside a quoted field, and since an
+ * escaped quote in CSV is a doubled quote, toggling on every quote character
+ * is enough to track whether we are inside a quoted field.
+ */
+type rowCounter struct {
+	rows       int64
+	inQuotes   bool
+	bytesInRow int64
+	totalBytes int64
+}
+
+func (r *rowCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		switch {
+		case b == '"':
+			r.inQuotes = !r.inQuotes
+			r.bytesInRow++
+		case b == '\n' && !r.inQuotes:
+			r.rows++
+			r.bytesInRow = 0
+		default:
+			r.bytesInRow++
+		}
+	}
+	r.totalBytes += int64(len(p))
+	return len(p), nil
+}
+
+func (r *rowCounter) hasIncompleteRow() bool {
+	return r.bytesInRow > 0 || r.inQuotes
+}
+
+func checkChecksum(checksum hash.Hash, expectedChecksum string) string {
+	if expectedChecksum == "" {
+		return ""
+	}
+	computedChecksum := formatChecksum(checksum)
+	if computedChecksum != expectedChecksum {
+		return fmt.Sprintf("does not match its checksum: expected %s, computed %s", expectedChecksum, computedChecksum)
+	}
+	return ""
+}
+
+func doVerifyAgent() error {
+	oidList, err := getOidListFromFile(*oidFile)
+	if err != nil {
+		// error logging handled in getOidListFromFile
+		return err
+	}
+
+	var results []utils.DataVerificationResult
+	if *singleDataFile {
+		results = verifySingleDataFile(oidList)
+	} else {
+		results = verifyTableDataFiles(oidList)
+	}
+
+	output, err := yaml.Marshal(results)
+	if err != nil {
+		logError(fmt.Sprintf("Error encountered marshalling verification results: %v", err))
+		return err
+	}
+	fmt.Print(string(output))
+	return nil
+}
+
+func verifyTableDataFiles(oidList []int) []utils.DataVerificationResult {
+	results := make([]utils.DataVerificationResult, 0, len(oidList))
+	for _, oid := range oidList {
+		result := utils.DataVerificationResult{Oid: uint32(oid)}
+		filename := constructSingleTableFilename(*dataFile, *content, oid)
+		if *pluginConfigFile == "" && !utils.FileExists(filename) {
+			logVerbose(fmt.Sprintf("Oid %d: Data file %s is missing", oid, filename))
+			result.Problems = append(result.Problems, fmt.Sprintf("Data file %s is missing", filename))
+			results = append(results, result)
+			continue
+		}
+
+		logVerbose(fmt.Sprintf("Oid %d: Verifying data file %s", oid, filename))
+		reader, err := getRestoreDataReader(filename, nil, nil)
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("Unable to read data file %s: %v", filename, err))
+			results = append(results, result)
+			continue
+		}
+		counter := &rowCounter{}
+		checksum := newChecksum()
+		_, err = io.Copy(io.MultiWriter(counter, checksum), reader.bufReader)
+		if reader.fileHandle != nil {
+			_ = reader.fileHandle.Close()
+		}
+		result.RowCount = counter.rows
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("Data file %s is truncated or corrupt: %v", filename, err))
+		} else if counter.hasIncompleteRow() {
+			result.Problems = append(result.Problems, fmt.Sprintf("Data file %s ends with an incomplete row", filename))
+		} else {
+			expectedChecksum, err := getTableChecksum(*content, oid)
+			if err != nil {
+				result.Problems = append(result.Problems, fmt.Sprintf("Unable to read checksum file %s: %v", constructChecksumFilename(*dataFile, *content), err))
+			} else if problem := checkChecksum(checksum, expectedChecksum); problem != "" {
+				result.Problems = append(result.Problems, fmt.Sprintf("Data file %s %s", filename, problem))
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+/*
+ * In a single data file backup, the segment TOC records the range of bytes in
+ * the uncompressed data stream that belongs to each table.  We read through
+ * the stream in order, the same way the restore agent does, so once one range
+ * is truncated every range after it is unreadable as well.
+ */
+func verifySingleDataFile(oidList []int) []utils.DataVerificationResult {
+	results := make([]utils.DataVerificationResult, 0, len(oidList))
+	failAll := func(oids []int, problem string) []utils.DataVerificationResult {
+		for _, oid := range oids {
+			results = append(results, utils.DataVerificationResult{Oid: uint32(oid), Problems: []string{problem}})
+		}
+		return results
+	}
+
+	if !utils.FileExists(*tocFile) {
+		return failAll(oidList, fmt.Sprintf("Segment table of contents file %s is missing", *tocFile))
+	}
+	segmentTOC := toc.NewSegmentTOC(*tocFile)
+	if *pluginConfigFile == "" && !utils.FileExists(*dataFile) {
+		return failAll(oidList, fmt.Sprintf("Data file %s is missing", *dataFile))
+	}
+
+	entries := make([]int, 0, len(oidList))
+	for _, oid := range oidList {
+		if _, ok := segmentTOC.DataEntries[uint(oid)]; !ok {
+			results = append(results, utils.DataVerificationResult{Oid: uint32(oid),
+				Problems: []string{fmt.Sprintf("No entry found in segment table of contents file %s", *tocFile)}})
+			continue
+		}
+		entries = append(entries, oid)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return segmentTOC.DataEntries[uint(entries[i])].StartByte < segmentTOC.DataEntries[uint(entries[j])].StartByte
+	})
+
+	reader, err := getRestoreDataReader(*dataFile, segmentTOC, entries)
+	if err != nil {
+		return failAll(entries, fmt.Sprintf("Unable to read data file %s: %v", *dataFile, err))
+	}
+	if reader.fileHandle != nil {
+		defer reader.fileHandle.Close()
+	}
+
+	var lastByte uint64
+	var streamErr error
+	for _, oid := range entries {
+		entry := segmentTOC.DataEntries[uint(oid)]
+		result := utils.DataVerificationResult{Oid: uint32(oid)}
+		byteRange := fmt.Sprintf("%d-%d", entry.StartByte, entry.EndByte)
+		if entry.EndByte < entry.StartByte || entry.StartByte < lastByte {
+			result.Problems = append(result.Problems, fmt.Sprintf("Byte range %s in data file %s is invalid", byteRange, *dataFile))
+			results = append(results, result)
+			continue
+		}
+		if streamErr != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("Byte range %s in data file %s could not be read: %v", byteRange, *dataFile, streamErr))
+			results = append(results, result)
+			continue
+		}
+
+		logVerbose(fmt.Sprintf("Oid %d: Verifying byte range %s in data file %s", oid, byteRange, *dataFile))
+		counter := &rowCounter{}
+		checksum := newChecksum()
+		streamErr = reader.positionReader(entry.StartByte-lastByte, oid)
+		if streamErr == nil {
+			_, streamErr = io.CopyN(io.MultiWriter(counter, checksum), reader.bufReader, int64(entry.EndByte-entry.StartByte))
+		}
+		lastByte = entry.StartByte + uint64(counter.totalBytes)
+		result.RowCount = counter.rows
+		if streamErr != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("Byte range %s in data file %s is truncated: read %d of %d bytes: %v",
+				byteRange, *dataFile, counter.totalBytes, entry.EndByte-entry.StartByte, streamErr))
+		} else if counter.hasIncompleteRow() {
+			result.Problems = append(result.Problems, fmt.Sprintf("Byte range %s in data file %s ends with an incomplete row", byteRange, *dataFile))
+		} else if problem := checkChecksum(checksum, entry.Checksum); problem != "" {
+			result.Problems = append(result.Problems, fmt.Sprintf("Byte range %s in data file %s %s", byteRange, *dataFile, problem))
+		}
+		results = append(results, result)
+	}
+	return results
+}
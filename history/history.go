@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
@@ -30,25 +29,34 @@ type BackupConfig struct {
 	BackupVersion         string
 	Compressed            bool
 	CompressionType       string
+	CompressionThreads    int
+	CompressionWindow     int
 	DatabaseName          string
 	DatabaseVersion       string
 	SegmentCount          int
 	DataOnly              bool
 	DateDeleted           string
+	EncryptionKeyID       string
+	ExcludeObjectTypes    []string
 	ExcludeRelations      []string
 	ExcludeSchemaFiltered bool
 	ExcludeSchemas        []string
 	ExcludeTableFiltered  bool
+	IncludeObjectTypes    []string
 	IncludeRelations      []string
 	IncludeSchemaFiltered bool
 	IncludeSchemas        []string
 	IncludeTableFiltered  bool
 	Incremental           bool
 	LeafPartitionData     bool
+	Masked                bool
+	MaskingRules          map[string]map[string]string
 	MetadataOnly          bool
 	Plugin                string
 	PluginVersion         string
 	RestorePlan           []RestorePlanEntry
+	RowFiltered           bool
+	RowFilters            map[string]string
 	SingleDataFile        bool
 	Timestamp             string
 	EndTime               string
@@ -63,7 +71,7 @@ func (backup *BackupConfig) Failed() bool {
 
 func ReadConfigFile(filename string) *BackupConfig {
 	config := &BackupConfig{}
-	contents, err := ioutil.ReadFile(filename)
+	contents, err := utils.ReadBackupFile(filename)
 	gplog.FatalOnError(err)
 	err = yaml.Unmarshal(contents, config)
 	gplog.FatalOnError(err)
@@ -73,7 +81,7 @@ func ReadConfigFile(filename string) *BackupConfig {
 func WriteConfigFile(config *BackupConfig, configFilename string) {
 	configContents, err := yaml.Marshal(config)
 	gplog.FatalOnError(err)
-	_ = utils.WriteToFileAndMakeReadOnly(configFilename, configContents)
+	_ = utils.WriteBackupFileAndMakeReadOnly(configFilename, configContents)
 }
 
 func InitializeHistoryDatabase(historyDBPath string) (*sql.DB, error) {
@@ -140,6 +148,13 @@ func InitializeHistoryDatabase(historyDBPath string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	err = addMissingBackupsColumns(tx)
+	if err != nil {
+		tx.Rollback()
+		db.Close()
+		return nil, err
+	}
+
 	createAuxTableQuery := `
 		CREATE TABLE IF NOT EXISTS %s (
 			timestamp TEXT NOT NULL,
@@ -147,7 +162,8 @@ func InitializeHistoryDatabase(historyDBPath string) (*sql.DB, error) {
 			FOREIGN KEY(timestamp) REFERENCES backups(timestamp)
 		);`
 
-	auxTables := []string{"exclude_relations", "exclude_schemas", "include_relations", "include_schemas"}
+	auxTables := []string{"exclude_relations", "exclude_schemas", "include_relations", "include_schemas",
+		"exclude_object_types", "include_object_types"}
 	for _, auxTable := range auxTables {
 		_, err = tx.Exec(fmt.Sprintf(createAuxTableQuery, auxTable))
 		if err != nil {
@@ -195,6 +211,57 @@ func InitializeHistoryDatabase(historyDBPath string) (*sql.DB, error) {
 	return db, nil
 }
 
+/*
+ * Columns added to the backups table after it was first released.  They are
+ * added to existing history databases when they are opened, so new columns
+ * must have a default that is correct for backups recorded before the column
+ * existed.
+ */
+var addedBackupsColumns = []struct {
+	name       string
+	definition string
+}{
+	{"encryption_key_id", "TEXT NOT NULL DEFAULT ''"},
+	{"compression_threads", "INT NOT NULL DEFAULT 0"},
+	{"compression_window", "INT NOT NULL DEFAULT 0"},
+	{"row_filtered", "INT NOT NULL DEFAULT 0"},
+	{"masked", "INT NOT NULL DEFAULT 0"},
+}
+
+func addMissingBackupsColumns(tx *sql.Tx) error {
+	rows, err := tx.Query("PRAGMA table_info(backups);")
+	if err != nil {
+		return err
+	}
+	existingColumns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue sql.NullString
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		existingColumns[name] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range addedBackupsColumns {
+		if existingColumns[column.name] {
+			continue
+		}
+		_, err = tx.Exec(fmt.Sprintf("ALTER TABLE backups ADD COLUMN %s %s;", column.name, column.definition))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func CurrentTimestamp() string {
 	return operating.System.Now().Format("20060102150405")
 }
@@ -222,9 +289,10 @@ func StoreBackupHistory(db *sql.DB, currentBackupConfig *BackupConfig) error {
 			database_version, segment_count, data_only, date_deleted, exclude_schema_filtered,
 			exclude_table_filtered, include_schema_filtered, include_table_filtered, incremental,
 			leaf_partition_data, metadata_only, plugin, plugin_version, single_data_file, end_time,
-			without_globals, with_statistics, status
+			without_globals, with_statistics, status, encryption_key_id, compression_threads,
+			compression_window, row_filtered, masked
 			)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
 		currentBackupConfig.Timestamp, currentBackupConfig.BackupDir,
 		currentBackupConfig.BackupVersion, currentBackupConfig.Compressed,
 		currentBackupConfig.CompressionType, currentBackupConfig.DatabaseName,
@@ -236,7 +304,10 @@ func StoreBackupHistory(db *sql.DB, currentBackupConfig *BackupConfig) error {
 		currentBackupConfig.MetadataOnly, currentBackupConfig.Plugin,
 		currentBackupConfig.PluginVersion, currentBackupConfig.SingleDataFile,
 		currentBackupConfig.EndTime, currentBackupConfig.WithoutGlobals,
-		currentBackupConfig.WithStatistics, currentBackupConfig.Status)
+		currentBackupConfig.WithStatistics, currentBackupConfig.Status,
+		currentBackupConfig.EncryptionKeyID, currentBackupConfig.CompressionThreads,
+		currentBackupConfig.CompressionWindow, currentBackupConfig.RowFiltered,
+		currentBackupConfig.Masked)
 	if err != nil {
 		goto CleanupError
 	}
@@ -261,6 +332,16 @@ func StoreBackupHistory(db *sql.DB, currentBackupConfig *BackupConfig) error {
 		goto CleanupError
 	}
 
+	err = storeAuxTable(tx, currentBackupConfig.ExcludeObjectTypes, "exclude_object_types", currentBackupConfig.Timestamp)
+	if err != nil {
+		goto CleanupError
+	}
+
+	err = storeAuxTable(tx, currentBackupConfig.IncludeObjectTypes, "include_object_types", currentBackupConfig.Timestamp)
+	if err != nil {
+		goto CleanupError
+	}
+
 	// unpack and store restore plan entries
 	for _, restorePlan := range currentBackupConfig.RestorePlan {
 		_, err = tx.Exec("INSERT INTO restore_plans VALUES (?, ?);",
@@ -296,7 +377,8 @@ func GetMainBackupInfo(timestamp string, historyDB *sql.DB) (BackupConfig, error
 			database_version, segment_count, data_only, date_deleted, exclude_schema_filtered,
 			exclude_table_filtered, include_schema_filtered, include_table_filtered, incremental,
 			leaf_partition_data, metadata_only, plugin, plugin_version, single_data_file, end_time,
-			without_globals, with_statistics, status
+			without_globals, with_statistics, status, encryption_key_id, compression_threads,
+			compression_window, row_filtered, masked
 		FROM backups WHERE timestamp = '%s'`,
 		timestamp)
 	backupRow := historyDB.QueryRow(backupQuery)
@@ -310,7 +392,9 @@ func GetMainBackupInfo(timestamp string, historyDB *sql.DB) (BackupConfig, error
 	var isInclTableFiltered int
 	var isIncremental int
 	var isLeafPartition int
+	var isMasked int
 	var isMetadataOnly int
+	var isRowFiltered int
 	var isSingleDataFile int
 	var isWithoutGlobals int
 	var isWithStatistics int
@@ -321,7 +405,9 @@ func GetMainBackupInfo(timestamp string, historyDB *sql.DB) (BackupConfig, error
 		&backupConfig.DateDeleted, &isExclSchemaFiltered, &isExclTableFiltered,
 		&isInclSchemaFiltered, &isInclTableFiltered, &isIncremental, &isLeafPartition,
 		&isMetadataOnly, &backupConfig.Plugin, &backupConfig.PluginVersion, &isSingleDataFile,
-		&backupConfig.EndTime, &isWithoutGlobals, &isWithStatistics, &backupConfig.Status)
+		&backupConfig.EndTime, &isWithoutGlobals, &isWithStatistics, &backupConfig.Status,
+		&backupConfig.EncryptionKeyID, &backupConfig.CompressionThreads,
+		&backupConfig.CompressionWindow, &isRowFiltered, &isMasked)
 	if err == sql.ErrNoRows {
 		return backupConfig, errors.New("timestamp doesn't match any existing backups")
 	} else if err != nil {
@@ -336,7 +422,9 @@ func GetMainBackupInfo(timestamp string, historyDB *sql.DB) (BackupConfig, error
 	backupConfig.IncludeTableFiltered = isInclTableFiltered == 1
 	backupConfig.Incremental = isIncremental == 1
 	backupConfig.LeafPartitionData = isLeafPartition == 1
+	backupConfig.Masked = isMasked == 1
 	backupConfig.MetadataOnly = isMetadataOnly == 1
+	backupConfig.RowFiltered = isRowFiltered == 1
 	backupConfig.SingleDataFile = isSingleDataFile == 1
 	backupConfig.WithoutGlobals = isWithoutGlobals == 1
 	backupConfig.WithStatistics = isWithStatistics == 1
@@ -392,6 +480,16 @@ func GetBackupConfig(timestamp string, historyDB *sql.DB) (*BackupConfig, error)
 		return nil, err
 	}
 
+	backupConfig.ExcludeObjectTypes, err = getAuxTable(historyDB, timestamp, "exclude_object_types")
+	if err != nil {
+		return nil, err
+	}
+
+	backupConfig.IncludeObjectTypes, err = getAuxTable(historyDB, timestamp, "include_object_types")
+	if err != nil {
+		return nil, err
+	}
+
 	// Retrieve restore plan information
 	restorePlanQuery := fmt.Sprintf("SELECT DISTINCT restore_plan_timestamp FROM restore_plans WHERE timestamp = '%s' ORDER BY restore_plan_timestamp", timestamp)
 	restorePlanRows, err := historyDB.Query(restorePlanQuery)
@@ -434,3 +532,72 @@ func GetBackupConfig(timestamp string, historyDB *sql.DB) (*BackupConfig, error)
 
 	return &backupConfig, err
 }
+
+// Returns the timestamps of all backups recorded in the history database, most recent
+// first.  If status is non-empty, only backups with that status are returned.
+func GetBackupTimestamps(historyDB *sql.DB, status string) ([]string, error) {
+	timestampQuery := "SELECT timestamp FROM backups WHERE (? = '' OR status = ?) ORDER BY timestamp DESC"
+	timestampRows, err := historyDB.Query(timestampQuery, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer timestampRows.Close()
+
+	timestamps := make([]string, 0)
+	for timestampRows.Next() {
+		var timestamp string
+		err = timestampRows.Scan(&timestamp)
+		if err != nil {
+			return nil, err
+		}
+		timestamps = append(timestamps, timestamp)
+	}
+
+	return timestamps, nil
+}
+
+// Returns the timestamps of all backups that have not been deleted and whose restore
+// plan references the given backup, most recent first.  Deleting the given backup
+// would leave these backups unrestorable.
+func GetDependentBackupTimestamps(historyDB *sql.DB, timestamp string) ([]string, error) {
+	dependentQuery := `
+		SELECT DISTINCT r.timestamp
+		FROM restore_plans r
+			JOIN backups b ON r.timestamp = b.timestamp
+		WHERE r.restore_plan_timestamp = ?
+			AND r.timestamp != ?
+			AND coalesce(b.date_deleted, '') = ''
+		ORDER BY r.timestamp DESC`
+	dependentRows, err := historyDB.Query(dependentQuery, timestamp, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	defer dependentRows.Close()
+
+	timestamps := make([]string, 0)
+	for dependentRows.Next() {
+		var dependentTimestamp string
+		err = dependentRows.Scan(&dependentTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		timestamps = append(timestamps, dependentTimestamp)
+	}
+
+	return timestamps, nil
+}
+
+func MarkBackupDeleted(historyDB *sql.DB, timestamp string, dateDeleted string) error {
+	result, err := historyDB.Exec("UPDATE backups SET date_deleted = ? WHERE timestamp = ?", dateDeleted, timestamp)
+	if err != nil {
+		return err
+	}
+	numRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return errors.New("timestamp doesn't match any existing backups")
+	}
+	return nil
+}
@@ -34,22 +34,26 @@ var _ = Describe("backup/history tests", func() {
 
 	BeforeEach(func() {
 		testConfig1 = history.BackupConfig{
-			DatabaseName:     "testdb1",
-			ExcludeRelations: []string{},
-			ExcludeSchemas:   []string{},
-			IncludeRelations: []string{"testschema.testtable1", "testschema.testtable2"},
-			IncludeSchemas:   []string{},
-			RestorePlan:      []history.RestorePlanEntry{},
-			Timestamp:        "timestamp1",
+			DatabaseName:       "testdb1",
+			ExcludeObjectTypes: []string{},
+			ExcludeRelations:   []string{},
+			ExcludeSchemas:     []string{},
+			IncludeObjectTypes: []string{},
+			IncludeRelations:   []string{"testschema.testtable1", "testschema.testtable2"},
+			IncludeSchemas:     []string{},
+			RestorePlan:        []history.RestorePlanEntry{},
+			Timestamp:          "timestamp1",
 		}
 		testConfig2 = history.BackupConfig{
-			DatabaseName:     "testdb1",
-			ExcludeRelations: []string{},
-			ExcludeSchemas:   []string{},
-			IncludeRelations: []string{"testschema.testtable1", "testschema.testtable2"},
-			IncludeSchemas:   []string{},
-			RestorePlan:      []history.RestorePlanEntry{{"timestamp1", []string{"testschema.testtable1"}}, {"timestamp2", []string{"testschema.testtable2"}}},
-			Timestamp:        "timestamp2",
+			DatabaseName:       "testdb1",
+			ExcludeObjectTypes: []string{},
+			ExcludeRelations:   []string{},
+			ExcludeSchemas:     []string{},
+			IncludeObjectTypes: []string{},
+			IncludeRelations:   []string{"testschema.testtable1", "testschema.testtable2"},
+			IncludeSchemas:     []string{},
+			RestorePlan:        []history.RestorePlanEntry{{"timestamp1", []string{"testschema.testtable1"}}, {"timestamp2", []string{"testschema.testtable2"}}},
+			Timestamp:          "timestamp2",
 		}
 		_ = os.Remove(historyDBPath)
 	})
@@ -80,12 +84,14 @@ var _ = Describe("backup/history tests", func() {
 			}
 
 			Expect(tableNames[0]).To(Equal("backups"))
-			Expect(tableNames[1]).To(Equal("exclude_relations"))
-			Expect(tableNames[2]).To(Equal("exclude_schemas"))
-			Expect(tableNames[3]).To(Equal("include_relations"))
-			Expect(tableNames[4]).To(Equal("include_schemas"))
-			Expect(tableNames[5]).To(Equal("restore_plan_tables"))
-			Expect(tableNames[6]).To(Equal("restore_plans"))
+			Expect(tableNames[1]).To(Equal("exclude_object_types"))
+			Expect(tableNames[2]).To(Equal("exclude_relations"))
+			Expect(tableNames[3]).To(Equal("exclude_schemas"))
+			Expect(tableNames[4]).To(Equal("include_object_types"))
+			Expect(tableNames[5]).To(Equal("include_relations"))
+			Expect(tableNames[6]).To(Equal("include_schemas"))
+			Expect(tableNames[7]).To(Equal("restore_plan_tables"))
+			Expect(tableNames[8]).To(Equal("restore_plans"))
 
 		})
 
@@ -104,6 +110,23 @@ var _ = Describe("backup/history tests", func() {
 			Expect(tableName).To(Equal("dummy"))
 
 		})
+
+		It("adds columns missing from a database created by an older version", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			_, err := db.Exec("ALTER TABLE backups DROP COLUMN encryption_key_id;")
+			Expect(err).To(BeNil())
+			_, err = db.Exec("INSERT INTO backups (timestamp) VALUES ('timestamp0');")
+			Expect(err).To(BeNil())
+			db.Close()
+
+			sameDB, err := history.InitializeHistoryDatabase(historyDBPath)
+			Expect(err).To(BeNil())
+			defer sameDB.Close()
+			var encryptionKeyID string
+			err = sameDB.QueryRow("SELECT encryption_key_id FROM backups WHERE timestamp = 'timestamp0';").Scan(&encryptionKeyID)
+			Expect(err).To(BeNil())
+			Expect(encryptionKeyID).To(Equal(""))
+		})
 	})
 
 	Describe("StoreBackupHistory", func() {
@@ -158,6 +181,64 @@ var _ = Describe("backup/history tests", func() {
 			Expect(err).To(BeNil())
 			Expect(config).To(structmatcher.MatchStruct(testConfig1))
 		})
+		It("gets the ID of the key an encrypted backup was encrypted with", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			testConfig1.EncryptionKeyID = "0123456789abcdef"
+			err := history.StoreBackupHistory(db, &testConfig1)
+			Expect(err).To(BeNil())
+
+			config, err := history.GetBackupConfig(testConfig1.Timestamp, db)
+			Expect(err).To(BeNil())
+			Expect(config.EncryptionKeyID).To(Equal("0123456789abcdef"))
+		})
+		It("gets the compression settings a backup was taken with", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			testConfig1.CompressionThreads = 8
+			testConfig1.CompressionWindow = 27
+			err := history.StoreBackupHistory(db, &testConfig1)
+			Expect(err).To(BeNil())
+
+			config, err := history.GetBackupConfig(testConfig1.Timestamp, db)
+			Expect(err).To(BeNil())
+			Expect(config.CompressionThreads).To(Equal(8))
+			Expect(config.CompressionWindow).To(Equal(27))
+		})
+		It("gets whether the table data of a backup was filtered", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			testConfig1.RowFiltered = true
+			err := history.StoreBackupHistory(db, &testConfig1)
+			Expect(err).To(BeNil())
+
+			config, err := history.GetBackupConfig(testConfig1.Timestamp, db)
+			Expect(err).To(BeNil())
+			Expect(config.RowFiltered).To(BeTrue())
+		})
+		It("gets whether the table data of a backup was masked", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			testConfig1.Masked = true
+			err := history.StoreBackupHistory(db, &testConfig1)
+			Expect(err).To(BeNil())
+
+			config, err := history.GetBackupConfig(testConfig1.Timestamp, db)
+			Expect(err).To(BeNil())
+			Expect(config.Masked).To(BeTrue())
+		})
+		It("gets the object types a backup was filtered on", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			testConfig1.ExcludeObjectTypes = []string{"TRIGGER", "RULE"}
+			err := history.StoreBackupHistory(db, &testConfig1)
+			Expect(err).To(BeNil())
+
+			config, err := history.GetBackupConfig(testConfig1.Timestamp, db)
+			Expect(err).To(BeNil())
+			Expect(config.ExcludeObjectTypes).To(Equal([]string{"TRIGGER", "RULE"}))
+			Expect(config.IncludeObjectTypes).To(BeEmpty())
+		})
 
 		It("refuses to get a config from the database if the timestamp is not present", func() {
 			db, _ := history.InitializeHistoryDatabase(historyDBPath)
@@ -182,4 +263,85 @@ var _ = Describe("backup/history tests", func() {
 			Expect(config).To(structmatcher.MatchStruct(testConfig2))
 		})
 	})
+	Describe("GetBackupTimestamps", func() {
+		It("gets all timestamps from the database in descending order", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			err := history.StoreBackupHistory(db, &testConfig1)
+			Expect(err).To(BeNil())
+			err = history.StoreBackupHistory(db, &testConfig2)
+			Expect(err).To(BeNil())
+
+			timestamps, err := history.GetBackupTimestamps(db, "")
+			Expect(err).To(BeNil())
+			Expect(timestamps).To(Equal([]string{"timestamp2", "timestamp1"}))
+		})
+		It("gets only the timestamps of backups with the given status", func() {
+			testConfig1.Status = history.BackupStatusSucceed
+			testConfig2.Status = history.BackupStatusFailed
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			err := history.StoreBackupHistory(db, &testConfig1)
+			Expect(err).To(BeNil())
+			err = history.StoreBackupHistory(db, &testConfig2)
+			Expect(err).To(BeNil())
+
+			timestamps, err := history.GetBackupTimestamps(db, history.BackupStatusFailed)
+			Expect(err).To(BeNil())
+			Expect(timestamps).To(Equal([]string{"timestamp2"}))
+		})
+	})
+	Describe("GetDependentBackupTimestamps", func() {
+		It("gets the timestamps of backups whose restore plan references the given backup", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			err := history.StoreBackupHistory(db, &testConfig1)
+			Expect(err).To(BeNil())
+			err = history.StoreBackupHistory(db, &testConfig2)
+			Expect(err).To(BeNil())
+
+			timestamps, err := history.GetDependentBackupTimestamps(db, "timestamp1")
+			Expect(err).To(BeNil())
+			Expect(timestamps).To(Equal([]string{"timestamp2"}))
+
+			timestamps, err = history.GetDependentBackupTimestamps(db, "timestamp2")
+			Expect(err).To(BeNil())
+			Expect(timestamps).To(BeEmpty())
+		})
+		It("does not return backups that have already been deleted", func() {
+			testConfig2.DateDeleted = "20220101010101"
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			err := history.StoreBackupHistory(db, &testConfig1)
+			Expect(err).To(BeNil())
+			err = history.StoreBackupHistory(db, &testConfig2)
+			Expect(err).To(BeNil())
+
+			timestamps, err := history.GetDependentBackupTimestamps(db, "timestamp1")
+			Expect(err).To(BeNil())
+			Expect(timestamps).To(BeEmpty())
+		})
+	})
+	Describe("MarkBackupDeleted", func() {
+		It("records the deletion date of a backup", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			err := history.StoreBackupHistory(db, &testConfig1)
+			Expect(err).To(BeNil())
+
+			err = history.MarkBackupDeleted(db, "timestamp1", "20220101010101")
+			Expect(err).To(BeNil())
+
+			config, err := history.GetBackupConfig("timestamp1", db)
+			Expect(err).To(BeNil())
+			Expect(config.DateDeleted).To(Equal("20220101010101"))
+		})
+		It("returns an error if the timestamp is not present", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+
+			err := history.MarkBackupDeleted(db, "timestampDNE", "20220101010101")
+			Expect(err.Error()).To(Equal("timestamp doesn't match any existing backups"))
+		})
+	})
 })
@@ -263,6 +263,32 @@ options:
 			Expect(err).ToNot(HaveOccurred())
 			assertNoErrors()
 		})
+		It("reports an error when the checksum of a table's data does not match", func() {
+			setupRestoreFiles("", false)
+			f, _ := os.Create(tocFile)
+			_, _ = f.WriteString(`dataentries:
+  1:
+    startbyte: 0
+    endbyte: 18
+    checksum: "0000"
+  3:
+    startbyte: 36
+    endbyte: 54
+`)
+			_ = f.Close()
+			helperCmd := gpbackupHelperRestore(gpbackupHelperPath, "--data-file", dataFileFullPath)
+			contents, _ := ioutil.ReadFile(fmt.Sprintf("%s_%d_0", pipeFile, 1))
+			Expect(string(contents)).To(HavePrefix("here is some data\n"))
+
+			err := helperCmd.Wait()
+
+			Expect(err).To(HaveOccurred())
+			assertErrorsHandled()
+			homeDir := os.Getenv("HOME")
+			helperFiles, _ := filepath.Glob(filepath.Join(homeDir, "gpAdminLogs/gpbackup_helper_*"))
+			helperLog, _ := ioutil.ReadFile(helperFiles[len(helperFiles)-1])
+			Expect(string(helperLog)).To(ContainSubstring("Checksum mismatch for oid 1: expected 0000"))
+		})
 		It("Generates error file when restore agent interrupted", FlakeAttempts(5), func() {
 			setupRestoreFiles("gzip", false)
 			helperCmd := gpbackupHelperRestore(gpbackupHelperPath, "--data-file", dataFileFullPath+".gz", "--single-data-file")
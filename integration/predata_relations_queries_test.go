@@ -191,6 +191,52 @@ PARTITION BY LIST (gender)
 			structmatcher.ExpectStructsToMatchIncluding(&tableFoo, &tables[0], "Name", "Schema")
 		})
 	})
+	Describe("GetTableDataSizes", func() {
+		It("returns the size of the data of each table", func() {
+			testhelper.AssertQueryRuns(connectionPool, "CREATE TABLE public.empty(i int) DISTRIBUTED BY (i)")
+			defer testhelper.AssertQueryRuns(connectionPool, "DROP TABLE public.empty")
+			testhelper.AssertQueryRuns(connectionPool, "CREATE TABLE public.full(i int) DISTRIBUTED BY (i)")
+			defer testhelper.AssertQueryRuns(connectionPool, "DROP TABLE public.full")
+			testhelper.AssertQueryRuns(connectionPool, "INSERT INTO public.full SELECT generate_series(1, 10000)")
+			emptyOid := testutils.OidFromObjectName(connectionPool, "public", "empty", backup.TYPE_RELATION)
+			fullOid := testutils.OidFromObjectName(connectionPool, "public", "full", backup.TYPE_RELATION)
+			tables := []backup.Table{
+				{Relation: backup.Relation{Oid: emptyOid, Schema: "public", Name: "empty"}},
+				{Relation: backup.Relation{Oid: fullOid, Schema: "public", Name: "full"}},
+			}
+
+			sizes := backup.GetTableDataSizes(connectionPool, tables)
+
+			Expect(sizes).To(HaveLen(2))
+			Expect(sizes[emptyOid]).To(Equal(int64(0)))
+			Expect(sizes[fullOid]).To(BeNumerically(">", 0))
+		})
+		It("includes the sizes of the leaf partitions at every level of a partitioned table", func() {
+			if connectionPool.Version.AtLeast("7") {
+				Skip("test only applicable to GPDB 6 and earlier")
+			}
+			testhelper.AssertQueryRuns(connectionPool, `CREATE TABLE public.part_table (id int, year int, region text) DISTRIBUTED BY (id)
+PARTITION BY RANGE (year)
+SUBPARTITION BY LIST (region)
+SUBPARTITION TEMPLATE
+(SUBPARTITION usa VALUES ('usa'),
+SUBPARTITION eur VALUES ('eur'))
+(START (2022) END (2024) EVERY (1))`)
+			defer testhelper.AssertQueryRuns(connectionPool, "DROP TABLE public.part_table")
+			testhelper.AssertQueryRuns(connectionPool, "INSERT INTO public.part_table SELECT i, 2022 + i % 2, CASE WHEN i % 3 = 0 THEN 'usa' ELSE 'eur' END FROM generate_series(1, 10000) i")
+			rootOid := testutils.OidFromObjectName(connectionPool, "public", "part_table", backup.TYPE_RELATION)
+			tables := []backup.Table{{Relation: backup.Relation{Oid: rootOid, Schema: "public", Name: "part_table"}}}
+			leafSize := dbconn.MustSelectString(connectionPool, `SELECT sum(pg_relation_size(quote_ident(partitionschemaname) || '.' || quote_ident(partitiontablename)))::text AS string
+FROM pg_partitions
+WHERE schemaname = 'public' AND tablename = 'part_table' AND partitionlevel = 1`)
+
+			sizes := backup.GetTableDataSizes(connectionPool, tables)
+
+			Expect(sizes).To(HaveLen(1))
+			Expect(sizes[rootOid]).To(BeNumerically(">", 0))
+			Expect(strconv.FormatInt(sizes[rootOid], 10)).To(Equal(leafSize))
+		})
+	})
 	Describe("GetAllSequenceRelations", func() {
 		It("returns a slice of all sequences", func() {
 			testhelper.AssertQueryRuns(connectionPool, "CREATE SEQUENCE public.my_sequence START 10")
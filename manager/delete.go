@@ -0,0 +1,264 @@
+package manager
+
+/*
+ * This file contains functions for deleting backups and enforcing retention
+ * policies using the history database.
+ */
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewDeleteCommand() *cobra.Command {
+	deleteCmd := &cobra.Command{
+		Use:   "delete <timestamp>",
+		Short: "Delete a backup from the coordinator and all segments and mark it as deleted in the backup history database",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			DoDelete(cmd.Flags(), args[0])
+		}}
+	deleteCmd.Flags().Bool(options.CASCADE, false, "Also delete any incremental backups that depend on the specified backup")
+	deleteCmd.Flags().String(options.PLUGIN_CONFIG, "", "The configuration file to use for deleting backups taken with a plugin")
+	return deleteCmd
+}
+
+func NewPruneCommand() *cobra.Command {
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete all backups that fall outside of the specified retention policy",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			DoPrune(cmd.Flags())
+		}}
+	pruneCmd.Flags().Int(options.KEEP_LAST, 0, "Keep the specified number of most recent successful backups")
+	pruneCmd.Flags().Int(options.KEEP_DAYS, 0, "Keep all backups taken within the specified number of days")
+	pruneCmd.Flags().Bool(options.DRY_RUN, false, "Print the backups that would be deleted without deleting them")
+	pruneCmd.Flags().String(options.PLUGIN_CONFIG, "", "The configuration file to use for deleting backups taken with a plugin")
+	return pruneCmd
+}
+
+func DoDelete(flags *pflag.FlagSet, timestamp string) {
+	SetLoggerVerbosity(flags)
+	if !filepath.IsValidTimestamp(timestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", timestamp), "")
+	}
+
+	historyDB := OpenHistoryDB(GetHistoryDBPath(flags))
+	defer historyDB.Close()
+
+	backupsToDelete, err := GetBackupsToDelete(historyDB, timestamp, options.MustGetFlagBool(flags, options.CASCADE))
+	gplog.FatalOnError(err)
+
+	globalCluster := InitializeCluster()
+	pluginConfig := InitializePluginConfig(globalCluster, options.MustGetFlagString(flags, options.PLUGIN_CONFIG))
+	if pluginConfig != nil {
+		defer pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
+	}
+	for _, backupConfig := range backupsToDelete {
+		err = DeleteBackup(globalCluster, historyDB, backupConfig, pluginConfig)
+		gplog.FatalOnError(err)
+	}
+}
+
+func DoPrune(flags *pflag.FlagSet) {
+	SetLoggerVerbosity(flags)
+	keepLast := options.MustGetFlagInt(flags, options.KEEP_LAST)
+	keepDays := options.MustGetFlagInt(flags, options.KEEP_DAYS)
+	gplog.FatalOnError(ValidateRetentionPolicy(keepLast, keepDays))
+
+	historyDB := OpenHistoryDB(GetHistoryDBPath(flags))
+	defer historyDB.Close()
+
+	backupConfigs, err := GetBackupConfigs(historyDB, "")
+	gplog.FatalOnError(err)
+	backupsToPrune := GetBackupsToPrune(backupConfigs, keepLast, keepDays, operating.System.Now())
+	if len(backupsToPrune) == 0 {
+		gplog.Info("No backups fall outside of the retention policy")
+		return
+	}
+
+	if options.MustGetFlagBool(flags, options.DRY_RUN) {
+		for _, backupConfig := range backupsToPrune {
+			gplog.Info("Backup %s would be deleted", backupConfig.Timestamp)
+		}
+		return
+	}
+
+	globalCluster := InitializeCluster()
+	pluginConfig := InitializePluginConfig(globalCluster, options.MustGetFlagString(flags, options.PLUGIN_CONFIG))
+	if pluginConfig != nil {
+		defer pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
+	}
+	numPruned := 0
+	for _, backupConfig := range backupsToPrune {
+		if backupConfig.Plugin != "" && pluginConfig == nil {
+			gplog.Warn("Skipping backup %s, which was taken using plugin %s. Specify the plugin config using the --%s flag to delete it.",
+				backupConfig.Timestamp, backupConfig.Plugin, options.PLUGIN_CONFIG)
+			continue
+		}
+		err = DeleteBackup(globalCluster, historyDB, backupConfig, pluginConfig)
+		gplog.FatalOnError(err)
+		numPruned++
+	}
+	gplog.Info("Pruned %d backup(s)", numPruned)
+}
+
+func ValidateRetentionPolicy(keepLast int, keepDays int) error {
+	if keepLast < 0 || keepDays < 0 {
+		return errors.Errorf("--%s and --%s must not be negative", options.KEEP_LAST, options.KEEP_DAYS)
+	}
+	if keepLast == 0 && keepDays == 0 {
+		return errors.Errorf("At least one of --%s or --%s must be specified", options.KEEP_LAST, options.KEEP_DAYS)
+	}
+	return nil
+}
+
+/*
+ * Returns the backups that must be deleted in order to delete the backup with
+ * the given timestamp, in the order in which they should be deleted.  Any
+ * incremental backup whose restore plan references the given backup depends
+ * on it, so we refuse to delete it unless cascade is set, in which case the
+ * dependent backups are deleted first.
+ */
+func GetBackupsToDelete(historyDB *sql.DB, timestamp string, cascade bool) ([]*history.BackupConfig, error) {
+	backupConfig, err := history.GetBackupConfig(timestamp, historyDB)
+	if err != nil {
+		return nil, err
+	}
+	if backupConfig.DateDeleted != "" {
+		return nil, errors.Errorf("Backup %s was already deleted on %s", timestamp, backupConfig.DateDeleted)
+	}
+
+	dependentTimestamps, err := history.GetDependentBackupTimestamps(historyDB, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if len(dependentTimestamps) > 0 && !cascade {
+		return nil, errors.Errorf("Backup %s cannot be deleted because the following backups depend on it: %s. Use --%s to delete them as well.",
+			timestamp, strings.Join(dependentTimestamps, ", "), options.CASCADE)
+	}
+
+	backupsToDelete := make([]*history.BackupConfig, 0, len(dependentTimestamps)+1)
+	for _, dependentTimestamp := range dependentTimestamps {
+		dependentConfig, err := history.GetBackupConfig(dependentTimestamp, historyDB)
+		if err != nil {
+			return nil, err
+		}
+		backupsToDelete = append(backupsToDelete, dependentConfig)
+	}
+	backupsToDelete = append(backupsToDelete, backupConfig)
+
+	for _, toDelete := range backupsToDelete {
+		if toDelete.Status == history.BackupStatusInProgress {
+			return nil, errors.Errorf("Backup %s is still in progress and cannot be deleted", toDelete.Timestamp)
+		}
+	}
+	return backupsToDelete, nil
+}
+
+/*
+ * Returns the backups that fall outside of the retention policy, most recent
+ * first.  A backup is kept if it is one of the keepLast most recent successful
+ * backups or was taken within the last keepDays days; every backup in the
+ * restore plan of a kept backup is kept as well, so that pruning never breaks
+ * an incremental chain.  Backups that are still in progress are always kept.
+ * backupConfigs is expected to be sorted most recent first.
+ */
+func GetBackupsToPrune(backupConfigs []*history.BackupConfig, keepLast int, keepDays int, now time.Time) []*history.BackupConfig {
+	cutoff := now.AddDate(0, 0, -keepDays)
+	keptBackups := make(map[string]bool)
+	numSuccessful := 0
+	for _, backupConfig := range backupConfigs {
+		if backupConfig.DateDeleted != "" {
+			continue
+		}
+		keep := backupConfig.Status == history.BackupStatusInProgress
+		if backupConfig.Status == history.BackupStatusSucceed && numSuccessful < keepLast {
+			numSuccessful++
+			keep = true
+		}
+		if keepDays > 0 {
+			backupTime, err := time.ParseInLocation("20060102150405", backupConfig.Timestamp, now.Location())
+			if err == nil && !backupTime.Before(cutoff) {
+				keep = true
+			}
+		}
+		if keep || keptBackups[backupConfig.Timestamp] {
+			keptBackups[backupConfig.Timestamp] = true
+			for _, restorePlanEntry := range backupConfig.RestorePlan {
+				keptBackups[restorePlanEntry.Timestamp] = true
+			}
+		}
+	}
+
+	backupsToPrune := make([]*history.BackupConfig, 0)
+	for _, backupConfig := range backupConfigs {
+		if backupConfig.DateDeleted == "" && !keptBackups[backupConfig.Timestamp] {
+			backupsToPrune = append(backupsToPrune, backupConfig)
+		}
+	}
+	return backupsToPrune
+}
+
+/*
+ * Backups taken with a plugin are deleted from remote storage first, after
+ * which any files left behind in the local backup directories are removed.
+ */
+func DeleteBackup(c *cluster.Cluster, historyDB *sql.DB, backupConfig *history.BackupConfig, pluginConfig *utils.PluginConfig) error {
+	gplog.Info("Deleting backup %s", backupConfig.Timestamp)
+	if backupConfig.Plugin != "" {
+		err := DeletePluginBackup(pluginConfig, backupConfig)
+		if err != nil {
+			return err
+		}
+	}
+	segPrefix, singleBackupDir, err := filepath.ParseSegPrefix(backupConfig.BackupDir, backupConfig.Timestamp)
+	if _, ok := err.(filepath.BackupDirMissingError); ok {
+		/*
+		 * A failed or partially deleted backup may have no backup directory left
+		 * on the coordinator, from which the directory layout would be parsed, so
+		 * the segment directories of either layout are deleted instead.
+		 */
+		gplog.Info("Backup directory for backup %s no longer exists on the coordinator, so deleting any backup files left on the segments", backupConfig.Timestamp)
+		segPrefix = filepath.GetSegPrefixFromDataDir(c.GetDirForContent(-1))
+		DeleteBackupDirectories(c, filepath.NewFilePathInfo(c, backupConfig.BackupDir, backupConfig.Timestamp, segPrefix, false))
+		DeleteBackupDirectories(c, filepath.NewFilePathInfo(c, backupConfig.BackupDir, backupConfig.Timestamp, "", true))
+	} else if err != nil {
+		return err
+	} else {
+		fpInfo := filepath.NewFilePathInfo(c, backupConfig.BackupDir, backupConfig.Timestamp, segPrefix, singleBackupDir)
+		DeleteBackupDirectories(c, fpInfo)
+	}
+
+	return history.MarkBackupDeleted(historyDB, backupConfig.Timestamp, history.CurrentTimestamp())
+}
+
+func DeleteBackupDirectories(c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
+	scope := cluster.ON_SEGMENTS | cluster.INCLUDE_COORDINATOR
+	if fpInfo.SingleBackupDir {
+		// Every segment on a host shares the same backup directory
+		scope = cluster.ON_HOSTS | cluster.INCLUDE_COORDINATOR
+	}
+	remoteOutput := c.GenerateAndExecuteCommand(fmt.Sprintf("Deleting backup directories for backup %s", fpInfo.Timestamp), scope, func(contentID int) string {
+		return fmt.Sprintf("rm -rf %s", fpInfo.GetDirForContent(contentID))
+	})
+	c.CheckClusterError(remoteOutput, fmt.Sprintf("Unable to delete backup directories for backup %s", fpInfo.Timestamp), func(contentID int) string {
+		return fmt.Sprintf("Unable to delete backup directory %s", fpInfo.GetDirForContent(contentID))
+	})
+}
@@ -0,0 +1,262 @@
+package manager_test
+
+import (
+	"os"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/manager"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("manager/delete tests", func() {
+	var historyDBPath = "/tmp/manager_delete_db.db"
+
+	newBackup := func(timestamp string, status string, restorePlanTimestamps ...string) *history.BackupConfig {
+		restorePlan := []history.RestorePlanEntry{}
+		for _, planTimestamp := range restorePlanTimestamps {
+			restorePlan = append(restorePlan, history.RestorePlanEntry{Timestamp: planTimestamp, TableFQNs: []string{}})
+		}
+		return &history.BackupConfig{
+			DatabaseName:     "testdb",
+			ExcludeRelations: []string{},
+			ExcludeSchemas:   []string{},
+			IncludeRelations: []string{},
+			IncludeSchemas:   []string{},
+			Incremental:      len(restorePlanTimestamps) > 1,
+			RestorePlan:      restorePlan,
+			Timestamp:        timestamp,
+			EndTime:          timestamp,
+			Status:           status,
+		}
+	}
+
+	BeforeEach(func() {
+		_ = os.Remove(historyDBPath)
+	})
+	AfterEach(func() {
+		_ = os.Remove(historyDBPath)
+	})
+
+	Describe("ValidateRetentionPolicy", func() {
+		It("requires at least one retention flag", func() {
+			err := manager.ValidateRetentionPolicy(0, 0)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("At least one of --keep-last or --keep-days must be specified"))
+		})
+		It("rejects negative values", func() {
+			Expect(manager.ValidateRetentionPolicy(-1, 2)).ToNot(Succeed())
+		})
+		It("accepts either retention flag", func() {
+			Expect(manager.ValidateRetentionPolicy(3, 0)).To(Succeed())
+			Expect(manager.ValidateRetentionPolicy(0, 7)).To(Succeed())
+		})
+	})
+	Describe("GetBackupsToDelete", func() {
+		var db interface{ Close() error }
+		var full, incr1, incr2 *history.BackupConfig
+		BeforeEach(func() {
+			full = newBackup("20220101000000", history.BackupStatusSucceed, "20220101000000")
+			incr1 = newBackup("20220102000000", history.BackupStatusSucceed, "20220101000000", "20220102000000")
+			incr2 = newBackup("20220103000000", history.BackupStatusSucceed, "20220101000000", "20220102000000", "20220103000000")
+		})
+		AfterEach(func() {
+			if db != nil {
+				db.Close()
+			}
+		})
+		It("returns only the backup itself if nothing depends on it", func() {
+			historyDB, _ := history.InitializeHistoryDatabase(historyDBPath)
+			db = historyDB
+			Expect(history.StoreBackupHistory(historyDB, full)).To(Succeed())
+			Expect(history.StoreBackupHistory(historyDB, incr1)).To(Succeed())
+
+			backups, err := manager.GetBackupsToDelete(historyDB, "20220102000000", false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backups).To(HaveLen(1))
+			Expect(backups[0].Timestamp).To(Equal("20220102000000"))
+		})
+		It("refuses to delete a backup that incremental backups depend on", func() {
+			historyDB, _ := history.InitializeHistoryDatabase(historyDBPath)
+			db = historyDB
+			Expect(history.StoreBackupHistory(historyDB, full)).To(Succeed())
+			Expect(history.StoreBackupHistory(historyDB, incr1)).To(Succeed())
+			Expect(history.StoreBackupHistory(historyDB, incr2)).To(Succeed())
+
+			_, err := manager.GetBackupsToDelete(historyDB, "20220101000000", false)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Backup 20220101000000 cannot be deleted because the following backups depend on it: 20220103000000, 20220102000000. Use --cascade to delete them as well."))
+		})
+		It("returns dependent backups first when cascade is set", func() {
+			historyDB, _ := history.InitializeHistoryDatabase(historyDBPath)
+			db = historyDB
+			Expect(history.StoreBackupHistory(historyDB, full)).To(Succeed())
+			Expect(history.StoreBackupHistory(historyDB, incr1)).To(Succeed())
+			Expect(history.StoreBackupHistory(historyDB, incr2)).To(Succeed())
+
+			backups, err := manager.GetBackupsToDelete(historyDB, "20220101000000", true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backups).To(HaveLen(3))
+			Expect(backups[0].Timestamp).To(Equal("20220103000000"))
+			Expect(backups[1].Timestamp).To(Equal("20220102000000"))
+			Expect(backups[2].Timestamp).To(Equal("20220101000000"))
+		})
+		It("ignores dependent backups that were already deleted", func() {
+			historyDB, _ := history.InitializeHistoryDatabase(historyDBPath)
+			db = historyDB
+			incr1.DateDeleted = "20220105000000"
+			Expect(history.StoreBackupHistory(historyDB, full)).To(Succeed())
+			Expect(history.StoreBackupHistory(historyDB, incr1)).To(Succeed())
+
+			backups, err := manager.GetBackupsToDelete(historyDB, "20220101000000", false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backups).To(HaveLen(1))
+		})
+		It("refuses to delete a backup that was already deleted", func() {
+			historyDB, _ := history.InitializeHistoryDatabase(historyDBPath)
+			db = historyDB
+			full.DateDeleted = "20220105000000"
+			Expect(history.StoreBackupHistory(historyDB, full)).To(Succeed())
+
+			_, err := manager.GetBackupsToDelete(historyDB, "20220101000000", false)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Backup 20220101000000 was already deleted on 20220105000000"))
+		})
+		It("refuses to delete a backup that is in progress", func() {
+			historyDB, _ := history.InitializeHistoryDatabase(historyDBPath)
+			db = historyDB
+			full.Status = history.BackupStatusInProgress
+			Expect(history.StoreBackupHistory(historyDB, full)).To(Succeed())
+
+			_, err := manager.GetBackupsToDelete(historyDB, "20220101000000", false)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Backup 20220101000000 is still in progress and cannot be deleted"))
+		})
+	})
+	Describe("GetBackupsToPrune", func() {
+		now := time.Date(2022, time.January, 10, 0, 0, 0, 0, time.Local)
+		timestamps := func(backups []*history.BackupConfig) []string {
+			result := make([]string, 0)
+			for _, backup := range backups {
+				result = append(result, backup.Timestamp)
+			}
+			return result
+		}
+
+		It("keeps the most recent successful backups", func() {
+			backups := []*history.BackupConfig{
+				newBackup("20220104000000", history.BackupStatusSucceed, "20220104000000"),
+				newBackup("20220103000000", history.BackupStatusFailed, "20220103000000"),
+				newBackup("20220102000000", history.BackupStatusSucceed, "20220102000000"),
+				newBackup("20220101000000", history.BackupStatusSucceed, "20220101000000"),
+			}
+			Expect(timestamps(manager.GetBackupsToPrune(backups, 2, 0, now))).To(Equal([]string{"20220103000000", "20220101000000"}))
+		})
+		It("keeps backups taken within the retention window", func() {
+			backups := []*history.BackupConfig{
+				newBackup("20220109000000", history.BackupStatusFailed, "20220109000000"),
+				newBackup("20220108000000", history.BackupStatusSucceed, "20220108000000"),
+				newBackup("20220101000000", history.BackupStatusSucceed, "20220101000000"),
+			}
+			Expect(timestamps(manager.GetBackupsToPrune(backups, 0, 3, now))).To(Equal([]string{"20220101000000"}))
+		})
+		It("keeps every backup in the restore plan of a kept backup", func() {
+			backups := []*history.BackupConfig{
+				newBackup("20220103000000", history.BackupStatusSucceed, "20220101000000", "20220102000000", "20220103000000"),
+				newBackup("20220102000000", history.BackupStatusSucceed, "20220101000000", "20220102000000"),
+				newBackup("20220101000000", history.BackupStatusSucceed, "20220101000000"),
+				newBackup("20211201000000", history.BackupStatusSucceed, "20211201000000"),
+			}
+			Expect(timestamps(manager.GetBackupsToPrune(backups, 1, 0, now))).To(Equal([]string{"20211201000000"}))
+		})
+		It("never prunes deleted or in-progress backups", func() {
+			deleted := newBackup("20220102000000", history.BackupStatusSucceed, "20220102000000")
+			deleted.DateDeleted = "20220105000000"
+			backups := []*history.BackupConfig{
+				newBackup("20220104000000", history.BackupStatusSucceed, "20220104000000"),
+				newBackup("20220103000000", history.BackupStatusInProgress, "20220103000000"),
+				deleted,
+				newBackup("20220101000000", history.BackupStatusSucceed, "20220101000000"),
+			}
+			Expect(timestamps(manager.GetBackupsToPrune(backups, 1, 0, now))).To(Equal([]string{"20220101000000"}))
+		})
+	})
+	Describe("DeleteBackupDirectories", func() {
+		var testCluster *cluster.Cluster
+		var testExecutor *testhelper.TestExecutor
+		BeforeEach(func() {
+			coordinatorSeg := cluster.SegConfig{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"}
+			localSegOne := cluster.SegConfig{ContentID: 0, Hostname: "localhost", DataDir: "/data/gpseg0"}
+			remoteSegOne := cluster.SegConfig{ContentID: 1, Hostname: "remotehost1", DataDir: "/data/gpseg1"}
+			testExecutor = &testhelper.TestExecutor{}
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{}
+			testCluster = cluster.NewCluster([]cluster.SegConfig{coordinatorSeg, localSegOne, remoteSegOne})
+			testCluster.Executor = testExecutor
+		})
+		It("removes the backup directory on the coordinator and every segment", func() {
+			fpInfo := filepath.NewFilePathInfo(testCluster, "", "20220101000000", "", false)
+			manager.DeleteBackupDirectories(testCluster, fpInfo)
+
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc).To(HaveLen(3))
+			Expect(cc[0].CommandString).To(ContainSubstring("rm -rf /data/gpseg-1/backups/20220101/20220101000000"))
+			Expect(cc[1].CommandString).To(ContainSubstring("rm -rf /data/gpseg0/backups/20220101/20220101000000"))
+			Expect(cc[2].CommandString).To(ContainSubstring("rm -rf /data/gpseg1/backups/20220101/20220101000000"))
+		})
+	})
+	Describe("DeleteBackup", func() {
+		It("deletes the segment directories of a backup whose coordinator backup directory no longer exists", func() {
+			testExecutor := &testhelper.TestExecutor{ClusterOutput: &cluster.RemoteOutput{}}
+			testCluster := cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"},
+				{ContentID: 0, Hostname: "remotehost1", DataDir: "/data/gpseg0"},
+			})
+			testCluster.Executor = testExecutor
+			historyDB, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer historyDB.Close()
+			backup := newBackup("20220101000000", history.BackupStatusFailed, "20220101000000")
+			backup.BackupDir = "/tmp/manager_delete_missing_backup_dir"
+			Expect(history.StoreBackupHistory(historyDB, backup)).To(Succeed())
+
+			err := manager.DeleteBackup(testCluster, historyDB, backup, nil)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testExecutor.NumExecutions).To(Equal(2))
+			Expect(testExecutor.ClusterCommands[0][1].CommandString).To(ContainSubstring("rm -rf /tmp/manager_delete_missing_backup_dir/gpseg0/backups/20220101/20220101000000"))
+			Expect(testExecutor.ClusterCommands[1][1].CommandString).To(ContainSubstring("rm -rf /tmp/manager_delete_missing_backup_dir/backups/20220101/20220101000000"))
+			deletedBackup, err := history.GetBackupConfig("20220101000000", historyDB)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deletedBackup.DateDeleted).ToNot(BeEmpty())
+		})
+		It("does not mark a backup deleted if its segment directories cannot be deleted", func() {
+			testExecutor := &testhelper.TestExecutor{ClusterOutput: &cluster.RemoteOutput{
+				NumErrors:      1,
+				FailedCommands: []*cluster.ShellCommand{{Content: 0}},
+			}}
+			testCluster := cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"},
+				{ContentID: 0, Hostname: "remotehost1", DataDir: "/data/gpseg0"},
+			})
+			testCluster.Executor = testExecutor
+			historyDB, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer historyDB.Close()
+			backup := newBackup("20220101000000", history.BackupStatusFailed, "20220101000000")
+			backup.BackupDir = "/tmp/manager_delete_missing_backup_dir"
+			Expect(history.StoreBackupHistory(historyDB, backup)).To(Succeed())
+			defer func() {
+				notDeletedBackup, err := history.GetBackupConfig("20220101000000", historyDB)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(notDeletedBackup.DateDeleted).To(BeEmpty())
+			}()
+			defer testhelper.ShouldPanicWithMessage("Unable to delete backup directories for backup 20220101000000")
+
+			_ = manager.DeleteBackup(testCluster, historyDB, backup, nil)
+		})
+	})
+})
@@ -0,0 +1,240 @@
+package manager
+
+/*
+ * This file contains functions for listing and displaying the backups recorded
+ * in the history database.
+ */
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+)
+
+func NewListCommand() *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the backups recorded in the backup history database",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			DoList(cmd.Flags())
+		}}
+	listCmd.Flags().String(options.FORMAT, FormatTable, "Output format. Valid values are 'table', 'json', and 'yaml'")
+	listCmd.Flags().String(options.STATUS, "", "Only list backups with the specified status. Valid values are 'Success', 'Failure', and 'In Progress'")
+	return listCmd
+}
+
+func NewShowCommand() *cobra.Command {
+	showCmd := &cobra.Command{
+		Use:   "show <timestamp>",
+		Short: "Show the details of a single backup recorded in the backup history database",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			DoShow(cmd.Flags(), args[0])
+		}}
+	showCmd.Flags().String(options.FORMAT, FormatTable, "Output format. Valid values are 'table', 'json', and 'yaml'")
+	return showCmd
+}
+
+func DoList(flags *pflag.FlagSet) {
+	SetLoggerVerbosity(flags)
+	format := options.MustGetFlagString(flags, options.FORMAT)
+	status := options.MustGetFlagString(flags, options.STATUS)
+	gplog.FatalOnError(ValidateFormat(format))
+	gplog.FatalOnError(ValidateStatus(status))
+
+	historyDB := OpenHistoryDB(GetHistoryDBPath(flags))
+	defer historyDB.Close()
+
+	backupConfigs, err := GetBackupConfigs(historyDB, status)
+	gplog.FatalOnError(err)
+	err = PrintBackupList(operating.System.Stdout, backupConfigs, format)
+	gplog.FatalOnError(err)
+}
+
+func DoShow(flags *pflag.FlagSet, timestamp string) {
+	SetLoggerVerbosity(flags)
+	format := options.MustGetFlagString(flags, options.FORMAT)
+	gplog.FatalOnError(ValidateFormat(format))
+	if !filepath.IsValidTimestamp(timestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", timestamp), "")
+	}
+
+	historyDB := OpenHistoryDB(GetHistoryDBPath(flags))
+	defer historyDB.Close()
+
+	backupConfig, err := history.GetBackupConfig(timestamp, historyDB)
+	gplog.FatalOnError(err)
+	err = PrintBackupDetails(operating.System.Stdout, backupConfig, format)
+	gplog.FatalOnError(err)
+}
+
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatTable, FormatJSON, FormatYAML:
+		return nil
+	}
+	return errors.Errorf("Invalid format '%s'. Valid values are '%s', '%s', and '%s'.", format, FormatTable, FormatJSON, FormatYAML)
+}
+
+func ValidateStatus(status string) error {
+	switch status {
+	case "", history.BackupStatusSucceed, history.BackupStatusFailed, history.BackupStatusInProgress:
+		return nil
+	}
+	return errors.Errorf("Invalid status '%s'. Valid values are '%s', '%s', and '%s'.", status,
+		history.BackupStatusSucceed, history.BackupStatusFailed, history.BackupStatusInProgress)
+}
+
+func GetBackupConfigs(historyDB *sql.DB, status string) ([]*history.BackupConfig, error) {
+	timestamps, err := history.GetBackupTimestamps(historyDB, status)
+	if err != nil {
+		return nil, err
+	}
+
+	backupConfigs := make([]*history.BackupConfig, 0, len(timestamps))
+	for _, timestamp := range timestamps {
+		backupConfig, err := history.GetBackupConfig(timestamp, historyDB)
+		if err != nil {
+			return nil, err
+		}
+		backupConfigs = append(backupConfigs, backupConfig)
+	}
+	return backupConfigs, nil
+}
+
+func PrintBackupList(w io.Writer, backupConfigs []*history.BackupConfig, format string) error {
+	switch format {
+	case FormatJSON:
+		return printJSON(w, backupConfigs)
+	case FormatYAML:
+		return printYAML(w, backupConfigs)
+	}
+
+	tabWriter := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "TIMESTAMP\tDATABASE\tTYPE\tSECTIONS\tCOMPRESSION\tPLUGIN\tSTATUS\tDATE DELETED")
+	for _, backupConfig := range backupConfigs {
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", backupConfig.Timestamp, backupConfig.DatabaseName,
+			getBackupType(backupConfig), getBackupSections(backupConfig), getCompression(backupConfig),
+			valueOrDash(backupConfig.Plugin), valueOrDash(backupConfig.Status), valueOrDash(backupConfig.DateDeleted))
+	}
+	return tabWriter.Flush()
+}
+
+func PrintBackupDetails(w io.Writer, backupConfig *history.BackupConfig, format string) error {
+	switch format {
+	case FormatJSON:
+		return printJSON(w, backupConfig)
+	case FormatYAML:
+		return printYAML(w, backupConfig)
+	}
+
+	tabWriter := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	lines := []struct{ key, value string }{
+		{"timestamp", backupConfig.Timestamp},
+		{"end time", valueOrDash(backupConfig.EndTime)},
+		{"status", valueOrDash(backupConfig.Status)},
+		{"database name", backupConfig.DatabaseName},
+		{"database version", backupConfig.DatabaseVersion},
+		{"gpbackup version", backupConfig.BackupVersion},
+		{"segment count", fmt.Sprintf("%d", backupConfig.SegmentCount)},
+		{"backup type", getBackupType(backupConfig)},
+		{"backup sections", getBackupSections(backupConfig)},
+		{"compression", getCompression(backupConfig)},
+		{"single data file", fmt.Sprintf("%t", backupConfig.SingleDataFile)},
+		{"leaf partition data", fmt.Sprintf("%t", backupConfig.LeafPartitionData)},
+		{"with statistics", fmt.Sprintf("%t", backupConfig.WithStatistics)},
+		{"without globals", fmt.Sprintf("%t", backupConfig.WithoutGlobals)},
+		{"backup directory", valueOrDash(backupConfig.BackupDir)},
+		{"plugin", valueOrDash(backupConfig.Plugin)},
+		{"plugin version", valueOrDash(backupConfig.PluginVersion)},
+		{"include schemas", valueOrDash(strings.Join(backupConfig.IncludeSchemas, ","))},
+		{"exclude schemas", valueOrDash(strings.Join(backupConfig.ExcludeSchemas, ","))},
+		{"include tables", valueOrDash(strings.Join(backupConfig.IncludeRelations, ","))},
+		{"exclude tables", valueOrDash(strings.Join(backupConfig.ExcludeRelations, ","))},
+		{"date deleted", valueOrDash(backupConfig.DateDeleted)},
+	}
+	for _, line := range lines {
+		fmt.Fprintf(tabWriter, "%s:\t%s\n", line.key, line.value)
+	}
+	if len(backupConfig.RestorePlan) > 0 {
+		fmt.Fprintln(tabWriter, "restore plan:\t")
+		for _, entry := range backupConfig.RestorePlan {
+			fmt.Fprintf(tabWriter, "  %s:\t%d table(s)\n", entry.Timestamp, len(entry.TableFQNs))
+		}
+	}
+	return tabWriter.Flush()
+}
+
+func printJSON(w io.Writer, value interface{}) error {
+	contents, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(contents))
+	return err
+}
+
+func printYAML(w io.Writer, value interface{}) error {
+	contents, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(contents)
+	return err
+}
+
+func getBackupType(backupConfig *history.BackupConfig) string {
+	if backupConfig.Incremental {
+		return "incremental"
+	}
+	return "full"
+}
+
+func getBackupSections(backupConfig *history.BackupConfig) string {
+	if backupConfig.MetadataOnly {
+		return "metadata-only"
+	} else if backupConfig.DataOnly {
+		return "data-only"
+	}
+	return "metadata+data"
+}
+
+func getCompression(backupConfig *history.BackupConfig) string {
+	if !backupConfig.Compressed {
+		return "none"
+	}
+	// backups taken before zstd support did not record a compression type
+	if backupConfig.CompressionType == "" {
+		return "gzip"
+	}
+	return backupConfig.CompressionType
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
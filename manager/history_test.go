@@ -0,0 +1,177 @@
+package manager_test
+
+import (
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/manager"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/spf13/pflag"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("manager/history tests", func() {
+	var fullBackup, incrBackup, failedBackup history.BackupConfig
+	var historyDBPath = "/tmp/manager_history_db.db"
+
+	BeforeEach(func() {
+		fullBackup = history.BackupConfig{
+			BackupVersion:    "1.30.0",
+			Compressed:       true,
+			CompressionType:  "gzip",
+			DatabaseName:     "testdb",
+			DatabaseVersion:  "6.20.0",
+			ExcludeRelations: []string{},
+			ExcludeSchemas:   []string{},
+			IncludeRelations: []string{},
+			IncludeSchemas:   []string{},
+			RestorePlan:      []history.RestorePlanEntry{{Timestamp: "20220101010101", TableFQNs: []string{"public.foo"}}},
+			Timestamp:        "20220101010101",
+			EndTime:          "20220101010201",
+			Status:           history.BackupStatusSucceed,
+		}
+		incrBackup = fullBackup
+		incrBackup.Incremental = true
+		incrBackup.Timestamp = "20220102010101"
+		incrBackup.EndTime = "20220102010201"
+		incrBackup.RestorePlan = []history.RestorePlanEntry{{Timestamp: "20220101010101", TableFQNs: []string{}}, {Timestamp: "20220102010101", TableFQNs: []string{"public.foo"}}}
+		failedBackup = fullBackup
+		failedBackup.Compressed = false
+		failedBackup.MetadataOnly = true
+		failedBackup.Timestamp = "20220103010101"
+		failedBackup.EndTime = "20220103010201"
+		failedBackup.RestorePlan = []history.RestorePlanEntry{}
+		failedBackup.Status = history.BackupStatusFailed
+		_ = os.Remove(historyDBPath)
+	})
+	AfterEach(func() {
+		_ = os.Remove(historyDBPath)
+	})
+
+	Describe("GetHistoryDBPath", func() {
+		var flags *pflag.FlagSet
+		BeforeEach(func() {
+			flags = pflag.NewFlagSet("manager", pflag.ContinueOnError)
+			flags.String(options.HISTORY_DB, "", "")
+		})
+		AfterEach(func() {
+			operating.InitializeSystemFunctions()
+		})
+		It("uses the history database flag if it is set", func() {
+			_ = flags.Set(options.HISTORY_DB, "/some/path/history.db")
+			Expect(manager.GetHistoryDBPath(flags)).To(Equal("/some/path/history.db"))
+		})
+		It("defaults to the coordinator data directory", func() {
+			operating.System.Getenv = func(key string) string {
+				if key == "COORDINATOR_DATA_DIRECTORY" {
+					return "/data/gpseg-1"
+				}
+				return ""
+			}
+			Expect(manager.GetHistoryDBPath(flags)).To(Equal("/data/gpseg-1/gpbackup_history.db"))
+		})
+		It("falls back to the master data directory", func() {
+			operating.System.Getenv = func(key string) string {
+				if key == "MASTER_DATA_DIRECTORY" {
+					return "/data/master/gpseg-1"
+				}
+				return ""
+			}
+			Expect(manager.GetHistoryDBPath(flags)).To(Equal("/data/master/gpseg-1/gpbackup_history.db"))
+		})
+	})
+	Describe("ValidateFormat", func() {
+		It("accepts the supported formats", func() {
+			Expect(manager.ValidateFormat("table")).To(Succeed())
+			Expect(manager.ValidateFormat("json")).To(Succeed())
+			Expect(manager.ValidateFormat("yaml")).To(Succeed())
+		})
+		It("rejects an unknown format", func() {
+			err := manager.ValidateFormat("csv")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Invalid format 'csv'. Valid values are 'table', 'json', and 'yaml'."))
+		})
+	})
+	Describe("ValidateStatus", func() {
+		It("accepts an empty status and the backup statuses", func() {
+			Expect(manager.ValidateStatus("")).To(Succeed())
+			Expect(manager.ValidateStatus(history.BackupStatusSucceed)).To(Succeed())
+			Expect(manager.ValidateStatus(history.BackupStatusFailed)).To(Succeed())
+			Expect(manager.ValidateStatus(history.BackupStatusInProgress)).To(Succeed())
+		})
+		It("rejects an unknown status", func() {
+			Expect(manager.ValidateStatus("Done")).ToNot(Succeed())
+		})
+	})
+	Describe("GetBackupConfigs", func() {
+		It("returns all backups, most recent first", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			Expect(history.StoreBackupHistory(db, &fullBackup)).To(Succeed())
+			Expect(history.StoreBackupHistory(db, &incrBackup)).To(Succeed())
+			Expect(history.StoreBackupHistory(db, &failedBackup)).To(Succeed())
+
+			configs, err := manager.GetBackupConfigs(db, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configs).To(HaveLen(3))
+			Expect(configs[0].Timestamp).To(Equal("20220103010101"))
+			Expect(configs[1].Timestamp).To(Equal("20220102010101"))
+			Expect(configs[1].RestorePlan).To(HaveLen(2))
+			Expect(configs[2].Timestamp).To(Equal("20220101010101"))
+		})
+		It("returns only backups with the requested status", func() {
+			db, _ := history.InitializeHistoryDatabase(historyDBPath)
+			defer db.Close()
+			Expect(history.StoreBackupHistory(db, &fullBackup)).To(Succeed())
+			Expect(history.StoreBackupHistory(db, &failedBackup)).To(Succeed())
+
+			configs, err := manager.GetBackupConfigs(db, history.BackupStatusFailed)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configs).To(HaveLen(1))
+			Expect(configs[0].Timestamp).To(Equal("20220103010101"))
+		})
+	})
+	Describe("PrintBackupList", func() {
+		It("prints a table of backups", func() {
+			buffer := NewBuffer()
+			err := manager.PrintBackupList(buffer, []*history.BackupConfig{&failedBackup, &incrBackup}, "table")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buffer.Contents())).To(Equal(
+				`TIMESTAMP       DATABASE  TYPE         SECTIONS       COMPRESSION  PLUGIN  STATUS   DATE DELETED
+20220103010101  testdb    full         metadata-only  none         -       Failure  -
+20220102010101  testdb    incremental  metadata+data  gzip         -       Success  -
+`))
+		})
+		It("prints backups as json", func() {
+			buffer := NewBuffer()
+			err := manager.PrintBackupList(buffer, []*history.BackupConfig{&fullBackup}, "json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buffer).To(Say(`"Timestamp": "20220101010101"`))
+			Expect(buffer).To(Say(`"Status": "Success"`))
+		})
+		It("prints backups as yaml", func() {
+			buffer := NewBuffer()
+			err := manager.PrintBackupList(buffer, []*history.BackupConfig{&fullBackup}, "yaml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buffer).To(Say(`- backupdir: ""`))
+			Expect(buffer).To(Say(`timestamp: "20220101010101"`))
+		})
+	})
+	Describe("PrintBackupDetails", func() {
+		It("prints the details of a backup including its restore plan", func() {
+			buffer := NewBuffer()
+			err := manager.PrintBackupDetails(buffer, &incrBackup, "table")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buffer).To(Say(`timestamp:\s+20220102010101`))
+			Expect(buffer).To(Say(`backup type:\s+incremental`))
+			Expect(buffer).To(Say(`compression:\s+gzip`))
+			Expect(buffer).To(Say(`restore plan:`))
+			Expect(buffer).To(Say(`20220101010101:\s+0 table\(s\)`))
+			Expect(buffer).To(Say(`20220102010101:\s+1 table\(s\)`))
+		})
+	})
+})
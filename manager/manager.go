@@ -0,0 +1,94 @@
+package manager
+
+/*
+ * This file contains the setup and teardown functions for gpbackup_manager,
+ * which inspects and maintains the backups recorded in the history database.
+ */
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	path "path/filepath"
+	"runtime/debug"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	version string
+)
+
+// This function handles setup that can be done before parsing flags.
+func DoInit(cmd *cobra.Command) {
+	gplog.InitializeLogging("gpbackup_manager", "")
+	cmd.PersistentFlags().String(options.HISTORY_DB, "", "The absolute path of the backup history database. Defaults to gpbackup_history.db in the coordinator data directory")
+	cmd.PersistentFlags().Bool(options.VERBOSE, false, "Print verbose log messages")
+	cmd.AddCommand(NewListCommand(), NewShowCommand(), NewDeleteCommand(), NewPruneCommand(), NewListDirectoryCommand())
+}
+
+func DoTeardown() {
+	if err := recover(); err != nil {
+		// gplog's Fatal will cause a panic with error code 2
+		if gplog.GetErrorCode() != 2 {
+			gplog.Error(fmt.Sprintf("%v: %s", err, debug.Stack()))
+			gplog.SetErrorCode(2)
+		} else {
+			fmt.Println(err)
+		}
+	}
+	os.Exit(gplog.GetErrorCode())
+}
+
+func SetLoggerVerbosity(flags *pflag.FlagSet) {
+	if options.MustGetFlagBool(flags, options.VERBOSE) {
+		gplog.SetVerbosity(gplog.LOGVERBOSE)
+	}
+}
+
+func GetVersion() string {
+	return version
+}
+
+/*
+ * The history database lives in the coordinator data directory, but unlike
+ * gpbackup we do not need a database connection just to read it, so we rely
+ * on the environment to locate the coordinator data directory.
+ */
+func GetHistoryDBPath(flags *pflag.FlagSet) string {
+	historyDBPath := options.MustGetFlagString(flags, options.HISTORY_DB)
+	if historyDBPath != "" {
+		return historyDBPath
+	}
+	coordinatorDataDir := operating.System.Getenv("COORDINATOR_DATA_DIRECTORY")
+	if coordinatorDataDir == "" {
+		coordinatorDataDir = operating.System.Getenv("MASTER_DATA_DIRECTORY")
+	}
+	return path.Join(coordinatorDataDir, "gpbackup_history.db")
+}
+
+func OpenHistoryDB(historyDBPath string) *sql.DB {
+	if !utils.FileExists(historyDBPath) {
+		gplog.Fatal(errors.Errorf("Backup history database %s does not exist. Please specify its location using the --%s flag.", historyDBPath, options.HISTORY_DB), "")
+	}
+	historyDB, err := history.InitializeHistoryDatabase(historyDBPath)
+	gplog.FatalOnError(err)
+	return historyDB
+}
+
+func InitializeCluster() *cluster.Cluster {
+	clusterConfigConn := dbconn.NewDBConnFromEnvironment("postgres")
+	clusterConfigConn.MustConnect(1)
+	defer clusterConfigConn.Close()
+	segConfig := cluster.MustGetSegmentConfiguration(clusterConfigConn)
+	return cluster.NewCluster(segConfig)
+}
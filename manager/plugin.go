@@ -0,0 +1,89 @@
+package manager
+
+/*
+ * This file contains functions for managing backups stored using a plugin.
+ */
+
+import (
+	"fmt"
+	path "path/filepath"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewListDirectoryCommand() *cobra.Command {
+	listDirectoryCmd := &cobra.Command{
+		Use:   "list-directory [relative path]",
+		Short: "List the contents of a directory in the remote storage of a plugin",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			defer DoTeardown()
+			relativePath := ""
+			if len(args) == 1 {
+				relativePath = args[0]
+			}
+			DoListDirectory(cmd.Flags(), relativePath)
+		}}
+	listDirectoryCmd.Flags().String(options.PLUGIN_CONFIG, "", "The configuration file to use for the plugin")
+	_ = listDirectoryCmd.MarkFlagRequired(options.PLUGIN_CONFIG)
+	return listDirectoryCmd
+}
+
+func DoListDirectory(flags *pflag.FlagSet, relativePath string) {
+	SetLoggerVerbosity(flags)
+	globalCluster := InitializeCluster()
+	pluginConfig := InitializePluginConfig(globalCluster, options.MustGetFlagString(flags, options.PLUGIN_CONFIG))
+	defer pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
+
+	entries, err := pluginConfig.ListDirectory(relativePath)
+	gplog.FatalOnError(err)
+	for _, entry := range entries {
+		fmt.Fprintln(operating.System.Stdout, entry)
+	}
+}
+
+/*
+ * Plugin commands are run on the coordinator using a copy of the plugin
+ * config, as in gpbackup and gprestore.  Calling CheckPluginExistsOnAllHosts
+ * also records the plugin API version, which determines whether the optional
+ * delete_backup and list_directory commands are supported.
+ */
+func InitializePluginConfig(c *cluster.Cluster, pluginConfigFile string) *utils.PluginConfig {
+	if pluginConfigFile == "" {
+		return nil
+	}
+	err := utils.ValidateFullPath(pluginConfigFile)
+	gplog.FatalOnError(err)
+	pluginConfig, err := utils.ReadPluginConfig(pluginConfigFile)
+	gplog.FatalOnError(err)
+	configFilename := path.Base(pluginConfig.ConfigPath)
+	configDirname := path.Dir(pluginConfig.ConfigPath)
+	pluginConfig.ConfigPath = path.Join(configDirname, history.CurrentTimestamp()+"_"+configFilename)
+	gplog.Debug("Plugin config path: %s", pluginConfig.ConfigPath)
+
+	pluginConfig.CheckPluginExistsOnAllHosts(c)
+	pluginConfig.CopyPluginConfigToAllHosts(c)
+	return pluginConfig
+}
+
+func DeletePluginBackup(pluginConfig *utils.PluginConfig, backupConfig *history.BackupConfig) error {
+	if pluginConfig == nil {
+		return errors.Errorf("Backup %s was taken using plugin %s. Please specify the plugin config using the --%s flag to delete it.",
+			backupConfig.Timestamp, backupConfig.Plugin, options.PLUGIN_CONFIG)
+	}
+	_, pluginBinaryName := path.Split(pluginConfig.ExecutablePath)
+	if pluginBinaryName != backupConfig.Plugin {
+		return errors.Errorf("Backup %s was taken using plugin %s, but the specified plugin config uses %s.",
+			backupConfig.Timestamp, backupConfig.Plugin, pluginBinaryName)
+	}
+	gplog.Verbose("Deleting backup %s from plugin storage", backupConfig.Timestamp)
+	return pluginConfig.DeleteBackup(backupConfig.Timestamp)
+}
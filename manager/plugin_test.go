@@ -0,0 +1,42 @@
+package manager_test
+
+import (
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/manager"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("manager/plugin tests", func() {
+	Describe("DeletePluginBackup", func() {
+		var backupConfig *history.BackupConfig
+		var pluginConfig *utils.PluginConfig
+
+		BeforeEach(func() {
+			backupConfig = &history.BackupConfig{Timestamp: "20170101010101", Plugin: "myPlugin"}
+			pluginConfig = &utils.PluginConfig{
+				ExecutablePath: "/a/b/myPlugin",
+				ConfigPath:     "/tmp/my_plugin_config.yaml",
+				Options:        make(map[string]string),
+			}
+		})
+		It("requires a plugin config", func() {
+			err := manager.DeletePluginBackup(nil, backupConfig)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Backup 20170101010101 was taken using plugin myPlugin. Please specify the plugin config using the --plugin-config flag to delete it."))
+		})
+		It("refuses to delete a backup taken with a different plugin", func() {
+			pluginConfig.ExecutablePath = "/a/b/otherPlugin"
+			err := manager.DeletePluginBackup(pluginConfig, backupConfig)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Backup 20170101010101 was taken using plugin myPlugin, but the specified plugin config uses otherPlugin."))
+		})
+		It("refuses to delete a backup if the plugin does not support delete_backup", func() {
+			err := manager.DeletePluginBackup(pluginConfig, backupConfig)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Plugin /a/b/myPlugin does not support deleting backups. Plugin API version 0.4.0 or later is required."))
+		})
+	})
+})
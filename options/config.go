@@ -0,0 +1,194 @@
+package options
+
+/*
+ * This file contains functions for setting flags from a configuration file.
+ */
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * A configuration file maps flag names to values, with a list of values for
+ * a flag that may be given more than once.  The flags of a named profile are
+ * applied over the top-level flags when the profile is selected:
+ *
+ * dbname: proddb
+ * backup-dir: /data/backups
+ * include-schema: [sales, marketing]
+ * profiles:
+ *   nightly:
+ *     incremental: true
+ *     leaf-partition-data: true
+ *   weekly-full:
+ *     leaf-partition-data: true
+ *     jobs: 8
+ */
+type ConfigFile struct {
+	Flags    map[string]interface{}            `yaml:",inline"`
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// These flags select the configuration, so they cannot be set by it
+var unconfigurableFlags = map[string]bool{
+	CONFIG:    true,
+	PROFILE:   true,
+	"help":    true,
+	"version": true,
+}
+
+func ReadConfigFile(filename string) (*ConfigFile, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read configuration file %s", filename)
+	}
+	config := &ConfigFile{}
+	err = yaml.UnmarshalStrict(contents, config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse configuration file %s", filename)
+	}
+	return config, nil
+}
+
+func (config *ConfigFile) GetProfileFlags(profile string) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(config.Flags))
+	for name, value := range config.Flags {
+		values[name] = value
+	}
+	if profile == "" {
+		return values, nil
+	}
+	profileValues, ok := config.Profiles[profile]
+	if !ok {
+		return nil, errors.Errorf("Profile %s is not defined in the configuration file", profile)
+	}
+	for name, value := range profileValues {
+		values[name] = value
+	}
+	return values, nil
+}
+
+func formatConfigValues(flag *pflag.Flag, value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, errors.Errorf("No value is given for --%s in the configuration file", flag.Name)
+	case []interface{}:
+		if flag.Value.Type() != "stringArray" {
+			return nil, errors.Errorf("A list of values is given for --%s in the configuration file, but it may only be specified once", flag.Name)
+		}
+		values := make([]string, 0, len(value))
+		for _, element := range value {
+			values = append(values, fmt.Sprint(element))
+		}
+		return values, nil
+	case map[interface{}]interface{}:
+		return nil, errors.Errorf("Invalid value for --%s in the configuration file", flag.Name)
+	default:
+		return []string{fmt.Sprint(value)}, nil
+	}
+}
+
+/*
+ * The flags given on the command line override those in the configuration
+ * file, so a flag that may be specified more than once takes all of its values
+ * from the command line if it is given there.  The flags set from the file
+ * are marked as changed, so they are validated as though they had been given
+ * on the command line.
+ */
+func ApplyConfigFile(flags *pflag.FlagSet) error {
+	filename, err := flags.GetString(CONFIG)
+	if err != nil {
+		return err
+	}
+	profile, err := flags.GetString(PROFILE)
+	if err != nil {
+		return err
+	}
+	if filename == "" {
+		if profile != "" {
+			return errors.Errorf("--%s may only be specified with --%s", PROFILE, CONFIG)
+		}
+		return nil
+	}
+
+	config, err := ReadConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	values, err := config.GetProfileFlags(profile)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to apply configuration file %s", filename)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := flags.Lookup(name)
+		if flag == nil || unconfigurableFlags[name] {
+			return errors.Errorf("Unknown flag %s in configuration file %s", name, filename)
+		}
+		if flag.Changed {
+			continue
+		}
+		flagValues, err := formatConfigValues(flag, values[name])
+		if err != nil {
+			return err
+		}
+		for _, value := range flagValues {
+			err = flags.Set(name, value)
+			if err != nil {
+				return errors.Wrapf(err, "Invalid value for --%s in configuration file %s", name, filename)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * The options written are those given on the command line or in the
+ * configuration file.  The file is made read-only, as it records how the
+ * backup or restore was run; the file of a backup being resumed is replaced.
+ */
+func WriteOptionsFile(flags *pflag.FlagSet, filename string) error {
+	values := make(map[string]interface{})
+	var err error
+	flags.Visit(func(flag *pflag.Flag) {
+		if unconfigurableFlags[flag.Name] || err != nil {
+			return
+		}
+		switch flag.Value.Type() {
+		case "stringArray":
+			values[flag.Name], err = flags.GetStringArray(flag.Name)
+		case "bool":
+			values[flag.Name], err = flags.GetBool(flag.Name)
+		case "int":
+			values[flag.Name], err = flags.GetInt(flag.Name)
+		default:
+			values[flag.Name] = flag.Value.String()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	contents, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	err = utils.RemoveFileIfExists(filename)
+	if err == nil {
+		err = utils.WriteToFileAndMakeReadOnly(filename, contents)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write options file %s", filename)
+	}
+	return nil
+}
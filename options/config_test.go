@@ -0,0 +1,180 @@
+package options_test
+
+import (
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("options/config tests", func() {
+	var (
+		flags      *pflag.FlagSet
+		configFile string
+	)
+	BeforeEach(func() {
+		flags = pflag.NewFlagSet("gpbackup", pflag.ContinueOnError)
+		options.SetBackupFlagDefaults(flags)
+		configFile = `dbname: proddb
+backup-dir: /data/backups
+jobs: 4
+include-schema: [sales, marketing]
+profiles:
+  nightly:
+    incremental: true
+    leaf-partition-data: true
+  weekly-full:
+    jobs: 8
+    leaf-partition-data: true
+`
+		operating.System.ReadFile = func(filename string) ([]byte, error) { return []byte(configFile), nil }
+	})
+	AfterEach(func() {
+		operating.InitializeSystemFunctions()
+	})
+
+	Describe("ApplyConfigFile", func() {
+		It("does nothing if no configuration file is given", func() {
+			Expect(flags.Parse([]string{"--dbname", "testdb"})).To(Succeed())
+
+			Expect(options.ApplyConfigFile(flags)).To(Succeed())
+
+			Expect(flags.Changed(options.BACKUP_DIR)).To(BeFalse())
+		})
+		It("sets the flags of the configuration file, marking them as changed", func() {
+			Expect(flags.Parse([]string{"--config", "gpbackup.yaml"})).To(Succeed())
+
+			Expect(options.ApplyConfigFile(flags)).To(Succeed())
+
+			Expect(options.MustGetFlagString(flags, options.DBNAME)).To(Equal("proddb"))
+			Expect(options.MustGetFlagString(flags, options.BACKUP_DIR)).To(Equal("/data/backups"))
+			Expect(options.MustGetFlagInt(flags, options.JOBS)).To(Equal(4))
+			Expect(options.MustGetFlagStringArray(flags, options.INCLUDE_SCHEMA)).To(Equal([]string{"sales", "marketing"}))
+			Expect(options.MustGetFlagBool(flags, options.INCREMENTAL)).To(BeFalse())
+			Expect(flags.Changed(options.DBNAME)).To(BeTrue())
+			Expect(flags.Changed(options.INCREMENTAL)).To(BeFalse())
+		})
+		It("sets the flags of the selected profile over those of the file", func() {
+			Expect(flags.Parse([]string{"--config", "gpbackup.yaml", "--profile", "weekly-full"})).To(Succeed())
+
+			Expect(options.ApplyConfigFile(flags)).To(Succeed())
+
+			Expect(options.MustGetFlagString(flags, options.DBNAME)).To(Equal("proddb"))
+			Expect(options.MustGetFlagInt(flags, options.JOBS)).To(Equal(8))
+			Expect(options.MustGetFlagBool(flags, options.LEAF_PARTITION_DATA)).To(BeTrue())
+			Expect(options.MustGetFlagBool(flags, options.INCREMENTAL)).To(BeFalse())
+		})
+		It("does not override the flags given on the command line", func() {
+			Expect(flags.Parse([]string{"--config", "gpbackup.yaml", "--profile", "nightly", "--jobs", "2", "--include-schema", "public"})).To(Succeed())
+
+			Expect(options.ApplyConfigFile(flags)).To(Succeed())
+
+			Expect(options.MustGetFlagInt(flags, options.JOBS)).To(Equal(2))
+			Expect(options.MustGetFlagStringArray(flags, options.INCLUDE_SCHEMA)).To(Equal([]string{"public"}))
+			Expect(options.MustGetFlagBool(flags, options.INCREMENTAL)).To(BeTrue())
+		})
+		It("sets a flag that may be given more than once from a single value", func() {
+			configFile = "exclude-table: public.foo\n"
+			Expect(flags.Parse([]string{"--config", "gpbackup.yaml"})).To(Succeed())
+
+			Expect(options.ApplyConfigFile(flags)).To(Succeed())
+
+			Expect(options.MustGetFlagStringArray(flags, options.EXCLUDE_RELATION)).To(Equal([]string{"public.foo"}))
+		})
+		It("returns an error if the profile is not defined", func() {
+			Expect(flags.Parse([]string{"--config", "gpbackup.yaml", "--profile", "hourly"})).To(Succeed())
+
+			err := options.ApplyConfigFile(flags)
+
+			Expect(err).To(MatchError("Unable to apply configuration file gpbackup.yaml: Profile hourly is not defined in the configuration file"))
+		})
+		It("returns an error if a profile is given without a configuration file", func() {
+			Expect(flags.Parse([]string{"--profile", "nightly"})).To(Succeed())
+
+			err := options.ApplyConfigFile(flags)
+
+			Expect(err).To(MatchError("--profile may only be specified with --config"))
+		})
+		It("returns an error for a flag that does not exist", func() {
+			configFile = "db-name: proddb\n"
+			Expect(flags.Parse([]string{"--config", "gpbackup.yaml"})).To(Succeed())
+
+			err := options.ApplyConfigFile(flags)
+
+			Expect(err).To(MatchError("Unknown flag db-name in configuration file gpbackup.yaml"))
+		})
+		It("returns an error for a flag that selects the configuration", func() {
+			configFile = "profile: nightly\n"
+			Expect(flags.Parse([]string{"--config", "gpbackup.yaml"})).To(Succeed())
+
+			err := options.ApplyConfigFile(flags)
+
+			Expect(err).To(MatchError("Unknown flag profile in configuration file gpbackup.yaml"))
+		})
+		It("returns an error for a list of values for a flag that may only be given once", func() {
+			configFile = "dbname: [proddb, testdb]\n"
+			Expect(flags.Parse([]string{"--config", "gpbackup.yaml"})).To(Succeed())
+
+			err := options.ApplyConfigFile(flags)
+
+			Expect(err).To(MatchError("A list of values is given for --dbname in the configuration file, but it may only be specified once"))
+		})
+		It("returns an error for an invalid value", func() {
+			configFile = "jobs: many\n"
+			Expect(flags.Parse([]string{"--config", "gpbackup.yaml"})).To(Succeed())
+
+			err := options.ApplyConfigFile(flags)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Invalid value for --jobs in configuration file gpbackup.yaml"))
+		})
+	})
+	Describe("WriteOptionsFile", func() {
+		It("writes the flags given on the command line and in the configuration file", func() {
+			tempDir, err := os.MkdirTemp("", "options")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tempDir)
+			Expect(flags.Parse([]string{"--config", "gpbackup.yaml", "--profile", "nightly", "--jobs", "2"})).To(Succeed())
+			Expect(options.ApplyConfigFile(flags)).To(Succeed())
+			optionsFilename := path.Join(tempDir, "gpbackup_options.yaml")
+
+			Expect(options.WriteOptionsFile(flags, optionsFilename)).To(Succeed())
+
+			contents, err := os.ReadFile(optionsFilename)
+			Expect(err).ToNot(HaveOccurred())
+			written := make(map[string]interface{})
+			Expect(yaml.Unmarshal(contents, &written)).To(Succeed())
+			Expect(written).To(Equal(map[string]interface{}{
+				"dbname":              "proddb",
+				"backup-dir":          "/data/backups",
+				"jobs":                2,
+				"include-schema":      []interface{}{"sales", "marketing"},
+				"incremental":         true,
+				"leaf-partition-data": true,
+			}))
+			info, err := os.Stat(optionsFilename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0444)))
+		})
+		It("replaces the read-only options file of a backup being resumed", func() {
+			tempDir, err := os.MkdirTemp("", "options")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tempDir)
+			optionsFilename := path.Join(tempDir, "gpbackup_options.yaml")
+			Expect(os.WriteFile(optionsFilename, []byte("jobs: 4\n"), 0444)).To(Succeed())
+			Expect(flags.Parse([]string{"--jobs", "2"})).To(Succeed())
+
+			Expect(options.WriteOptionsFile(flags, optionsFilename)).To(Succeed())
+
+			contents, err := os.ReadFile(optionsFilename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("jobs: 2\n"))
+		})
+	})
+})
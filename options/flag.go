@@ -17,14 +17,19 @@ const (
 	BACKUP_DIR            = "backup-dir"
 	COMPRESSION_TYPE      = "compression-type"
 	COMPRESSION_LEVEL     = "compression-level"
+	COMPRESSION_THREADS   = "compression-threads"
+	COMPRESSION_WINDOW    = "compression-window"
+	CONFIG                = "config"
 	DATA_ONLY             = "data-only"
 	DBNAME                = "dbname"
 	DEBUG                 = "debug"
+	EXCLUDE_OBJECT_TYPE   = "exclude-object-type"
 	EXCLUDE_RELATION      = "exclude-table"
 	EXCLUDE_RELATION_FILE = "exclude-table-file"
 	EXCLUDE_SCHEMA        = "exclude-schema"
 	EXCLUDE_SCHEMA_FILE   = "exclude-schema-file"
 	FROM_TIMESTAMP        = "from-timestamp"
+	INCLUDE_OBJECT_TYPE   = "include-object-type"
 	INCLUDE_RELATION      = "include-table"
 	INCLUDE_RELATION_FILE = "include-table-file"
 	INCLUDE_SCHEMA        = "include-schema"
@@ -32,10 +37,15 @@ const (
 	INCREMENTAL           = "incremental"
 	JOBS                  = "jobs"
 	LEAF_PARTITION_DATA   = "leaf-partition-data"
+	LOCK_RETRIES          = "lock-retries"
+	LOCK_WAIT_TIMEOUT     = "lock-wait-timeout"
 	METADATA_ONLY         = "metadata-only"
+	METRICS_FILE          = "metrics-file"
 	NO_COMPRESSION        = "no-compression"
 	NO_HISTORY            = "no-history"
+	PIN_TABLE             = "pin-table"
 	PLUGIN_CONFIG         = "plugin-config"
+	PROFILE               = "profile"
 	QUIET                 = "quiet"
 	SINGLE_DATA_FILE      = "single-data-file"
 	COPY_QUEUE_SIZE       = "copy-queue-size"
@@ -54,34 +64,70 @@ const (
 	RESIZE_CLUSTER        = "resize-cluster"
 	NO_INHERITS           = "no-inherits"
 	REPORT_DIR            = "report-dir"
+	HISTORY_DB            = "history-db"
+	FORMAT                = "format"
+	STATUS                = "status"
+	CASCADE               = "cascade"
+	KEEP_LAST             = "keep-last"
+	KEEP_DAYS             = "keep-days"
+	DRY_RUN               = "dry-run"
+	VERIFY_ONLY           = "verify-only"
+	ENCRYPTION_KEY_FILE   = "encryption-key-file"
+	ENCRYPTION_KEY_ENV    = "encryption-key-env"
+	ENCRYPTION_KEY_CMD    = "encryption-key-command"
+	RESUME                = "resume"
+	NO_OWNER              = "no-owner"
+	NO_PRIVILEGES         = "no-privileges"
+	ROLE_MAP              = "role-map"
+	NO_TABLESPACES        = "no-tablespaces"
+	TABLESPACE_MAP        = "tablespace-map"
+	REDIRECT_TABLE        = "redirect-table"
+	ROW_FILTER_FILE       = "row-filter-file"
+	MASKING_RULES_FILE    = "masking-rules-file"
 )
 
 func SetBackupFlagDefaults(flagSet *pflag.FlagSet) {
 	flagSet.String(BACKUP_DIR, "", "The absolute path of the directory to which all backup files will be written")
-	flagSet.String(COMPRESSION_TYPE, "gzip", "Type of compression to use during data backup. Valid values are 'gzip', 'zstd'")
+	flagSet.String(COMPRESSION_TYPE, "gzip", "Type of compression to use during data backup. Valid values are 'gzip', 'pgzip', 'zstd', 'lz4'")
 	flagSet.Int(COMPRESSION_LEVEL, 1, "Level of compression to use during data backup. Range of valid values depends on compression type")
+	flagSet.Int(COMPRESSION_THREADS, 0, "Number of threads each segment uses for zstd compression of a single data file backup. 0 uses the default of the compression library")
+	flagSet.Int(COMPRESSION_WINDOW, 0, "Base 2 logarithm of the window size zstd uses to find long-distance matches in a single data file backup, as with zstd --long. Valid values are 10 to 27, or 0 for the default window")
+	flagSet.String(CONFIG, "", "A YAML file from which to set flags not given on the command line")
 	flagSet.Bool(DATA_ONLY, false, "Only back up data, do not back up metadata")
 	flagSet.String(DBNAME, "", "The database to be backed up")
 	flagSet.Bool(DEBUG, false, "Print verbose and debug log messages")
-	flagSet.StringArray(EXCLUDE_SCHEMA, []string{}, "Back up all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
+	flagSet.StringArray(EXCLUDE_SCHEMA, []string{}, "Back up all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times, and accepts glob:-prefixed globs and re:-prefixed regular expressions.")
+	flagSet.String(ENCRYPTION_KEY_CMD, "", "A command whose output is the hex-encoded 256-bit key with which to encrypt the backup")
+	flagSet.String(ENCRYPTION_KEY_ENV, "", "An environment variable containing the hex-encoded 256-bit key with which to encrypt the backup")
+	flagSet.String(ENCRYPTION_KEY_FILE, "", "A file containing the hex-encoded 256-bit key with which to encrypt the backup")
 	flagSet.String(EXCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas to be excluded from the backup")
-	flagSet.StringArray(EXCLUDE_RELATION, []string{}, "Back up all metadata except the specified table(s). --exclude-table can be specified multiple times.")
+	flagSet.StringArray(EXCLUDE_RELATION, []string{}, "Back up all metadata except the specified table(s). --exclude-table can be specified multiple times, and accepts glob:-prefixed globs and re:-prefixed regular expressions.")
 	flagSet.String(EXCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified tables to be excluded from the backup")
+	flagSet.StringArray(EXCLUDE_OBJECT_TYPE, []string{}, "Back up all metadata except objects of the specified type(s), such as TRIGGER or \"ROLE GRANT\". --exclude-object-type can be specified multiple times.")
 	flagSet.String(FROM_TIMESTAMP, "", "A timestamp to use to base the current incremental backup off")
 	flagSet.Bool("help", false, "Help for gpbackup")
-	flagSet.StringArray(INCLUDE_SCHEMA, []string{}, "Back up only the specified schema(s). --include-schema can be specified multiple times.")
+	flagSet.StringArray(INCLUDE_SCHEMA, []string{}, "Back up only the specified schema(s). --include-schema can be specified multiple times, and accepts glob:-prefixed globs and re:-prefixed regular expressions.")
 	flagSet.String(INCLUDE_SCHEMA_FILE, "", "A file containing a list of schema(s) to be included in the backup")
-	flagSet.StringArray(INCLUDE_RELATION, []string{}, "Back up only the specified table(s). --include-table can be specified multiple times.")
+	flagSet.StringArray(INCLUDE_RELATION, []string{}, "Back up only the specified table(s). --include-table can be specified multiple times, and accepts glob:-prefixed globs and re:-prefixed regular expressions.")
 	flagSet.String(INCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified tables to be included in the backup")
+	flagSet.StringArray(INCLUDE_OBJECT_TYPE, []string{}, "Back up only the metadata of objects of the specified type(s), such as TABLE or VIEW. --include-object-type can be specified multiple times.")
 	flagSet.Bool(INCREMENTAL, false, "Only back up data for AO tables that have been modified since the last backup")
 	flagSet.Int(JOBS, 1, "The number of parallel connections to use when backing up data")
 	flagSet.Bool(LEAF_PARTITION_DATA, false, "For partition tables, create one data file per leaf partition instead of one data file for the whole table")
+	flagSet.Int(LOCK_RETRIES, 0, "The number of times to retry acquiring locks on tables that could not be locked within --lock-wait-timeout, waiting twice as long before each retry")
+	flagSet.Int(LOCK_WAIT_TIMEOUT, 0, "The number of seconds to wait to acquire locks on tables before retrying or failing, or 0 to wait indefinitely")
+	flagSet.String(MASKING_RULES_FILE, "", "A YAML file mapping fully-qualified tables to expressions to back up in place of the data of their columns, such as md5(email) or NULL")
 	flagSet.Bool(METADATA_ONLY, false, "Only back up metadata, do not back up data")
+	flagSet.String(METRICS_FILE, "", "A file to which to write metrics for the backup in the OpenMetrics text format, such as a .prom file read by the node_exporter textfile collector")
 	flagSet.Bool(NO_COMPRESSION, false, "Skip compression of data files")
 	flagSet.Bool(NO_HISTORY, false, "Do not write a backup entry to the gpbackup_history database")
+	flagSet.StringArray(PIN_TABLE, []string{}, "Back up the data of the specified table on a connection of its own, which backs up no other table. --pin-table can be specified multiple times.")
 	flagSet.String(PLUGIN_CONFIG, "", "The configuration file to use for a plugin")
+	flagSet.String(PROFILE, "", "The profile in the --config file whose flags to set, in addition to the flags set for every profile")
 	flagSet.Bool("version", false, "Print version number and exit")
 	flagSet.Bool(QUIET, false, "Suppress non-warning, non-error log messages")
+	flagSet.String(RESUME, "", "The timestamp of a failed or cancelled multi-file backup whose remaining table data should be backed up. Only --dbname, --backup-dir, --jobs, --compression-level, --no-history, --metrics-file, the encryption key flags, and logging flags may be specified with --resume")
+	flagSet.String(ROW_FILTER_FILE, "", "A YAML file mapping fully-qualified tables to predicates, such that only the rows of each table satisfying its predicate are backed up")
 	flagSet.Bool(SINGLE_BACKUP_DIR, false, "Back up all data to a single directory instead of split by segment")
 	flagSet.Bool(SINGLE_DATA_FILE, false, "Back up all data to a single file instead of one per table")
 	flagSet.Int(COPY_QUEUE_SIZE, 1, "number of COPY commands gpbackup should enqueue when backing up using the --single-data-file option")
@@ -93,29 +139,44 @@ func SetBackupFlagDefaults(flagSet *pflag.FlagSet) {
 
 func SetRestoreFlagDefaults(flagSet *pflag.FlagSet) {
 	flagSet.String(BACKUP_DIR, "", "The absolute path of the directory in which the backup files to be restored are located")
+	flagSet.String(CONFIG, "", "A YAML file from which to set flags not given on the command line")
 	flagSet.Bool(CREATE_DB, false, "Create the database before metadata restore")
 	flagSet.Bool(DATA_ONLY, false, "Only restore data, do not restore metadata")
 	flagSet.Bool(DEBUG, false, "Print verbose and debug log messages")
-	flagSet.StringArray(EXCLUDE_SCHEMA, []string{}, "Restore all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
+	flagSet.StringArray(EXCLUDE_SCHEMA, []string{}, "Restore all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times, and accepts glob:-prefixed globs and re:-prefixed regular expressions.")
+	flagSet.String(ENCRYPTION_KEY_CMD, "", "A command whose output is the hex-encoded 256-bit key with which the backup was encrypted. The ID of the key is passed in GPBACKUP_ENCRYPTION_KEY_ID")
+	flagSet.String(ENCRYPTION_KEY_ENV, "", "An environment variable containing the hex-encoded 256-bit key with which the backup was encrypted")
+	flagSet.String(ENCRYPTION_KEY_FILE, "", "A file containing the hex-encoded 256-bit key with which the backup was encrypted")
 	flagSet.String(EXCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas that will not be restored")
-	flagSet.StringArray(EXCLUDE_RELATION, []string{}, "Restore all metadata except the specified relation(s). --exclude-table can be specified multiple times.")
+	flagSet.StringArray(EXCLUDE_RELATION, []string{}, "Restore all metadata except the specified relation(s). --exclude-table can be specified multiple times, and accepts glob:-prefixed globs and re:-prefixed regular expressions.")
 	flagSet.String(EXCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified relation(s) that will not be restored")
+	flagSet.StringArray(EXCLUDE_OBJECT_TYPE, []string{}, "Restore all metadata except objects of the specified type(s), such as TRIGGER or \"ROLE GRANT\". --exclude-object-type can be specified multiple times.")
 	flagSet.Bool("help", false, "Help for gprestore")
-	flagSet.StringArray(INCLUDE_SCHEMA, []string{}, "Restore only the specified schema(s). --include-schema can be specified multiple times.")
+	flagSet.StringArray(INCLUDE_SCHEMA, []string{}, "Restore only the specified schema(s). --include-schema can be specified multiple times, and accepts glob:-prefixed globs and re:-prefixed regular expressions.")
 	flagSet.String(INCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas that will be restored")
-	flagSet.StringArray(INCLUDE_RELATION, []string{}, "Restore only the specified relation(s). --include-table can be specified multiple times.")
+	flagSet.StringArray(INCLUDE_RELATION, []string{}, "Restore only the specified relation(s). --include-table can be specified multiple times, and accepts glob:-prefixed globs and re:-prefixed regular expressions.")
 	flagSet.String(INCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified relation(s) that will be restored")
+	flagSet.StringArray(INCLUDE_OBJECT_TYPE, []string{}, "Restore only the metadata of objects of the specified type(s), such as TABLE or VIEW. --include-object-type can be specified multiple times.")
 	flagSet.Bool(INCREMENTAL, false, "BETA FEATURE: Only restore data for all heap tables and only AO tables that have been modified since the last backup")
 	flagSet.Bool(METADATA_ONLY, false, "Only restore metadata, do not restore data")
+	flagSet.Bool(NO_OWNER, false, "Do not restore the owners of objects, so they are owned by the user running the restore")
+	flagSet.Bool(NO_PRIVILEGES, false, "Do not restore the privileges of objects or the default privileges of roles")
+	flagSet.Bool(NO_TABLESPACES, false, "Do not restore tablespaces, and restore all objects to the default tablespace")
+	flagSet.String(METRICS_FILE, "", "A file to which to write metrics for the restore in the OpenMetrics text format, such as a .prom file read by the node_exporter textfile collector")
 	flagSet.Int(JOBS, 1, "Number of parallel connections to use when restoring table data and post-data")
 	flagSet.Bool(ON_ERROR_CONTINUE, false, "Log errors and continue restore, instead of exiting on first error")
 	flagSet.String(PLUGIN_CONFIG, "", "The configuration file to use for a plugin")
+	flagSet.String(PROFILE, "", "The profile in the --config file whose flags to set, in addition to the flags set for every profile")
 	flagSet.Bool("version", false, "Print version number and exit")
 	flagSet.Bool(QUIET, false, "Suppress non-warning, non-error log messages")
 	flagSet.String(REDIRECT_DB, "", "Restore to the specified database instead of the database that was backed up")
+	flagSet.StringArray(ROLE_MAP, []string{}, "Restore the owners and privileges of a role as those of another, given in the form old=new. --role-map can be specified multiple times.")
+	flagSet.Bool(RESUME, false, "Resume a failed or cancelled restore of the backup into the same database, skipping the metadata sections and tables it restored. A metadata section that failed partway is restored again in full, so add --on-error-continue to skip the objects it already created. The other flags must match those of the restore being resumed")
 	flagSet.String(REDIRECT_SCHEMA, "", "Restore to the specified schema instead of the schema that was backed up")
+	flagSet.StringArray(REDIRECT_TABLE, []string{}, "Restore a table, with its indexes, constraints, and data, as another table, given in the form schema.table=schema.new_table. --redirect-table can be specified multiple times.")
 	flagSet.Int(COPY_QUEUE_SIZE, 1, "Number of COPY commands gprestore should enqueue when restoring a backup taken using the --single-data-file option")
 	flagSet.Bool(WITH_GLOBALS, false, "Restore global metadata")
+	flagSet.StringArray(TABLESPACE_MAP, []string{}, "Restore the objects in a tablespace to another tablespace that exists in the restore cluster, given in the form old=new. --tablespace-map can be specified multiple times.")
 	flagSet.String(TIMESTAMP, "", "The timestamp to be restored, in the format YYYYMMDDHHMMSS")
 	flagSet.Bool(TRUNCATE_TABLE, false, "Removes data of the tables getting restored")
 	flagSet.Bool(VERBOSE, false, "Print verbose log messages")
@@ -124,6 +185,7 @@ func SetRestoreFlagDefaults(flagSet *pflag.FlagSet) {
 	flagSet.Bool(RUN_ANALYZE, false, "Run ANALYZE on restored tables")
 	flagSet.Bool(RESIZE_CLUSTER, false, "Restore a backup taken on a cluster with more or fewer segments than the cluster to which it will be restored")
 	flagSet.String(REPORT_DIR, "", "The absolute path of the directory to which restore report and error tables will be written")
+	flagSet.Bool(VERIFY_ONLY, false, "Verify that the backup data files match the table of contents on every segment, without restoring anything")
 	_ = flagSet.MarkHidden(LEAF_PARTITION_DATA)
 }
 
@@ -162,6 +224,22 @@ func HandleSingleDashes(args []string) []string {
 	return newArgs
 }
 
+// Each mapping given to a flag such as --role-map is of the form old=new, taking the name old to the name new
+func ParseNameMap(flagName string, mappings []string) (map[string]string, error) {
+	nameMap := make(map[string]string, len(mappings))
+	for _, mapping := range mappings {
+		oldName, newName, found := strings.Cut(mapping, "=")
+		if !found || oldName == "" || newName == "" {
+			return nil, errors.Errorf("Invalid --%s value %s; it must be of the form old=new", flagName, mapping)
+		}
+		if _, ok := nameMap[oldName]; ok {
+			return nil, errors.Errorf("%s is mapped more than once by --%s", oldName, flagName)
+		}
+		nameMap[oldName] = newName
+	}
+	return nameMap, nil
+}
+
 func MustGetFlagString(cmdFlags *pflag.FlagSet, flagName string) string {
 	value, err := cmdFlags.GetString(flagName)
 	gplog.FatalOnError(err)
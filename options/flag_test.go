@@ -57,5 +57,23 @@ var _ = Describe("utils/flag tests", func() {
 				Expect(result).To(Equal([]string{"-s", "some_argument"}))
 			})
 		})
+		Context("ParseNameMap", func() {
+			It("maps each old name to its new name", func() {
+				roleMap, err := options.ParseNameMap(options.ROLE_MAP, []string{"prod_owner=dev_owner", "Reader=dev=reader"})
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(roleMap).To(Equal(map[string]string{"prod_owner": "dev_owner", "Reader": "dev=reader"}))
+			})
+			It("returns an error for a mapping without a new name", func() {
+				_, err := options.ParseNameMap(options.ROLE_MAP, []string{"prod_owner="})
+
+				Expect(err).To(MatchError("Invalid --role-map value prod_owner=; it must be of the form old=new"))
+			})
+			It("returns an error for a name that is mapped twice", func() {
+				_, err := options.ParseNameMap(options.ROLE_MAP, []string{"prod_owner=dev_owner", "prod_owner=test_owner"})
+
+				Expect(err).To(MatchError("prod_owner is mapped more than once by --role-map"))
+			})
+		})
 	})
 })
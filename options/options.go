@@ -3,14 +3,17 @@ package options
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
 )
 
 // This is meant to be a read only package. Values inside should only be
@@ -49,11 +52,19 @@ func NewOptions(initialFlags *pflag.FlagSet) (*Options, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = utils.ValidateFilterPatterns(includedSchemas)
+	if err != nil {
+		return nil, err
+	}
 
 	excludedSchemas, err := setFiltersFromFile(initialFlags, EXCLUDE_SCHEMA, EXCLUDE_SCHEMA_FILE)
 	if err != nil {
 		return nil, err
 	}
+	err = utils.ValidateFilterPatterns(excludedSchemas)
+	if err != nil {
+		return nil, err
+	}
 
 	leafPartitionData, err := initialFlags.GetBool(LEAF_PARTITION_DATA)
 	if err != nil {
@@ -140,6 +151,75 @@ func (o *Options) AddIncludedRelation(relation string) {
 	o.IncludedRelations = append(o.IncludedRelations, relation)
 }
 
+func (o Options) HasSchemaPatterns() bool {
+	return hasFilterPatterns(o.IncludedSchemas) || hasFilterPatterns(o.ExcludedSchemas)
+}
+
+func (o Options) HasRelationPatterns() bool {
+	return hasFilterPatterns(o.IncludedRelations) || hasFilterPatterns(o.ExcludedRelations)
+}
+
+func hasFilterPatterns(filters []string) bool {
+	for _, filter := range filters {
+		if utils.IsFilterPattern(filter) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * The names map the unquoted name of each schema to the name used in the
+ * filters.  The flags are updated along with the options, since gpbackup
+ * reads the schema filters from the flags.
+ */
+func (o *Options) ExpandSchemaPatterns(flags *pflag.FlagSet, schemaNames map[string]string) error {
+	var err error
+	o.IncludedSchemas, err = expandFilterPatterns(flags, INCLUDE_SCHEMA, o.IncludedSchemas, schemaNames, "schema", false)
+	if err != nil {
+		return err
+	}
+	o.ExcludedSchemas, err = expandFilterPatterns(flags, EXCLUDE_SCHEMA, o.ExcludedSchemas, schemaNames, "schema", true)
+	return err
+}
+
+// The names map the unquoted "schema.table" name of each relation to the name used in the filters
+func (o *Options) ExpandRelationPatterns(flags *pflag.FlagSet, relationNames map[string]string) error {
+	var err error
+	o.IncludedRelations, err = expandFilterPatterns(flags, INCLUDE_RELATION, o.IncludedRelations, relationNames, "table", false)
+	if err != nil {
+		return err
+	}
+	o.originalIncludedRelations = o.IncludedRelations
+	o.ExcludedRelations, err = expandFilterPatterns(flags, EXCLUDE_RELATION, o.ExcludedRelations, relationNames, "table", true)
+	return err
+}
+
+func expandFilterPatterns(flags *pflag.FlagSet, filterFlag string, filters []string, names map[string]string, objectType string, excludeSet bool) ([]string, error) {
+	if !hasFilterPatterns(filters) {
+		return filters, nil
+	}
+	expanded, unmatched, err := utils.ExpandFilterPatterns(filters, names)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range unmatched {
+		if excludeSet {
+			gplog.Warn("Excluded %s pattern %s does not match any %s", objectType, pattern, objectType)
+		} else {
+			return nil, errors.Errorf("Included %s pattern %s does not match any %s", objectType, pattern, objectType)
+		}
+	}
+	gplog.Verbose("Expanded --%s patterns to: %s", filterFlag, strings.Join(expanded, ", "))
+	if flag := flags.Lookup(filterFlag); flag != nil {
+		err = flag.Value.(pflag.SliceValue).Replace(expanded)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
 type Relation struct {
 	SchemaOid uint32
 	Oid       uint32
@@ -152,7 +232,14 @@ func QuoteTableNames(conn *dbconn.DBConn, tableNames []string) ([]string, error)
 		return []string{}, nil
 	}
 
-	fqnSlice, err := SeparateSchemaAndTable(tableNames)
+	// Patterns are matched against unquoted names, so they are left as they are
+	names := make([]string, 0, len(tableNames))
+	for _, tableName := range tableNames {
+		if !utils.IsFilterPattern(tableName) {
+			names = append(names, tableName)
+		}
+	}
+	fqnSlice, err := SeparateSchemaAndTable(names)
 	if err != nil {
 		return nil, err
 	}
@@ -172,10 +259,138 @@ func QuoteTableNames(conn *dbconn.DBConn, tableNames []string) ([]string, error)
 		quoted := queryResultTable[0].SchemaName + "." + queryResultTable[0].TableName
 		result = append(result, quoted)
 	}
+	for _, tableName := range tableNames {
+		if utils.IsFilterPattern(tableName) {
+			result = append(result, tableName)
+		}
+	}
 
 	return result, nil
 }
 
+/*
+ * Each table given to --redirect-table is restored as a different table, so
+ * the tables must be named exactly and no two may be restored as the same one.
+ */
+func ParseRedirectTableMap(mappings []string) (map[string]string, error) {
+	tableMap, err := ParseNameMap(REDIRECT_TABLE, mappings)
+	if err != nil {
+		return nil, err
+	}
+	oldTables := make([]string, 0, len(tableMap))
+	for oldTable := range tableMap {
+		oldTables = append(oldTables, oldTable)
+	}
+	sort.Strings(oldTables)
+	redirectedTables := make(map[string]string, len(tableMap))
+	for _, oldTable := range oldTables {
+		newTable := tableMap[oldTable]
+		for _, table := range []string{oldTable, newTable} {
+			if utils.IsFilterPattern(table) {
+				return nil, errors.Errorf("--%s does not accept patterns, but %s is given", REDIRECT_TABLE, table)
+			}
+		}
+		err = utils.ValidateFQNs([]string{oldTable, newTable})
+		if err != nil {
+			return nil, err
+		}
+		if otherTable, ok := redirectedTables[newTable]; ok {
+			return nil, errors.Errorf("Tables %s and %s cannot both be redirected to %s", otherTable, oldTable, newTable)
+		}
+		redirectedTables[newTable] = oldTable
+	}
+	return tableMap, nil
+}
+
+/*
+ * A row filter file maps each table whose data is filtered to the predicate
+ * that the rows backed up must satisfy, as in a WHERE clause:
+ *
+ * public.events: created_at > now() - interval '90 days'
+ * sales.orders: region = 'EMEA'
+ */
+func ReadRowFilterFile(filename string) (map[string]string, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read row filter file %s", filename)
+	}
+	rowFilters := make(map[string]string)
+	err = yaml.UnmarshalStrict(contents, &rowFilters)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse row filter file %s", filename)
+	}
+	tables := make([]string, 0, len(rowFilters))
+	for table := range rowFilters {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		if utils.IsFilterPattern(table) {
+			return nil, errors.Errorf("--%s does not accept patterns, but %s is given", ROW_FILTER_FILE, table)
+		}
+		if strings.TrimSpace(rowFilters[table]) == "" {
+			return nil, errors.Errorf("No predicate is given for table %s in row filter file %s", table, filename)
+		}
+	}
+	err = utils.ValidateFQNs(tables)
+	if err != nil {
+		return nil, err
+	}
+	return rowFilters, nil
+}
+
+/*
+ * A masking rules file maps each table with masked columns to the expression
+ * whose value is backed up in place of the data of each of those columns,
+ * where null is the SQL NULL:
+ *
+ * public.customers:
+ *   email: md5(email)
+ *   phone: null
+ *   name: "'redacted'"
+ */
+func ReadMaskingRulesFile(filename string) (map[string]map[string]string, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read masking rules file %s", filename)
+	}
+	rules := make(map[string]map[string]*string)
+	err = yaml.UnmarshalStrict(contents, &rules)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse masking rules file %s", filename)
+	}
+	tables := make([]string, 0, len(rules))
+	for table := range rules {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	maskingRules := make(map[string]map[string]string, len(rules))
+	for _, table := range tables {
+		if utils.IsFilterPattern(table) {
+			return nil, errors.Errorf("--%s does not accept patterns, but %s is given", MASKING_RULES_FILE, table)
+		}
+		if len(rules[table]) == 0 {
+			return nil, errors.Errorf("No columns are given for table %s in masking rules file %s", table, filename)
+		}
+		maskingRules[table] = make(map[string]string, len(rules[table]))
+		for column, expression := range rules[table] {
+			if expression == nil {
+				maskingRules[table][column] = "NULL"
+				continue
+			}
+			if strings.TrimSpace(*expression) == "" {
+				return nil, errors.Errorf("No expression is given for column %s of table %s in masking rules file %s", column, table, filename)
+			}
+			maskingRules[table][column] = *expression
+		}
+	}
+	err = utils.ValidateFQNs(tables)
+	if err != nil {
+		return nil, err
+	}
+	return maskingRules, nil
+}
+
 func SeparateSchemaAndTable(tableNames []string) ([]Relation, error) {
 	fqnSlice := make([]Relation, 0)
 
@@ -6,6 +6,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/spf13/pflag"
@@ -202,6 +203,13 @@ var _ = Describe("options", func() {
 			_, err = options.NewOptions(myflags)
 			Expect(err).To(HaveOccurred())
 		})
+		It("returns an error upon an invalid regular expression", func() {
+			err := myflags.Set(options.INCLUDE_SCHEMA, "re:stg_(")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = options.NewOptions(myflags)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`Invalid regular expression in filter "re:stg_("`))
+		})
 		Describe("AddIncludeRelation", func() {
 			It("it adds a relation", func() {
 				subject, err := options.NewOptions(myflags)
@@ -313,5 +321,189 @@ var _ = Describe("options", func() {
 			Expect(err).To(Not(HaveOccurred()))
 			Expect(tablenames).To(Equal(quotedTableNames))
 		})
+		It("leaves patterns unquoted", func() {
+			tablenames := []string{"glob:stg.load_*", "public.foo"}
+			queryMock := mockdb.ExpectQuery("SELECT quote_")
+			resultRows := sqlmock.NewRows([]string{"schemaname", "tablename"}).
+				AddRow("public", "foo")
+			queryMock.WillReturnRows(resultRows)
+
+			quotedTableNames, err := options.QuoteTableNames(conn, tablenames)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(quotedTableNames).To(Equal([]string{"public.foo", "glob:stg.load_*"}))
+		})
+	})
+	Describe("ExpandRelationPatterns", func() {
+		relationNames := map[string]string{
+			"stg.load_orders":    "stg.load_orders",
+			"stg.load_customers": "stg.load_customers",
+			"stg.archive":        "stg.archive",
+			"My Schema.Sales":    `"My Schema"."Sales"`,
+		}
+		It("replaces the patterns in the options and the flags with the relations that they match", func() {
+			Expect(myflags.Set(options.INCLUDE_RELATION, "glob:stg.load_*")).To(Succeed())
+			Expect(myflags.Set(options.INCLUDE_RELATION, "re:My Schema\\.[A-Z].*")).To(Succeed())
+			Expect(myflags.Set(options.INCLUDE_RELATION, "public.foo")).To(Succeed())
+			subject, err := options.NewOptions(myflags)
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = subject.ExpandRelationPatterns(myflags, relationNames)
+
+			Expect(err).To(Not(HaveOccurred()))
+			expected := []string{"stg.load_customers", "stg.load_orders", `"My Schema"."Sales"`, "public.foo"}
+			Expect(subject.GetIncludedTables()).To(Equal(expected))
+			Expect(subject.GetOriginalIncludedTables()).To(Equal(expected))
+			Expect(options.MustGetFlagStringArray(myflags, options.INCLUDE_RELATION)).To(Equal(expected))
+		})
+		It("returns an error if an included pattern matches no relations", func() {
+			Expect(myflags.Set(options.INCLUDE_RELATION, "glob:stg.tmp_*")).To(Succeed())
+			subject, err := options.NewOptions(myflags)
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = subject.ExpandRelationPatterns(myflags, relationNames)
+
+			Expect(err).To(MatchError("Included table pattern glob:stg.tmp_* does not match any table"))
+		})
+		It("drops an excluded pattern that matches no relations", func() {
+			Expect(myflags.Set(options.EXCLUDE_RELATION, "glob:stg.tmp_*")).To(Succeed())
+			subject, err := options.NewOptions(myflags)
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = subject.ExpandRelationPatterns(myflags, relationNames)
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(subject.GetExcludedTables()).To(BeEmpty())
+		})
+	})
+	Describe("ExpandSchemaPatterns", func() {
+		It("replaces the patterns in the options and the flags with the schemas that they match", func() {
+			Expect(myflags.Set(options.EXCLUDE_SCHEMA, "glob:stg_[0-9]*")).To(Succeed())
+			subject, err := options.NewOptions(myflags)
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = subject.ExpandSchemaPatterns(myflags, map[string]string{"stg_1": "stg_1", "stg_2": "stg_2", "stg_old": "stg_old"})
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(subject.GetExcludedSchemas()).To(Equal([]string{"stg_1", "stg_2"}))
+			Expect(options.MustGetFlagStringArray(myflags, options.EXCLUDE_SCHEMA)).To(Equal([]string{"stg_1", "stg_2"}))
+		})
+	})
+	Describe("ParseRedirectTableMap", func() {
+		It("maps each table to the table to redirect it to", func() {
+			tableMap, err := options.ParseRedirectTableMap([]string{"public.orders=archive.orders_2023"})
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(tableMap).To(Equal(map[string]string{"public.orders": "archive.orders_2023"}))
+		})
+		It("returns an error for a table that is not fully qualified", func() {
+			_, err := options.ParseRedirectTableMap([]string{"public.orders=orders_2023"})
+
+			Expect(err).To(HaveOccurred())
+		})
+		It("returns an error for a pattern", func() {
+			_, err := options.ParseRedirectTableMap([]string{"glob:public.orders_*=archive.orders"})
+
+			Expect(err).To(MatchError("--redirect-table does not accept patterns, but glob:public.orders_* is given"))
+		})
+		It("returns an error for two tables redirected to the same table", func() {
+			_, err := options.ParseRedirectTableMap([]string{"public.orders=archive.orders", "sales.orders=archive.orders"})
+
+			Expect(err).To(MatchError("Tables public.orders and sales.orders cannot both be redirected to archive.orders"))
+		})
+	})
+	Describe("ReadRowFilterFile", func() {
+		var rowFilterFile string
+		BeforeEach(func() {
+			operating.System.ReadFile = func(filename string) ([]byte, error) { return []byte(rowFilterFile), nil }
+		})
+		AfterEach(func() {
+			operating.InitializeSystemFunctions()
+		})
+		It("maps each table to the predicate its rows must satisfy", func() {
+			rowFilterFile = `public.events: created_at > now() - interval '90 days'
+sales.orders: "region = 'EMEA'"
+`
+
+			rowFilters, err := options.ReadRowFilterFile("filters.yaml")
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(rowFilters).To(Equal(map[string]string{
+				"public.events": "created_at > now() - interval '90 days'",
+				"sales.orders":  "region = 'EMEA'",
+			}))
+		})
+		It("returns an error for a table that is not fully qualified", func() {
+			rowFilterFile = "events: id > 0\n"
+
+			_, err := options.ReadRowFilterFile("filters.yaml")
+
+			Expect(err).To(HaveOccurred())
+		})
+		It("returns an error for a pattern", func() {
+			rowFilterFile = "glob:public.events_*: id > 0\n"
+
+			_, err := options.ReadRowFilterFile("filters.yaml")
+
+			Expect(err).To(MatchError("--row-filter-file does not accept patterns, but glob:public.events_* is given"))
+		})
+		It("returns an error for a table without a predicate", func() {
+			rowFilterFile = "public.events:\n"
+
+			_, err := options.ReadRowFilterFile("filters.yaml")
+
+			Expect(err).To(MatchError("No predicate is given for table public.events in row filter file filters.yaml"))
+		})
+	})
+	Describe("ReadMaskingRulesFile", func() {
+		var maskingRulesFile string
+		BeforeEach(func() {
+			operating.System.ReadFile = func(filename string) ([]byte, error) { return []byte(maskingRulesFile), nil }
+		})
+		AfterEach(func() {
+			operating.InitializeSystemFunctions()
+		})
+		It("maps the masked columns of each table to their expressions", func() {
+			maskingRulesFile = `public.customers:
+  email: md5(email)
+  phone: null
+  name: "'redacted'"
+  age: 0
+`
+
+			maskingRules, err := options.ReadMaskingRulesFile("masking.yaml")
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(maskingRules).To(Equal(map[string]map[string]string{
+				"public.customers": {"email": "md5(email)", "phone": "NULL", "name": "'redacted'", "age": "0"},
+			}))
+		})
+		It("returns an error for a table that is not fully qualified", func() {
+			maskingRulesFile = "customers:\n  email: md5(email)\n"
+
+			_, err := options.ReadMaskingRulesFile("masking.yaml")
+
+			Expect(err).To(HaveOccurred())
+		})
+		It("returns an error for a pattern", func() {
+			maskingRulesFile = "glob:public.customers_*:\n  email: md5(email)\n"
+
+			_, err := options.ReadMaskingRulesFile("masking.yaml")
+
+			Expect(err).To(MatchError("--masking-rules-file does not accept patterns, but glob:public.customers_* is given"))
+		})
+		It("returns an error for a table without columns", func() {
+			maskingRulesFile = "public.customers: {}\n"
+
+			_, err := options.ReadMaskingRulesFile("masking.yaml")
+
+			Expect(err).To(MatchError("No columns are given for table public.customers in masking rules file masking.yaml"))
+		})
+		It("returns an error for a column without an expression", func() {
+			maskingRulesFile = "public.customers:\n  email: ''\n"
+
+			_, err := options.ReadMaskingRulesFile("masking.yaml")
+
+			Expect(err).To(MatchError("No expression is given for column email of table public.customers in masking rules file masking.yaml"))
+		})
 	})
 })
@@ -0,0 +1,329 @@
+package report
+
+/*
+ * This file contains structs and functions for writing backup and restore
+ * metrics in the OpenMetrics text format, to be read by the textfile
+ * collector of the Prometheus node_exporter.
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * The in-progress metrics describe the latest backup or restore of a database
+ * and are updated while its data is backed up or restored, while the
+ * remaining metrics describe the latest one to complete, successfully or not.
+ */
+type Metrics struct {
+	Utility         string
+	DatabaseName    string
+	InProgress      bool
+	StartTime       time.Time
+	TablesCompleted int64
+	TablesTotal     int64
+
+	EndTime           time.Time
+	Succeeded         bool
+	Bytes             int64
+	UncompressedBytes int64
+	Rows              int64
+	Tables            int64
+	Errors            int64
+}
+
+type metricFamily struct {
+	name       string
+	help       string
+	inProgress bool
+}
+
+/*
+ * The metrics of both utilities are listed so that gpbackup and gprestore can
+ * share a metrics file without removing each other's metrics.
+ */
+var metricFamilies = append(getMetricFamilies("gpbackup", "backup", "backed up"), getMetricFamilies("gprestore", "restore", "restored")...)
+
+func getMetricFamilies(utility string, operation string, verb string) []metricFamily {
+	return []metricFamily{
+		{utility + "_in_progress", fmt.Sprintf("Whether a %s of the database is in progress", operation), true},
+		{utility + "_start_timestamp_seconds", fmt.Sprintf("Start time of the latest %s of the database", operation), true},
+		{utility + "_progress_tables", fmt.Sprintf("Number of tables whose data the latest %s of the database has %s", operation, verb), true},
+		{utility + "_progress_tables_total", fmt.Sprintf("Number of tables whose data the latest %s of the database is to have %s", operation, verb), true},
+		{utility + "_status", fmt.Sprintf("Whether the latest completed %s of the database succeeded (1) or failed (0)", operation), false},
+		{utility + "_end_timestamp_seconds", fmt.Sprintf("End time of the latest completed %s of the database", operation), false},
+		{utility + "_duration_seconds", fmt.Sprintf("Duration of the latest completed %s of the database", operation), false},
+		{utility + "_bytes", fmt.Sprintf("Bytes of table data %s by the latest completed %s of the database, as stored in the backup", verb, operation), false},
+		{utility + "_uncompressed_bytes", fmt.Sprintf("Bytes of table data %s by the latest completed %s of the database, before compression", verb, operation), false},
+		{utility + "_rows", fmt.Sprintf("Rows %s by the latest completed %s of the database", verb, operation), false},
+		{utility + "_tables", fmt.Sprintf("Number of tables whose data the latest completed %s of the database %s", operation, verb), false},
+		{utility + "_errors", fmt.Sprintf("Number of errors encountered by the latest completed %s of the database", operation), false},
+		{utility + "_last_success_timestamp_seconds", fmt.Sprintf("End time of the latest successful %s of the database", operation), false},
+	}
+}
+
+var metricSampleRegex = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)\{database="((?:[^"\\]|\\.)*)"\} (\S+)$`)
+
+/*
+ * The samples of each metric are keyed by the escaped name of the database,
+ * so that the samples read from a metrics file are written back unchanged.
+ */
+type metricSamples map[string]map[string]string
+
+func (samples metricSamples) set(name string, database string, value string) {
+	if samples[name] == nil {
+		samples[name] = make(map[string]string)
+	}
+	samples[name][database] = value
+}
+
+func readMetricSamples(filename string) (metricSamples, error) {
+	samples := make(metricSamples)
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return samples, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		match := metricSampleRegex.FindStringSubmatch(scanner.Text())
+		if match != nil {
+			samples.set(match[1], match[2], match[3])
+		}
+	}
+	return samples, scanner.Err()
+}
+
+func escapeMetricLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatMetricTimestamp(timestamp time.Time) string {
+	return strconv.FormatFloat(float64(timestamp.UnixNano())/float64(time.Second), 'f', -1, 64)
+}
+
+func formatMetricBool(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+func (metrics Metrics) getSampleValues() map[string]string {
+	prefix := metrics.Utility + "_"
+	values := map[string]string{
+		prefix + "in_progress":           formatMetricBool(metrics.InProgress),
+		prefix + "progress_tables":       strconv.FormatInt(metrics.TablesCompleted, 10),
+		prefix + "progress_tables_total": strconv.FormatInt(metrics.TablesTotal, 10),
+	}
+	if !metrics.StartTime.IsZero() {
+		values[prefix+"start_timestamp_seconds"] = formatMetricTimestamp(metrics.StartTime)
+	}
+	if metrics.InProgress {
+		return values
+	}
+	values[prefix+"status"] = formatMetricBool(metrics.Succeeded)
+	values[prefix+"end_timestamp_seconds"] = formatMetricTimestamp(metrics.EndTime)
+	if !metrics.StartTime.IsZero() {
+		values[prefix+"duration_seconds"] = strconv.FormatFloat(metrics.EndTime.Sub(metrics.StartTime).Seconds(), 'f', -1, 64)
+	}
+	values[prefix+"bytes"] = strconv.FormatInt(metrics.Bytes, 10)
+	values[prefix+"uncompressed_bytes"] = strconv.FormatInt(metrics.UncompressedBytes, 10)
+	values[prefix+"rows"] = strconv.FormatInt(metrics.Rows, 10)
+	values[prefix+"tables"] = strconv.FormatInt(metrics.Tables, 10)
+	values[prefix+"errors"] = strconv.FormatInt(metrics.Errors, 10)
+	if metrics.Succeeded {
+		values[prefix+"last_success_timestamp_seconds"] = formatMetricTimestamp(metrics.EndTime)
+	}
+	return values
+}
+
+/*
+ * The metrics of other databases, and those of this database that are not
+ * replaced, are kept from the existing metrics file.  The file is replaced
+ * with a rename, so that the collector never reads a partially written file.
+ *
+ * Concurrent gpbackup and gprestore runs share the file, so the whole
+ * read-merge-rename is done under an exclusive lock on a sidecar lock file;
+ * the metrics file itself cannot be locked, as the rename replaces it.
+ */
+func WriteMetricsFile(filename string, metrics Metrics) error {
+	lockFile, err := os.OpenFile(filename+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write metrics file %s", filename)
+	}
+	defer lockFile.Close()
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write metrics file %s", filename)
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	return writeMetricsFile(filename, metrics)
+}
+
+func writeMetricsFile(filename string, metrics Metrics) error {
+	samples, err := readMetricSamples(filename)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read metrics file %s", filename)
+	}
+	database := escapeMetricLabelValue(metrics.DatabaseName)
+	values := metrics.getSampleValues()
+	for _, family := range metricFamilies {
+		if !strings.HasPrefix(family.name, metrics.Utility+"_") || (metrics.InProgress && !family.inProgress) {
+			continue
+		}
+		if value, ok := values[family.name]; ok {
+			samples.set(family.name, database, value)
+		} else if family.name != metrics.Utility+"_last_success_timestamp_seconds" {
+			delete(samples[family.name], database)
+		}
+	}
+
+	var contents strings.Builder
+	for _, family := range metricFamilies {
+		if len(samples[family.name]) == 0 {
+			continue
+		}
+		contents.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s gauge\n", family.name, family.help, family.name))
+		databases := make([]string, 0, len(samples[family.name]))
+		for db := range samples[family.name] {
+			databases = append(databases, db)
+		}
+		sort.Strings(databases)
+		for _, db := range databases {
+			contents.WriteString(fmt.Sprintf("%s{database=\"%s\"} %s\n", family.name, db, samples[family.name][db]))
+		}
+	}
+	contents.WriteString("# EOF\n")
+
+	tempFile, err := os.CreateTemp(path.Dir(filename), path.Base(filename)+".*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write metrics file %s", filename)
+	}
+	_, err = tempFile.WriteString(contents.String())
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempFile.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), filename)
+	}
+	if err != nil {
+		_ = utils.RemoveFileIfExists(tempFile.Name())
+		return errors.Wrapf(err, "Unable to write metrics file %s", filename)
+	}
+	return nil
+}
+
+func sumTableReports(metrics *Metrics, tables []TableReport) {
+	metrics.Tables = int64(len(tables))
+	for _, table := range tables {
+		metrics.Rows += table.Rows
+		metrics.Bytes += table.Bytes
+		metrics.UncompressedBytes += table.UncompressedBytes
+	}
+}
+
+/*
+ * gpbackup stops at the first error, so a failed backup counts one error.
+ */
+func (report *Report) NewBackupMetrics(timestamp string, endtime time.Time, tables []TableReport, backupFailed bool) Metrics {
+	startTime, _ := time.ParseInLocation("20060102150405", timestamp, endtime.Location())
+	metrics := Metrics{
+		Utility:         "gpbackup",
+		DatabaseName:    utils.UnquoteIdent(report.DatabaseName),
+		StartTime:       startTime,
+		TablesCompleted: int64(len(tables)),
+		TablesTotal:     int64(len(tables)),
+		EndTime:         endtime,
+		Succeeded:       !backupFailed,
+	}
+	sumTableReports(&metrics, tables)
+	if !metrics.Succeeded {
+		metrics.Errors = 1
+	}
+	return metrics
+}
+
+/*
+ * A restore that continued past errors with --on-error-continue completed,
+ * so it counts as a success, with an error for each table that failed to
+ * restore; a restore that failed otherwise counts at least one error.
+ */
+func NewRestoreMetrics(jsonReport RestoreJSONReport, databaseName string) Metrics {
+	startTime, _ := time.Parse(time.RFC3339, jsonReport.StartTime)
+	endTime, _ := time.Parse(time.RFC3339, jsonReport.EndTime)
+	metrics := Metrics{
+		Utility:         "gprestore",
+		DatabaseName:    databaseName,
+		StartTime:       startTime,
+		TablesCompleted: int64(len(jsonReport.Tables)),
+		EndTime:         endTime,
+		Succeeded:       jsonReport.Status != history.BackupStatusFailed,
+		Errors:          int64(len(jsonReport.ErrorTablesMetadata) + len(jsonReport.ErrorTablesData)),
+	}
+	metrics.TablesTotal = metrics.TablesCompleted + int64(len(jsonReport.ErrorTablesData))
+	sumTableReports(&metrics, jsonReport.Tables)
+	if !metrics.Succeeded && metrics.Errors == 0 {
+		metrics.Errors = 1
+	}
+	return metrics
+}
+
+/*
+ * The in-progress metrics are written when the updates start and then at
+ * every interval, until the returned function is called to stop them, which
+ * may be done more than once.  Failing to write metrics does not fail the
+ * backup or restore.
+ */
+func StartMetricsUpdates(filename string, interval time.Duration, getMetrics func() Metrics) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		warned := false
+		for {
+			err := WriteMetricsFile(filename, getMetrics())
+			if err != nil && !warned {
+				gplog.Warn("%v", err)
+				warned = true
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
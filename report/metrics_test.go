@@ -0,0 +1,227 @@
+package report_test
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/report"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("report/metrics tests", func() {
+	var (
+		tempDir         string
+		metricsFilename string
+		startTime       = time.Date(2017, 1, 1, 1, 1, 1, 0, time.UTC)
+		endTime         = time.Date(2017, 1, 1, 1, 2, 31, 0, time.UTC)
+	)
+	BeforeEach(func() {
+		var err error
+		tempDir, err = os.MkdirTemp("", "metrics")
+		Expect(err).ToNot(HaveOccurred())
+		metricsFilename = path.Join(tempDir, "gpbackup.prom")
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+	readMetricsFile := func() string {
+		contents, err := os.ReadFile(metricsFilename)
+		Expect(err).ToNot(HaveOccurred())
+		return string(contents)
+	}
+
+	Describe("WriteMetricsFile", func() {
+		completedMetrics := report.Metrics{
+			Utility:           "gpbackup",
+			DatabaseName:      "testdb",
+			StartTime:         startTime,
+			TablesCompleted:   2,
+			TablesTotal:       2,
+			EndTime:           endTime,
+			Succeeded:         true,
+			Bytes:             100,
+			UncompressedBytes: 400,
+			Rows:              30,
+			Tables:            2,
+		}
+		It("writes the metrics of a completed backup", func() {
+			Expect(report.WriteMetricsFile(metricsFilename, completedMetrics)).To(Succeed())
+
+			contents := readMetricsFile()
+			Expect(contents).To(ContainSubstring(`# HELP gpbackup_status Whether the latest completed backup of the database succeeded (1) or failed (0)
+# TYPE gpbackup_status gauge
+gpbackup_status{database="testdb"} 1
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_in_progress{database="testdb"} 0
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_duration_seconds{database="testdb"} 90
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_bytes{database="testdb"} 100
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_uncompressed_bytes{database="testdb"} 400
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_rows{database="testdb"} 30
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_tables{database="testdb"} 2
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_errors{database="testdb"} 0
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_last_success_timestamp_seconds{database="testdb"} 1483232551
+`))
+			Expect(contents).ToNot(ContainSubstring("gprestore"))
+			Expect(contents).To(HaveSuffix("# EOF\n"))
+		})
+		It("keeps the metrics of other databases and utilities", func() {
+			otherMetrics := completedMetrics
+			otherMetrics.DatabaseName = "otherdb"
+			Expect(report.WriteMetricsFile(metricsFilename, otherMetrics)).To(Succeed())
+			restoreMetrics := completedMetrics
+			restoreMetrics.Utility = "gprestore"
+			Expect(report.WriteMetricsFile(metricsFilename, restoreMetrics)).To(Succeed())
+
+			Expect(report.WriteMetricsFile(metricsFilename, completedMetrics)).To(Succeed())
+
+			contents := readMetricsFile()
+			Expect(contents).To(ContainSubstring(`gpbackup_rows{database="otherdb"} 30
+gpbackup_rows{database="testdb"} 30
+`))
+			Expect(contents).To(ContainSubstring(`gprestore_rows{database="testdb"} 30
+`))
+		})
+		It("keeps the time of the last successful backup when a backup fails", func() {
+			Expect(report.WriteMetricsFile(metricsFilename, completedMetrics)).To(Succeed())
+			failedMetrics := report.Metrics{Utility: "gpbackup", DatabaseName: "testdb", EndTime: endTime.Add(time.Hour), Errors: 1}
+
+			Expect(report.WriteMetricsFile(metricsFilename, failedMetrics)).To(Succeed())
+
+			contents := readMetricsFile()
+			Expect(contents).To(ContainSubstring(`gpbackup_status{database="testdb"} 0
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_errors{database="testdb"} 1
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_last_success_timestamp_seconds{database="testdb"} 1483232551
+`))
+			Expect(contents).ToNot(ContainSubstring("gpbackup_start_timestamp_seconds"))
+			Expect(contents).ToNot(ContainSubstring("gpbackup_duration_seconds"))
+		})
+		It("only replaces the in-progress metrics while a backup is in progress", func() {
+			Expect(report.WriteMetricsFile(metricsFilename, completedMetrics)).To(Succeed())
+			progressMetrics := report.Metrics{Utility: "gpbackup", DatabaseName: "testdb", InProgress: true, StartTime: endTime, TablesCompleted: 1, TablesTotal: 5}
+
+			Expect(report.WriteMetricsFile(metricsFilename, progressMetrics)).To(Succeed())
+
+			contents := readMetricsFile()
+			Expect(contents).To(ContainSubstring(`gpbackup_in_progress{database="testdb"} 1
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_start_timestamp_seconds{database="testdb"} 1483232551
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_progress_tables{database="testdb"} 1
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_progress_tables_total{database="testdb"} 5
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_status{database="testdb"} 1
+`))
+			Expect(contents).To(ContainSubstring(`gpbackup_duration_seconds{database="testdb"} 90
+`))
+		})
+		It("keeps the metrics of every database when they are written concurrently", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					metrics := completedMetrics
+					metrics.DatabaseName = fmt.Sprintf("db%d", i)
+					Expect(report.WriteMetricsFile(metricsFilename, metrics)).To(Succeed())
+				}(i)
+			}
+			wg.Wait()
+
+			contents := readMetricsFile()
+			for i := 0; i < 10; i++ {
+				Expect(contents).To(ContainSubstring(fmt.Sprintf(`gpbackup_rows{database="db%d"} 30
+`, i)))
+			}
+		})
+		It("escapes the name of the database", func() {
+			metrics := completedMetrics
+			metrics.DatabaseName = `test"db\`
+
+			Expect(report.WriteMetricsFile(metricsFilename, metrics)).To(Succeed())
+			Expect(report.WriteMetricsFile(metricsFilename, completedMetrics)).To(Succeed())
+
+			contents := readMetricsFile()
+			Expect(contents).To(ContainSubstring(`gpbackup_rows{database="test\"db\\"} 30
+gpbackup_rows{database="testdb"} 30
+`))
+		})
+		It("returns an error if the metrics file cannot be written", func() {
+			err := report.WriteMetricsFile(path.Join(tempDir, "missing", "gpbackup.prom"), completedMetrics)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unable to write metrics file"))
+		})
+	})
+	Describe("NewBackupMetrics", func() {
+		backupReport := &report.Report{BackupConfig: history.BackupConfig{DatabaseName: `"Test DB"`}}
+		tables := []report.TableReport{
+			{Schema: "public", Name: "foo", Rows: 10, Bytes: 5, UncompressedBytes: 20},
+			{Schema: "public", Name: "bar", Rows: 20, Bytes: 7, UncompressedBytes: 30},
+		}
+		It("sums the tables of a successful backup", func() {
+			metrics := backupReport.NewBackupMetrics("20170101010101", endTime, tables, false)
+
+			Expect(metrics.DatabaseName).To(Equal("Test DB"))
+			Expect(metrics.StartTime).To(Equal(startTime))
+			Expect(metrics.Succeeded).To(BeTrue())
+			Expect(metrics.Tables).To(Equal(int64(2)))
+			Expect(metrics.Rows).To(Equal(int64(30)))
+			Expect(metrics.Bytes).To(Equal(int64(12)))
+			Expect(metrics.UncompressedBytes).To(Equal(int64(50)))
+			Expect(metrics.Errors).To(Equal(int64(0)))
+		})
+		It("counts an error for a failed backup", func() {
+			metrics := backupReport.NewBackupMetrics("20170101010101", endTime, tables, true)
+
+			Expect(metrics.Succeeded).To(BeFalse())
+			Expect(metrics.Errors).To(Equal(int64(1)))
+		})
+	})
+	Describe("NewRestoreMetrics", func() {
+		jsonReport := report.RestoreJSONReport{
+			Status:              report.RestoreStatusSucceedWithErrors,
+			StartTime:           startTime.Format(time.RFC3339),
+			EndTime:             endTime.Format(time.RFC3339),
+			Tables:              []report.TableReport{{Schema: "public", Name: "foo", Rows: 10, Bytes: 5}},
+			ErrorTablesMetadata: []string{"public.bar"},
+			ErrorTablesData:     []string{"public.baz"},
+		}
+		It("counts a table that failed to restore as an error of a successful restore", func() {
+			metrics := report.NewRestoreMetrics(jsonReport, "testdb")
+
+			Expect(metrics.Utility).To(Equal("gprestore"))
+			Expect(metrics.DatabaseName).To(Equal("testdb"))
+			Expect(metrics.Succeeded).To(BeTrue())
+			Expect(metrics.EndTime.Sub(metrics.StartTime)).To(Equal(90 * time.Second))
+			Expect(metrics.Tables).To(Equal(int64(1)))
+			Expect(metrics.TablesTotal).To(Equal(int64(2)))
+			Expect(metrics.Rows).To(Equal(int64(10)))
+			Expect(metrics.Errors).To(Equal(int64(2)))
+		})
+		It("counts an error for a failed restore without error tables", func() {
+			failedReport := report.RestoreJSONReport{Status: history.BackupStatusFailed, Tables: []report.TableReport{}}
+
+			metrics := report.NewRestoreMetrics(failedReport, "testdb")
+
+			Expect(metrics.Succeeded).To(BeFalse())
+			Expect(metrics.Errors).To(Equal(int64(1)))
+		})
+	})
+})
@@ -0,0 +1,237 @@
+package report
+
+/*
+ * This file contains structs and functions for notifying webhooks and local
+ * commands of the outcome of a backup or restore, as an alternative to the
+ * email report.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const NotificationsFilename = "gp_notifications.yaml"
+
+var NotificationTimeout = 30 * time.Second
+
+/*
+ * The notifications file lists the channels to notify for each utility, for
+ * example:
+ *
+ * notifications:
+ *   gpbackup:
+ *   - webhook: https://hooks.example.com/gpbackup
+ *     headers:
+ *       Authorization: Bearer <token>
+ *     on: failure
+ *   gprestore:
+ *   - command: /usr/local/bin/notify_restore.sh
+ *     on: [success, success_with_errors]
+ *
+ * A channel is notified on the exit statuses listed in "on", or on all of
+ * them if "on" is not given.
+ */
+type NotificationFile struct {
+	Notifications map[string][]NotificationChannel `yaml:"notifications"`
+}
+
+type NotificationChannel struct {
+	Webhook string               `yaml:"webhook"`
+	Headers map[string]string    `yaml:"headers"`
+	Command string               `yaml:"command"`
+	On      NotificationStatuses `yaml:"on"`
+}
+
+// The statuses may be given as a single status or as a list of statuses
+type NotificationStatuses []string
+
+func (statuses *NotificationStatuses) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var status string
+	if err := unmarshal(&status); err == nil {
+		*statuses = NotificationStatuses{status}
+		return nil
+	}
+	var statusList []string
+	if err := unmarshal(&statusList); err != nil {
+		return err
+	}
+	*statuses = statusList
+	return nil
+}
+
+func (channel NotificationChannel) notifiesOn(exitStatus string) bool {
+	if len(channel.On) == 0 {
+		return true
+	}
+	for _, status := range channel.On {
+		if status == exitStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// Status is "success", "success_with_errors", "failure", or "cancelled"
+type Notification struct {
+	Utility      string `json:"Utility"`
+	Status       string `json:"Status"`
+	Timestamp    string `json:"Timestamp"`
+	DatabaseName string `json:"DatabaseName"`
+	ReportFile   string `json:"ReportFile"`
+	Hostname     string `json:"Hostname"`
+}
+
+func NewNotification(utility string, timestamp string, dbname string, reportFilePath string, cancelled bool) Notification {
+	hostname, _ := operating.System.Hostname()
+	status := getExitStatus()
+	if cancelled {
+		status = "cancelled"
+	}
+	return Notification{
+		Utility:      utility,
+		Status:       status,
+		Timestamp:    timestamp,
+		DatabaseName: dbname,
+		ReportFile:   reportFilePath,
+		Hostname:     hostname,
+	}
+}
+
+func ReadNotificationChannels(filename string, utility string) ([]NotificationChannel, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read notifications file %s", filename)
+	}
+	notificationFile := &NotificationFile{}
+	err = yaml.UnmarshalStrict(contents, notificationFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse notifications file %s", filename)
+	}
+	channels := notificationFile.Notifications[utility]
+	for _, channel := range channels {
+		if (channel.Webhook == "") == (channel.Command == "") {
+			return nil, errors.Errorf("Each %s notification in %s must give exactly one of webhook or command", utility, filename)
+		}
+		for _, status := range channel.On {
+			if status != "success" && status != "success_with_errors" && status != "failure" && status != "cancelled" {
+				return nil, errors.Errorf(`Invalid notification status "%s" in %s; valid statuses are success, success_with_errors, failure, and cancelled`, status, filename)
+			}
+		}
+	}
+	return channels, nil
+}
+
+/*
+ * A webhook is sent the notification as a JSON object in the body of a POST
+ * request, and is expected to respond with a 2xx status.
+ */
+func SendWebhookNotification(channel NotificationChannel, notification Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, channel.Webhook, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrapf(err, "Unable to notify webhook %s", channel.Webhook)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range channel.Headers {
+		request.Header.Set(key, value)
+	}
+	client := &http.Client{Timeout: NotificationTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to notify webhook %s", channel.Webhook)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.Errorf("Unable to notify webhook %s: received status %s", channel.Webhook, response.Status)
+	}
+	return nil
+}
+
+func quoteShellValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+/*
+ * A command is run on the coordinator with the fields of the notification in
+ * environment variables, and the whole notification as JSON in
+ * GPBACKUP_NOTIFICATION.
+ */
+func ConstructNotificationCommand(channel NotificationChannel, notification Notification) string {
+	payload, _ := json.Marshal(notification)
+	variables := map[string]string{
+		"GPBACKUP_NOTIFICATION":             string(payload),
+		"GPBACKUP_NOTIFICATION_UTILITY":     notification.Utility,
+		"GPBACKUP_NOTIFICATION_STATUS":      notification.Status,
+		"GPBACKUP_NOTIFICATION_TIMESTAMP":   notification.Timestamp,
+		"GPBACKUP_NOTIFICATION_DBNAME":      notification.DatabaseName,
+		"GPBACKUP_NOTIFICATION_REPORT_FILE": notification.ReportFile,
+	}
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	exports := make([]string, 0, len(names))
+	for _, name := range names {
+		exports = append(exports, fmt.Sprintf("%s=%s", name, quoteShellValue(variables[name])))
+	}
+	return fmt.Sprintf("export %s; %s", strings.Join(exports, " "), channel.Command)
+}
+
+/*
+ * Notifications are sent from $HOME/gp_notifications.yaml or, if there is no
+ * such file, from $GPHOME/bin/gp_notifications.yaml.  Failing to notify a
+ * channel does not fail the backup or restore.
+ *
+ * A backup or restore that fails before the cluster is known, or before its
+ * report is written, is still notified, with no report file.
+ */
+func SendNotifications(c *cluster.Cluster, timestamp string, reportFilePath string, utility string, dbname string, cancelled bool) {
+	if c == nil {
+		c = cluster.NewCluster(nil)
+	}
+	notificationsFilename, err := findConfigFile(c, NotificationsFilename)
+	if err != nil {
+		gplog.Verbose("%v; no notifications will be sent", err)
+		return
+	}
+	channels, err := ReadNotificationChannels(notificationsFilename, utility)
+	if err != nil {
+		gplog.Warn("%v", err)
+		return
+	}
+	notification := NewNotification(utility, timestamp, dbname, reportFilePath, cancelled)
+	for _, channel := range channels {
+		if !channel.notifiesOn(notification.Status) {
+			continue
+		}
+		if channel.Webhook != "" {
+			gplog.Verbose("Sending %s notification to webhook %s", notification.Status, channel.Webhook)
+			err = SendWebhookNotification(channel, notification)
+			if err != nil {
+				gplog.Warn("%v", err)
+			}
+		} else {
+			gplog.Verbose("Running notification command %s", channel.Command)
+			output, err := c.ExecuteLocalCommand(ConstructNotificationCommand(channel, notification))
+			if err != nil {
+				gplog.Warn("Notification command %s failed: %s", channel.Command, strings.TrimSpace(output))
+			}
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package report_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("report/notification tests", func() {
+	var (
+		server           *httptest.Server
+		requests         []*http.Request
+		requestBodies    []report.Notification
+		responseStatus   int
+		notificationFile string
+	)
+	notification := report.Notification{
+		Utility:      "gpbackup",
+		Status:       "failure",
+		Timestamp:    "20170101010101",
+		DatabaseName: "testdb",
+		ReportFile:   "/data/backups/gpbackup_20170101010101_report",
+		Hostname:     "localhost",
+	}
+	BeforeEach(func() {
+		requests = nil
+		requestBodies = nil
+		responseStatus = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			var received report.Notification
+			_ = json.Unmarshal(body, &received)
+			requests = append(requests, r)
+			requestBodies = append(requestBodies, received)
+			w.WriteHeader(responseStatus)
+		}))
+		notificationFile = `notifications:
+  gpbackup:
+  - webhook: ` + server.URL + `/failure
+    headers:
+      Authorization: Bearer token
+    on: failure
+  - webhook: ` + server.URL + `/always
+  - command: notify.sh
+    on: [success, success_with_errors]
+  gprestore:
+  - command: notify_restore.sh
+`
+		operating.System.ReadFile = func(filename string) ([]byte, error) { return []byte(notificationFile), nil }
+		operating.System.Hostname = func() (string, error) { return "localhost", nil }
+		gplog.SetErrorCode(0)
+	})
+	AfterEach(func() {
+		server.Close()
+		operating.InitializeSystemFunctions()
+		gplog.SetErrorCode(0)
+	})
+
+	Describe("ReadNotificationChannels", func() {
+		It("reads the channels of a utility with a single status or a list of statuses", func() {
+			channels, err := report.ReadNotificationChannels("gp_notifications.yaml", "gpbackup")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(channels).To(HaveLen(3))
+			Expect(channels[0].Webhook).To(Equal(server.URL + "/failure"))
+			Expect(channels[0].Headers).To(Equal(map[string]string{"Authorization": "Bearer token"}))
+			Expect(channels[0].On).To(Equal(report.NotificationStatuses{"failure"}))
+			Expect(channels[1].On).To(BeEmpty())
+			Expect(channels[2].Command).To(Equal("notify.sh"))
+			Expect(channels[2].On).To(Equal(report.NotificationStatuses{"success", "success_with_errors"}))
+		})
+		It("returns no channels for a utility that is not listed", func() {
+			notificationFile = "notifications:\n  gprestore:\n  - command: notify.sh\n"
+
+			channels, err := report.ReadNotificationChannels("gp_notifications.yaml", "gpbackup")
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(channels).To(BeEmpty())
+		})
+		It("returns an error if a channel gives both a webhook and a command", func() {
+			notificationFile = "notifications:\n  gpbackup:\n  - command: notify.sh\n    webhook: http://localhost\n"
+
+			_, err := report.ReadNotificationChannels("gp_notifications.yaml", "gpbackup")
+
+			Expect(err).To(MatchError("Each gpbackup notification in gp_notifications.yaml must give exactly one of webhook or command"))
+		})
+		It("returns an error if a channel gives an invalid status", func() {
+			notificationFile = "notifications:\n  gpbackup:\n  - command: notify.sh\n    on: succeeded\n"
+
+			_, err := report.ReadNotificationChannels("gp_notifications.yaml", "gpbackup")
+
+			Expect(err).To(MatchError(`Invalid notification status "succeeded" in gp_notifications.yaml; valid statuses are success, success_with_errors, failure, and cancelled`))
+		})
+		It("returns an error if the file contains an unknown field", func() {
+			notificationFile = "notifications:\n  gpbackup:\n  - command: notify.sh\n    when: failure\n"
+
+			_, err := report.ReadNotificationChannels("gp_notifications.yaml", "gpbackup")
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unable to parse notifications file gp_notifications.yaml"))
+		})
+	})
+	Describe("SendWebhookNotification", func() {
+		It("posts the notification as JSON with the headers of the channel", func() {
+			channel := report.NotificationChannel{Webhook: server.URL + "/hook", Headers: map[string]string{"X-Token": "secret"}}
+
+			err := report.SendWebhookNotification(channel, notification)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].Method).To(Equal(http.MethodPost))
+			Expect(requests[0].URL.Path).To(Equal("/hook"))
+			Expect(requests[0].Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(requests[0].Header.Get("X-Token")).To(Equal("secret"))
+			Expect(requestBodies[0]).To(Equal(notification))
+		})
+		It("returns an error if the webhook does not respond with a success status", func() {
+			responseStatus = http.StatusInternalServerError
+			channel := report.NotificationChannel{Webhook: server.URL + "/hook"}
+
+			err := report.SendWebhookNotification(channel, notification)
+
+			Expect(err).To(MatchError(ContainSubstring("received status 500 Internal Server Error")))
+		})
+	})
+	Describe("ConstructNotificationCommand", func() {
+		It("exports the fields of the notification before running the command", func() {
+			channel := report.NotificationChannel{Command: "notify.sh --quiet"}
+			quotedNotification := notification
+			quotedNotification.DatabaseName = "test'db"
+
+			command := report.ConstructNotificationCommand(channel, quotedNotification)
+
+			Expect(command).To(Equal(`export GPBACKUP_NOTIFICATION='{"Utility":"gpbackup","Status":"failure","Timestamp":"20170101010101","DatabaseName":"test'\''db","ReportFile":"/data/backups/gpbackup_20170101010101_report","Hostname":"localhost"}' ` +
+				`GPBACKUP_NOTIFICATION_DBNAME='test'\''db' GPBACKUP_NOTIFICATION_REPORT_FILE='/data/backups/gpbackup_20170101010101_report' ` +
+				`GPBACKUP_NOTIFICATION_STATUS='failure' GPBACKUP_NOTIFICATION_TIMESTAMP='20170101010101' GPBACKUP_NOTIFICATION_UTILITY='gpbackup'; notify.sh --quiet`))
+		})
+	})
+	Describe("SendNotifications", func() {
+		var (
+			testExecutor *testhelper.TestExecutor
+			testCluster  *cluster.Cluster
+		)
+		BeforeEach(func() {
+			testCluster = testutils.SetDefaultSegmentConfiguration()
+			testExecutor = &testhelper.TestExecutor{}
+			testCluster.Executor = testExecutor
+			operating.System.Getenv = func(key string) string {
+				if key == "HOME" {
+					return "home"
+				}
+				return "gphome"
+			}
+		})
+		It("notifies the channels of a failed backup", func() {
+			gplog.SetErrorCode(2)
+
+			report.SendNotifications(testCluster, "20170101010101", "report_file", "gpbackup", "testdb", false)
+
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[0].URL.Path).To(Equal("/failure"))
+			Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer token"))
+			Expect(requests[1].URL.Path).To(Equal("/always"))
+			Expect(requestBodies[1].Status).To(Equal("failure"))
+			Expect(requestBodies[1].DatabaseName).To(Equal("testdb"))
+			Expect(requestBodies[1].ReportFile).To(Equal("report_file"))
+			Expect(testExecutor.LocalCommands).To(Equal([]string{"test -f home/gp_notifications.yaml"}))
+		})
+		It("notifies the channels of a cancelled backup", func() {
+			gplog.SetErrorCode(2)
+
+			report.SendNotifications(testCluster, "20170101010101", "", "gpbackup", "testdb", true)
+
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].URL.Path).To(Equal("/always"))
+			Expect(requestBodies[0].Status).To(Equal("cancelled"))
+			Expect(requestBodies[0].ReportFile).To(Equal(""))
+		})
+		It("notifies the channels of a successful backup", func() {
+			report.SendNotifications(testCluster, "20170101010101", "report_file", "gpbackup", "testdb", false)
+
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].URL.Path).To(Equal("/always"))
+			Expect(requestBodies[0].Status).To(Equal("success"))
+			Expect(testExecutor.LocalCommands).To(HaveLen(2))
+			Expect(testExecutor.LocalCommands[1]).To(HavePrefix("export GPBACKUP_NOTIFICATION="))
+			Expect(testExecutor.LocalCommands[1]).To(HaveSuffix("; notify.sh"))
+		})
+		It("warns if a webhook cannot be notified", func() {
+			responseStatus = http.StatusNotFound
+			gplog.SetErrorCode(2)
+
+			report.SendNotifications(testCluster, "20170101010101", "report_file", "gpbackup", "testdb", false)
+
+			Expect(requests).To(HaveLen(2))
+			Expect(stdout).To(Say("Unable to notify webhook " + server.URL + "/failure: received status 404 Not Found"))
+		})
+		It("warns if a notification command fails", func() {
+			testExecutor.ErrorOnExecNum = 2
+			testExecutor.LocalError = errors.Errorf("exit status 1")
+			testExecutor.LocalOutput = "notify.sh: not found\n"
+
+			report.SendNotifications(testCluster, "20170101010101", "report_file", "gprestore", "testdb", false)
+
+			Expect(testExecutor.NumExecutions).To(Equal(2))
+			Expect(stdout).To(Say("Notification command notify_restore.sh failed: notify.sh: not found"))
+		})
+		It("sends no notifications if there is no notifications file", func() {
+			testExecutor.LocalError = errors.Errorf("exit status 1")
+
+			report.SendNotifications(testCluster, "20170101010101", "report_file", "gpbackup", "testdb", false)
+
+			Expect(requests).To(BeEmpty())
+			Expect(testExecutor.LocalCommands).To(Equal([]string{"test -f home/gp_notifications.yaml", "test -f gphome/bin/gp_notifications.yaml"}))
+		})
+	})
+})
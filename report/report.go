@@ -1,6 +1,7 @@
 package report
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -29,9 +31,20 @@ import (
 type Report struct {
 	BackupParamsString string
 	DatabaseSize       string
+	BlockingLocks      []BlockingLock
 	history.BackupConfig
 }
 
+// A lock held or waited for by another session on a table that gpbackup waited to lock
+type BlockingLock struct {
+	Relation    string `json:"Relation"`
+	Mode        string `json:"Mode"`
+	Granted     string `json:"Granted"`
+	Application string `json:"Application"`
+	User        string `json:"User"`
+	Pid         string `json:"Pid"`
+}
+
 type LineInfo struct {
 	Key   string
 	Value string
@@ -61,13 +74,42 @@ func (report *Report) ConstructBackupParamsString() {
 	if report.ExcludeTableFiltered {
 		filterStr += "Exclude Table Filter"
 	}
+	objectTypeFilterStr := ""
+	if len(report.IncludeObjectTypes) > 0 {
+		objectTypeFilterStr = fmt.Sprintf("Include Object Type Filter (%s)", strings.Join(report.IncludeObjectTypes, ", "))
+	} else if len(report.ExcludeObjectTypes) > 0 {
+		objectTypeFilterStr = fmt.Sprintf("Exclude Object Type Filter (%s)", strings.Join(report.ExcludeObjectTypes, ", "))
+	}
+	if objectTypeFilterStr != "" && filterStr != "" {
+		filterStr = strings.TrimSpace(filterStr) + ", " + objectTypeFilterStr
+	} else if objectTypeFilterStr != "" {
+		filterStr = objectTypeFilterStr
+	}
 	if filterStr == "" {
 		filterStr = "None"
 	}
+	rowFilterStr := "None"
+	if report.RowFiltered {
+		rowFilterStr = fmt.Sprintf("%d table(s)", len(report.RowFilters))
+	}
+	maskingStr := "None"
+	if report.Masked {
+		numColumns := 0
+		for _, columnMasks := range report.MaskingRules {
+			numColumns += len(columnMasks)
+		}
+		maskingStr = fmt.Sprintf("%d column(s) of %d table(s)", numColumns, len(report.MaskingRules))
+	}
 	compressStr := "None"
 	program := utils.GetPipeThroughProgram()
 	if report.Compressed {
 		compressStr = program.Name
+		if report.CompressionThreads > 0 {
+			compressStr += fmt.Sprintf(", %d threads", report.CompressionThreads)
+		}
+		if report.CompressionWindow > 0 {
+			compressStr += fmt.Sprintf(", window 2^%d", report.CompressionWindow)
+		}
 	}
 	pluginStr := "None"
 	if report.Plugin != "" {
@@ -94,11 +136,13 @@ func (report *Report) ConstructBackupParamsString() {
 plugin executable: %s
 backup section: %s
 object filtering: %s
+row filtering: %s
+column masking: %s
 includes statistics: %s
 data file format: %s
 %s`
 	report.BackupParamsString = fmt.Sprintf(backupParamsTemplate, compressStr, pluginStr, sectionStr, filterStr,
-		statsStr, filesStr, report.constructIncrementalSection())
+		rowFilterStr, maskingStr, statsStr, filesStr, report.constructIncrementalSection())
 }
 
 func (report *Report) constructIncrementalSection() string {
@@ -114,7 +158,7 @@ incremental backup set:
 %s`, strings.Join(backupTimestamps, "\n"))
 }
 
-func (report *Report) WriteBackupReportFile(reportFilename string, timestamp string, endtime time.Time, objectCounts map[string]int, errMsg string) {
+func (report *Report) WriteBackupReportFile(reportFilename string, timestamp string, endtime time.Time, objectCounts map[string]int, dataEntries []toc.CoordinatorDataEntry, errMsg string) {
 	reportFile, err := iohelper.OpenFileForWriting(reportFilename)
 	if err != nil {
 		gplog.Error("Unable to open backup report file %s", reportFilename)
@@ -167,8 +211,16 @@ func (report *Report) WriteBackupReportFile(reportFilename string, timestamp str
 
 	logOutputReport(reportFile, reportInfo)
 
+	report.printBlockingLocks(reportFile)
+
+	report.printMaskedColumns(reportFile)
+
 	PrintObjectCounts(reportFile, objectCounts)
 
+	PrintTableStatistics(reportFile, dataEntries)
+
+	PrintWorkerUtilization(reportFile, dataEntries)
+
 	err = reportFile.Close()
 	gplog.FatalOnError(err)
 	_ = operating.System.Chmod(reportFilename, 0444)
@@ -261,6 +313,41 @@ func reformatDuration(duration time.Duration) string {
 	return fmt.Sprintf("%d:%02d:%02d", hour, min, sec)
 }
 
+func (report *Report) printBlockingLocks(reportFile io.WriteCloser) {
+	if len(report.BlockingLocks) == 0 {
+		return
+	}
+	rows := [][]string{{"table", "mode", "granted", "application", "user", "pid"}}
+	for _, lock := range report.BlockingLocks {
+		rows = append(rows, []string{lock.Relation, lock.Mode, lock.Granted, lock.Application, lock.User, lock.Pid})
+	}
+	utils.MustPrintf(reportFile, "\nlocks blocking the backup:\n%s", formatTable(rows))
+}
+
+// The expression backed up in place of each masked column is listed, so the backup can be confirmed to be sanitized
+func (report *Report) printMaskedColumns(reportFile io.WriteCloser) {
+	if len(report.MaskingRules) == 0 {
+		return
+	}
+	tables := make([]string, 0, len(report.MaskingRules))
+	for table := range report.MaskingRules {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	rows := [][]string{{"table", "column", "expression"}}
+	for _, table := range tables {
+		columns := make([]string, 0, len(report.MaskingRules[table]))
+		for column := range report.MaskingRules[table] {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for _, column := range columns {
+			rows = append(rows, []string{table, column, report.MaskingRules[table][column]})
+		}
+	}
+	utils.MustPrintf(reportFile, "\nmasked columns:\n%s", formatTable(rows))
+}
+
 func PrintObjectCounts(reportFile io.WriteCloser, objectCounts map[string]int) {
 	objectStr := "\ncount of database objects in backup:\n"
 	objectSlice := make([]string, 0)
@@ -282,6 +369,160 @@ func PrintObjectCounts(reportFile io.WriteCloser, objectCounts map[string]int) {
 	utils.MustPrintf(reportFile, objectStr)
 }
 
+const NumTablesInReport = 10
+
+/*
+ * Lists the tables whose data took longest to back up and the tables with the
+ * most data, which between them tend to determine how long a backup takes.
+ * Backups taken before table times and sizes were recorded list neither.
+ */
+func PrintTableStatistics(reportFile io.WriteCloser, dataEntries []toc.CoordinatorDataEntry) {
+	timedEntries := make([]toc.CoordinatorDataEntry, 0)
+	sizedEntries := make([]toc.CoordinatorDataEntry, 0)
+	for _, entry := range dataEntries {
+		if !entry.StartTime.IsZero() {
+			timedEntries = append(timedEntries, entry)
+		}
+		if entry.UncompressedBytes > 0 || entry.CompressedBytes > 0 {
+			sizedEntries = append(sizedEntries, entry)
+		}
+	}
+
+	if len(timedEntries) > 0 {
+		sort.SliceStable(timedEntries, func(i int, j int) bool {
+			return timedEntries[i].EndTime.Sub(timedEntries[i].StartTime) > timedEntries[j].EndTime.Sub(timedEntries[j].StartTime)
+		})
+		if len(timedEntries) > NumTablesInReport {
+			timedEntries = timedEntries[:NumTablesInReport]
+		}
+		rows := [][]string{{"table", "duration", "rows", "uncompressed size", "throughput"}}
+		for _, entry := range timedEntries {
+			duration := entry.EndTime.Sub(entry.StartTime)
+			throughput := "-"
+			if duration > 0 && entry.UncompressedBytes > 0 {
+				throughput = FormatBytes(int64(float64(entry.UncompressedBytes)/duration.Seconds())) + "/s"
+			}
+			rows = append(rows, []string{utils.MakeFQN(entry.Schema, entry.Name), reformatDuration(duration),
+				fmt.Sprintf("%d", entry.RowsCopied), formatOptionalBytes(entry.UncompressedBytes), throughput})
+		}
+		utils.MustPrintf(reportFile, "\nslowest tables:\n%s", formatTable(rows))
+	}
+
+	if len(sizedEntries) > 0 {
+		sort.SliceStable(sizedEntries, func(i int, j int) bool {
+			if sizedEntries[i].UncompressedBytes != sizedEntries[j].UncompressedBytes {
+				return sizedEntries[i].UncompressedBytes > sizedEntries[j].UncompressedBytes
+			}
+			return sizedEntries[i].CompressedBytes > sizedEntries[j].CompressedBytes
+		})
+		if len(sizedEntries) > NumTablesInReport {
+			sizedEntries = sizedEntries[:NumTablesInReport]
+		}
+		rows := [][]string{{"table", "uncompressed size", "compressed size", "rows"}}
+		for _, entry := range sizedEntries {
+			rows = append(rows, []string{utils.MakeFQN(entry.Schema, entry.Name), formatOptionalBytes(entry.UncompressedBytes),
+				formatOptionalBytes(entry.CompressedBytes), fmt.Sprintf("%d", entry.RowsCopied)})
+		}
+		utils.MustPrintf(reportFile, "\nlargest tables:\n%s", formatTable(rows))
+	}
+}
+
+/*
+ * Lists the number of tables each worker backed up and the share of the data
+ * backup it spent backing them up, from which it can be seen whether a few
+ * large tables kept some workers busy long after the others had finished.
+ * Worker 0 only backs up tables that other workers could not lock, and
+ * backups taken before workers were recorded list no utilization.
+ */
+func PrintWorkerUtilization(reportFile io.WriteCloser, dataEntries []toc.CoordinatorDataEntry) {
+	var dataStart, dataEnd time.Time
+	workerTables := make(map[int]int)
+	workerTimes := make(map[int]time.Duration)
+	hasWorkers := false
+	for _, entry := range dataEntries {
+		if entry.StartTime.IsZero() {
+			continue
+		}
+		if dataStart.IsZero() || entry.StartTime.Before(dataStart) {
+			dataStart = entry.StartTime
+		}
+		if entry.EndTime.After(dataEnd) {
+			dataEnd = entry.EndTime
+		}
+		workerTables[entry.Worker]++
+		workerTimes[entry.Worker] += entry.EndTime.Sub(entry.StartTime)
+		hasWorkers = hasWorkers || entry.Worker > 0
+	}
+	if !hasWorkers {
+		return
+	}
+
+	workers := make([]int, 0, len(workerTables))
+	for worker := range workerTables {
+		workers = append(workers, worker)
+	}
+	sort.Ints(workers)
+	dataDuration := dataEnd.Sub(dataStart)
+	rows := [][]string{{"worker", "tables", "busy time", "utilization"}}
+	for _, worker := range workers {
+		utilization := "-"
+		if dataDuration > 0 {
+			utilization = fmt.Sprintf("%.0f%%", 100*workerTimes[worker].Seconds()/dataDuration.Seconds())
+		}
+		rows = append(rows, []string{fmt.Sprintf("%d", worker), fmt.Sprintf("%d", workerTables[worker]),
+			reformatDuration(workerTimes[worker]), utilization})
+	}
+	utils.MustPrintf(reportFile, "\nworker utilization:\n%s", formatTable(rows))
+}
+
+func formatTable(rows [][]string) string {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, value := range row {
+			if len(value) > widths[i] {
+				widths[i] = len(value)
+			}
+		}
+	}
+	tableStr := ""
+	for _, row := range rows {
+		line := ""
+		for i, value := range row {
+			if i < len(row)-1 {
+				line += fmt.Sprintf("%-*s", widths[i]+3, value)
+			} else {
+				line += value
+			}
+		}
+		tableStr += line + "\n"
+	}
+	return tableStr
+}
+
+// Sizes are given in the units pg_size_pretty uses
+func FormatBytes(numBytes int64) string {
+	units := []string{"kB", "MB", "GB", "TB"}
+	if numBytes < 1024 {
+		return fmt.Sprintf("%d bytes", numBytes)
+	}
+	size := float64(numBytes)
+	unit := ""
+	for _, unit = range units {
+		size /= 1024
+		if size < 1024 {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f %s", size, unit)
+}
+
+func formatOptionalBytes(numBytes int64) string {
+	if numBytes == 0 {
+		return "-"
+	}
+	return FormatBytes(numBytes)
+}
+
 /*
  * This function will not error out if the user has gprestore X.Y.Z
  * and gpbackup X.Y.Z+dev, when technically the uncommitted code changes
@@ -333,14 +574,7 @@ func GetContacts(filename string, utility string) string {
 		return ""
 	}
 
-	errorCode := gplog.GetErrorCode()
-	exitStatus := "success"
-	if errorCode == 1 {
-		exitStatus = "success_with_errors"
-	} else if errorCode == 2 {
-		exitStatus = "failure"
-	}
-
+	exitStatus := getExitStatus()
 	contactList := make([]string, 0)
 	for _, contact := range contactFile.Contacts[utility] {
 		if contact.Status[exitStatus] {
@@ -350,6 +584,17 @@ func GetContacts(filename string, utility string) string {
 	return strings.Join(contactList, " ")
 }
 
+// The exit status is used to select email contacts and notification channels
+func getExitStatus() string {
+	errorCode := gplog.GetErrorCode()
+	if errorCode == 1 {
+		return "success_with_errors"
+	} else if errorCode == 2 {
+		return "failure"
+	}
+	return "success"
+}
+
 func ConstructEmailMessage(timestamp string, contactList string, reportFilePath string, utility string, status bool, dbname string) string {
 	hostname, _ := operating.System.Hostname()
 	statusString := history.BackupStatusSucceed
@@ -373,21 +618,27 @@ Content-Disposition: inline
 	return emailHeader + fileContents + emailFooter
 }
 
-func EmailReport(c *cluster.Cluster, timestamp string, reportFilePath string, utility string, status bool, dbname string) {
-	contactsFilename := "gp_email_contacts.yaml"
-	gphomeFile := fmt.Sprintf("%s/bin/%s", operating.System.Getenv("GPHOME"), contactsFilename)
-	homeFile := fmt.Sprintf("%s/%s", operating.System.Getenv("HOME"), contactsFilename)
+// A file in $HOME takes precedence over one in $GPHOME/bin
+func findConfigFile(c *cluster.Cluster, filename string) (string, error) {
+	gphomeFile := fmt.Sprintf("%s/bin/%s", operating.System.Getenv("GPHOME"), filename)
+	homeFile := fmt.Sprintf("%s/%s", operating.System.Getenv("HOME"), filename)
 	_, homeErr := c.ExecuteLocalCommand(fmt.Sprintf("test -f %s", homeFile))
-	if homeErr != nil {
-		_, gphomeErr := c.ExecuteLocalCommand(fmt.Sprintf("test -f %s", gphomeFile))
-		if gphomeErr != nil {
-			gplog.Info("Found neither %s nor %s", gphomeFile, homeFile)
-			gplog.Info("Email containing %s report %s will not be sent", utility, reportFilePath)
-			return
-		}
-		contactsFilename = gphomeFile
-	} else {
-		contactsFilename = homeFile
+	if homeErr == nil {
+		return homeFile, nil
+	}
+	_, gphomeErr := c.ExecuteLocalCommand(fmt.Sprintf("test -f %s", gphomeFile))
+	if gphomeErr == nil {
+		return gphomeFile, nil
+	}
+	return "", errors.Errorf("Found neither %s nor %s", gphomeFile, homeFile)
+}
+
+func EmailReport(c *cluster.Cluster, timestamp string, reportFilePath string, utility string, status bool, dbname string) {
+	contactsFilename, err := findConfigFile(c, "gp_email_contacts.yaml")
+	if err != nil {
+		gplog.Info("%v", err)
+		gplog.Info("Email containing %s report %s will not be sent", utility, reportFilePath)
+		return
 	}
 	gplog.Info("%s list found, %s will be sent", contactsFilename, reportFilePath)
 	contactList := GetContacts(contactsFilename, utility)
@@ -417,3 +668,198 @@ func AppendBackupParams(infoArr *[]LineInfo, paramsStr string) {
 		}
 	}
 }
+
+/*
+ * The JSON reports are written alongside the text reports for consumption by
+ * other programs.  Fields may be added to them without changing the schema
+ * version, but fields are never renamed, removed, or changed in meaning
+ * without incrementing it.
+ */
+const JSONReportSchemaVersion = 1
+
+const RestoreStatusSucceedWithErrors = "Success With Errors"
+
+// Bytes is the size of the table's data as stored in the backup, after compression
+type TableReport struct {
+	Schema            string  `json:"Schema"`
+	Name              string  `json:"Name"`
+	Oid               uint32  `json:"Oid"`
+	Rows              int64   `json:"Rows"`
+	Bytes             int64   `json:"Bytes,omitempty"`
+	UncompressedBytes int64   `json:"UncompressedBytes,omitempty"`
+	StartTime         string  `json:"StartTime,omitempty"`
+	EndTime           string  `json:"EndTime,omitempty"`
+	DurationSeconds   float64 `json:"DurationSeconds,omitempty"`
+}
+
+func NewTableReport(entry toc.CoordinatorDataEntry) TableReport {
+	table := TableReport{
+		Schema:            entry.Schema,
+		Name:              entry.Name,
+		Oid:               entry.Oid,
+		Rows:              entry.RowsCopied,
+		Bytes:             entry.CompressedBytes,
+		UncompressedBytes: entry.UncompressedBytes,
+	}
+	if !entry.StartTime.IsZero() {
+		table.StartTime = entry.StartTime.Format(time.RFC3339Nano)
+		table.EndTime = entry.EndTime.Format(time.RFC3339Nano)
+		table.DurationSeconds = entry.EndTime.Sub(entry.StartTime).Seconds()
+	}
+	return table
+}
+
+type BackupJSONReport struct {
+	SchemaVersion   int                  `json:"SchemaVersion"`
+	Utility         string               `json:"Utility"`
+	Timestamp       string               `json:"Timestamp"`
+	Status          string               `json:"Status"`
+	Error           string               `json:"Error,omitempty"`
+	CommandLine     string               `json:"CommandLine"`
+	StartTime       string               `json:"StartTime"`
+	EndTime         string               `json:"EndTime"`
+	DurationSeconds int64                `json:"DurationSeconds"`
+	DatabaseSize    string               `json:"DatabaseSize,omitempty"`
+	BackupConfig    history.BackupConfig `json:"BackupConfig"`
+	ObjectCounts    map[string]int       `json:"ObjectCounts"`
+	Tables          []TableReport        `json:"Tables"`
+	BlockingLocks   []BlockingLock       `json:"BlockingLocks"`
+}
+
+type RestoreJSONReport struct {
+	SchemaVersion       int                  `json:"SchemaVersion"`
+	Utility             string               `json:"Utility"`
+	Timestamp           string               `json:"Timestamp"`
+	RestoreTimestamp    string               `json:"RestoreTimestamp"`
+	Status              string               `json:"Status"`
+	Error               string               `json:"Error,omitempty"`
+	CommandLine         string               `json:"CommandLine"`
+	StartTime           string               `json:"StartTime"`
+	EndTime             string               `json:"EndTime"`
+	DurationSeconds     int64                `json:"DurationSeconds"`
+	DatabaseName        string               `json:"DatabaseName"`
+	DatabaseVersion     string               `json:"DatabaseVersion"`
+	RestoreVersion      string               `json:"RestoreVersion"`
+	BackupSegmentCount  int                  `json:"BackupSegmentCount"`
+	RestoreSegmentCount int                  `json:"RestoreSegmentCount"`
+	BackupConfig        history.BackupConfig `json:"BackupConfig"`
+	Tables              []TableReport        `json:"Tables"`
+	ErrorTablesMetadata []string             `json:"ErrorTablesMetadata"`
+	ErrorTablesData     []string             `json:"ErrorTablesData"`
+}
+
+func getJSONDurationInfo(timestamp string, endTime time.Time) (string, string, int64) {
+	startTime, _ := time.ParseInLocation("20060102150405", timestamp, operating.System.Local)
+	return startTime.Format(time.RFC3339), endTime.Format(time.RFC3339), int64(endTime.Sub(startTime) / time.Second)
+}
+
+func SortTableReports(tables []TableReport) {
+	sort.Slice(tables, func(i int, j int) bool {
+		if tables[i].Schema != tables[j].Schema {
+			return tables[i].Schema < tables[j].Schema
+		}
+		return tables[i].Name < tables[j].Name
+	})
+}
+
+func (report *Report) WriteBackupJSONReportFile(reportFilename string, timestamp string, endtime time.Time, objectCounts map[string]int, tables []TableReport, errMsg string) {
+	start, end, duration := getJSONDurationInfo(timestamp, endtime)
+	jsonReport := BackupJSONReport{
+		SchemaVersion:   JSONReportSchemaVersion,
+		Utility:         "gpbackup",
+		Timestamp:       timestamp,
+		Status:          history.BackupStatusSucceed,
+		Error:           errMsg,
+		CommandLine:     strings.Join(os.Args, " "),
+		StartTime:       start,
+		EndTime:         end,
+		DurationSeconds: duration,
+		DatabaseSize:    strings.ToUpper(report.DatabaseSize),
+		BackupConfig:    report.BackupConfig,
+		ObjectCounts:    objectCounts,
+		Tables:          tables,
+		BlockingLocks:   report.BlockingLocks,
+	}
+	if errMsg != "" {
+		jsonReport.Status = history.BackupStatusFailed
+	}
+	if jsonReport.ObjectCounts == nil {
+		jsonReport.ObjectCounts = make(map[string]int)
+	}
+	if jsonReport.Tables == nil {
+		jsonReport.Tables = make([]TableReport, 0)
+	}
+	if jsonReport.BlockingLocks == nil {
+		jsonReport.BlockingLocks = make([]BlockingLock, 0)
+	}
+	SortTableReports(jsonReport.Tables)
+	err := writeJSONReportFile(reportFilename, jsonReport)
+	if err != nil {
+		gplog.Error("Unable to write backup JSON report file %s: %v", reportFilename, err)
+	}
+}
+
+/*
+ * The caller fills in the backup config, the segment counts, and the tables
+ * restored, as the report package has no knowledge of the restore itself.
+ */
+func NewRestoreJSONReport(backupTimestamp string, startTimestamp string, connectionPool *dbconn.DBConn, restoreVersion string, errMsg string) RestoreJSONReport {
+	start, end, duration := getJSONDurationInfo(startTimestamp, operating.System.Now())
+	jsonReport := RestoreJSONReport{
+		SchemaVersion:       JSONReportSchemaVersion,
+		Utility:             "gprestore",
+		Timestamp:           backupTimestamp,
+		RestoreTimestamp:    startTimestamp,
+		Status:              history.BackupStatusSucceed,
+		Error:               errMsg,
+		CommandLine:         strings.Join(os.Args, " "),
+		StartTime:           start,
+		EndTime:             end,
+		DurationSeconds:     duration,
+		RestoreVersion:      restoreVersion,
+		Tables:              make([]TableReport, 0),
+		ErrorTablesMetadata: make([]string, 0),
+		ErrorTablesData:     make([]string, 0),
+	}
+	if connectionPool != nil {
+		jsonReport.DatabaseName = connectionPool.DBName
+		jsonReport.DatabaseVersion = connectionPool.Version.VersionString
+	}
+	if gplog.GetErrorCode() == 1 {
+		jsonReport.Status = RestoreStatusSucceedWithErrors
+	} else if errMsg != "" {
+		jsonReport.Status = history.BackupStatusFailed
+	}
+	return jsonReport
+}
+
+func WriteRestoreJSONReportFile(reportFilename string, jsonReport RestoreJSONReport) {
+	SortTableReports(jsonReport.Tables)
+	sort.Strings(jsonReport.ErrorTablesMetadata)
+	sort.Strings(jsonReport.ErrorTablesData)
+	err := writeJSONReportFile(reportFilename, jsonReport)
+	if err != nil {
+		gplog.Warn("Unable to write restore JSON report file %s: %v", reportFilename, err)
+	}
+}
+
+func writeJSONReportFile(reportFilename string, jsonReport interface{}) error {
+	contents, err := json.MarshalIndent(jsonReport, "", "  ")
+	if err != nil {
+		return err
+	}
+	reportFile, err := iohelper.OpenFileForWriting(reportFilename)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(reportFile, "%s\n", contents)
+	closeErr := reportFile.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	_ = operating.System.Chmod(reportFilename, 0444)
+	return nil
+}
@@ -1,6 +1,7 @@
 package report_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -21,6 +22,7 @@ import (
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
@@ -93,7 +95,7 @@ data file format: Single Data File Per Segment`,
 		})
 
 		It("writes a report for a successful backup", func() {
-			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, nil, "")
 			Expect(buffer).To(Say(`Greenplum Database Backup Report
 
 timestamp key:         20170101010101
@@ -123,7 +125,7 @@ tables      42
 types       1000`))
 		})
 		It("writes a report for a failed backup", func() {
-			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "Cannot access /tmp/backups: Permission denied")
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, nil, "Cannot access /tmp/backups: Permission denied")
 			Expect(buffer).To(Say(`Greenplum Database Backup Report
 
 timestamp key:         20170101010101
@@ -155,7 +157,7 @@ types       1000`))
 		})
 		It("writes a report without database size information", func() {
 			backupReport.DatabaseSize = ""
-			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, nil, "")
 			Expect(buffer).To(Say(`Greenplum Database Backup Report
 
 timestamp key:         20170101010101
@@ -183,6 +185,133 @@ sequences   1
 tables      42
 types       1000`))
 		})
+		It("writes the slowest and largest tables of a backup", func() {
+			tableStart := time.Date(2017, 1, 1, 1, 0, 0, 0, time.Local)
+			dataEntries := []toc.CoordinatorDataEntry{
+				{Schema: "public", Name: "small", RowsCopied: 10, StartTime: tableStart, EndTime: tableStart.Add(30 * time.Second), UncompressedBytes: 2048},
+				{Schema: "public", Name: "big", RowsCopied: 1000, StartTime: tableStart, EndTime: tableStart.Add(2 * time.Minute),
+					UncompressedBytes: 1000 * 1024 * 1024, CompressedBytes: 100 * 1024 * 1024},
+				{Schema: "public", Name: "empty"},
+			}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, dataEntries, "")
+			Expect(buffer).To(Say(`types       1000
+
+slowest tables:
+table          duration   rows   uncompressed size   throughput
+public\.big     0:02:00    1000   1000\.0 MB           8\.3 MB/s
+public\.small   0:00:30    10     2\.0 kB              68 bytes/s
+
+largest tables:
+table          uncompressed size   compressed size   rows
+public\.big     1000\.0 MB           100\.0 MB          1000
+public\.small   2\.0 kB              -                 10
+`))
+			Expect(string(buffer.Contents())).ToNot(ContainSubstring("public.empty"))
+		})
+		It("writes the locks that blocked the backup", func() {
+			backupReport.BlockingLocks = []report.BlockingLock{{Relation: "public.orders", Mode: "AccessExclusiveLock", Granted: "true", Application: "etl", User: "loader", Pid: "1234"}}
+			defer func() { backupReport.BlockingLocks = nil }()
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, nil, "")
+			Expect(buffer).To(Say(`segment count:         3
+
+locks blocking the backup:
+table           mode                  granted   application   user     pid
+public\.orders   AccessExclusiveLock   true      etl           loader   1234
+
+count of database objects in backup:`))
+		})
+		It("writes the expressions backed up in place of masked columns", func() {
+			backupReport.MaskingRules = map[string]map[string]string{
+				"public.customers": {"phone": "NULL", "email": "md5(email)"},
+				"public.accounts":  {"iban": "'redacted'"},
+			}
+			defer func() { backupReport.MaskingRules = nil }()
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, nil, "")
+			Expect(buffer).To(Say(`segment count:         3
+
+masked columns:
+table              column   expression
+public\.accounts    iban     'redacted'
+public\.customers   email    md5\(email\)
+public\.customers   phone    NULL
+
+count of database objects in backup:`))
+		})
+		It("writes the utilization of the workers that backed up data", func() {
+			tableStart := time.Date(2017, 1, 1, 1, 0, 0, 0, time.Local)
+			dataEntries := []toc.CoordinatorDataEntry{
+				{Schema: "public", Name: "fact", StartTime: tableStart, EndTime: tableStart.Add(4 * time.Minute), Worker: 1},
+				{Schema: "public", Name: "dim1", StartTime: tableStart, EndTime: tableStart.Add(time.Minute), Worker: 2},
+				{Schema: "public", Name: "dim2", StartTime: tableStart.Add(time.Minute), EndTime: tableStart.Add(2 * time.Minute), Worker: 2},
+				{Schema: "public", Name: "empty"},
+			}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, dataEntries, "")
+			Expect(buffer).To(Say(`worker utilization:
+worker   tables   busy time   utilization
+1        1        0:04:00     100%
+2        2        0:02:00     50%
+`))
+		})
+		It("does not write worker utilization for a backup that did not record workers", func() {
+			tableStart := time.Date(2017, 1, 1, 1, 0, 0, 0, time.Local)
+			dataEntries := []toc.CoordinatorDataEntry{
+				{Schema: "public", Name: "small", StartTime: tableStart, EndTime: tableStart.Add(30 * time.Second)},
+			}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, dataEntries, "")
+			Expect(string(buffer.Contents())).ToNot(ContainSubstring("worker utilization"))
+		})
+	})
+	Describe("FormatBytes", func() {
+		It("formats sizes in the units pg_size_pretty uses", func() {
+			Expect(report.FormatBytes(1023)).To(Equal("1023 bytes"))
+			Expect(report.FormatBytes(1536)).To(Equal("1.5 kB"))
+			Expect(report.FormatBytes(5 * 1024 * 1024 * 1024)).To(Equal("5.0 GB"))
+			Expect(report.FormatBytes(3 * 1024 * 1024 * 1024 * 1024 * 1024)).To(Equal("3072.0 TB"))
+		})
+	})
+	Describe("ConstructBackupParamsString", func() {
+		It("includes the zstd compression settings a backup was taken with", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			utils.InitializePipeThroughParameters(true, "zstd", 3)
+			backupReport := &report.Report{BackupConfig: history.BackupConfig{Compressed: true, CompressionType: "zstd",
+				CompressionThreads: 8, CompressionWindow: 27, SingleDataFile: true}}
+
+			backupReport.ConstructBackupParamsString()
+
+			Expect(backupReport.BackupParamsString).To(HavePrefix("compression: zstd, 8 threads, window 2^27\n"))
+		})
+		It("includes the object types that were filtered", func() {
+			backupReport := &report.Report{BackupConfig: history.BackupConfig{ExcludeObjectTypes: []string{"TRIGGER", "RULE"}}}
+
+			backupReport.ConstructBackupParamsString()
+
+			Expect(backupReport.BackupParamsString).To(ContainSubstring("object filtering: Exclude Object Type Filter (TRIGGER, RULE)\n"))
+		})
+		It("includes the object types that were filtered along with the other filters", func() {
+			backupReport := &report.Report{BackupConfig: history.BackupConfig{IncludeSchemaFiltered: true,
+				IncludeObjectTypes: []string{"TABLE", "VIEW"}}}
+
+			backupReport.ConstructBackupParamsString()
+
+			Expect(backupReport.BackupParamsString).To(ContainSubstring("object filtering: Include Schema Filter, Include Object Type Filter (TABLE, VIEW)\n"))
+		})
+		It("includes the number of tables whose rows were filtered", func() {
+			backupReport := &report.Report{BackupConfig: history.BackupConfig{RowFiltered: true,
+				RowFilters: map[string]string{"public.events": "id > 10", "sales.orders": "region = 'EMEA'"}}}
+
+			backupReport.ConstructBackupParamsString()
+
+			Expect(backupReport.BackupParamsString).To(ContainSubstring("object filtering: None\nrow filtering: 2 table(s)\n"))
+		})
+		It("includes the number of columns whose data was masked", func() {
+			backupReport := &report.Report{BackupConfig: history.BackupConfig{Masked: true,
+				MaskingRules: map[string]map[string]string{"public.customers": {"email": "md5(email)", "phone": "NULL"}}}}
+
+			backupReport.ConstructBackupParamsString()
+
+			Expect(backupReport.BackupParamsString).To(ContainSubstring("row filtering: None\ncolumn masking: 2 column(s) of 1 table(s)\n"))
+		})
 	})
 	Describe("AppendBackupParams", func() {
 		It("correctly parses the string and appends to the LineInfo array", func() {
@@ -315,6 +444,140 @@ restore status:          Success but non-fatal errors occurred. See log file .+
 
 		})
 	})
+	Describe("WriteBackupJSONReportFile", func() {
+		timestamp := "20170101010101"
+		endtime := time.Date(2017, 1, 1, 5, 4, 3, 2, time.Local)
+		objectCounts := map[string]int{"tables": 2}
+		tables := []report.TableReport{
+			{Schema: "public", Name: "foo", Oid: 2, Rows: 10, Bytes: 512},
+			{Schema: "public", Name: "bar", Oid: 1, Rows: 20},
+		}
+		var backupReport *report.Report
+		BeforeEach(func() {
+			backupReport = &report.Report{
+				DatabaseSize: "42 mb",
+				BackupConfig: history.BackupConfig{BackupVersion: "0.1.0", DatabaseName: "testdb", SegmentCount: 3},
+			}
+			operating.System.OpenFileWrite = func(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+				return buffer, nil
+			}
+			operating.System.Chmod = func(name string, mode os.FileMode) error {
+				return nil
+			}
+		})
+
+		It("writes a versioned report for a successful backup with its tables sorted by name", func() {
+			backupReport.WriteBackupJSONReportFile("filename", timestamp, endtime, objectCounts, tables, "")
+
+			var jsonReport report.BackupJSONReport
+			Expect(json.Unmarshal(buffer.Contents(), &jsonReport)).To(Succeed())
+			Expect(jsonReport.SchemaVersion).To(Equal(report.JSONReportSchemaVersion))
+			Expect(jsonReport.Utility).To(Equal("gpbackup"))
+			Expect(jsonReport.Timestamp).To(Equal(timestamp))
+			Expect(jsonReport.Status).To(Equal(history.BackupStatusSucceed))
+			Expect(jsonReport.Error).To(BeEmpty())
+			Expect(jsonReport.DurationSeconds).To(Equal(int64(4*3600 + 3*60 + 2)))
+			Expect(jsonReport.DatabaseSize).To(Equal("42 MB"))
+			Expect(jsonReport.BackupConfig.DatabaseName).To(Equal("testdb"))
+			Expect(jsonReport.ObjectCounts).To(Equal(objectCounts))
+			Expect(jsonReport.Tables).To(Equal([]report.TableReport{
+				{Schema: "public", Name: "bar", Oid: 1, Rows: 20},
+				{Schema: "public", Name: "foo", Oid: 2, Rows: 10, Bytes: 512},
+			}))
+		})
+		It("writes the stable field names of the schema", func() {
+			backupReport.WriteBackupJSONReportFile("filename", timestamp, endtime, nil, nil, "")
+
+			Expect(buffer).To(Say(`"SchemaVersion": 1,\s+"Utility": "gpbackup",\s+"Timestamp": "20170101010101",\s+"Status": "Success",`))
+			Expect(buffer).To(Say(`"ObjectCounts": \{\},\s+"Tables": \[\],\s+"BlockingLocks": \[\]`))
+		})
+		It("includes the locks that blocked the backup", func() {
+			backupReport.BlockingLocks = []report.BlockingLock{{Relation: "public.orders", Mode: "AccessExclusiveLock", Granted: "true", Application: "etl", User: "loader", Pid: "1234"}}
+
+			backupReport.WriteBackupJSONReportFile("filename", timestamp, endtime, objectCounts, tables, "")
+
+			var jsonReport report.BackupJSONReport
+			Expect(json.Unmarshal(buffer.Contents(), &jsonReport)).To(Succeed())
+			Expect(jsonReport.BlockingLocks).To(Equal(backupReport.BlockingLocks))
+		})
+		It("writes a report for a failed backup", func() {
+			backupReport.WriteBackupJSONReportFile("filename", timestamp, endtime, objectCounts, tables, "Cannot access /tmp/backups: Permission denied")
+
+			var jsonReport report.BackupJSONReport
+			Expect(json.Unmarshal(buffer.Contents(), &jsonReport)).To(Succeed())
+			Expect(jsonReport.Status).To(Equal(history.BackupStatusFailed))
+			Expect(jsonReport.Error).To(Equal("Cannot access /tmp/backups: Permission denied"))
+		})
+	})
+	Describe("NewTableReport", func() {
+		It("includes the times and sizes recorded for a table's data", func() {
+			tableStart := time.Date(2017, 1, 1, 1, 0, 0, 0, time.UTC)
+			entry := toc.CoordinatorDataEntry{Schema: "public", Name: "foo", Oid: 1, RowsCopied: 10, StartTime: tableStart,
+				EndTime: tableStart.Add(1500 * time.Millisecond), UncompressedBytes: 2048, CompressedBytes: 512}
+
+			Expect(report.NewTableReport(entry)).To(Equal(report.TableReport{Schema: "public", Name: "foo", Oid: 1, Rows: 10, Bytes: 512,
+				UncompressedBytes: 2048, StartTime: "2017-01-01T01:00:00Z", EndTime: "2017-01-01T01:00:01.5Z", DurationSeconds: 1.5}))
+		})
+		It("leaves out times and sizes that were not recorded", func() {
+			entry := toc.CoordinatorDataEntry{Schema: "public", Name: "foo", Oid: 1, RowsCopied: 10}
+
+			Expect(report.NewTableReport(entry)).To(Equal(report.TableReport{Schema: "public", Name: "foo", Oid: 1, Rows: 10}))
+		})
+	})
+	Describe("WriteRestoreJSONReportFile", func() {
+		connectionPool := &dbconn.DBConn{
+			DBName: "testdb",
+			Version: dbconn.GPDBVersion{
+				VersionString: "5.0.0 build test",
+			},
+		}
+		BeforeEach(func() {
+			operating.System.OpenFileWrite = func(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+				return buffer, nil
+			}
+			operating.System.Now = func() time.Time {
+				return time.Date(2017, 1, 1, 5, 4, 3, 2, time.Local)
+			}
+			operating.System.Chmod = func(name string, mode os.FileMode) error {
+				return nil
+			}
+			gplog.SetErrorCode(0)
+		})
+		AfterEach(func() {
+			gplog.SetErrorCode(0)
+		})
+
+		It("writes a report for a successful restore with its error tables", func() {
+			gplog.SetErrorCode(1)
+			jsonReport := report.NewRestoreJSONReport("20170101010101", "20170101010102", connectionPool, "0.1.0", "")
+			jsonReport.Tables = append(jsonReport.Tables, report.TableReport{Schema: "public", Name: "foo", Oid: 1, Rows: 10})
+			jsonReport.ErrorTablesData = append(jsonReport.ErrorTablesData, "public.baz", "public.bar")
+			report.WriteRestoreJSONReportFile("filename", jsonReport)
+
+			var written report.RestoreJSONReport
+			Expect(json.Unmarshal(buffer.Contents(), &written)).To(Succeed())
+			Expect(written.SchemaVersion).To(Equal(report.JSONReportSchemaVersion))
+			Expect(written.Utility).To(Equal("gprestore"))
+			Expect(written.RestoreTimestamp).To(Equal("20170101010102"))
+			Expect(written.Status).To(Equal(report.RestoreStatusSucceedWithErrors))
+			Expect(written.DatabaseName).To(Equal("testdb"))
+			Expect(written.DatabaseVersion).To(Equal("5.0.0 build test"))
+			Expect(written.DurationSeconds).To(Equal(int64(4*3600 + 3*60 + 1)))
+			Expect(written.Tables).To(HaveLen(1))
+			Expect(written.ErrorTablesMetadata).To(BeEmpty())
+			Expect(written.ErrorTablesData).To(Equal([]string{"public.bar", "public.baz"}))
+		})
+		It("writes a report for a failed restore", func() {
+			gplog.SetErrorCode(2)
+			jsonReport := report.NewRestoreJSONReport("20170101010101", "20170101010102", connectionPool, "0.1.0", "Cannot access /tmp/backups: Permission denied")
+			report.WriteRestoreJSONReportFile("filename", jsonReport)
+
+			var written report.RestoreJSONReport
+			Expect(json.Unmarshal(buffer.Contents(), &written)).To(Succeed())
+			Expect(written.Status).To(Equal(history.BackupStatusFailed))
+			Expect(written.Error).To(Equal("Cannot access /tmp/backups: Permission denied"))
+		})
+	})
 	Describe("SetBackupParamFromFlags", func() {
 		AfterEach(func() {
 			utils.InitializePipeThroughParameters(false, "", 0)
@@ -325,6 +588,8 @@ restore status:          Success but non-fatal errors occurred. See log file .+
 			backup.SetCmdFlags(backupCmdFlags)
 			err := backupCmdFlags.Set(options.INCLUDE_RELATION, "public.foobar")
 			Expect(err).ToNot(HaveOccurred())
+			err = backupCmdFlags.Set(options.EXCLUDE_OBJECT_TYPE, "trigger")
+			Expect(err).ToNot(HaveOccurred())
 			opts, err := options.NewOptions(backupCmdFlags)
 			Expect(err).ToNot(HaveOccurred())
 			opts.AddIncludedRelation("public.baz")
@@ -344,6 +609,8 @@ restore status:          Success but non-fatal errors occurred. See log file .+
 				IncludeRelations:     []string{"public.foobar"},
 				ExcludeSchemas:       []string{},
 				ExcludeRelations:     []string{},
+				IncludeObjectTypes:   []string{},
+				ExcludeObjectTypes:   []string{"TRIGGER"},
 				Plugin:               "/tmp/plugin.sh",
 				Timestamp:            "timestamp1",
 				IncludeTableFiltered: true,
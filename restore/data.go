@@ -6,6 +6,8 @@ package restore
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/jackc/pgconn"
@@ -25,7 +28,7 @@ var (
 	tableDelim = ","
 )
 
-func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttributes string, destinationToRead string, singleDataFile bool, whichConn int) (int64, error) {
+func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttributes string, destinationToRead string, checksumCommand string, singleDataFile bool, whichConn int) (int64, error) {
 	if wasTerminated {
 		return -1, nil
 	}
@@ -47,6 +50,10 @@ func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttribute
 	} else {
 		copyCommand = fmt.Sprintf("PROGRAM '%s %s | %s'", readFromDestinationCommand, destinationToRead, customPipeThroughCommand)
 	}
+	if checksumCommand != "" {
+		// The checksum agent exits with an error on a mismatch, which causes the COPY to fail
+		copyCommand = fmt.Sprintf("%s | %s'", strings.TrimSuffix(copyCommand, "'"), checksumCommand)
+	}
 
 	query := fmt.Sprintf("COPY %s%s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT;", tableName, tableAttributes, copyCommand, tableDelim)
 
@@ -74,7 +81,7 @@ func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttribute
 	return rowsLoaded, nil
 }
 
-func restoreSingleTableData(fpInfo *filepath.FilePathInfo, entry toc.CoordinatorDataEntry, tableName string, whichConn int) error {
+func restoreSingleTableData(fpInfo *filepath.FilePathInfo, entry toc.CoordinatorDataEntry, tableName string, verifyChecksums bool, whichConn int) error {
 	origSize, destSize, resizeCluster, batches := GetResizeClusterInfo()
 
 	var lastErr error
@@ -85,10 +92,19 @@ func restoreSingleTableData(fpInfo *filepath.FilePathInfo, entry toc.Coordinator
 	}
 	for i := 0; i < batches; i++ {
 		destinationToRead := ""
+		checksumCommand := ""
 		if backupConfig.SingleDataFile || resizeCluster {
+			// gpbackup_helper verifies checksums itself while streaming data to the pipe
 			destinationToRead = fmt.Sprintf("%s_%d_%d", fpInfo.GetSegmentPipePathForCopyCommand(), entry.Oid, i)
 		} else {
 			destinationToRead = fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, utils.GetPipeThroughProgram().Extension, backupConfig.SingleDataFile)
+			if utils.GetEncryptionKey() != nil {
+				// The data was encrypted after it was compressed, so it is decrypted before it is decompressed
+				destinationToRead = fmt.Sprintf("%s | %s", destinationToRead, utils.GetEncryptionAgentCommand(*fpInfo, true))
+			}
+			if verifyChecksums {
+				checksumCommand = utils.GetChecksumAgentCommand(*fpInfo, fpInfo.GetSegmentChecksumFilePathForCopyCommand(), "", entry.Oid, true)
+			}
 		}
 		gplog.Debug("Reading from %s", destinationToRead)
 
@@ -108,7 +124,7 @@ func restoreSingleTableData(fpInfo *filepath.FilePathInfo, entry toc.Coordinator
 			gplog.FatalOnError(agentErr)
 		}
 
-		partialRowsRestored, copyErr := CopyTableIn(connectionPool, tableName, entry.AttributeString, destinationToRead, backupConfig.SingleDataFile, whichConn)
+		partialRowsRestored, copyErr := CopyTableIn(connectionPool, tableName, entry.AttributeString, destinationToRead, checksumCommand, backupConfig.SingleDataFile, whichConn)
 
 		if copyErr != nil {
 			gplog.Error(copyErr.Error())
@@ -200,6 +216,34 @@ func RedistributeTableData(tableName string, whichConn int) error {
 	return err
 }
 
+/*
+ * Tables are restored largest first, so that a connection that finishes a
+ * table takes the largest of those left and the restore does not end with a
+ * single long COPY.  Tables are sized by the bytes of their data, or by their
+ * rows for backups that did not record bytes.
+ */
+func SortDataEntriesBySize(dataEntries []toc.CoordinatorDataEntry) {
+	sizeByBytes := false
+	for _, entry := range dataEntries {
+		if entry.UncompressedBytes > 0 || entry.CompressedBytes > 0 {
+			sizeByBytes = true
+			break
+		}
+	}
+	size := func(entry toc.CoordinatorDataEntry) int64 {
+		if !sizeByBytes {
+			return entry.RowsCopied
+		}
+		if entry.UncompressedBytes > 0 {
+			return entry.UncompressedBytes
+		}
+		return entry.CompressedBytes
+	}
+	sort.SliceStable(dataEntries, func(i int, j int) bool {
+		return size(dataEntries[i]) > size(dataEntries[j])
+	})
+}
+
 func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.CoordinatorDataEntry,
 	gucStatements []toc.StatementWithType, dataProgressBar utils.ProgressBar) int32 {
 	totalTables := len(dataEntries)
@@ -208,6 +252,11 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Co
 		return 0
 	}
 
+	// The helpers read a single data file in the order in which it was written, so its tables are restored in that order
+	if !backupConfig.SingleDataFile && connectionPool.NumConns > 1 {
+		SortDataEntriesBySize(dataEntries)
+	}
+
 	origSize, destSize, resizeCluster, batches := GetResizeClusterInfo()
 	if backupConfig.SingleDataFile || resizeCluster {
 		msg := ""
@@ -235,6 +284,9 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Co
 		}
 
 		utils.WriteOidListToSegments(oidList, globalCluster, fpInfo, "oid")
+		if utils.GetEncryptionKey() != nil {
+			utils.WriteEncryptionKeyToSegments(globalCluster, fpInfo)
+		}
 		initialPipes := CreateInitialSegmentPipes(oidList, globalCluster, connectionPool, fpInfo)
 		if wasTerminated {
 			return 0
@@ -249,6 +301,19 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Co
 		}
 		utils.StartGpbackupHelpers(globalCluster, fpInfo, "--restore-agent", MustGetFlagString(options.PLUGIN_CONFIG), compressStr, MustGetFlagBool(options.ON_ERROR_CONTINUE), isFilter, &wasTerminated, initialPipes, backupConfig.SingleDataFile, resizeCluster, origSize, destSize, gplog.GetVerbosity())
 	}
+	if !backupConfig.SingleDataFile && !resizeCluster {
+		utils.VerifyCompressionProgramOnSegments(globalCluster, utils.GetPipeThroughProgram().InputCommand)
+	}
+	verifyChecksums := false
+	if !backupConfig.SingleDataFile && !resizeCluster && MustGetFlagString(options.PLUGIN_CONFIG) == "" {
+		verifyChecksums = utils.ChecksumManifestsExistOnSegments(globalCluster, fpInfo)
+		if verifyChecksums || utils.GetEncryptionKey() != nil {
+			utils.VerifyHelperVersionOnSegments(version, globalCluster)
+		}
+		if utils.GetEncryptionKey() != nil {
+			utils.WriteEncryptionKeyToSegments(globalCluster, fpInfo)
+		}
+	}
 	/*
 	 * We break when an interrupt is received and rely on
 	 * TerminateHangingCopySessions to stop any COPY
@@ -277,10 +342,7 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Co
 					dataProgressBar.(*pb.ProgressBar).NotPrint = true
 					return
 				}
-				tableName := utils.MakeFQN(entry.Schema, entry.Name)
-				if opts.RedirectSchema != "" {
-					tableName = utils.MakeFQN(opts.RedirectSchema, entry.Name)
-				}
+				tableName := GetRestoreTableName(entry)
 				// Truncate table before restore, if needed
 				var err error
 				if MustGetFlagBool(options.INCREMENTAL) || MustGetFlagBool(options.TRUNCATE_TABLE) {
@@ -291,7 +353,8 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Co
 					}
 				}
 				if err == nil {
-					err = restoreSingleTableData(&fpInfo, entry, tableName, whichConn)
+					restoreState.RecordTableStarted(tableName)
+					err = restoreSingleTableData(&fpInfo, entry, tableName, verifyChecksums, whichConn)
 				}
 
 				if err != nil {
@@ -304,6 +367,19 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Co
 					errorTablesData[tableName] = Empty{}
 					mutex.Unlock()
 				} else {
+					restoreState.RecordTableRestored(tableName)
+					restoredSchema, restoredName := getRestoreSchemaAndName(entry)
+					mutex.Lock()
+					restoredTables = append(restoredTables, report.TableReport{
+						Schema:            restoredSchema,
+						Name:              restoredName,
+						Oid:               entry.Oid,
+						Rows:              entry.RowsCopied,
+						Bytes:             entry.CompressedBytes,
+						UncompressedBytes: entry.UncompressedBytes,
+					})
+					mutex.Unlock()
+					atomic.AddInt64(&numDataTablesRestored, 1)
 					utils.LogProgress("Restored data to table %s from file (table %d of %d)", tableName, atomic.AddInt64(&tableNum, 1), totalTables)
 				}
 
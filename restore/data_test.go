@@ -12,6 +12,7 @@ import (
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/jackc/pgconn"
 
@@ -33,7 +34,7 @@ var _ = Describe("restore/data tests", func() {
 			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz | gzip -d -c' WITH CSV DELIMITER ',' ON SEGMENT")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, "", false, 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -42,7 +43,7 @@ var _ = Describe("restore/data tests", func() {
 			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.zst | zstd --decompress -c' WITH CSV DELIMITER ',' ON SEGMENT")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.zst"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, "", false, 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -50,7 +51,26 @@ var _ = Describe("restore/data tests", func() {
 			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, "", false, 0)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("will restore a table from its own file with gzip compression and verify its checksum", func() {
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -1", InputCommand: "gzip -d -c", Extension: ".gz"})
+			checksumCommand := "/usr/local/greenplum-db/bin/gpbackup_helper --checksum-agent --verify-checksum --oid 3456 --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums.yaml --content <SEGID>"
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz | gzip -d -c | " + checksumCommand + "' WITH CSV DELIMITER ',' ON SEGMENT")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, checksumCommand, false, 0)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("will restore a table from its own file without compression and verify its checksum", func() {
+			checksumCommand := "/usr/local/greenplum-db/bin/gpbackup_helper --checksum-agent --verify-checksum --oid 3456 --checksum-file <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_checksums.yaml --content <SEGID>"
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456 | " + checksumCommand + "' WITH CSV DELIMITER ',' ON SEGMENT")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, checksumCommand, false, 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -58,7 +78,7 @@ var _ = Describe("restore/data tests", func() {
 			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456' WITH CSV DELIMITER ',' ON SEGMENT")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, true, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, "", true, 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -71,7 +91,7 @@ var _ = Describe("restore/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, "", false, 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -84,7 +104,7 @@ var _ = Describe("restore/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.zst"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, "", false, 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -96,7 +116,7 @@ var _ = Describe("restore/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456.gz"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, "", false, 0)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -110,7 +130,7 @@ var _ = Describe("restore/data tests", func() {
 			}
 			mock.ExpectExec(execStr).WillReturnError(pgErr)
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
-			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, "", false, 0)
 
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("Error loading data into table public.foo: " +
@@ -118,6 +138,31 @@ var _ = Describe("restore/data tests", func() {
 				"ERROR: value of distribution key doesn't belong to segment with ID 0, it belongs to segment with ID 1 (SQLSTATE 22P04)"))
 		})
 	})
+	Describe("SortDataEntriesBySize", func() {
+		It("sorts the tables with the most bytes first", func() {
+			dataEntries := []toc.CoordinatorDataEntry{
+				{Name: "small", RowsCopied: 1000, UncompressedBytes: 100},
+				{Name: "big", RowsCopied: 10, UncompressedBytes: 10000},
+				{Name: "plugin", RowsCopied: 10, CompressedBytes: 1000},
+				{Name: "empty"},
+			}
+
+			restore.SortDataEntriesBySize(dataEntries)
+
+			Expect([]string{dataEntries[0].Name, dataEntries[1].Name, dataEntries[2].Name, dataEntries[3].Name}).To(Equal([]string{"big", "plugin", "small", "empty"}))
+		})
+		It("sorts the tables with the most rows first if no bytes were recorded", func() {
+			dataEntries := []toc.CoordinatorDataEntry{
+				{Name: "small", RowsCopied: 10},
+				{Name: "big", RowsCopied: 1000},
+				{Name: "small2", RowsCopied: 10},
+			}
+
+			restore.SortDataEntriesBySize(dataEntries)
+
+			Expect([]string{dataEntries[0].Name, dataEntries[1].Name, dataEntries[2].Name}).To(Equal([]string{"big", "small", "small2"}))
+		})
+	})
 	Describe("CheckRowsRestored", func() {
 		var (
 			expectedRows int64 = 10
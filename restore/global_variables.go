@@ -8,6 +8,7 @@ import (
 	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/spf13/pflag"
@@ -34,11 +35,16 @@ var (
 	globalFPInfo        filepath.FilePathInfo
 	globalTOC           *toc.TOC
 	pluginConfig        *utils.PluginConfig
+	restoreDatabase     string
 	restoreStartTime    string
 	version             string
 	wasTerminated       bool
 	errorTablesMetadata map[string]Empty
 	errorTablesData     map[string]Empty
+	restoredTables      []report.TableReport
+	roleMap             map[string]string
+	tablespaceMap       map[string]string
+	redirectTables      map[string]options.Relation
 	opts                *options.Options
 	/*
 	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
@@ -0,0 +1,70 @@
+package restore
+
+/*
+ * This file contains functions for writing the metrics of a restore to the
+ * file given with --metrics-file.
+ */
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+)
+
+var (
+	metricsUpdateInterval = 15 * time.Second
+	stopMetricsUpdates    = func() {}
+	numDataTablesRestored int64
+)
+
+func startRestoreMetricsUpdates(numTables int) {
+	metricsFilename := MustGetFlagString(options.METRICS_FILE)
+	if metricsFilename == "" {
+		return
+	}
+	startTime, _ := time.ParseInLocation("20060102150405", restoreStartTime, operating.System.Local)
+	stopMetricsUpdates = report.StartMetricsUpdates(metricsFilename, metricsUpdateInterval, func() report.Metrics {
+		return report.Metrics{
+			Utility:         "gprestore",
+			DatabaseName:    restoreDatabase,
+			InProgress:      true,
+			StartTime:       startTime,
+			TablesCompleted: atomic.LoadInt64(&numDataTablesRestored),
+			TablesTotal:     int64(numTables),
+		}
+	})
+}
+
+/*
+ * The metrics are written during cleanup, so that a restore that is cancelled
+ * is recorded as having failed as well.  A restore that fails before the
+ * database to restore to is known is not recorded, unless given --redirect-db.
+ */
+func writeRestoreMetrics(restoreFailed bool) {
+	stopMetricsUpdates()
+	metricsFilename := MustGetFlagString(options.METRICS_FILE)
+	if metricsFilename == "" {
+		return
+	}
+	databaseName := restoreDatabase
+	if databaseName == "" {
+		databaseName = MustGetFlagString(options.REDIRECT_DB)
+	}
+	if databaseName == "" {
+		gplog.Verbose("Not writing metrics file %s, as the database to restore to is not known", metricsFilename)
+		return
+	}
+	jsonReport := getRestoreJSONReport(0, 0, "")
+	if restoreFailed {
+		jsonReport.Status = history.BackupStatusFailed
+	}
+	err := report.WriteMetricsFile(metricsFilename, report.NewRestoreMetrics(jsonReport, databaseName))
+	if err != nil {
+		gplog.Warn("%v", err)
+	}
+}
@@ -51,12 +51,13 @@ func VerifyBackupFileCountOnSegments() {
 		// Coordinator backup files (and any gprestore report files) will be mixed in with segment backup files on a single-node cluster,
 		// so we explicitly look for filenames in the segment filename format.  In a smaller-to-larger restore, the contents list for a segment
 		// outside the destination array will be "[]", which the find command can handle safely in this context.
+		// Checksum manifests are optional, as backups taken with older versions do not have them, so we do not count them.
 		contentsList := fmt.Sprintf("(%s)", strings.Join(contentMap[contentID], "|"))
 		var cmdString string
 		if runtime.GOOS == "linux" {
-			cmdString = fmt.Sprintf(`find %s -type f -regextype posix-extended -regex ".*gpbackup_%s_%s.*" | wc -l`, globalFPInfo.GetDirForContent(contentID), contentsList, globalFPInfo.Timestamp)
+			cmdString = fmt.Sprintf(`find %s -type f -regextype posix-extended -regex ".*gpbackup_%s_%s.*" ! -name "*_checksums.yaml" | wc -l`, globalFPInfo.GetDirForContent(contentID), contentsList, globalFPInfo.Timestamp)
 		} else if runtime.GOOS == "darwin" {
-			cmdString = fmt.Sprintf(`find -E %s -type f -regex ".*gpbackup_%s_%s.*" | wc -l`, globalFPInfo.GetDirForContent(contentID), contentsList, globalFPInfo.Timestamp)
+			cmdString = fmt.Sprintf(`find -E %s -type f -regex ".*gpbackup_%s_%s.*" ! -name "*_checksums.yaml" | wc -l`, globalFPInfo.GetDirForContent(contentID), contentsList, globalFPInfo.Timestamp)
 		}
 		return cmdString
 	})
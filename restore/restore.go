@@ -43,6 +43,14 @@ func DoValidation(cmd *cobra.Command) {
 	gplog.FatalOnError(err)
 	err = utils.ValidateFullPath(MustGetFlagString(options.PLUGIN_CONFIG))
 	gplog.FatalOnError(err)
+	err = toc.ValidateObjectTypes(append(MustGetFlagStringArray(options.INCLUDE_OBJECT_TYPE), MustGetFlagStringArray(options.EXCLUDE_OBJECT_TYPE)...))
+	gplog.FatalOnError(err)
+	for _, mapFlag := range []string{options.ROLE_MAP, options.TABLESPACE_MAP} {
+		_, err = options.ParseNameMap(mapFlag, MustGetFlagStringArray(mapFlag))
+		gplog.FatalOnError(err)
+	}
+	_, err = options.ParseRedirectTableMap(MustGetFlagStringArray(options.REDIRECT_TABLE))
+	gplog.FatalOnError(err)
 	providedTimestamp := MustGetFlagString(options.TIMESTAMP)
 	if providedTimestamp != "" && !filepath.IsValidTimestamp(providedTimestamp) {
 		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", providedTimestamp), "")
@@ -82,6 +90,10 @@ func DoSetup() {
 	err = opts.QuoteExcludeRelations(connectionPool)
 	gplog.FatalOnError(err)
 
+	roleMap = quoteNameMap(options.ROLE_MAP)
+	tablespaceMap = quoteNameMap(options.TABLESPACE_MAP)
+	redirectTables = quoteRedirectTableMap()
+
 	segPrefix, singleBackupDir, err := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), backupTimestamp)
 	gplog.FatalOnError(err)
 	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), backupTimestamp, segPrefix, singleBackupDir)
@@ -97,6 +109,12 @@ func DoSetup() {
 	} else {
 		InitializeBackupConfig()
 	}
+	if MustGetFlagString(options.CONFIG) != "" {
+		err = options.WriteOptionsFile(cmdFlags, globalFPInfo.GetRestoreOptionsFilePath(restoreStartTime))
+		if err != nil {
+			gplog.Warn("%v", err)
+		}
+	}
 
 	ValidateSafeToResizeCluster()
 
@@ -105,6 +123,10 @@ func DoSetup() {
 	gplog.Info("Greenplum Database Version = %s", connectionPool.Version.VersionString)
 
 	BackupConfigurationValidation()
+	if MustGetFlagBool(options.VERIFY_ONLY) {
+		// Only the backup files are read during verification, so there is nothing to check in the restore database
+		return
+	}
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
 	if !backupConfig.DataOnly {
 		gplog.Verbose("Metadata will be restored from %s", metadataFilename)
@@ -113,11 +135,29 @@ func DoSetup() {
 	if MustGetFlagString(options.REDIRECT_DB) != "" {
 		unquotedRestoreDatabase = MustGetFlagString(options.REDIRECT_DB)
 	}
-	ValidateDatabaseExistence(unquotedRestoreDatabase, MustGetFlagBool(options.CREATE_DB), backupConfig.IncludeTableFiltered || backupConfig.DataOnly)
-	if MustGetFlagBool(options.WITH_GLOBALS) {
+	restoreDatabase = unquotedRestoreDatabase
+	initializeRestoreState(unquotedRestoreDatabase)
+	createDB := MustGetFlagBool(options.CREATE_DB) && !restoreState.IsSectionRestored(SECTION_DATABASE)
+	ValidateDatabaseExistence(unquotedRestoreDatabase, createDB, backupConfig.IncludeTableFiltered || backupConfig.DataOnly)
+	restoreGlobals := MustGetFlagBool(options.WITH_GLOBALS) && !restoreState.IsSectionRestored(SECTION_GLOBALS)
+	if restoreGlobals {
 		restoreGlobal(metadataFilename)
-	} else if MustGetFlagBool(options.CREATE_DB) {
+		restoreState.RecordSectionRestored(SECTION_GLOBALS)
+		if MustGetFlagBool(options.CREATE_DB) {
+			restoreState.RecordSectionRestored(SECTION_DATABASE)
+		}
+	}
+	// The tablespaces mapped to must exist before any statement using them is restored, so they are checked after the globals create them
+	if len(tablespaceMap) > 0 {
+		tablespaces := make([]string, 0, len(tablespaceMap))
+		for _, tablespace := range tablespaceMap {
+			tablespaces = append(tablespaces, tablespace)
+		}
+		ValidateTablespacesInRestoreCluster(connectionPool, tablespaces)
+	}
+	if !restoreGlobals && createDB {
 		createDatabase(metadataFilename)
+		restoreState.RecordSectionRestored(SECTION_DATABASE)
 	}
 	if connectionPool != nil {
 		connectionPool.Close()
@@ -130,7 +170,7 @@ func DoSetup() {
 	 * For on-error-continue, we will see the same errors later when we try to run SQL,
 	 * but since they will not stop the restore, it is not necessary to log them twice.
 	 */
-	if !MustGetFlagBool(options.CREATE_DB) && !MustGetFlagBool(options.ON_ERROR_CONTINUE) && !MustGetFlagBool(options.INCREMENTAL) {
+	if !MustGetFlagBool(options.CREATE_DB) && !MustGetFlagBool(options.ON_ERROR_CONTINUE) && !MustGetFlagBool(options.INCREMENTAL) && !MustGetFlagBool(options.RESUME) {
 		relationsToRestore := GenerateRestoreRelationList(*opts)
 		if opts.RedirectSchema != "" {
 			fqns, err := options.SeparateSchemaAndTable(relationsToRestore)
@@ -141,15 +181,28 @@ func DoSetup() {
 			}
 			relationsToRestore = redirectRelationsToRestore
 		}
+		for i, relation := range relationsToRestore {
+			if redirectTable, ok := redirectTables[relation]; ok {
+				relationsToRestore[i] = utils.MakeFQN(redirectTable.Schema, redirectTable.Name)
+			}
+		}
 		ValidateRelationsInRestoreDatabase(connectionPool, relationsToRestore)
 	}
 
 	if opts.RedirectSchema != "" {
 		ValidateRedirectSchema(connectionPool, opts.RedirectSchema)
 	}
+	if len(redirectTables) > 0 {
+		ValidateRedirectTablesInRestoreDatabase(redirectTables)
+	}
 }
 
 func DoRestore() {
+	if MustGetFlagBool(options.VERIFY_ONLY) {
+		VerifyBackupData()
+		return
+	}
+
 	var filteredDataEntries map[string][]toc.CoordinatorDataEntry
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
 	isDataOnly := backupConfig.DataOnly || MustGetFlagBool(options.DATA_ONLY)
@@ -161,12 +214,12 @@ func DoRestore() {
 	}
 
 	if !isDataOnly && !isIncremental {
-		restorePredata(metadataFilename)
+		restoreSection(SECTION_PREDATA, func() { restorePredata(metadataFilename) })
 	} else if isDataOnly {
 		// The sequence setval commands need to be run during data only restores since
 		// they are arguably the data of the sequence relations and can affect user tables
 		// containing columns that reference those sequence relations.
-		restoreSequenceValues(metadataFilename)
+		restoreSection(SECTION_SEQUENCES, func() { restoreSequenceValues(metadataFilename) })
 	}
 
 	totalTablesRestored := 0
@@ -178,13 +231,25 @@ func DoRestore() {
 	}
 
 	if !isDataOnly && !isIncremental {
-		restorePostdata(metadataFilename)
+		restoreSection(SECTION_POSTDATA, func() { restorePostdata(metadataFilename) })
 	}
 
 	if MustGetFlagBool(options.WITH_STATS) && backupConfig.WithStatistics {
-		restoreStatistics()
+		restoreSection(SECTION_STATISTICS, restoreStatistics)
 	} else if MustGetFlagBool(options.RUN_ANALYZE) && totalTablesRestored > 0 {
-		runAnalyze(filteredDataEntries)
+		restoreSection(SECTION_ANALYZE, func() { runAnalyze(filteredDataEntries) })
+	}
+}
+
+// A section that was restored before a resumed restore failed is not restored again
+func restoreSection(section string, restoreFunc func()) {
+	if restoreState.IsSectionRestored(section) {
+		gplog.Info("Skipping %s restore, as it was completed before the restore was resumed", section)
+		return
+	}
+	restoreFunc()
+	if !wasTerminated {
+		restoreState.RecordSectionRestored(section)
 	}
 }
 
@@ -303,6 +368,7 @@ func restorePredata(metadataFilename string) {
 	statements := GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{}, []string{toc.OBJ_SCHEMA}, filters)
 
 	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	editStatementsRedirectTables(statements, redirectTables)
 	progressBar := utils.NewProgressBar(len(schemaStatements)+len(statements), "Pre-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
 
@@ -453,6 +519,115 @@ func editStatementsRedirectSchema(statements []toc.StatementWithType, redirectSc
 	}
 }
 
+/*
+ * Index and sequence names are unique within a schema, so the indexes,
+ * constraints, and owned sequences of a redirected table are renamed for the
+ * table to which it is redirected, by replacing the name of the table at the
+ * start of theirs or by prefixing theirs with it.
+ */
+func redirectDependentName(name string, oldTableName string, newTableName string) string {
+	unquotedName := utils.UnquoteIdent(name)
+	unquotedOldTableName := utils.UnquoteIdent(oldTableName)
+	newName := utils.UnquoteIdent(newTableName)
+	if strings.HasPrefix(unquotedName, unquotedOldTableName) {
+		newName += strings.TrimPrefix(unquotedName, unquotedOldTableName)
+	} else {
+		newName += "_" + unquotedName
+	}
+	// A name made from names that did not need quotes does not need them either
+	if !strings.HasPrefix(name, `"`) && !strings.HasPrefix(newTableName, `"`) {
+		return newName
+	}
+	return fmt.Sprintf(`"%s"`, strings.ReplaceAll(newName, `"`, `""`))
+}
+
+/*
+ * Returns the name to which an index, constraint, or sequence that belongs to
+ * a redirected table is renamed; an owned sequence is found through the
+ * statement that sets its owner, as it is created before the table.
+ */
+func redirectDependentObject(schema string, name string, objectType string, referenceObject string, redirectTables map[string]options.Relation) (options.Relation, bool) {
+	redirectTable, ok := redirectTables[referenceObject]
+	if !ok || (objectType != toc.OBJ_INDEX && objectType != toc.OBJ_CONSTRAINT && objectType != toc.OBJ_SEQUENCE_OWNER) {
+		return options.Relation{}, false
+	}
+	oldTableName := strings.TrimPrefix(referenceObject, schema+".")
+	return options.Relation{
+		Schema: redirectTable.Schema,
+		Name:   redirectDependentName(name, oldTableName, redirectTable.Name),
+	}, true
+}
+
+func replaceIdentifier(statement string, prefix string, oldName string, newName string) string {
+	pattern := regexp.MustCompile(fmt.Sprintf(`(^|[\s(,'])%s%s([\s(.;,)']|$)`, regexp.QuoteMeta(prefix), regexp.QuoteMeta(oldName)))
+	return pattern.ReplaceAllString(statement, fmt.Sprintf("${1}%s%s${2}", strings.ReplaceAll(prefix, "$", "$$"), strings.ReplaceAll(newName, "$", "$$")))
+}
+
+/*
+ * The statements that create a redirected table, set its metadata, or create
+ * the indexes, constraints, triggers, rules, and owned sequences on it, along
+ * with the statements that set the metadata of those, are edited to refer to
+ * the table to which it is redirected.  The sequences are renamed in the
+ * column defaults of the table as well.
+ */
+func editStatementsRedirectTables(statements []toc.StatementWithType, redirectTables map[string]options.Relation) {
+	if len(redirectTables) == 0 {
+		return
+	}
+	renamedObjects := make(map[string]options.Relation)
+	for _, statement := range statements {
+		if renamedObject, ok := redirectDependentObject(statement.Schema, statement.Name, statement.ObjectType, statement.ReferenceObject, redirectTables); ok {
+			renamedObjects[utils.MakeFQN(statement.Schema, statement.Name)] = renamedObject
+		}
+	}
+
+	for i := range statements {
+		fqn := utils.MakeFQN(statements[i].Schema, statements[i].Name)
+		redirectTable, isTable := redirectTables[fqn]
+		referencedTable, referencesTable := redirectTables[statements[i].ReferenceObject]
+		renamedObject, referencesObject := renamedObjects[statements[i].ReferenceObject]
+		// The statements that create an owned sequence and set its metadata refer to no other object
+		renamedSequence, isRenamedSequence := renamedObjects[fqn]
+		isRenamedSequence = isRenamedSequence && statements[i].ReferenceObject == ""
+		if !isTable && !referencesTable && !referencesObject && !isRenamedSequence {
+			continue
+		}
+		statement := statements[i].Statement
+		for oldTable, newTable := range redirectTables {
+			statement = replaceIdentifier(statement, "", oldTable, utils.MakeFQN(newTable.Schema, newTable.Name))
+		}
+		for oldObject, newObject := range renamedObjects {
+			statement = replaceIdentifier(statement, "", oldObject, utils.MakeFQN(newObject.Schema, newObject.Name))
+		}
+
+		if isTable {
+			statements[i].Schema = redirectTable.Schema
+			statements[i].Name = redirectTable.Name
+		}
+		if isRenamedSequence {
+			statements[i].Schema = renamedSequence.Schema
+			statements[i].Name = renamedSequence.Name
+		}
+		if referencesTable {
+			statements[i].ReferenceObject = utils.MakeFQN(referencedTable.Schema, referencedTable.Name)
+			if renamedObject, ok := renamedObjects[fqn]; ok {
+				statement = replaceIdentifier(statement, "INDEX ", statements[i].Name, renamedObject.Name)
+				statement = replaceIdentifier(statement, "CONSTRAINT ", statements[i].Name, renamedObject.Name)
+				statements[i].Schema = renamedObject.Schema
+				statements[i].Name = renamedObject.Name
+			}
+		}
+		if referencesObject {
+			statement = replaceIdentifier(statement, "CONSTRAINT ", statements[i].Name, renamedObject.Name)
+			statement = replaceIdentifier(statement, "CLUSTER ON ", statements[i].Name, renamedObject.Name)
+			statements[i].ReferenceObject = utils.MakeFQN(renamedObject.Schema, renamedObject.Name)
+			statements[i].Schema = renamedObject.Schema
+			statements[i].Name = renamedObject.Name
+		}
+		statements[i].Statement = statement
+	}
+}
+
 func restoreData() (int, map[string][]toc.CoordinatorDataEntry) {
 	if wasTerminated {
 		return -1, nil
@@ -470,22 +645,37 @@ func restoreData() (int, map[string][]toc.CoordinatorDataEntry) {
 
 	totalTables := 0
 	filteredDataEntries := make(map[string][]toc.CoordinatorDataEntry)
+	dataFileExtensions := make(map[string]string)
 	for _, entry := range restorePlanEntries {
 		fpInfo := GetBackupFPInfoForTimestamp(entry.Timestamp)
 		tocfile := toc.NewTOC(fpInfo.GetTOCFilePath())
+		dataFileExtensions[entry.Timestamp] = tocfile.DataFileExtension
 		restorePlanTableFQNs := entry.TableFQNs
 		filteredDataEntriesForTimestamp := tocfile.GetDataEntriesMatching(opts.IncludedSchemas,
 			opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations, restorePlanTableFQNs)
 		filteredDataEntries[entry.Timestamp] = filteredDataEntriesForTimestamp
 		totalTables += len(filteredDataEntriesForTimestamp)
 	}
-	dataProgressBar := utils.NewProgressBar(totalTables, "Tables restored: ", utils.PB_INFO)
+	// ANALYZE is run on every table restored, whether or not the restore was resumed
+	remainingDataEntries := make(map[string][]toc.CoordinatorDataEntry, len(filteredDataEntries))
+	numRemainingTables := 0
+	for timestamp, entries := range filteredDataEntries {
+		remainingDataEntries[timestamp] = filterRestoredDataEntries(entries)
+		numRemainingTables += len(remainingDataEntries[timestamp])
+	}
+	if numRemainingTables < totalTables {
+		gplog.Info("Skipping data restore for %d tables restored before the restore was resumed", totalTables-numRemainingTables)
+	}
+	dataProgressBar := utils.NewProgressBar(numRemainingTables, "Tables restored: ", utils.PB_INFO)
 	dataProgressBar.Start()
+	startRestoreMetricsUpdates(numRemainingTables)
+	defer stopMetricsUpdates()
 
 	gucStatements := setGUCsForConnection(nil, 0)
 	numErrors := int32(0)
-	for timestamp, entries := range filteredDataEntries {
+	for timestamp, entries := range remainingDataEntries {
 		gplog.Verbose("Restoring data for %d tables from backup with timestamp: %s", len(entries), timestamp)
+		initializePipeThroughParametersForTimestamp(dataFileExtensions[timestamp])
 		numErrors = restoreDataFromTimestamp(GetBackupFPInfoForTimestamp(timestamp), entries, gucStatements, dataProgressBar)
 	}
 
@@ -511,6 +701,7 @@ func restorePostdata(metadataFilename string) {
 
 	statements := GetRestoreMetadataStatementsFiltered("postdata", metadataFilename, []string{}, []string{}, filters)
 	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	editStatementsRedirectTables(statements, redirectTables)
 	firstBatch, secondBatch, thirdBatch := BatchPostdataStatements(statements)
 	progressBar := utils.NewProgressBar(len(statements), "Post-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
@@ -540,6 +731,7 @@ func restoreStatistics() {
 
 	statements := GetRestoreMetadataStatementsFiltered("statistics", statisticsFilename, []string{}, []string{}, filters)
 	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	editStatementsRedirectTables(statements, redirectTables)
 	numErrors := ExecuteRestoreMetadataStatements("statistics", statements, "Table statistics", nil, utils.PB_VERBOSE, false)
 
 	if numErrors > 0 {
@@ -558,16 +750,12 @@ func runAnalyze(filteredDataEntries map[string][]toc.CoordinatorDataEntry) {
 	var analyzeStatements []toc.StatementWithType
 	for _, dataEntries := range filteredDataEntries {
 		for _, entry := range dataEntries {
-			tableSchema := entry.Schema
-			if opts.RedirectSchema != "" {
-				tableSchema = opts.RedirectSchema
-			}
-			tableFQN := utils.MakeFQN(tableSchema, entry.Name)
-			analyzeCommand := fmt.Sprintf("ANALYZE %s", tableFQN)
+			tableSchema, tableName := getRestoreSchemaAndName(entry)
+			analyzeCommand := fmt.Sprintf("ANALYZE %s", utils.MakeFQN(tableSchema, tableName))
 
 			newAnalyzeStatement := toc.StatementWithType{
 				Schema:    tableSchema,
-				Name:      entry.Name,
+				Name:      tableName,
 				Statement: analyzeCommand,
 			}
 			analyzeStatements = append(analyzeStatements, newAnalyzeStatement)
@@ -632,6 +820,13 @@ func DoTeardown() {
 		fmt.Println(errStr)
 	}
 	errMsg := report.ParseErrorMessage(errStr)
+	if restoreFailed {
+		if restoreState != nil {
+			gplog.Info("Restore progress is recorded in %s; run gprestore again with --resume to resume the restore", restoreState.filename)
+		}
+	} else {
+		removeRestoreState()
+	}
 
 	if globalFPInfo.Timestamp != "" {
 		_, statErr := os.Stat(globalFPInfo.GetDirForContent(-1))
@@ -641,6 +836,7 @@ func DoTeardown() {
 		reportFilename := globalFPInfo.GetRestoreReportFilePath(restoreStartTime)
 		origSize, destSize, _, _ := GetResizeClusterInfo()
 		report.WriteRestoreReportFile(reportFilename, globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, origSize, destSize, errMsg)
+		writeRestoreJSONReport(origSize, destSize, errMsg)
 		report.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gprestore", !restoreFailed, backupConfig.DatabaseName)
 		if pluginConfig != nil {
 			pluginConfig.CleanupPluginForRestore(globalCluster, globalFPInfo)
@@ -657,6 +853,31 @@ func DoTeardown() {
 	}
 }
 
+/*
+ * The notifications are sent during cleanup rather than along with the report,
+ * so that a restore that fails before its report is written, or is cancelled,
+ * is notified as well.
+ */
+func sendRestoreNotifications() {
+	timestamp := globalFPInfo.Timestamp
+	if timestamp == "" {
+		timestamp = MustGetFlagString(options.TIMESTAMP)
+	}
+	reportFilename := ""
+	if globalFPInfo.Timestamp != "" && utils.FileExists(globalFPInfo.GetRestoreReportFilePath(restoreStartTime)) {
+		reportFilename = globalFPInfo.GetRestoreReportFilePath(restoreStartTime)
+	}
+	notificationDatabase := restoreDatabase
+	if notificationDatabase == "" {
+		notificationDatabase = MustGetFlagString(options.REDIRECT_DB)
+	}
+	if notificationDatabase == "" && backupConfig != nil {
+		// A verification does not restore to a database
+		notificationDatabase = utils.UnquoteIdent(backupConfig.DatabaseName)
+	}
+	report.SendNotifications(globalCluster, timestamp, reportFilename, "gprestore", notificationDatabase, wasTerminated)
+}
+
 func writeErrorTables(isMetadata bool) {
 	var errorTables *map[string]Empty
 	var errorFilename string
@@ -701,6 +922,28 @@ func writeErrorTables(isMetadata bool) {
 	}
 }
 
+func writeRestoreJSONReport(origSize int, destSize int, errMsg string) {
+	jsonReport := getRestoreJSONReport(origSize, destSize, errMsg)
+	report.WriteRestoreJSONReportFile(globalFPInfo.GetRestoreJSONReportFilePath(restoreStartTime), jsonReport)
+}
+
+func getRestoreJSONReport(origSize int, destSize int, errMsg string) report.RestoreJSONReport {
+	jsonReport := report.NewRestoreJSONReport(globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, errMsg)
+	if backupConfig != nil {
+		jsonReport.BackupConfig = *backupConfig
+	}
+	jsonReport.BackupSegmentCount = origSize
+	jsonReport.RestoreSegmentCount = destSize
+	jsonReport.Tables = append(jsonReport.Tables, restoredTables...)
+	for table := range errorTablesMetadata {
+		jsonReport.ErrorTablesMetadata = append(jsonReport.ErrorTablesMetadata, table)
+	}
+	for table := range errorTablesData {
+		jsonReport.ErrorTablesData = append(jsonReport.ErrorTablesData, table)
+	}
+	return jsonReport
+}
+
 func DoCleanup(restoreFailed bool) {
 	cleanupTimeout := 60 * time.Second
 
@@ -735,7 +978,15 @@ func DoCleanup(restoreFailed bool) {
 				}
 			}
 		}
+	} else if backupConfig != nil && utils.GetEncryptionKey() != nil {
+		// Multi-file restores leave only the encryption key file behind on the segments
+		fpInfoList := GetBackupFPInfoListFromRestorePlan()
+		for _, fpInfo := range fpInfoList {
+			utils.CleanUpHelperFilesOnAllHosts(globalCluster, fpInfo, cleanupTimeout)
+		}
 	}
+	writeRestoreMetrics(restoreFailed)
+	sendRestoreNotifications()
 
 	if connectionPool != nil {
 		connectionPool.Close()
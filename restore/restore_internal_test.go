@@ -2,6 +2,7 @@ package restore
 
 import (
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/toc"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -137,4 +138,60 @@ var _ = Describe("restore internal tests", func() {
 			}
 		})
 	})
+	Describe("editStatementsRedirectTables", func() {
+		redirectTables := map[string]options.Relation{"public.orders": {Schema: "archive", Name: "orders_2023"}}
+		It("does not alter statements if no tables are redirected", func() {
+			redirectStatements := []toc.StatementWithType{
+				{Schema: "public", Name: "orders", ObjectType: toc.OBJ_TABLE, Statement: "\n\nCREATE TABLE public.orders (\n\tid integer\n) DISTRIBUTED BY (id);\n"},
+			}
+			originalStatements := make([]toc.StatementWithType, len(redirectStatements))
+			copy(originalStatements, redirectStatements)
+
+			editStatementsRedirectTables(redirectStatements, map[string]options.Relation{})
+
+			Expect(redirectStatements).To(Equal(originalStatements))
+		})
+		It("changes the table and the objects that depend on it", func() {
+			redirectStatements := []toc.StatementWithType{
+				{Schema: "public", Name: "orders_id_seq", ObjectType: toc.OBJ_SEQUENCE, Statement: "\n\nCREATE SEQUENCE public.orders_id_seq\n\tSTART WITH 1;\n\nSELECT pg_catalog.setval('public.orders_id_seq', 1, false);\n"},
+				{Schema: "public", Name: "orders_id_seq", ObjectType: toc.OBJ_SEQUENCE, Statement: "\n\nCOMMENT ON SEQUENCE public.orders_id_seq IS 'ids';\n"},
+				{Schema: "public", Name: "orders", ObjectType: toc.OBJ_TABLE, Statement: "\n\nCREATE TABLE public.orders (\n\tid integer DEFAULT nextval('public.orders_id_seq'::regclass)\n) DISTRIBUTED BY (id);\n"},
+				{Schema: "public", Name: "orders", ObjectType: toc.OBJ_TABLE, Statement: "\n\nCOMMENT ON TABLE public.orders IS 'orders';\n"},
+				{Schema: "public", Name: "orders_history", ObjectType: toc.OBJ_TABLE, Statement: "\n\nCREATE TABLE public.orders_history (\n\tid integer\n) DISTRIBUTED BY (id);\n"},
+				{Schema: "public", Name: "orders_id_seq", ObjectType: toc.OBJ_SEQUENCE_OWNER, ReferenceObject: "public.orders", Statement: "\n\nALTER SEQUENCE public.orders_id_seq OWNED BY public.orders.id;\n"},
+				{Schema: "public", Name: "orders_pkey", ObjectType: toc.OBJ_CONSTRAINT, ReferenceObject: "public.orders", Statement: "\n\nALTER TABLE ONLY public.orders ADD CONSTRAINT orders_pkey PRIMARY KEY (id);\n"},
+				{Schema: "public", Name: "idx_id", ObjectType: toc.OBJ_INDEX, ReferenceObject: "public.orders", Statement: "\n\nCREATE INDEX idx_id ON public.orders USING btree (id);\n"},
+				{Schema: "public", Name: "idx_id", ObjectType: "INDEX METADATA", ReferenceObject: "public.idx_id", Statement: "\n\nALTER TABLE public.orders CLUSTER ON idx_id;\n"},
+				{Schema: "public", Name: "idx_id", ObjectType: "INDEX METADATA", ReferenceObject: "public.idx_id", Statement: "\n\nCOMMENT ON INDEX public.idx_id IS 'id';\n"},
+				{Schema: "public", Name: "orders_pkey", ObjectType: "CONSTRAINT METADATA", ReferenceObject: "public.orders_pkey", Statement: "\n\nCOMMENT ON CONSTRAINT orders_pkey ON public.orders IS 'key';\n"},
+				{Schema: "public", Name: "orders_history_pkey", ObjectType: toc.OBJ_CONSTRAINT, ReferenceObject: "public.orders_history", Statement: "\n\nALTER TABLE ONLY public.orders_history ADD CONSTRAINT orders_history_pkey PRIMARY KEY (id);\n"},
+			}
+
+			editStatementsRedirectTables(redirectStatements, redirectTables)
+
+			expectedStatements := []toc.StatementWithType{
+				{Schema: "archive", Name: "orders_2023_id_seq", ObjectType: toc.OBJ_SEQUENCE, Statement: "\n\nCREATE SEQUENCE archive.orders_2023_id_seq\n\tSTART WITH 1;\n\nSELECT pg_catalog.setval('archive.orders_2023_id_seq', 1, false);\n"},
+				{Schema: "archive", Name: "orders_2023_id_seq", ObjectType: toc.OBJ_SEQUENCE, Statement: "\n\nCOMMENT ON SEQUENCE archive.orders_2023_id_seq IS 'ids';\n"},
+				{Schema: "archive", Name: "orders_2023", ObjectType: toc.OBJ_TABLE, Statement: "\n\nCREATE TABLE archive.orders_2023 (\n\tid integer DEFAULT nextval('archive.orders_2023_id_seq'::regclass)\n) DISTRIBUTED BY (id);\n"},
+				{Schema: "archive", Name: "orders_2023", ObjectType: toc.OBJ_TABLE, Statement: "\n\nCOMMENT ON TABLE archive.orders_2023 IS 'orders';\n"},
+				{Schema: "public", Name: "orders_history", ObjectType: toc.OBJ_TABLE, Statement: "\n\nCREATE TABLE public.orders_history (\n\tid integer\n) DISTRIBUTED BY (id);\n"},
+				{Schema: "archive", Name: "orders_2023_id_seq", ObjectType: toc.OBJ_SEQUENCE_OWNER, ReferenceObject: "archive.orders_2023", Statement: "\n\nALTER SEQUENCE archive.orders_2023_id_seq OWNED BY archive.orders_2023.id;\n"},
+				{Schema: "archive", Name: "orders_2023_pkey", ObjectType: toc.OBJ_CONSTRAINT, ReferenceObject: "archive.orders_2023", Statement: "\n\nALTER TABLE ONLY archive.orders_2023 ADD CONSTRAINT orders_2023_pkey PRIMARY KEY (id);\n"},
+				{Schema: "archive", Name: "orders_2023_idx_id", ObjectType: toc.OBJ_INDEX, ReferenceObject: "archive.orders_2023", Statement: "\n\nCREATE INDEX orders_2023_idx_id ON archive.orders_2023 USING btree (id);\n"},
+				{Schema: "archive", Name: "orders_2023_idx_id", ObjectType: "INDEX METADATA", ReferenceObject: "archive.orders_2023_idx_id", Statement: "\n\nALTER TABLE archive.orders_2023 CLUSTER ON orders_2023_idx_id;\n"},
+				{Schema: "archive", Name: "orders_2023_idx_id", ObjectType: "INDEX METADATA", ReferenceObject: "archive.orders_2023_idx_id", Statement: "\n\nCOMMENT ON INDEX archive.orders_2023_idx_id IS 'id';\n"},
+				{Schema: "archive", Name: "orders_2023_pkey", ObjectType: "CONSTRAINT METADATA", ReferenceObject: "archive.orders_2023_pkey", Statement: "\n\nCOMMENT ON CONSTRAINT orders_2023_pkey ON archive.orders_2023 IS 'key';\n"},
+				{Schema: "public", Name: "orders_history_pkey", ObjectType: toc.OBJ_CONSTRAINT, ReferenceObject: "public.orders_history", Statement: "\n\nALTER TABLE ONLY public.orders_history ADD CONSTRAINT orders_history_pkey PRIMARY KEY (id);\n"},
+			}
+			Expect(redirectStatements).To(HaveLen(len(expectedStatements)))
+			for i := range redirectStatements {
+				Expect(redirectStatements[i]).To(Equal(expectedStatements[i]))
+			}
+		})
+		It("quotes the names of dependent objects if the table to redirect to is quoted", func() {
+			Expect(redirectDependentName("orders_pkey", "orders", `"Orders"`)).To(Equal(`"Orders_pkey"`))
+			Expect(redirectDependentName(`"Idx"`, `"Orders"`, "orders_2023")).To(Equal(`"orders_2023_Idx"`))
+			Expect(redirectDependentName("idx", "orders", "orders_2023")).To(Equal("orders_2023_idx"))
+		})
+	})
 })
@@ -0,0 +1,263 @@
+package restore
+
+/*
+ * This file contains structs and functions related to recording the progress
+ * of a restore, so that a failed or cancelled restore can be resumed.
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	SECTION_GLOBALS    = "globals"
+	SECTION_DATABASE   = "database"
+	SECTION_PREDATA    = "predata"
+	SECTION_SEQUENCES  = "sequences"
+	SECTION_POSTDATA   = "postdata"
+	SECTION_STATISTICS = "statistics"
+	SECTION_ANALYZE    = "analyze"
+
+	stateDatabase = "database"
+	stateSection  = "section"
+	stateStarted  = "started"
+	stateRestored = "restored"
+)
+
+var restoreState *RestoreState
+
+/*
+ * The state file is a log to which a line is appended as each metadata section
+ * is restored and as the data of each table starts to load and is loaded, so
+ * that a restore that fails at any point leaves a usable record behind.
+ */
+type RestoreState struct {
+	Database         string
+	RestoredSections map[string]bool
+	StartedTables    map[string]bool
+	RestoredTables   map[string]bool
+	filename         string
+	mutex            sync.Mutex
+}
+
+func NewRestoreState(filename string, database string) (*RestoreState, error) {
+	state := &RestoreState{
+		Database:         database,
+		RestoredSections: make(map[string]bool),
+		StartedTables:    make(map[string]bool),
+		RestoredTables:   make(map[string]bool),
+		filename:         filename,
+	}
+	err := os.WriteFile(filename, []byte(formatStateLine(stateDatabase, database)), 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to create restore state file %s", filename)
+	}
+	return state, nil
+}
+
+// A line left incomplete by a restore that was killed while writing it is ignored
+func ReadRestoreState(filename string) (*RestoreState, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read restore state file %s", filename)
+	}
+	defer file.Close()
+
+	state := &RestoreState{
+		RestoredSections: make(map[string]bool),
+		StartedTables:    make(map[string]bool),
+		RestoredTables:   make(map[string]bool),
+		filename:         filename,
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		kind, quotedName, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			continue
+		}
+		name, err := strconv.Unquote(quotedName)
+		if err != nil {
+			continue
+		}
+		switch kind {
+		case stateDatabase:
+			state.Database = name
+		case stateSection:
+			state.RestoredSections[name] = true
+		case stateStarted:
+			state.StartedTables[name] = true
+		case stateRestored:
+			state.RestoredTables[name] = true
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Unable to read restore state file %s", filename)
+	}
+	return state, nil
+}
+
+func formatStateLine(kind string, name string) string {
+	return fmt.Sprintf("%s %s\n", kind, strconv.Quote(name))
+}
+
+/*
+ * Failing to record progress does not fail the restore, though it means the
+ * restore may not be resumed from where it failed.
+ */
+func (state *RestoreState) record(kind string, name string) {
+	if state == nil {
+		return
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	switch kind {
+	case stateSection:
+		state.RestoredSections[name] = true
+	case stateStarted:
+		state.StartedTables[name] = true
+	case stateRestored:
+		state.RestoredTables[name] = true
+	}
+	file, err := os.OpenFile(state.filename, os.O_APPEND|os.O_WRONLY, 0644)
+	if err == nil {
+		_, err = file.WriteString(formatStateLine(kind, name))
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		gplog.Warn("Unable to record restore progress in %s: %v", state.filename, err)
+	}
+}
+
+func (state *RestoreState) RecordSectionRestored(section string) {
+	state.record(stateSection, section)
+}
+
+func (state *RestoreState) RecordTableStarted(tableName string) {
+	state.record(stateStarted, tableName)
+}
+
+func (state *RestoreState) RecordTableRestored(tableName string) {
+	state.record(stateRestored, tableName)
+}
+
+func (state *RestoreState) IsSectionRestored(section string) bool {
+	if state == nil {
+		return false
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return state.RestoredSections[section]
+}
+
+func (state *RestoreState) IsTableRestored(tableName string) bool {
+	if state == nil {
+		return false
+	}
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return state.RestoredTables[tableName]
+}
+
+// The tables whose data was being loaded when the restore failed
+func (state *RestoreState) InFlightTables() []string {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	tables := make([]string, 0)
+	for table := range state.StartedTables {
+		if !state.RestoredTables[table] {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+/*
+ * A new restore starts a new state file, while a resumed restore continues
+ * the state file of the restore it resumes.  The state file is named for the
+ * database being restored into, so a restore can only resume a restore into
+ * the same database.
+ */
+func initializeRestoreState(unquotedRestoreDatabase string) {
+	stateFilename := globalFPInfo.GetRestoreStateFilePath(unquotedRestoreDatabase)
+	var err error
+	if !MustGetFlagBool(options.RESUME) {
+		restoreState, err = NewRestoreState(stateFilename, unquotedRestoreDatabase)
+		if err != nil {
+			gplog.Warn("%v; the restore will not be able to be resumed if it fails", err)
+		}
+		return
+	}
+
+	if !utils.FileExists(stateFilename) {
+		gplog.Fatal(errors.Errorf("Cannot resume restore of backup %s into database %s, as there is no restore state file %s",
+			globalFPInfo.Timestamp, unquotedRestoreDatabase, stateFilename), "")
+	}
+	restoreState, err = ReadRestoreState(stateFilename)
+	gplog.FatalOnError(err)
+	gplog.Info("Resuming restore into database %s with data for %d tables already restored", unquotedRestoreDatabase, len(restoreState.RestoredTables))
+
+	inFlightTables := restoreState.InFlightTables()
+	if len(inFlightTables) == 0 {
+		return
+	}
+	if MustGetFlagBool(options.TRUNCATE_TABLE) {
+		gplog.Info("Tables whose data was being restored when the restore failed will be truncated, along with the other tables whose data remains to be restored")
+	} else {
+		gplog.Warn("The data of the following tables was being restored when the restore failed, and will be restored again without truncating them; " +
+			"use --truncate-table to truncate them first if they contain data:")
+		for _, table := range inFlightTables {
+			gplog.Warn("\t%s", table)
+		}
+	}
+}
+
+func removeRestoreState() {
+	if restoreState == nil {
+		return
+	}
+	err := utils.RemoveFileIfExists(restoreState.filename)
+	if err != nil {
+		gplog.Warn("Unable to remove restore state file %s: %v", restoreState.filename, err)
+	}
+}
+
+// Data entries are identified by the name of the table they are restored to
+func GetRestoreTableName(entry toc.CoordinatorDataEntry) string {
+	return utils.MakeFQN(getRestoreSchemaAndName(entry))
+}
+
+func getRestoreSchemaAndName(entry toc.CoordinatorDataEntry) (string, string) {
+	if opts.RedirectSchema != "" {
+		return opts.RedirectSchema, entry.Name
+	}
+	if redirectTable, ok := redirectTables[utils.MakeFQN(entry.Schema, entry.Name)]; ok {
+		return redirectTable.Schema, redirectTable.Name
+	}
+	return entry.Schema, entry.Name
+}
+
+func filterRestoredDataEntries(dataEntries []toc.CoordinatorDataEntry) []toc.CoordinatorDataEntry {
+	remainingEntries := make([]toc.CoordinatorDataEntry, 0, len(dataEntries))
+	for _, entry := range dataEntries {
+		if !restoreState.IsTableRestored(GetRestoreTableName(entry)) {
+			remainingEntries = append(remainingEntries, entry)
+		}
+	}
+	return remainingEntries
+}
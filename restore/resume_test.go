@@ -0,0 +1,67 @@
+package restore_test
+
+import (
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gpbackup/restore"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/resume tests", func() {
+	var stateFilename string
+	BeforeEach(func() {
+		stateFilename = path.Join(GinkgoT().TempDir(), "gprestore_20170101010101_testdb_state")
+	})
+	Describe("ReadRestoreState", func() {
+		It("reads the progress recorded by a restore", func() {
+			state, err := restore.NewRestoreState(stateFilename, "testdb")
+			Expect(err).ToNot(HaveOccurred())
+			state.RecordSectionRestored(restore.SECTION_PREDATA)
+			state.RecordTableStarted("public.foo")
+			state.RecordTableRestored("public.foo")
+			state.RecordTableStarted(`"my schema"."bar baz"`)
+
+			resumedState, err := restore.ReadRestoreState(stateFilename)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resumedState.Database).To(Equal("testdb"))
+			Expect(resumedState.IsSectionRestored(restore.SECTION_PREDATA)).To(BeTrue())
+			Expect(resumedState.IsSectionRestored(restore.SECTION_POSTDATA)).To(BeFalse())
+			Expect(resumedState.IsTableRestored("public.foo")).To(BeTrue())
+			Expect(resumedState.IsTableRestored(`"my schema"."bar baz"`)).To(BeFalse())
+			Expect(resumedState.InFlightTables()).To(Equal([]string{`"my schema"."bar baz"`}))
+		})
+		It("ignores a line left incomplete by a killed restore", func() {
+			contents := "database \"testdb\"\nrestored \"public.foo\"\nrestored \"public.ba"
+			Expect(os.WriteFile(stateFilename, []byte(contents), 0644)).To(Succeed())
+
+			state, err := restore.ReadRestoreState(stateFilename)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.RestoredTables).To(Equal(map[string]bool{"public.foo": true}))
+		})
+		It("returns an error if there is no state file", func() {
+			_, err := restore.ReadRestoreState(stateFilename)
+
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("NewRestoreState", func() {
+		It("discards the progress of an earlier restore", func() {
+			state, err := restore.NewRestoreState(stateFilename, "testdb")
+			Expect(err).ToNot(HaveOccurred())
+			state.RecordTableRestored("public.foo")
+
+			_, err = restore.NewRestoreState(stateFilename, "otherdb")
+			Expect(err).ToNot(HaveOccurred())
+			resumedState, err := restore.ReadRestoreState(stateFilename)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resumedState.Database).To(Equal("otherdb"))
+			Expect(resumedState.RestoredTables).To(BeEmpty())
+		})
+	})
+})
@@ -2,6 +2,7 @@ package restore
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -18,6 +19,42 @@ import (
  * This file contains functions related to validating user input.
  */
 
+/*
+ * Replaces the glob and regex patterns in the filter lists with the names of
+ * the schemas and relations in the backup set that they match.  The names in
+ * the table of contents are quoted, so the patterns are matched against their
+ * unquoted forms.
+ */
+func expandFilterPatternsInBackupSet() {
+	if !opts.HasSchemaPatterns() && !opts.HasRelationPatterns() {
+		return
+	}
+	schemaNames := make(map[string]string)
+	relationNames := make(map[string]string)
+	addRelation := func(schema string, name string) {
+		unquotedFQN := utils.MakeFQN(utils.UnquoteIdent(schema), utils.UnquoteIdent(name))
+		relationNames[unquotedFQN] = utils.MakeFQN(schema, name)
+	}
+	for _, entry := range globalTOC.DataEntries {
+		schemaNames[utils.UnquoteIdent(entry.Schema)] = entry.Schema
+		addRelation(entry.Schema, entry.Name)
+	}
+	for _, entry := range globalTOC.PredataEntries {
+		if entry.Schema != "" {
+			schemaNames[utils.UnquoteIdent(entry.Schema)] = entry.Schema
+		}
+		switch entry.ObjectType {
+		case toc.OBJ_TABLE, toc.OBJ_VIEW, toc.OBJ_MATERIALIZED_VIEW, toc.OBJ_SEQUENCE:
+			addRelation(entry.Schema, entry.Name)
+		}
+	}
+
+	err := opts.ExpandSchemaPatterns(cmdFlags, schemaNames)
+	gplog.FatalOnError(err)
+	err = opts.ExpandRelationPatterns(cmdFlags, relationNames)
+	gplog.FatalOnError(err)
+}
+
 func validateFilterListsInBackupSet() {
 	ValidateIncludeSchemasInBackupSet(opts.IncludedSchemas)
 	ValidateExcludeSchemasInBackupSet(opts.ExcludedSchemas)
@@ -151,6 +188,70 @@ func ValidateRedirectSchema(connectionPool *dbconn.DBConn, redirectSchema string
 	}
 }
 
+func getRedirectedTables(redirectTables map[string]options.Relation) []string {
+	tables := make([]string, 0, len(redirectTables))
+	for table := range redirectTables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+func ValidateRedirectTablesInBackupSet(redirectTables map[string]options.Relation) {
+	tables := getRedirectedTables(redirectTables)
+	if keys := getFilterRelationsInBackupSet(tables); len(keys) != 0 {
+		gplog.Fatal(errors.Errorf("Could not find the following relation(s) to redirect in the backup set: %s", strings.Join(keys, ", ")), "")
+	}
+}
+
+/*
+ * A table is redirected to a new table that is created by the restore, unless
+ * only data is restored, in which case the data is restored to a table that
+ * already exists.  The sequences owned by a redirected table are renamed and
+ * created along with it, so they must not exist either.
+ */
+func ValidateRedirectTablesInRestoreDatabase(redirectTables map[string]options.Relation) {
+	existingTableFQNs, err := GetExistingTableFQNs()
+	gplog.FatalOnError(err)
+	existingTables := utils.NewSet(existingTableFQNs)
+	isDataOnly := backupConfig.DataOnly || MustGetFlagBool(options.DATA_ONLY)
+
+	tables := getRedirectedTables(redirectTables)
+	for _, table := range tables {
+		redirectFQN := utils.MakeFQN(redirectTables[table].Schema, redirectTables[table].Name)
+		exists := existingTables.MatchesFilter(redirectFQN)
+		if isDataOnly && !exists {
+			gplog.Fatal(nil, fmt.Sprintf("Table %s to redirect %s to must exist for data-only restore", redirectFQN, table))
+		} else if !isDataOnly && exists {
+			gplog.Fatal(nil, fmt.Sprintf("Table %s to redirect %s to already exists", redirectFQN, table))
+		}
+	}
+	if isDataOnly {
+		return
+	}
+	for _, entry := range globalTOC.PredataEntries {
+		renamedSequence, ok := redirectDependentObject(entry.Schema, entry.Name, entry.ObjectType, entry.ReferenceObject, redirectTables)
+		if !ok || entry.ObjectType != toc.OBJ_SEQUENCE_OWNER {
+			continue
+		}
+		renamedFQN := utils.MakeFQN(renamedSequence.Schema, renamedSequence.Name)
+		if existingTables.MatchesFilter(renamedFQN) {
+			gplog.Fatal(nil, fmt.Sprintf("Sequence %s to rename %s to for redirected table %s already exists", renamedFQN, utils.MakeFQN(entry.Schema, entry.Name), entry.ReferenceObject))
+		}
+	}
+}
+
+func ValidateTablespacesInRestoreCluster(connectionPool *dbconn.DBConn, tablespaces []string) {
+	query := fmt.Sprintf(`SELECT quote_ident(spcname) AS string FROM pg_tablespace WHERE quote_ident(spcname) IN (%s)`, utils.SliceToQuotedString(tablespaces))
+	tablespacesInDB := utils.NewSet(dbconn.MustSelectStringSlice(connectionPool, query))
+
+	for _, tablespace := range tablespaces {
+		if !tablespacesInDB.MatchesFilter(tablespace) {
+			gplog.Fatal(nil, fmt.Sprintf("Tablespace %s to restore into does not exist", tablespace))
+		}
+	}
+}
+
 func ValidateIncludeRelationsInBackupSet(schemaList []string) {
 	if keys := getFilterRelationsInBackupSet(schemaList); len(keys) != 0 {
 		gplog.Fatal(errors.Errorf("Could not find the following relation(s) in the backup set: %s", strings.Join(keys, ", ")), "")
@@ -265,6 +366,10 @@ func ValidateFlagCombinations(flags *pflag.FlagSet) {
 	options.CheckExclusiveFlags(flags, options.PLUGIN_CONFIG, options.BACKUP_DIR)
 	options.CheckExclusiveFlags(flags, options.TRUNCATE_TABLE, options.METADATA_ONLY, options.INCREMENTAL)
 	options.CheckExclusiveFlags(flags, options.TRUNCATE_TABLE, options.REDIRECT_SCHEMA)
+	options.CheckExclusiveFlags(flags, options.ENCRYPTION_KEY_FILE, options.ENCRYPTION_KEY_ENV, options.ENCRYPTION_KEY_CMD, options.PLUGIN_CONFIG)
+	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.INCLUDE_OBJECT_TYPE, options.EXCLUDE_OBJECT_TYPE)
+	options.CheckExclusiveFlags(flags, options.NO_TABLESPACES, options.TABLESPACE_MAP)
+	options.CheckExclusiveFlags(flags, options.REDIRECT_SCHEMA, options.REDIRECT_TABLE)
 
 	if flags.Changed(options.REDIRECT_SCHEMA) {
 		// Redirect schema not compatible with any exclude flags
@@ -278,9 +383,10 @@ func ValidateFlagCombinations(flags *pflag.FlagSet) {
 			gplog.Fatal(errors.Errorf("Cannot use --redirect-schema without --include-table, --include-table-file, --include-schema, or --include-schema-file"), "")
 		}
 	}
+	// A resumed restore only truncates the tables whose data it has yet to restore
 	if flags.Changed(options.TRUNCATE_TABLE) &&
 		!(flags.Changed(options.INCLUDE_RELATION) || flags.Changed(options.INCLUDE_RELATION_FILE)) &&
-		!flags.Changed(options.DATA_ONLY) {
+		!flags.Changed(options.DATA_ONLY) && !flags.Changed(options.RESUME) {
 		gplog.Fatal(errors.Errorf("Cannot use --truncate-table without --include-table or --include-table-file and without --data-only"), "")
 	}
 	if flags.Changed(options.INCREMENTAL) && !flags.Changed(options.DATA_ONLY) {
@@ -290,6 +396,14 @@ func ValidateFlagCombinations(flags *pflag.FlagSet) {
 		gplog.Fatal(errors.Errorf("Must provide --backup-dir if --timestamp is not provided"), "")
 	}
 	options.CheckExclusiveFlags(flags, options.RUN_ANALYZE, options.WITH_STATS)
+	// Verification does not touch the database, so none of the flags that affect what is restored apply
+	for _, flag := range []string{options.CREATE_DB, options.WITH_GLOBALS, options.REDIRECT_DB, options.REDIRECT_SCHEMA,
+		options.METADATA_ONLY, options.TRUNCATE_TABLE, options.INCREMENTAL, options.ON_ERROR_CONTINUE,
+		options.RUN_ANALYZE, options.WITH_STATS, options.RESIZE_CLUSTER, options.RESUME, options.INCLUDE_OBJECT_TYPE,
+		options.EXCLUDE_OBJECT_TYPE, options.NO_OWNER, options.NO_PRIVILEGES, options.ROLE_MAP,
+		options.NO_TABLESPACES, options.TABLESPACE_MAP, options.REDIRECT_TABLE} {
+		options.CheckExclusiveFlags(flags, options.VERIFY_ONLY, flag)
+	}
 }
 
 func ValidateSafeToResizeCluster() {
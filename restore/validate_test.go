@@ -192,6 +192,53 @@ var _ = Describe("restore/validate tests", func() {
 			})
 		})
 	})
+	Describe("ValidateRedirectTablesInRestoreDatabase", func() {
+		redirectTables := map[string]options.Relation{"public.orders": {Schema: "archive", Name: "orders"}}
+		BeforeEach(func() {
+			restore.SetBackupConfig(&history.BackupConfig{DataOnly: false})
+			_ = cmdFlags.Set(options.DATA_ONLY, "false")
+			tocfile, backupfile := testutils.InitializeTestTOC(buffer, "predata")
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "public", Name: "orders_id_seq", ObjectType: toc.OBJ_SEQUENCE_OWNER, ReferenceObject: "public.orders"}, 0, backupfile.ByteCount, []uint32{0, 0})
+			restore.SetTOC(tocfile)
+		})
+		It("passes if the table to redirect to is not present in database", func() {
+			tableRows := sqlmock.NewRows([]string{"string"}).AddRow("public.orders")
+			mock.ExpectQuery("SELECT (.*)").WillReturnRows(tableRows)
+			restore.ValidateRedirectTablesInRestoreDatabase(redirectTables)
+		})
+		It("panics if the table to redirect to is present in database", func() {
+			tableRows := sqlmock.NewRows([]string{"string"}).AddRow("archive.orders")
+			mock.ExpectQuery("SELECT (.*)").WillReturnRows(tableRows)
+			defer testhelper.ShouldPanicWithMessage("Table archive.orders to redirect public.orders to already exists")
+			restore.ValidateRedirectTablesInRestoreDatabase(redirectTables)
+		})
+		It("panics if the table to redirect to is missing from database for data-only restore", func() {
+			_ = cmdFlags.Set(options.DATA_ONLY, "true")
+			tableRows := sqlmock.NewRows([]string{"string"}).AddRow("public.orders")
+			mock.ExpectQuery("SELECT (.*)").WillReturnRows(tableRows)
+			defer testhelper.ShouldPanicWithMessage("Table archive.orders to redirect public.orders to must exist for data-only restore")
+			restore.ValidateRedirectTablesInRestoreDatabase(redirectTables)
+		})
+		It("panics if the sequence owned by the table to redirect is renamed to one present in database", func() {
+			tableRows := sqlmock.NewRows([]string{"string"}).AddRow("archive.orders_id_seq")
+			mock.ExpectQuery("SELECT (.*)").WillReturnRows(tableRows)
+			defer testhelper.ShouldPanicWithMessage("Sequence archive.orders_id_seq to rename public.orders_id_seq to for redirected table public.orders already exists")
+			restore.ValidateRedirectTablesInRestoreDatabase(redirectTables)
+		})
+	})
+	Describe("ValidateTablespacesInRestoreCluster", func() {
+		It("passes if all tablespaces exist in the restore cluster", func() {
+			tablespaceRows := sqlmock.NewRows([]string{"string"}).AddRow("dr_ts").AddRow(`"DR ts"`)
+			mock.ExpectQuery("SELECT (.*)").WillReturnRows(tablespaceRows)
+			restore.ValidateTablespacesInRestoreCluster(connectionPool, []string{"dr_ts", `"DR ts"`})
+		})
+		It("panics if a tablespace does not exist in the restore cluster", func() {
+			tablespaceRows := sqlmock.NewRows([]string{"string"}).AddRow("dr_ts")
+			mock.ExpectQuery("SELECT (.*)").WillReturnRows(tablespaceRows)
+			defer testhelper.ShouldPanicWithMessage(`Tablespace "DR ts" to restore into does not exist`)
+			restore.ValidateTablespacesInRestoreCluster(connectionPool, []string{"dr_ts", `"DR ts"`})
+		})
+	})
 	Describe("ValidateRelationsInBackupSet", func() {
 		var tocfile *toc.TOC
 		var backupfile *utils.FileWithByteCount
@@ -380,6 +427,13 @@ var _ = Describe("restore/validate tests", func() {
 			Entry("truncate combos", "--timestamp=0 --truncate-table --include-table-file /tmp/file2", true),
 			Entry("truncate combos", "--timestamp=0 --truncate-table --include-table schema.table2 --redirect-db foodb", true),
 			Entry("truncate combos", "--timestamp=0 --truncate-table --include-table schema.table2 --redirect-schema schema2", false),
+			Entry("truncate combos", "--timestamp=0 --truncate-table --resume", true),
+
+			/*
+			 * Below are various different resume combinations
+			 */
+			Entry("--resume combos", "--timestamp=0 --resume", true),
+			Entry("--resume combos", "--timestamp=0 --resume --verify-only", false),
 
 			/*
 			 * Below are various different redirect-schema combinations
@@ -395,6 +449,11 @@ var _ = Describe("restore/validate tests", func() {
 			Entry("--redirect-schema combos", "--timestamp=0 --redirect-schema schema1 --exclude-schema-file /tmp/file2", false),
 			Entry("--redirect-schema combos", "--timestamp=0 --redirect-schema schema1 --include-table schema.table2 --metadata-only", true),
 			Entry("--redirect-schema combos", "--timestamp=0 --redirect-schema schema1 --include-table schema.table2 --data-only", true),
+
+			Entry("--encryption-key-file combos", "--timestamp=0 --encryption-key-file /tmp/key", true),
+			Entry("--encryption-key-file combos", "--timestamp=0 --encryption-key-file /tmp/key --encryption-key-env KEY", false),
+			Entry("--encryption-key-command combos", "--timestamp=0 --encryption-key-command cat --encryption-key-file /tmp/key", false),
+			Entry("--encryption-key-env combos", "--timestamp=0 --encryption-key-env KEY --plugin-config /tmp/config", false),
 		)
 	})
 	Describe("ValidateBackupFlagCombinations", func() {
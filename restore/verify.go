@@ -0,0 +1,114 @@
+package restore
+
+/*
+ * This file contains functions for verifying the data files of a backup
+ * against its table of contents without restoring them.
+ */
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func VerifyBackupData() {
+	if backupConfig.MetadataOnly {
+		gplog.Info("Backup %s is metadata-only; there are no data files to verify", globalFPInfo.Timestamp)
+		return
+	}
+
+	utils.VerifyHelperVersionOnSegments(version, globalCluster)
+	totalTables := 0
+	totalErrorTables := 0
+	for _, restorePlanEntry := range backupConfig.RestorePlan {
+		if wasTerminated {
+			return
+		}
+		fpInfo := GetBackupFPInfoForTimestamp(restorePlanEntry.Timestamp)
+		tocfile := toc.NewTOC(fpInfo.GetTOCFilePath())
+		dataEntries := tocfile.GetDataEntriesMatching(opts.IncludedSchemas, opts.ExcludedSchemas,
+			opts.IncludedRelations, opts.ExcludedRelations, restorePlanEntry.TableFQNs)
+		if len(dataEntries) == 0 {
+			gplog.Verbose("No data to verify for timestamp = %s", fpInfo.Timestamp)
+			continue
+		}
+
+		gplog.Info("Verifying data files for %d tables from backup with timestamp: %s", len(dataEntries), fpInfo.Timestamp)
+		initializePipeThroughParametersForTimestamp(tocfile.DataFileExtension)
+		oidList := make([]string, 0, len(dataEntries))
+		for _, entry := range dataEntries {
+			oidList = append(oidList, fmt.Sprintf("%d", entry.Oid))
+		}
+		utils.WriteOidListToSegments(oidList, globalCluster, fpInfo, "oid")
+		if utils.GetEncryptionKey() != nil {
+			utils.WriteEncryptionKeyToSegments(globalCluster, fpInfo)
+		}
+		segmentResults := utils.VerifyDataOnSegments(globalCluster, fpInfo, MustGetFlagString(options.PLUGIN_CONFIG),
+			backupConfig.SingleDataFile, gplog.GetVerbosity())
+		utils.CleanUpHelperFilesOnAllHosts(globalCluster, fpInfo, 60*time.Second)
+
+		tableProblems := CheckVerificationResults(dataEntries, segmentResults)
+		for _, entry := range dataEntries {
+			tableFQN := utils.MakeFQN(entry.Schema, entry.Name)
+			for _, problem := range tableProblems[tableFQN] {
+				gplog.Error("Table %s: %s", tableFQN, problem)
+			}
+		}
+		totalTables += len(dataEntries)
+		totalErrorTables += len(tableProblems)
+	}
+
+	if totalErrorTables > 0 {
+		gplog.Fatal(errors.Errorf("Backup verification found problems with %d of %d table(s)", totalErrorTables, totalTables), "")
+	}
+	gplog.Info("Backup verification complete: the data files for %d table(s) match the table of contents", totalTables)
+}
+
+/*
+ * Combines the results reported by the verify agent on each segment into a
+ * list of problems per table, keyed by table FQN.  The rows found on all
+ * segments must add up to the number of rows COPY reported during backup.
+ */
+func CheckVerificationResults(dataEntries []toc.CoordinatorDataEntry, segmentResults map[int][]utils.DataVerificationResult) map[string][]string {
+	contentIDs := make([]int, 0, len(segmentResults))
+	resultsByOid := make(map[int]map[uint32]utils.DataVerificationResult, len(segmentResults))
+	for contentID, results := range segmentResults {
+		contentIDs = append(contentIDs, contentID)
+		resultsByOid[contentID] = make(map[uint32]utils.DataVerificationResult, len(results))
+		for _, result := range results {
+			resultsByOid[contentID][result.Oid] = result
+		}
+	}
+	sort.Ints(contentIDs)
+
+	tableProblems := make(map[string][]string)
+	for _, entry := range dataEntries {
+		tableFQN := utils.MakeFQN(entry.Schema, entry.Name)
+		problems := make([]string, 0)
+		var rowsFound int64
+		for _, contentID := range contentIDs {
+			result, ok := resultsByOid[contentID][entry.Oid]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("Segment %d: No verification result was reported", contentID))
+				continue
+			}
+			for _, problem := range result.Problems {
+				problems = append(problems, fmt.Sprintf("Segment %d: %s", contentID, problem))
+			}
+			rowsFound += result.RowCount
+		}
+		if rowsFound != entry.RowsCopied {
+			problems = append(problems, fmt.Sprintf("Expected %d rows in the backup, but found %d", entry.RowsCopied, rowsFound))
+		}
+		if len(problems) > 0 {
+			tableProblems[tableFQN] = problems
+		}
+	}
+	return tableProblems
+}
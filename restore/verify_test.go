@@ -0,0 +1,55 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/verify tests", func() {
+	Describe("CheckVerificationResults", func() {
+		dataEntries := []toc.CoordinatorDataEntry{
+			{Schema: "public", Name: "foo", Oid: 1, RowsCopied: 20},
+			{Schema: "public", Name: "bar", Oid: 2, RowsCopied: 7},
+		}
+		It("reports no problems when every segment's rows add up to the rows backed up", func() {
+			segmentResults := map[int][]utils.DataVerificationResult{
+				0: {{Oid: 1, RowCount: 12}, {Oid: 2, RowCount: 7}},
+				1: {{Oid: 1, RowCount: 8}, {Oid: 2, RowCount: 0}},
+			}
+
+			Expect(restore.CheckVerificationResults(dataEntries, segmentResults)).To(BeEmpty())
+		})
+		It("reports a row count mismatch", func() {
+			segmentResults := map[int][]utils.DataVerificationResult{
+				0: {{Oid: 1, RowCount: 12}, {Oid: 2, RowCount: 7}},
+				1: {{Oid: 1, RowCount: 6}, {Oid: 2, RowCount: 0}},
+			}
+
+			tableProblems := restore.CheckVerificationResults(dataEntries, segmentResults)
+
+			Expect(tableProblems).To(Equal(map[string][]string{
+				"public.foo": {"Expected 20 rows in the backup, but found 18"},
+			}))
+		})
+		It("reports the problems found on each segment", func() {
+			segmentResults := map[int][]utils.DataVerificationResult{
+				0: {{Oid: 1, RowCount: 12}, {Oid: 2, RowCount: 7}},
+				1: {{Oid: 1, RowCount: 3, Problems: []string{"Byte range 100-200 in data file /data/gpseg1/gpbackup_1_20170101010101 is truncated"}}},
+			}
+
+			tableProblems := restore.CheckVerificationResults(dataEntries, segmentResults)
+
+			Expect(tableProblems).To(Equal(map[string][]string{
+				"public.foo": {
+					"Segment 1: Byte range 100-200 in data file /data/gpseg1/gpbackup_1_20170101010101 is truncated",
+					"Expected 20 rows in the backup, but found 15",
+				},
+				"public.bar": {"Segment 1: No verification result was reported"},
+			}))
+		})
+	})
+})
@@ -8,7 +8,6 @@ import (
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
-	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
@@ -16,6 +15,7 @@ import (
 	"github.com/greenplum-db/gpbackup/report"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 )
 
 /*
@@ -156,12 +156,55 @@ func SetMaxCsvLineLengthQuery(connectionPool *dbconn.DBConn) string {
 }
 
 func InitializeBackupConfig() {
+	initializeEncryptionKey(globalFPInfo.GetConfigFilePath())
 	backupConfig = history.ReadConfigFile(globalFPInfo.GetConfigFilePath())
 	utils.InitializePipeThroughParameters(backupConfig.Compressed, backupConfig.CompressionType, 0)
 	report.EnsureBackupVersionCompatibility(backupConfig.BackupVersion, version)
 	report.EnsureDatabaseVersionCompatibility(backupConfig.DatabaseVersion, connectionPool.Version)
 }
 
+/*
+ * The config file of an encrypted backup is encrypted with the same key as the
+ * rest of the backup, so we read the ID of that key from the file header in
+ * order to request the right key before we can read the config.
+ */
+func initializeEncryptionKey(configFilename string) {
+	keyID, err := utils.GetFileEncryptionKeyID(configFilename)
+	gplog.FatalOnError(err)
+	keyFile := MustGetFlagString(options.ENCRYPTION_KEY_FILE)
+	keyEnvVar := MustGetFlagString(options.ENCRYPTION_KEY_ENV)
+	keyCommand := MustGetFlagString(options.ENCRYPTION_KEY_CMD)
+	keyProvided := keyFile != "" || keyEnvVar != "" || keyCommand != ""
+	if keyID == "" {
+		if keyProvided {
+			gplog.Warn("Backup %s is not encrypted; ignoring the encryption key", globalFPInfo.Timestamp)
+		}
+		return
+	}
+	if !keyProvided {
+		gplog.Fatal(errors.Errorf("Backup %s is encrypted with key %s. Please provide the key with --%s, --%s, or --%s.",
+			globalFPInfo.Timestamp, keyID, options.ENCRYPTION_KEY_FILE, options.ENCRYPTION_KEY_ENV, options.ENCRYPTION_KEY_CMD), "")
+	}
+	encryptionKey, err := utils.ReadEncryptionKey(keyFile, keyEnvVar, keyCommand, keyID)
+	gplog.FatalOnError(err)
+	gplog.Verbose("Decrypting backup files with key %s", keyID)
+	utils.SetEncryptionKey(encryptionKey)
+}
+
+/*
+ * The data files of each backup in a backup set are read according to the
+ * extension recorded in that backup's TOC.  Backups taken before the extension
+ * was recorded are read according to the compression type in the config.
+ */
+func initializePipeThroughParametersForTimestamp(dataFileExtension string) {
+	if dataFileExtension == "" {
+		utils.InitializePipeThroughParameters(backupConfig.Compressed, backupConfig.CompressionType, 0)
+		return
+	}
+	err := utils.InitializePipeThroughParametersForExtension(dataFileExtension)
+	gplog.FatalOnError(err)
+}
+
 func BackupConfigurationValidation() {
 	if !backupConfig.MetadataOnly {
 		gplog.Verbose("Gathering information on backup directories")
@@ -173,6 +216,10 @@ func BackupConfigurationValidation() {
 	tocFilename := globalFPInfo.GetTOCFilePath()
 	globalTOC = toc.NewTOC(tocFilename)
 	globalTOC.InitializeMetadataEntryMap()
+	if globalTOC.Incomplete {
+		gplog.Fatal(errors.Errorf("Backup %s failed before the data of all tables was backed up. Run gpbackup --resume %s to complete it before restoring it.",
+			globalFPInfo.Timestamp, globalFPInfo.Timestamp), "")
+	}
 
 	// Legacy backups prior to the incremental feature would have no restoreplan yaml element
 	if isLegacyBackup := backupConfig.RestorePlan == nil; isLegacyBackup {
@@ -181,7 +228,9 @@ func BackupConfigurationValidation() {
 
 	ValidateBackupFlagCombinations()
 
+	expandFilterPatternsInBackupSet()
 	validateFilterListsInBackupSet()
+	ValidateRedirectTablesInBackupSet(redirectTables)
 }
 
 func SetRestorePlanForLegacyBackup(toc *toc.TOC, backupTimestamp string, backupConfig *history.BackupConfig) {
@@ -279,7 +328,7 @@ func GetRestoreMetadataStatements(section string, filename string, includeObject
 }
 
 func GetRestoreMetadataStatementsFiltered(section string, filename string, includeObjectTypes []string, excludeObjectTypes []string, filters Filters) []toc.StatementWithType {
-	metadataFile := iohelper.MustOpenFileForReading(filename)
+	metadataFile := utils.MustOpenBackupFileForReading(filename)
 	var statements []toc.StatementWithType
 	var inSchemas, exSchemas, inRelations, exRelations []string
 	if !filtersEmpty(filters) {
@@ -307,9 +356,54 @@ func GetRestoreMetadataStatementsFiltered(section string, filename string, inclu
 		}
 	}
 	statements = globalTOC.GetSQLStatementForObjectTypes(section, metadataFile, includeObjectTypes, excludeObjectTypes, inSchemas, exSchemas, inRelations, exRelations)
+	// The object types given by the user narrow those requested by the caller
+	userIncludeObjectTypes := MustGetFlagStringArray(options.INCLUDE_OBJECT_TYPE)
+	userExcludeObjectTypes := MustGetFlagStringArray(options.EXCLUDE_OBJECT_TYPE)
+	if len(userIncludeObjectTypes) > 0 || len(userExcludeObjectTypes) > 0 {
+		statements = toc.FilterStatementsByObjectType(statements, toc.NewObjectTypeFilterSet(userIncludeObjectTypes, userExcludeObjectTypes))
+	}
+	if MustGetFlagBool(options.NO_OWNER) {
+		statements = toc.RemoveOwnerStatements(statements)
+	}
+	if MustGetFlagBool(options.NO_PRIVILEGES) {
+		statements = toc.RemovePrivilegesStatements(statements)
+	}
+	statements = toc.SubstituteRolesInStatements(statements, roleMap)
+	if MustGetFlagBool(options.NO_TABLESPACES) {
+		statements = toc.RemoveTablespaceClauses(statements)
+	}
+	statements = toc.SubstituteTablespacesInStatements(statements, tablespaceMap)
 	return statements
 }
 
+// The tables are keyed by their quoted names in the backup, as the tables in the metadata file are
+func quoteRedirectTableMap() map[string]options.Relation {
+	unquotedTableMap, err := options.ParseRedirectTableMap(MustGetFlagStringArray(options.REDIRECT_TABLE))
+	gplog.FatalOnError(err)
+	quotedTableMap := make(map[string]options.Relation, len(unquotedTableMap))
+	for oldTable, newTable := range unquotedTableMap {
+		tables, err := options.SeparateSchemaAndTable([]string{oldTable, newTable})
+		gplog.FatalOnError(err)
+		oldFQN := utils.MakeFQN(utils.QuoteIdent(connectionPool, tables[0].Schema), utils.QuoteIdent(connectionPool, tables[0].Name))
+		quotedTableMap[oldFQN] = options.Relation{
+			Schema: utils.QuoteIdent(connectionPool, tables[1].Schema),
+			Name:   utils.QuoteIdent(connectionPool, tables[1].Name),
+		}
+	}
+	return quotedTableMap
+}
+
+// The names in the metadata file are quoted, so the names mapped by the user are too
+func quoteNameMap(mapFlag string) map[string]string {
+	unquotedNameMap, err := options.ParseNameMap(mapFlag, MustGetFlagStringArray(mapFlag))
+	gplog.FatalOnError(err)
+	quotedNameMap := make(map[string]string, len(unquotedNameMap))
+	for oldName, newName := range unquotedNameMap {
+		quotedNameMap[utils.QuoteIdent(connectionPool, oldName)] = utils.QuoteIdent(connectionPool, newName)
+	}
+	return quotedNameMap
+}
+
 func ExecuteRestoreMetadataStatements(section string, statements []toc.StatementWithType, objectsTitle string, progressBar utils.ProgressBar, showProgressBar int, executeInParallel bool) int32 {
 	var numErrors int32
 	if section == "predata" {
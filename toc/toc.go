@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
@@ -20,6 +24,8 @@ type TOC struct {
 	StatisticsEntries   []MetadataEntry
 	DataEntries         []CoordinatorDataEntry
 	IncrementalMetadata IncrementalEntries
+	DataFileExtension   string `yaml:",omitempty"`
+	Incomplete          bool   `yaml:",omitempty"`
 }
 
 type SegmentTOC struct {
@@ -36,20 +42,44 @@ type MetadataEntry struct {
 	Tier            []uint32
 }
 
+/*
+ * The times and byte counts of a table's data are recorded for reporting
+ * only; backups taken before they were recorded leave them empty.  The byte
+ * counts are the totals across all segments.
+ */
 type CoordinatorDataEntry struct {
-	Schema          string
-	Name            string
-	Oid             uint32
-	AttributeString string
-	RowsCopied      int64
-	PartitionRoot   string
-	IsReplicated    bool
-	DistByEnum      bool
+	Schema            string
+	Name              string
+	Oid               uint32
+	AttributeString   string
+	RowsCopied        int64
+	PartitionRoot     string
+	IsReplicated      bool
+	DistByEnum        bool
+	StartTime         time.Time `yaml:",omitempty"`
+	EndTime           time.Time `yaml:",omitempty"`
+	UncompressedBytes int64     `yaml:",omitempty"`
+	CompressedBytes   int64     `yaml:",omitempty"`
+	Worker            int       `yaml:",omitempty"`
+	RowFilter         string    `yaml:",omitempty"`
 }
 
+/*
+ * A single data file is compressed as one stream, so the compressed bytes of
+ * a table are those written to the file while its data was being backed up,
+ * which includes some of the data of previous tables that the compressor had
+ * buffered.
+ */
 type SegmentDataEntry struct {
-	StartByte uint64
-	EndByte   uint64
+	StartByte       uint64
+	EndByte         uint64
+	Checksum        string `yaml:",omitempty"`
+	CompressedBytes uint64 `yaml:",omitempty"`
+}
+
+type TableDataSize struct {
+	UncompressedBytes int64
+	CompressedBytes   int64
 }
 
 type IncrementalEntries struct {
@@ -122,9 +152,173 @@ const (
 	OBJ_VIEW                      = "VIEW"
 )
 
+/*
+ * The object types that may be given to --include-object-type and
+ * --exclude-object-type.  The session GUCs are set on every connection a
+ * restore makes, so they are never filtered.
+ */
+var filterableObjectTypes = []string{
+	OBJ_AGGREGATE,
+	OBJ_ACCESS_METHOD,
+	OBJ_CAST,
+	OBJ_COLLATION,
+	OBJ_COLUMN,
+	OBJ_CONSTRAINT,
+	OBJ_CONVERSION,
+	OBJ_DATABASE,
+	OBJ_DATABASE_GUC,
+	OBJ_DATABASE_METADATA,
+	OBJ_DOMAIN,
+	OBJ_EVENT_TRIGGER,
+	OBJ_EXTENSION,
+	OBJ_FOREIGN_DATA_WRAPPER,
+	OBJ_FOREIGN_SERVER,
+	OBJ_FOREIGN_TABLE,
+	OBJ_FUNCTION,
+	OBJ_INDEX,
+	OBJ_LANGUAGE,
+	OBJ_MATERIALIZED_VIEW,
+	OBJ_OPERATOR_CLASS,
+	OBJ_OPERATOR,
+	OBJ_OPERATOR_FAMILY,
+	OBJ_PROCEDURE,
+	OBJ_PROTOCOL,
+	OBJ_RELATION,
+	OBJ_RESOURCE_GROUP,
+	OBJ_RESOURCE_QUEUE,
+	OBJ_ROLE,
+	OBJ_ROLE_GRANT,
+	OBJ_ROLE_GUC,
+	OBJ_RULE,
+	OBJ_SCHEMA,
+	OBJ_SEQUENCE,
+	OBJ_SEQUENCE_OWNER,
+	OBJ_SERVER,
+	OBJ_STATISTICS,
+	OBJ_STATISTICS_EXT,
+	OBJ_TABLE,
+	OBJ_TABLESPACE,
+	OBJ_TRANSFORM,
+	OBJ_TRIGGER,
+	OBJ_TEXT_SEARCH_CONFIGURATION,
+	OBJ_TEXT_SEARCH_DICTIONARY,
+	OBJ_TEXT_SEARCH_PARSER,
+	OBJ_TEXT_SEARCH_TEMPLATE,
+	OBJ_TYPE,
+	OBJ_USER_MAPPING,
+	OBJ_VIEW,
+}
+
+func ValidateObjectTypes(objectTypes []string) error {
+	validTypes := utils.NewSet(filterableObjectTypes)
+	for _, objectType := range objectTypes {
+		if !validTypes.MatchesFilter(strings.ToUpper(objectType)) {
+			return errors.Errorf(`Invalid object type "%s"; valid object types are %s`, objectType, strings.Join(filterableObjectTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// Object types given by users are case-insensitive, so they are compared in upper case
+func NormalizeObjectTypes(objectTypes []string) []string {
+	normalized := make([]string, 0, len(objectTypes))
+	for _, objectType := range objectTypes {
+		normalized = append(normalized, strings.ToUpper(objectType))
+	}
+	return normalized
+}
+
+/*
+ * The statements that set the comments, owners, and privileges of postdata
+ * objects have " METADATA" appended to their object type, so they are filtered
+ * along with the object.
+ */
+func NewObjectTypeFilterSet(includeObjectTypes []string, excludeObjectTypes []string) *utils.FilterSet {
+	if len(includeObjectTypes) > 0 {
+		return utils.NewIncludeSet(NormalizeObjectTypes(includeObjectTypes))
+	}
+	return utils.NewExcludeSet(NormalizeObjectTypes(excludeObjectTypes))
+}
+
+func objectTypeMatchesFilter(objectSet *utils.FilterSet, objectType string) bool {
+	if objectType == OBJ_SESSION_GUC {
+		return true
+	}
+	baseType := strings.TrimSuffix(objectType, " METADATA")
+	if objectSet.IsExclude {
+		return objectSet.MatchesFilter(objectType) && objectSet.MatchesFilter(baseType)
+	}
+	return objectSet.MatchesFilter(objectType) || objectSet.MatchesFilter(baseType)
+}
+
+func FilterStatementsByObjectType(statements []StatementWithType, objectSet *utils.FilterSet) []StatementWithType {
+	filtered := make([]StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		if objectTypeMatchesFilter(objectSet, statement.ObjectType) {
+			filtered = append(filtered, statement)
+		}
+	}
+	return filtered
+}
+
+/*
+ * Removes the statements of the object types that do not match objectSet from
+ * the contents of a metadata file, and moves the byte offsets of the entries
+ * that remain to match the returned contents.  Bytes that belong to no entry,
+ * such as the blank lines between statements, are kept.
+ */
+func (toc *TOC) FilterMetadataByObjectType(contents []byte, objectSet *utils.FilterSet) []byte {
+	type byteRange struct {
+		start uint64
+		end   uint64
+	}
+	removed := make([]byteRange, 0)
+	for _, section := range []string{"global", "predata", "postdata"} {
+		for _, entry := range *toc.metadataEntryMap[section] {
+			if !objectTypeMatchesFilter(objectSet, entry.ObjectType) {
+				removed = append(removed, byteRange{entry.StartByte, entry.EndByte})
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return contents
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].start < removed[j].start })
+
+	filtered := make([]byte, 0, len(contents))
+	position := uint64(0)
+	for _, r := range removed {
+		filtered = append(filtered, contents[position:r.start]...)
+		position = r.end
+	}
+	filtered = append(filtered, contents[position:]...)
+
+	// An entry moves back by the number of bytes removed before it
+	removedBytes := make([]uint64, len(removed)+1)
+	for i, r := range removed {
+		removedBytes[i+1] = removedBytes[i] + r.end - r.start
+	}
+	removedBefore := func(offset uint64) uint64 {
+		return removedBytes[sort.Search(len(removed), func(i int) bool { return removed[i].end > offset })]
+	}
+	for _, section := range []string{"global", "predata", "postdata"} {
+		kept := make([]MetadataEntry, 0, len(*toc.metadataEntryMap[section]))
+		for _, entry := range *toc.metadataEntryMap[section] {
+			if objectTypeMatchesFilter(objectSet, entry.ObjectType) {
+				shift := removedBefore(entry.StartByte)
+				entry.StartByte -= shift
+				entry.EndByte -= shift
+				kept = append(kept, entry)
+			}
+		}
+		*toc.metadataEntryMap[section] = kept
+	}
+	return filtered
+}
+
 func NewTOC(filename string) *TOC {
 	toc := &TOC{}
-	contents, err := ioutil.ReadFile(filename)
+	contents, err := utils.ReadBackupFile(filename)
 	gplog.FatalOnError(err)
 	err = yaml.Unmarshal(contents, toc)
 	gplog.FatalOnError(err)
@@ -140,19 +334,45 @@ func NewSegmentTOC(filename string) *SegmentTOC {
 	return toc
 }
 
+/*
+ * Multi-file backups have no segment TOC, so the checksum of each table's data
+ * is recorded in a per-segment manifest mapping table oids to checksums.
+ */
+func ReadSegmentChecksums(filename string) (map[uint]string, error) {
+	checksums := make(map[uint]string)
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(contents, &checksums)
+	if err != nil {
+		return nil, err
+	}
+	return checksums, nil
+}
+
 func (toc *TOC) WriteToFileAndMakeReadOnly(filename string) {
 	contents, err := yaml.Marshal(toc)
 	gplog.FatalOnError(err)
-	err = utils.WriteToFileAndMakeReadOnly(filename, contents)
+	err = utils.WriteBackupFileAndMakeReadOnly(filename, contents)
 	gplog.FatalOnError(err)
 }
 
+/*
+ * The segment TOC is written to a temporary file that is then renamed into
+ * place, so that gpbackup never reads a partially written TOC.
+ */
 func (toc *SegmentTOC) WriteToFileAndMakeReadOnly(filename string) error {
 	contents, err := yaml.Marshal(toc)
 	if err != nil {
 		return err
 	}
-	return utils.WriteToFileAndMakeReadOnly(filename, contents)
+	tempFilename := filename + ".tmp"
+	err = utils.WriteToFileAndMakeReadOnly(tempFilename, contents)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempFilename, filename)
 }
 
 type StatementWithType struct {
@@ -317,6 +537,273 @@ func RemoveActiveRole(activeUser string, statements []StatementWithType) []State
 	return newStatements
 }
 
+var (
+	ownerStatementRegex      = regexp.MustCompile(`^ALTER .+ OWNER TO .+;$`)
+	privilegesStatementRegex = regexp.MustCompile(`^(ALTER DEFAULT PRIVILEGES .+ )?(GRANT|REVOKE) .+;$`)
+)
+
+/*
+ * Owner and privileges statements are printed one to a line, so a statement
+ * is treated as one of them only if every line of it matches, which leaves
+ * intact statements such as function bodies that merely contain such a line.
+ */
+func statementLinesMatch(statement string, patterns ...*regexp.Regexp) bool {
+	matched := false
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lineMatched := false
+		for _, pattern := range patterns {
+			if pattern.MatchString(line) {
+				lineMatched = true
+				break
+			}
+		}
+		if !lineMatched {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+func RemoveOwnerStatements(statements []StatementWithType) []StatementWithType {
+	newStatements := make([]StatementWithType, 0)
+	for _, statement := range statements {
+		if statementLinesMatch(statement.Statement, ownerStatementRegex) {
+			continue
+		}
+		newStatements = append(newStatements, statement)
+	}
+	return newStatements
+}
+
+// Role memberships are granted like privileges, but they are not privileges on an object, so they are kept
+func RemovePrivilegesStatements(statements []StatementWithType) []StatementWithType {
+	newStatements := make([]StatementWithType, 0)
+	for _, statement := range statements {
+		if statement.ObjectType != OBJ_ROLE_GRANT && statementLinesMatch(statement.Statement, privilegesStatementRegex) {
+			continue
+		}
+		newStatements = append(newStatements, statement)
+	}
+	return newStatements
+}
+
+func replaceRoleInLine(line string, pattern *regexp.Regexp, roleMap map[string]string) string {
+	indices := pattern.FindStringSubmatchIndex(line)
+	if indices == nil {
+		return line
+	}
+	return line[:indices[2]] + roleMap[line[indices[2]:indices[3]]] + line[indices[3]:]
+}
+
+/*
+ * The role map takes quoted role names to the quoted names with which to
+ * replace them as owners, as grantees and grantors of privileges, and as the
+ * roles whose default privileges are altered.
+ */
+func SubstituteRolesInStatements(statements []StatementWithType, roleMap map[string]string) []StatementWithType {
+	if len(roleMap) == 0 {
+		return statements
+	}
+	roles := make([]string, 0, len(roleMap))
+	for role := range roleMap {
+		roles = append(roles, regexp.QuoteMeta(role))
+	}
+	rolesPattern := strings.Join(roles, "|")
+	ownerPattern := regexp.MustCompile(fmt.Sprintf(` OWNER TO (%s);$`, rolesPattern))
+	granteePattern := regexp.MustCompile(fmt.Sprintf(` (?:TO|FROM) (%s)(?: WITH (?:GRANT|ADMIN) OPTION)?(?: GRANTED BY .+)?;$`, rolesPattern))
+	grantorPattern := regexp.MustCompile(fmt.Sprintf(` GRANTED BY (%s);$`, rolesPattern))
+	defaultPrivilegesPattern := regexp.MustCompile(fmt.Sprintf(`^ALTER DEFAULT PRIVILEGES FOR ROLE (%s) `, rolesPattern))
+	grantedRolePattern := regexp.MustCompile(fmt.Sprintf(`^GRANT (%s) TO `, rolesPattern))
+
+	for i := range statements {
+		if !statementLinesMatch(statements[i].Statement, ownerStatementRegex, privilegesStatementRegex) {
+			continue
+		}
+		lines := strings.Split(statements[i].Statement, "\n")
+		for j, line := range lines {
+			line = replaceRoleInLine(line, ownerPattern, roleMap)
+			line = replaceRoleInLine(line, granteePattern, roleMap)
+			line = replaceRoleInLine(line, grantorPattern, roleMap)
+			line = replaceRoleInLine(line, defaultPrivilegesPattern, roleMap)
+			if statements[i].ObjectType == OBJ_ROLE_GRANT {
+				line = replaceRoleInLine(line, grantedRolePattern, roleMap)
+			}
+			lines[j] = line
+		}
+		statements[i].Statement = strings.Join(lines, "\n")
+	}
+	return statements
+}
+
+const tablespaceNamePattern = `("(?:[^"]|"")+"|[a-z_][a-z0-9_$]*)`
+
+var (
+	indexTablespaceStatementRegex = regexp.MustCompile(`^ALTER INDEX .+ SET TABLESPACE .+;$`)
+	tablespaceClauseRegex         = regexp.MustCompile(`\sTABLESPACE ` + tablespaceNamePattern)
+	// The index of a primary key, unique, or exclusion constraint is placed in a tablespace by this clause as a whole
+	constraintTablespaceClauseRegex = regexp.MustCompile(`\sUSING INDEX TABLESPACE ` + tablespaceNamePattern)
+	// Only the statements that create objects of these types place them in a tablespace
+	tablespaceClauseRegexes = map[string]*regexp.Regexp{
+		OBJ_DATABASE:            tablespaceClauseRegex,
+		OBJ_TABLE:               tablespaceClauseRegex,
+		OBJ_MATERIALIZED_VIEW:   tablespaceClauseRegex,
+		OBJ_INDEX + " METADATA": tablespaceClauseRegex,
+		OBJ_CONSTRAINT:          constraintTablespaceClauseRegex,
+	}
+)
+
+/*
+ * Returns a copy of the statement of the same length in which string
+ * literals, comments, and the contents of quoted identifiers are masked out,
+ * along with the column definitions of a table and the query of a
+ * materialized view, so that a tablespace clause regex only matches the
+ * clauses gpbackup writes and not text that happens to look like one.
+ */
+func maskTablespaceClauseStatement(statement StatementWithType) string {
+	masked := []byte(statement.Statement)
+	maskRange := func(start int, end int, mask byte) {
+		for i := start; i < end && i < len(masked); i++ {
+			masked[i] = mask
+		}
+	}
+	for i := 0; i < len(masked); {
+		switch {
+		case masked[i] == '\'' || masked[i] == '"':
+			quote := masked[i]
+			end := i + 1
+			for end < len(masked) {
+				if masked[end] == quote {
+					if end+1 < len(masked) && masked[end+1] == quote {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			if quote == '"' {
+				// The quotes are kept so that a quoted tablespace name still matches
+				maskRange(i+1, end, '#')
+			} else {
+				maskRange(i, end+1, '#')
+			}
+			i = end + 1
+		case strings.HasPrefix(string(masked[i:]), "--"):
+			end := strings.Index(string(masked[i:]), "\n")
+			if end == -1 {
+				end = len(masked) - i
+			}
+			maskRange(i, i+end, ' ')
+			i += end
+		case strings.HasPrefix(string(masked[i:]), "/*"):
+			end := strings.Index(string(masked[i:]), "*/")
+			if end == -1 {
+				end = len(masked) - i
+			} else {
+				end += 2
+			}
+			maskRange(i, i+end, ' ')
+			i += end
+		default:
+			i++
+		}
+	}
+	maskedStr := string(masked)
+	switch statement.ObjectType {
+	case OBJ_TABLE:
+		// The table clauses follow the closing parenthesis of the column definitions on its own line
+		if start := strings.Index(maskedStr, "(\n"); start != -1 {
+			if end := strings.Index(maskedStr[start:], "\n)"); end != -1 {
+				maskRange(start+1, start+end, '#')
+			}
+		}
+	case OBJ_MATERIALIZED_VIEW:
+		// The tablespace clause precedes the query
+		if start := strings.Index(maskedStr, " AS "); start != -1 {
+			maskRange(start, len(masked), '#')
+		}
+	}
+	return string(masked)
+}
+
+/*
+ * Calls replace with each tablespace clause of the statement and the name of
+ * its tablespace, and replaces the clause with the result.
+ */
+func replaceTablespaceClauses(statement StatementWithType, clauseRegex *regexp.Regexp, replace func(clause string, tablespace string) string) string {
+	matches := clauseRegex.FindAllStringSubmatchIndex(maskTablespaceClauseStatement(statement), -1)
+	if len(matches) == 0 {
+		return statement.Statement
+	}
+	var newStatement strings.Builder
+	prevEnd := 0
+	for _, match := range matches {
+		newStatement.WriteString(statement.Statement[prevEnd:match[0]])
+		newStatement.WriteString(replace(statement.Statement[match[0]:match[1]], statement.Statement[match[2]:match[3]]))
+		prevEnd = match[1]
+	}
+	newStatement.WriteString(statement.Statement[prevEnd:])
+	return newStatement.String()
+}
+
+/*
+ * Tablespaces are not created, indexes are not moved into them, and the
+ * TABLESPACE clauses of tables, materialized views, and databases and the
+ * USING INDEX TABLESPACE clauses of constraints are removed, so every object
+ * is created in the default tablespace.
+ */
+func RemoveTablespaceClauses(statements []StatementWithType) []StatementWithType {
+	newStatements := make([]StatementWithType, 0)
+	for _, statement := range statements {
+		if statement.ObjectType == OBJ_TABLESPACE || statementLinesMatch(statement.Statement, indexTablespaceStatementRegex) {
+			continue
+		}
+		if clauseRegex, ok := tablespaceClauseRegexes[statement.ObjectType]; ok {
+			statement.Statement = replaceTablespaceClauses(statement, clauseRegex, func(clause string, tablespace string) string {
+				return ""
+			})
+		}
+		newStatements = append(newStatements, statement)
+	}
+	return newStatements
+}
+
+/*
+ * The tablespace map takes quoted tablespace names to the quoted names of the
+ * tablespaces in which to create the objects of those tablespaces instead.
+ * The tablespaces mapped to already exist, so those mapped from are not
+ * created.
+ */
+func SubstituteTablespacesInStatements(statements []StatementWithType, tablespaceMap map[string]string) []StatementWithType {
+	if len(tablespaceMap) == 0 {
+		return statements
+	}
+	newStatements := make([]StatementWithType, 0)
+	for _, statement := range statements {
+		if statement.ObjectType == OBJ_TABLESPACE {
+			if _, ok := tablespaceMap[statement.Name]; !ok {
+				newStatements = append(newStatements, statement)
+			}
+			continue
+		}
+		if clauseRegex, ok := tablespaceClauseRegexes[statement.ObjectType]; ok {
+			statement.Statement = replaceTablespaceClauses(statement, clauseRegex, func(clause string, tablespace string) string {
+				if newTablespace, ok := tablespaceMap[tablespace]; ok {
+					return strings.TrimSuffix(clause, tablespace) + newTablespace
+				}
+				return clause
+			})
+		}
+		newStatements = append(newStatements, statement)
+	}
+	return newStatements
+}
+
 func (toc *TOC) InitializeMetadataEntryMap() {
 	toc.metadataEntryMap = make(map[string]*[]MetadataEntry, 4)
 	toc.metadataEntryMap["global"] = &toc.GlobalEntries
@@ -343,10 +830,24 @@ func (toc *TOC) AddMetadataEntry(section string, entry MetadataEntry, start, end
 
 func (toc *TOC) AddCoordinatorDataEntry(schema string, name string, oid uint32, attributeString string, rowsCopied int64, PartitionRoot string, distPolicy string, distByEnum bool) {
 	isReplicated := strings.Contains(distPolicy, "REPLICATED")
-	toc.DataEntries = append(toc.DataEntries, CoordinatorDataEntry{schema, name, oid, attributeString, rowsCopied, PartitionRoot, isReplicated, distByEnum})
+	toc.DataEntries = append(toc.DataEntries, CoordinatorDataEntry{Schema: schema, Name: name, Oid: oid, AttributeString: attributeString,
+		RowsCopied: rowsCopied, PartitionRoot: PartitionRoot, IsReplicated: isReplicated, DistByEnum: distByEnum})
+}
+
+// Sizes are summed across segments, so a table absent on some segments is still counted
+func (toc *TOC) AddDataEntrySizes(segmentSizes map[int]map[uint32]TableDataSize) {
+	for i := range toc.DataEntries {
+		entry := &toc.DataEntries[i]
+		entry.UncompressedBytes = 0
+		entry.CompressedBytes = 0
+		for _, sizes := range segmentSizes {
+			entry.UncompressedBytes += sizes[entry.Oid].UncompressedBytes
+			entry.CompressedBytes += sizes[entry.Oid].CompressedBytes
+		}
+	}
 }
 
-func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64) {
+func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64, checksum string, compressedBytes uint64) {
 	// We use uint for oid since the flags package does not have a uint32 flag
-	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte}
+	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte, checksum, compressedBytes}
 }
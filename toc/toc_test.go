@@ -2,6 +2,8 @@ package toc_test
 
 import (
 	"bytes"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/greenplum-db/gpbackup/testutils"
@@ -386,6 +388,190 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 `))
 		})
 	})
+	Describe("ValidateObjectTypes", func() {
+		It("accepts object types in any case", func() {
+			Expect(toc.ValidateObjectTypes([]string{"TRIGGER", "event trigger", "Role Grant"})).To(Succeed())
+		})
+		It("returns an error for an unknown object type", func() {
+			err := toc.ValidateObjectTypes([]string{"TRIGGERS"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix(`Invalid object type "TRIGGERS"; valid object types are AGGREGATE, ACCESS METHOD,`))
+		})
+	})
+	Describe("FilterStatementsByObjectType", func() {
+		trigger := toc.StatementWithType{Schema: "schema", Name: "sometrigger", ObjectType: toc.OBJ_TRIGGER, Statement: "CREATE TRIGGER sometrigger"}
+		eventTriggerMetadata := toc.StatementWithType{Name: "someeventtrigger", ObjectType: toc.OBJ_EVENT_TRIGGER + " METADATA", Statement: "ALTER EVENT TRIGGER someeventtrigger OWNER TO testrole"}
+		sessionGUCs := toc.StatementWithType{ObjectType: toc.OBJ_SESSION_GUC, Statement: "SET search_path = pg_catalog"}
+		statements := []toc.StatementWithType{sessionGUCs, table1, trigger, eventTriggerMetadata, index}
+		It("removes the statements of excluded object types along with their metadata", func() {
+			objectSet := toc.NewObjectTypeFilterSet([]string{}, []string{"trigger", "EVENT TRIGGER"})
+
+			filtered := toc.FilterStatementsByObjectType(statements, objectSet)
+
+			Expect(filtered).To(Equal([]toc.StatementWithType{sessionGUCs, table1, index}))
+		})
+		It("keeps only the statements of included object types and the session GUCs", func() {
+			objectSet := toc.NewObjectTypeFilterSet([]string{"EVENT TRIGGER", "INDEX"}, []string{})
+
+			filtered := toc.FilterStatementsByObjectType(statements, objectSet)
+
+			Expect(filtered).To(Equal([]toc.StatementWithType{sessionGUCs, eventTriggerMetadata, index}))
+		})
+	})
+	Describe("FilterMetadataByObjectType", func() {
+		It("removes the statements of excluded object types and moves the entries that remain", func() {
+			contents := "SET search_path = pg_catalog;\n\nCREATE ROLE r;\n\nGRANT r TO s;\n\nCREATE TABLE t;\n\nCREATE TRIGGER g;\n\nCREATE INDEX i;\n"
+			addEntry := func(section string, entry toc.MetadataEntry, statement string) {
+				start := uint64(bytes.Index([]byte(contents), []byte(statement)))
+				tocfile.AddMetadataEntry(section, entry, start, start+uint64(len(statement)), []uint32{0, 0})
+			}
+			addEntry("global", toc.MetadataEntry{ObjectType: toc.OBJ_SESSION_GUC}, "SET search_path = pg_catalog;\n")
+			addEntry("global", toc.MetadataEntry{Name: "r", ObjectType: toc.OBJ_ROLE}, "CREATE ROLE r;\n")
+			addEntry("global", toc.MetadataEntry{Name: "r", ObjectType: toc.OBJ_ROLE_GRANT}, "GRANT r TO s;\n")
+			addEntry("predata", toc.MetadataEntry{Schema: "public", Name: "t", ObjectType: toc.OBJ_TABLE}, "CREATE TABLE t;\n")
+			addEntry("postdata", toc.MetadataEntry{Schema: "public", Name: "g", ObjectType: toc.OBJ_TRIGGER}, "CREATE TRIGGER g;\n")
+			addEntry("postdata", toc.MetadataEntry{Schema: "public", Name: "i", ObjectType: toc.OBJ_INDEX}, "CREATE INDEX i;\n")
+
+			filtered := tocfile.FilterMetadataByObjectType([]byte(contents), toc.NewObjectTypeFilterSet([]string{}, []string{toc.OBJ_ROLE_GRANT, toc.OBJ_TRIGGER}))
+
+			Expect(string(filtered)).To(Equal("SET search_path = pg_catalog;\n\nCREATE ROLE r;\n\n\nCREATE TABLE t;\n\n\nCREATE INDEX i;\n"))
+			Expect(tocfile.GlobalEntries).To(HaveLen(2))
+			Expect(tocfile.PredataEntries).To(HaveLen(1))
+			Expect(tocfile.PostdataEntries).To(HaveLen(1))
+			for _, entry := range append(append(tocfile.GlobalEntries, tocfile.PredataEntries...), tocfile.PostdataEntries...) {
+				statement := string(filtered[entry.StartByte:entry.EndByte])
+				Expect(statement).To(HaveSuffix(";\n"))
+				Expect(contents).To(ContainSubstring(statement))
+			}
+			Expect(string(filtered[tocfile.PostdataEntries[0].StartByte:tocfile.PostdataEntries[0].EndByte])).To(Equal("CREATE INDEX i;\n"))
+		})
+	})
+	Describe("owner and privileges statements", func() {
+		tableOwner := toc.StatementWithType{Schema: "schema", Name: "table1", ObjectType: toc.OBJ_TABLE, Statement: "\n\nALTER TABLE schema.table1 OWNER TO prod_owner;\n"}
+		tablePrivileges := toc.StatementWithType{Schema: "schema", Name: "table1", ObjectType: toc.OBJ_TABLE, Statement: "\n\nREVOKE ALL ON TABLE schema.table1 FROM PUBLIC;\nREVOKE ALL ON TABLE schema.table1 FROM prod_owner;\nGRANT SELECT ON TABLE schema.table1 TO \"Reader\" WITH GRANT OPTION;\n"}
+		defaultPrivileges := toc.StatementWithType{Schema: "schema", ObjectType: "DEFAULT PRIVILEGES", Statement: "\n\nALTER DEFAULT PRIVILEGES FOR ROLE prod_owner IN SCHEMA schema REVOKE ALL ON TABLES FROM PUBLIC;\nALTER DEFAULT PRIVILEGES FOR ROLE prod_owner IN SCHEMA schema GRANT SELECT ON TABLES TO \"Reader\";\n"}
+		roleGrant := toc.StatementWithType{Name: "prod_owner", ObjectType: toc.OBJ_ROLE_GRANT, Statement: "\nGRANT prod_owner TO \"Reader\" GRANTED BY prod_owner;"}
+		function := toc.StatementWithType{Schema: "schema", Name: "grant_all", ObjectType: toc.OBJ_FUNCTION, Statement: "\n\nCREATE FUNCTION schema.grant_all() RETURNS void AS $$\nGRANT SELECT ON TABLE schema.table1 TO prod_owner;\n$$ LANGUAGE sql;\n"}
+		var statements []toc.StatementWithType
+		BeforeEach(func() {
+			statements = []toc.StatementWithType{table1, tableOwner, tablePrivileges, defaultPrivileges, roleGrant, function}
+		})
+		Describe("RemoveOwnerStatements", func() {
+			It("removes the statements that change the owners of objects", func() {
+				Expect(toc.RemoveOwnerStatements(statements)).To(Equal([]toc.StatementWithType{table1, tablePrivileges, defaultPrivileges, roleGrant, function}))
+			})
+		})
+		Describe("RemovePrivilegesStatements", func() {
+			It("removes the privileges and default privileges statements, but not role memberships", func() {
+				Expect(toc.RemovePrivilegesStatements(statements)).To(Equal([]toc.StatementWithType{table1, tableOwner, roleGrant, function}))
+			})
+		})
+		Describe("SubstituteRolesInStatements", func() {
+			It("replaces the mapped roles in owner and privileges statements", func() {
+				roleMap := map[string]string{"prod_owner": "dev_owner", `"Reader"`: "dev_reader"}
+
+				substituted := toc.SubstituteRolesInStatements(statements, roleMap)
+
+				Expect(substituted[0]).To(Equal(table1))
+				Expect(substituted[1].Statement).To(Equal("\n\nALTER TABLE schema.table1 OWNER TO dev_owner;\n"))
+				Expect(substituted[2].Statement).To(Equal("\n\nREVOKE ALL ON TABLE schema.table1 FROM PUBLIC;\nREVOKE ALL ON TABLE schema.table1 FROM dev_owner;\nGRANT SELECT ON TABLE schema.table1 TO dev_reader WITH GRANT OPTION;\n"))
+				Expect(substituted[3].Statement).To(Equal("\n\nALTER DEFAULT PRIVILEGES FOR ROLE dev_owner IN SCHEMA schema REVOKE ALL ON TABLES FROM PUBLIC;\nALTER DEFAULT PRIVILEGES FOR ROLE dev_owner IN SCHEMA schema GRANT SELECT ON TABLES TO dev_reader;\n"))
+				Expect(substituted[4].Statement).To(Equal("\nGRANT dev_owner TO dev_reader GRANTED BY dev_owner;"))
+				Expect(substituted[5].Statement).To(ContainSubstring("GRANT SELECT ON TABLE schema.table1 TO prod_owner;"))
+			})
+			It("does not replace a role whose name begins with that of a mapped role", func() {
+				roleMap := map[string]string{"prod": "dev"}
+
+				substituted := toc.SubstituteRolesInStatements(statements, roleMap)
+
+				Expect(substituted[1].Statement).To(Equal("\n\nALTER TABLE schema.table1 OWNER TO prod_owner;\n"))
+			})
+		})
+	})
+	Describe("tablespace statements", func() {
+		createTablespace := toc.StatementWithType{Name: "prod_ts", ObjectType: toc.OBJ_TABLESPACE, Statement: "\n\nCREATE TABLESPACE prod_ts LOCATION '/data/prod_ts';"}
+		createOtherTablespace := toc.StatementWithType{Name: `"Archive"`, ObjectType: toc.OBJ_TABLESPACE, Statement: "\n\nCREATE TABLESPACE \"Archive\" LOCATION '/data/archive';"}
+		createDatabase := toc.StatementWithType{Name: "testdb", ObjectType: toc.OBJ_DATABASE, Statement: "\n\nCREATE DATABASE testdb TEMPLATE template0 TABLESPACE prod_ts ENCODING 'UTF8';"}
+		createTable := toc.StatementWithType{Schema: "public", Name: "orders", ObjectType: toc.OBJ_TABLE, Statement: "\n\nCREATE TABLE public.orders (\n\tid integer\n) WITH (appendonly=true) TABLESPACE \"Archive\" DISTRIBUTED BY (id);\n"}
+		createMatview := toc.StatementWithType{Schema: "public", Name: "totals", ObjectType: toc.OBJ_MATERIALIZED_VIEW, Statement: "\n\nCREATE MATERIALIZED VIEW public.totals TABLESPACE prod_ts AS SELECT 1\nWITH NO DATA\nDISTRIBUTED RANDOMLY;\n"}
+		alterIndex := toc.StatementWithType{Schema: "public", Name: "orders_idx", ObjectType: "INDEX METADATA", Statement: "\nALTER INDEX public.orders_idx SET TABLESPACE prod_ts;"}
+		clusterIndex := toc.StatementWithType{Schema: "public", Name: "orders_idx", ObjectType: "INDEX METADATA", Statement: "\nALTER TABLE public.orders CLUSTER ON orders_idx;"}
+		addPrimaryKey := toc.StatementWithType{Schema: "public", Name: "orders_pkey", ObjectType: toc.OBJ_CONSTRAINT, Statement: "\n\nALTER TABLE ONLY public.orders ADD CONSTRAINT orders_pkey PRIMARY KEY (id) USING INDEX TABLESPACE prod_ts;\n"}
+		addUnique := toc.StatementWithType{Schema: "public", Name: "orders_code_key", ObjectType: toc.OBJ_CONSTRAINT, Statement: "\n\nALTER TABLE ONLY public.orders ADD CONSTRAINT orders_code_key UNIQUE (code) WITH (fillfactor='90') USING INDEX TABLESPACE \"Archive\";\n"}
+		// Only the clause following the column definitions places the table in a tablespace
+		createTableWithText := toc.StatementWithType{Schema: "public", Name: "notes", ObjectType: toc.OBJ_TABLE, Statement: "\n\nCREATE TABLE public.notes (\n\tnote text DEFAULT ' TABLESPACE prod_ts',\n\t\"x TABLESPACE prod_ts\" integer\n) TABLESPACE prod_ts DISTRIBUTED RANDOMLY PARTITION BY LIST(note) (PARTITION p1 VALUES(' TABLESPACE prod_ts') TABLESPACE prod_ts);\n"}
+		createMatviewWithText := toc.StatementWithType{Schema: "public", Name: "notes_view", ObjectType: toc.OBJ_MATERIALIZED_VIEW, Statement: "\n\nCREATE MATERIALIZED VIEW public.notes_view AS SELECT ' TABLESPACE prod_ts' AS note /* TABLESPACE prod_ts */\nWITH NO DATA\nDISTRIBUTED RANDOMLY;\n"}
+		var statements []toc.StatementWithType
+		BeforeEach(func() {
+			statements = []toc.StatementWithType{createTablespace, createOtherTablespace, createDatabase, createTable, createMatview, alterIndex, clusterIndex}
+		})
+		Describe("RemoveTablespaceClauses", func() {
+			It("removes tablespaces and the clauses that place objects in them", func() {
+				removed := toc.RemoveTablespaceClauses(statements)
+
+				Expect(removed).To(HaveLen(4))
+				Expect(removed[0].Statement).To(Equal("\n\nCREATE DATABASE testdb TEMPLATE template0 ENCODING 'UTF8';"))
+				Expect(removed[1].Statement).To(Equal("\n\nCREATE TABLE public.orders (\n\tid integer\n) WITH (appendonly=true) DISTRIBUTED BY (id);\n"))
+				Expect(removed[2].Statement).To(Equal("\n\nCREATE MATERIALIZED VIEW public.totals AS SELECT 1\nWITH NO DATA\nDISTRIBUTED RANDOMLY;\n"))
+				Expect(removed[3]).To(Equal(clusterIndex))
+			})
+			It("removes the USING INDEX TABLESPACE clauses of constraints", func() {
+				removed := toc.RemoveTablespaceClauses([]toc.StatementWithType{addPrimaryKey, addUnique})
+
+				Expect(removed).To(HaveLen(2))
+				Expect(removed[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.orders ADD CONSTRAINT orders_pkey PRIMARY KEY (id);\n"))
+				Expect(removed[1].Statement).To(Equal("\n\nALTER TABLE ONLY public.orders ADD CONSTRAINT orders_code_key UNIQUE (code) WITH (fillfactor='90');\n"))
+			})
+			It("does not remove text in literals, quoted identifiers, comments, or column definitions", func() {
+				removed := toc.RemoveTablespaceClauses([]toc.StatementWithType{createTableWithText, createMatviewWithText})
+
+				Expect(removed).To(HaveLen(2))
+				Expect(removed[0].Statement).To(Equal("\n\nCREATE TABLE public.notes (\n\tnote text DEFAULT ' TABLESPACE prod_ts',\n\t\"x TABLESPACE prod_ts\" integer\n) DISTRIBUTED RANDOMLY PARTITION BY LIST(note) (PARTITION p1 VALUES(' TABLESPACE prod_ts'));\n"))
+				Expect(removed[1]).To(Equal(createMatviewWithText))
+			})
+		})
+		Describe("SubstituteTablespacesInStatements", func() {
+			It("moves the objects of mapped tablespaces and does not create those tablespaces", func() {
+				tablespaceMap := map[string]string{"prod_ts": "dr_ts"}
+
+				substituted := toc.SubstituteTablespacesInStatements(statements, tablespaceMap)
+
+				Expect(substituted).To(HaveLen(6))
+				Expect(substituted[0]).To(Equal(createOtherTablespace))
+				Expect(substituted[1].Statement).To(Equal("\n\nCREATE DATABASE testdb TEMPLATE template0 TABLESPACE dr_ts ENCODING 'UTF8';"))
+				Expect(substituted[2]).To(Equal(createTable))
+				Expect(substituted[3].Statement).To(Equal("\n\nCREATE MATERIALIZED VIEW public.totals TABLESPACE dr_ts AS SELECT 1\nWITH NO DATA\nDISTRIBUTED RANDOMLY;\n"))
+				Expect(substituted[4].Statement).To(Equal("\nALTER INDEX public.orders_idx SET TABLESPACE dr_ts;"))
+				Expect(substituted[5]).To(Equal(clusterIndex))
+			})
+			It("moves the objects of a tablespace with a quoted name", func() {
+				tablespaceMap := map[string]string{`"Archive"`: `"DR Archive"`}
+
+				substituted := toc.SubstituteTablespacesInStatements(statements, tablespaceMap)
+
+				Expect(substituted).To(HaveLen(6))
+				Expect(substituted[2].Statement).To(Equal("\n\nCREATE TABLE public.orders (\n\tid integer\n) WITH (appendonly=true) TABLESPACE \"DR Archive\" DISTRIBUTED BY (id);\n"))
+			})
+			It("moves the indexes of constraints in mapped tablespaces", func() {
+				tablespaceMap := map[string]string{"prod_ts": "dr_ts"}
+
+				substituted := toc.SubstituteTablespacesInStatements([]toc.StatementWithType{addPrimaryKey, addUnique}, tablespaceMap)
+
+				Expect(substituted).To(HaveLen(2))
+				Expect(substituted[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.orders ADD CONSTRAINT orders_pkey PRIMARY KEY (id) USING INDEX TABLESPACE dr_ts;\n"))
+				Expect(substituted[1]).To(Equal(addUnique))
+			})
+			It("does not substitute text in literals, quoted identifiers, comments, or column definitions", func() {
+				tablespaceMap := map[string]string{"prod_ts": "dr_ts"}
+
+				substituted := toc.SubstituteTablespacesInStatements([]toc.StatementWithType{createTableWithText, createMatviewWithText}, tablespaceMap)
+
+				Expect(substituted).To(HaveLen(2))
+				Expect(substituted[0].Statement).To(Equal("\n\nCREATE TABLE public.notes (\n\tnote text DEFAULT ' TABLESPACE prod_ts',\n\t\"x TABLESPACE prod_ts\" integer\n) TABLESPACE dr_ts DISTRIBUTED RANDOMLY PARTITION BY LIST(note) (PARTITION p1 VALUES(' TABLESPACE prod_ts') TABLESPACE dr_ts);\n"))
+				Expect(substituted[1]).To(Equal(createMatviewWithText))
+			})
+		})
+	})
 	Describe("RemoveActiveRoles", func() {
 		user1 := toc.StatementWithType{Name: "user1", ObjectType: toc.OBJ_ROLE, Statement: "CREATE ROLE user1 SUPERUSER;\n"}
 		user2 := toc.StatementWithType{Name: "user2", ObjectType: toc.OBJ_ROLE, Statement: "CREATE ROLE user2;\n"}
@@ -442,4 +628,40 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 			Expect(roots).To(BeEmpty())
 		})
 	})
+	Describe("AddDataEntrySizes", func() {
+		It("sums the sizes of the data of each table across segments", func() {
+			tocfile := &toc.TOC{}
+			tocfile.AddCoordinatorDataEntry("schema1", "table1", 1, "(i)", 10, "", "", false)
+			tocfile.AddCoordinatorDataEntry("schema2", "table2", 2, "(i)", 10, "", "", false)
+			tocfile.AddCoordinatorDataEntry("schema3", "table3", 3, "(i)", 0, "", "", false)
+
+			tocfile.AddDataEntrySizes(map[int]map[uint32]toc.TableDataSize{
+				0: {1: {UncompressedBytes: 100, CompressedBytes: 10}, 2: {UncompressedBytes: 50, CompressedBytes: 5}},
+				1: {1: {UncompressedBytes: 200, CompressedBytes: 20}},
+			})
+
+			Expect(tocfile.DataEntries[0].UncompressedBytes).To(Equal(int64(300)))
+			Expect(tocfile.DataEntries[0].CompressedBytes).To(Equal(int64(30)))
+			Expect(tocfile.DataEntries[1].UncompressedBytes).To(Equal(int64(50)))
+			Expect(tocfile.DataEntries[1].CompressedBytes).To(Equal(int64(5)))
+			Expect(tocfile.DataEntries[2].UncompressedBytes).To(Equal(int64(0)))
+			Expect(tocfile.DataEntries[2].CompressedBytes).To(Equal(int64(0)))
+		})
+	})
+	Describe("ReadSegmentChecksums", func() {
+		var checksumFile string
+		BeforeEach(func() {
+			checksumFile = path.Join(GinkgoT().TempDir(), "gpbackup_0_20170101010101_checksums.yaml")
+		})
+		It("reads the checksum of each table from a checksum manifest", func() {
+			_ = os.WriteFile(checksumFile, []byte("1234: abc123\n5678: def456\n"), 0644)
+			checksums, err := toc.ReadSegmentChecksums(checksumFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checksums).To(Equal(map[uint]string{1234: "abc123", 5678: "def456"}))
+		})
+		It("returns an error if the checksum manifest does not exist", func() {
+			_, err := toc.ReadSegmentChecksums(checksumFile)
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
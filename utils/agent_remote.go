@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/hex"
 	"fmt"
 	"io"
 	path "path/filepath"
@@ -16,6 +17,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
 var helperMutex sync.Mutex
@@ -57,10 +59,7 @@ func CreateSegmentPipeOnAllHostsForRestore(oid string, c *cluster.Cluster, fpInf
 }
 
 func WriteOidListToSegments(oidList []string, c *cluster.Cluster, fpInfo filepath.FilePathInfo, fileSuffix string) {
-	rsync_exists := CommandExists("rsync")
-	if !rsync_exists {
-		gplog.Fatal(errors.New("Failed to find rsync on PATH. Please ensure rsync is installed."), "")
-	}
+	checkRsyncExists()
 
 	localOidFile, err := operating.System.TempFile("", "gpbackup-oids")
 	gplog.FatalOnError(err, "Cannot open temporary file to write oids")
@@ -73,16 +72,52 @@ func WriteOidListToSegments(oidList []string, c *cluster.Cluster, fpInfo filepat
 
 	WriteOidsToFile(localOidFile.Name(), oidList)
 
+	copyHelperFileToSegments(localOidFile.Name(), c, fpInfo, fileSuffix, "oid file")
+}
+
+/*
+ * The encryption key is copied to the segments so that gpbackup_helper can
+ * encrypt and decrypt table data there.  It is removed along with the other
+ * helper files once the backup or restore completes.
+ */
+func WriteEncryptionKeyToSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
+	checkRsyncExists()
+
+	// TempFile creates the file with mode 0600, which rsync preserves on the segments
+	localKeyFile, err := operating.System.TempFile("", "gpbackup-key")
+	gplog.FatalOnError(err, "Cannot open temporary file to write encryption key")
+	defer func() {
+		err = operating.System.Remove(localKeyFile.Name())
+		if err != nil {
+			gplog.Warn("Cannot remove temporary encryption key file: %s, Err: %s", localKeyFile.Name(), err.Error())
+		}
+	}()
+
+	_, err = localKeyFile.Write([]byte(hex.EncodeToString(encryptionKey.key)))
+	gplog.FatalOnError(err, localKeyFile.Name())
+	err = localKeyFile.Close()
+	gplog.FatalOnError(err, localKeyFile.Name())
+
+	copyHelperFileToSegments(localKeyFile.Name(), c, fpInfo, "key", "encryption key file")
+}
+
+func checkRsyncExists() {
+	rsync_exists := CommandExists("rsync")
+	if !rsync_exists {
+		gplog.Fatal(errors.New("Failed to find rsync on PATH. Please ensure rsync is installed."), "")
+	}
+}
+
+func copyHelperFileToSegments(sourceFile string, c *cluster.Cluster, fpInfo filepath.FilePathInfo, fileSuffix string, fileDescription string) {
 	generateScpCmd := func(contentID int) string {
-		sourceFile := localOidFile.Name()
 		hostname := c.GetHostForContent(contentID)
 		dest := fpInfo.GetSegmentHelperFilePath(contentID, fileSuffix)
 
 		return fmt.Sprintf(`rsync -e ssh %s %s:%s`, sourceFile, hostname, dest)
 	}
-	remoteOutput := c.GenerateAndExecuteCommand("rsync oid file to segments", cluster.ON_LOCAL|cluster.ON_SEGMENTS, generateScpCmd)
+	remoteOutput := c.GenerateAndExecuteCommand(fmt.Sprintf("rsync %s to segments", fileDescription), cluster.ON_LOCAL|cluster.ON_SEGMENTS, generateScpCmd)
 
-	errMsg := "Failed to rsync oid file"
+	errMsg := fmt.Sprintf("Failed to rsync %s", fileDescription)
 	errFunc := func(contentID int) string {
 		return "Failed to run rsync"
 	}
@@ -143,6 +178,25 @@ func VerifyHelperVersionOnSegments(version string, c *cluster.Cluster) {
 	}
 }
 
+/*
+ * Multi-file backups and restores run the compression program on the segments
+ * in their COPY commands, where a missing program would only show up as a
+ * broken pipe partway through the data, so we check that it is installed on
+ * every segment host beforehand.
+ */
+func VerifyCompressionProgramOnSegments(c *cluster.Cluster, command string) {
+	if command == DefaultPipeThroughProgram {
+		return
+	}
+	program := strings.Fields(command)[0]
+	remoteOutput := c.GenerateAndExecuteCommand(fmt.Sprintf("Verifying that %s is installed on segment hosts", program), cluster.ON_HOSTS, func(host string) string {
+		return fmt.Sprintf("command -v %s", program)
+	})
+	c.CheckClusterError(remoteOutput, fmt.Sprintf("The %s command used for compression was not found; install it on every segment host or choose a different compression type", program), func(host string) string {
+		return fmt.Sprintf("Could not find the %s command", program)
+	})
+}
+
 func StartGpbackupHelpers(c *cluster.Cluster, fpInfo filepath.FilePathInfo, operation string, pluginConfigFile string, compressStr string, onErrorContinue bool, isFilter bool, wasTerminated *bool, copyQueue int, isSingleDataFile bool, resizeCluster bool, origSize int, destSize int, verbosity int) {
 	// A mutex lock for cleaning up and starting gpbackup helpers prevents a
 	// race condition that causes gpbackup_helpers to be orphaned if
@@ -183,8 +237,9 @@ func StartGpbackupHelpers(c *cluster.Cluster, fpInfo filepath.FilePathInfo, oper
 		scriptFile := fpInfo.GetSegmentHelperFilePath(contentID, "script")
 		pipeFile := fpInfo.GetSegmentPipeFilePath(contentID)
 		backupFile := fpInfo.GetTableBackupFilePath(contentID, 0, GetPipeThroughProgram().Extension, true)
-		helperCmdStr := fmt.Sprintf(`gpbackup_helper %s --toc-file %s --oid-file %s --pipe-file %s --data-file "%s" --content %d%s%s%s%s%s%s --copy-queue-size %d --verbosity %d`,
-			operation, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, compressStr, onErrorContinueStr, filterStr, singleDataFileStr, resizeStr, copyQueue, verbosity)
+		encryptionStr := getEncryptionKeyFileStr(fpInfo, contentID)
+		helperCmdStr := fmt.Sprintf(`gpbackup_helper %s --toc-file %s --oid-file %s --pipe-file %s --data-file "%s" --content %d%s%s%s%s%s%s%s --copy-queue-size %d --verbosity %d`,
+			operation, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, compressStr, onErrorContinueStr, filterStr, singleDataFileStr, resizeStr, encryptionStr, copyQueue, verbosity)
 		// we run these commands in sequence to ensure that any failure is critical; the last command ensures the agent process was successfully started
 		return fmt.Sprintf(`cat << HEREDOC > %[1]s && chmod +x %[1]s && ( nohup %[1]s &> /dev/null &)
 #!/bin/bash
@@ -200,13 +255,301 @@ HEREDOC
 	})
 }
 
+/*
+ * The result of checking the data for a single table on a single segment, as
+ * reported by gpbackup_helper --verify-agent.
+ */
+type DataVerificationResult struct {
+	Oid      uint32
+	RowCount int64
+	Problems []string `yaml:",omitempty"`
+}
+
+/*
+ * Unlike the backup and restore agents, the verify agent runs in the
+ * foreground, so we can collect the results it writes to stdout directly.
+ */
+func VerifyDataOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo, pluginConfigFile string, isSingleDataFile bool, verbosity int) map[int][]DataVerificationResult {
+	gphomePath := operating.System.Getenv("GPHOME")
+	pluginStr := ""
+	if pluginConfigFile != "" {
+		_, configFilename := path.Split(pluginConfigFile)
+		pluginStr = fmt.Sprintf(" --plugin-config /tmp/%s", configFilename)
+	}
+	singleDataFileStr := ""
+	if isSingleDataFile {
+		singleDataFileStr = " --single-data-file"
+	}
+
+	remoteOutput := c.GenerateAndExecuteCommand("Verifying backup data files on segments", cluster.ON_SEGMENTS, func(contentID int) string {
+		tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
+		oidFile := fpInfo.GetSegmentHelperFilePath(contentID, "oid")
+		pipeFile := fpInfo.GetSegmentPipeFilePath(contentID)
+		backupFile := fpInfo.GetTableBackupFilePath(contentID, 0, GetPipeThroughProgram().Extension, true)
+		encryptionStr := getEncryptionKeyFileStr(fpInfo, contentID)
+		return fmt.Sprintf(`source %[1]s/greenplum_path.sh && %[1]s/bin/gpbackup_helper --verify-agent --toc-file %s --oid-file %s --pipe-file %s --data-file "%s" --content %d%s%s%s --verbosity %d`,
+			gphomePath, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, singleDataFileStr, encryptionStr, verbosity)
+	})
+	c.CheckClusterError(remoteOutput, "Error verifying backup data files", func(contentID int) string {
+		return fmt.Sprintf("Error verifying backup data files. See %s on the corresponding host for detailed error messages.", fpInfo.GetHelperLogPath())
+	})
+
+	results := make(map[int][]DataVerificationResult, len(remoteOutput.Commands))
+	for _, cmd := range remoteOutput.Commands {
+		segmentResults := make([]DataVerificationResult, 0)
+		err := yaml.Unmarshal([]byte(cmd.Stdout), &segmentResults)
+		if err != nil {
+			gplog.Fatal(errors.Wrapf(err, "Unable to parse verification results for segment %d on host %s", cmd.Content, c.GetHostForContent(cmd.Content)), "")
+		}
+		results[cmd.Content] = segmentResults
+	}
+	return results
+}
+
+func getEncryptionKeyFileStr(fpInfo filepath.FilePathInfo, contentID int) string {
+	if encryptionKey == nil {
+		return ""
+	}
+	return fmt.Sprintf(" --encryption-key-file %s", fpInfo.GetSegmentHelperFilePath(contentID, "key"))
+}
+
+/*
+ * The checksum agent is run on each segment as a filter in the COPY command
+ * of a multi-file backup or restore, so it is passed the file names in the
+ * format used by COPY ... ON SEGMENT.  The checksums of an encrypted backup
+ * are keyed with the encryption key, so it is passed the key file as well.
+ */
+func GetChecksumAgentCommand(fpInfo filepath.FilePathInfo, checksumFile string, sizeFile string, tableOid uint32, verify bool) string {
+	gphomePath := operating.System.Getenv("GPHOME")
+	verifyStr := ""
+	if verify {
+		verifyStr = " --verify-checksum"
+	}
+	sizeFileStr := ""
+	if sizeFile != "" {
+		sizeFileStr = fmt.Sprintf(" --size-file %s", sizeFile)
+	}
+	encryptionStr := ""
+	if encryptionKey != nil {
+		encryptionStr = fmt.Sprintf(" --encryption-key-file %s", fpInfo.GetSegmentHelperFilePathForCopyCommand("key"))
+	}
+	return fmt.Sprintf("%s/bin/gpbackup_helper --checksum-agent%s --oid %d --checksum-file %s%s%s --content <SEGID>", gphomePath, verifyStr, tableOid, checksumFile, sizeFileStr, encryptionStr)
+}
+
+/*
+ * Like the checksum agent, the encryption agent is run as a filter in the COPY
+ * command of a multi-file backup or restore, after the compression program
+ * during backup and before the decompression program during restore.
+ */
+func GetEncryptionAgentCommand(fpInfo filepath.FilePathInfo, decrypt bool) string {
+	gphomePath := operating.System.Getenv("GPHOME")
+	operation := "--encrypt-agent"
+	if decrypt {
+		operation = "--decrypt-agent"
+	}
+	return fmt.Sprintf("%s/bin/gpbackup_helper %s --encryption-key-file %s --content <SEGID>", gphomePath, operation, fpInfo.GetSegmentHelperFilePathForCopyCommand("key"))
+}
+
+/*
+ * Merges the checksum files written by the checksum agent for each table into
+ * a single manifest per segment and returns the number of checksums recorded
+ * on each segment.
+ */
+func WriteChecksumManifestsOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) map[int]int {
+	remoteOutput := c.GenerateAndExecuteCommand("Writing checksum manifests on segments", cluster.ON_SEGMENTS, func(contentID int) string {
+		manifest := fpInfo.GetSegmentChecksumFilePath(contentID)
+		findChecksumFiles := fmt.Sprintf(`find %s -maxdepth 1 -name "gpbackup_%d_%s_*_checksum"`, fpInfo.GetDirForContent(contentID), contentID, fpInfo.Timestamp)
+		return fmt.Sprintf("%[1]s -exec cat {} + > %[2]s && %[1]s -delete && chmod 444 %[2]s && wc -l < %[2]s", findChecksumFiles, manifest)
+	})
+	c.CheckClusterError(remoteOutput, "Unable to write checksum manifests on segments", func(contentID int) string {
+		return fmt.Sprintf("Unable to write checksum manifest %s", fpInfo.GetSegmentChecksumFilePath(contentID))
+	})
+
+	numChecksums := make(map[int]int, len(remoteOutput.Commands))
+	for _, cmd := range remoteOutput.Commands {
+		numChecksums[cmd.Content], _ = strconv.Atoi(strings.TrimSpace(cmd.Stdout))
+	}
+	return numChecksums
+}
+
+/*
+ * Backups taken before checksums were recorded, or using a plugin, have no
+ * checksum manifests, in which case there is nothing to verify.
+ */
+func ChecksumManifestsExistOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) bool {
+	remoteOutput := c.GenerateAndExecuteCommand("Checking for checksum manifests on segments", cluster.ON_SEGMENTS, func(contentID int) string {
+		manifest := fpInfo.GetSegmentChecksumFilePath(contentID)
+		return fmt.Sprintf("if [[ -f %s ]]; then echo 'exists'; fi", manifest)
+	})
+	c.CheckClusterError(remoteOutput, "Unable to check for checksum manifests on segments", func(contentID int) string {
+		return fmt.Sprintf("Unable to check for checksum manifest %s", fpInfo.GetSegmentChecksumFilePath(contentID))
+	})
+
+	numMissing := 0
+	for _, cmd := range remoteOutput.Commands {
+		if strings.TrimSpace(cmd.Stdout) != "exists" {
+			gplog.Verbose("Checksum manifest %s not found on host %s", fpInfo.GetSegmentChecksumFilePath(cmd.Content), c.GetHostForContent(cmd.Content))
+			numMissing++
+		}
+	}
+	if numMissing > 0 && numMissing < len(remoteOutput.Commands) {
+		gplog.Warn("Checksum manifests are missing on %d segment(s), so table data will not be verified against its checksums", numMissing)
+	}
+	return numMissing == 0
+}
+
+/*
+ * A resumed backup checks which data files of the backup it is resuming exist
+ * on the segments, and removes the files of tables it will back up again.
+ */
+func ListBackupFilesOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) map[int]map[string]bool {
+	remoteOutput := c.GenerateAndExecuteCommand("Listing backup files on segments", cluster.ON_SEGMENTS, func(contentID int) string {
+		return fmt.Sprintf("ls -1 %s", fpInfo.GetDirForContent(contentID))
+	})
+	c.CheckClusterError(remoteOutput, "Unable to list backup files on segments", func(contentID int) string {
+		return fmt.Sprintf("Unable to list backup files in %s", fpInfo.GetDirForContent(contentID))
+	})
+
+	segmentFiles := make(map[int]map[string]bool, len(remoteOutput.Commands))
+	for _, cmd := range remoteOutput.Commands {
+		files := make(map[string]bool)
+		for _, file := range strings.Split(cmd.Stdout, "\n") {
+			if file = strings.TrimSpace(file); file != "" {
+				files[file] = true
+			}
+		}
+		segmentFiles[cmd.Content] = files
+	}
+	return segmentFiles
+}
+
+/*
+ * The sizes of table data are only reported, so a segment whose sizes cannot
+ * be read is logged and left out rather than failing the backup.
+ */
+func warnOnSizeCommandErrors(remoteOutput *cluster.RemoteOutput, description string) {
+	for _, failedCommand := range remoteOutput.FailedCommands {
+		gplog.Warn("Unable to %s on segment %d: %s", description, failedCommand.Content, strings.TrimSpace(failedCommand.Stderr))
+	}
+}
+
+// Returns the size of the data files of each table on each segment of a multi-file backup
+func GetTableDataFileSizesOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) map[int]map[uint32]int64 {
+	remoteOutput := c.GenerateAndExecuteCommand("Getting sizes of data files on segments", cluster.ON_SEGMENTS, func(contentID int) string {
+		return fmt.Sprintf("find %s -maxdepth 1 -type f -name 'gpbackup_%d_%s_*' -printf '%%f %%s\\n'", fpInfo.GetDirForContent(contentID), contentID, fpInfo.Timestamp)
+	})
+	warnOnSizeCommandErrors(remoteOutput, "get sizes of data files")
+
+	segmentSizes := make(map[int]map[uint32]int64, len(remoteOutput.Commands))
+	for _, cmd := range remoteOutput.Commands {
+		if cmd.Error != nil {
+			continue
+		}
+		tableSizes := make(map[uint32]int64)
+		prefix := fmt.Sprintf("gpbackup_%d_%s_", cmd.Content, fpInfo.Timestamp)
+		for _, line := range strings.Split(cmd.Stdout, "\n") {
+			file, sizeStr, found := strings.Cut(strings.TrimSpace(line), " ")
+			if !found || !strings.HasPrefix(file, prefix) {
+				continue
+			}
+			// Skip checksum manifests and any other file not named for a table oid
+			oidStr, _, _ := strings.Cut(strings.TrimPrefix(file, prefix), ".")
+			oid, err := strconv.ParseUint(oidStr, 10, 32)
+			if err != nil {
+				continue
+			}
+			size, err := strconv.ParseInt(sizeStr, 10, 64)
+			if err != nil {
+				continue
+			}
+			tableSizes[uint32(oid)] += size
+		}
+		segmentSizes[cmd.Content] = tableSizes
+	}
+	return segmentSizes
+}
+
+/*
+ * Returns the number of bytes of each table's data on each segment of a
+ * multi-file backup, as recorded by the checksum agent in a file per table,
+ * and removes those files.
+ */
+func CollectTableSizeFilesOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) map[int]map[uint32]int64 {
+	remoteOutput := c.GenerateAndExecuteCommand("Collecting table data sizes on segments", cluster.ON_SEGMENTS, func(contentID int) string {
+		findSizeFiles := fmt.Sprintf(`find %s -maxdepth 1 -name "gpbackup_%d_%s_*_size"`, fpInfo.GetDirForContent(contentID), contentID, fpInfo.Timestamp)
+		return fmt.Sprintf("%[1]s -exec cat {} + && %[1]s -delete", findSizeFiles)
+	})
+	warnOnSizeCommandErrors(remoteOutput, "collect table data sizes")
+
+	segmentSizes := make(map[int]map[uint32]int64, len(remoteOutput.Commands))
+	for _, cmd := range remoteOutput.Commands {
+		if cmd.Error != nil {
+			continue
+		}
+		tableSizes := make(map[uint32]int64)
+		err := yaml.Unmarshal([]byte(cmd.Stdout), &tableSizes)
+		if err != nil {
+			gplog.Warn("Unable to parse table data sizes on segment %d: %v", cmd.Content, err)
+			continue
+		}
+		segmentSizes[cmd.Content] = tableSizes
+	}
+	return segmentSizes
+}
+
+/*
+ * Returns the contents of the segment TOC of each segment of a single data
+ * file backup.  The helper writes its TOC as the last thing it does before
+ * exiting, so we wait for the helper process to exit and only then read the
+ * file; a helper that failed leaves no TOC behind and that segment is skipped.
+ */
+func ReadSegmentTOCFilesOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) map[int][]byte {
+	remoteOutput := c.GenerateAndExecuteCommand("Reading segment TOC files", cluster.ON_SEGMENTS, func(contentID int) string {
+		tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
+		procPattern := fmt.Sprintf("gpbackup_helper --backup-agent --toc-file %s", tocFile)
+		return fmt.Sprintf(`while ps ux | grep "%s" | grep -v grep > /dev/null; do sleep 1; done; cat "%s"`, procPattern, tocFile)
+	})
+	warnOnSizeCommandErrors(remoteOutput, "read segment TOC file")
+
+	segmentTOCs := make(map[int][]byte, len(remoteOutput.Commands))
+	for _, cmd := range remoteOutput.Commands {
+		if cmd.Error == nil {
+			segmentTOCs[cmd.Content] = []byte(cmd.Stdout)
+		}
+	}
+	return segmentTOCs
+}
+
+func RemoveBackupFilesOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo, segmentFiles map[int][]string) {
+	numFiles := 0
+	for _, files := range segmentFiles {
+		numFiles += len(files)
+	}
+	if numFiles == 0 {
+		return
+	}
+	remoteOutput := c.GenerateAndExecuteCommand("Removing backup files on segments", cluster.ON_SEGMENTS, func(contentID int) string {
+		if len(segmentFiles[contentID]) == 0 {
+			return "true"
+		}
+		filePaths := make([]string, len(segmentFiles[contentID]))
+		for idx, file := range segmentFiles[contentID] {
+			filePaths[idx] = path.Join(fpInfo.GetDirForContent(contentID), file)
+		}
+		return fmt.Sprintf("rm -f %s", strings.Join(filePaths, " "))
+	})
+	c.CheckClusterError(remoteOutput, "Unable to remove backup files on segments", func(contentID int) string {
+		return fmt.Sprintf("Unable to remove backup files in %s", fpInfo.GetDirForContent(contentID))
+	})
+}
+
 func findCommandStr(c *cluster.Cluster, fpInfo filepath.FilePathInfo, contentID int) string {
 	var cmdString string
 	if runtime.GOOS == "linux" {
-		cmdString = fmt.Sprintf(`find %s -regextype posix-extended -regex ".*gpbackup_%d_%s_(oid|script|pipe)_%d.*"`,
+		cmdString = fmt.Sprintf(`find %s -regextype posix-extended -regex ".*gpbackup_%d_%s_(oid|script|pipe|key)_%d.*"`,
 			c.GetDirForContent(contentID), contentID, fpInfo.Timestamp, fpInfo.PID)
 	} else if runtime.GOOS == "darwin" {
-		cmdString = fmt.Sprintf(`find -E %s -regex ".*gpbackup_%d_%s_(oid|script|pipe)_%d.*"`,
+		cmdString = fmt.Sprintf(`find -E %s -regex ".*gpbackup_%d_%s_(oid|script|pipe|key)_%d.*"`,
 			c.GetDirForContent(contentID), contentID, fpInfo.Timestamp, fpInfo.PID)
 	}
 	return cmdString
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
@@ -147,6 +148,59 @@ var _ = Describe("agent remote", func() {
 			cc := testExecutor.ClusterCommands[0]
 			Expect(cc[1].CommandString).To(ContainSubstring("--verbosity %d", gplog.LOGDEBUG))
 		})
+		It("passes the encryption key file to gpbackup_helper if an encryption key is set", func() {
+			wasTerminated := false
+			encryptionKey, _ := utils.NewEncryptionKey(strings.Repeat("ab", 32))
+			utils.SetEncryptionKey(encryptionKey)
+			defer utils.SetEncryptionKey(nil)
+			utils.StartGpbackupHelpers(testCluster, fpInfo, "operation", "", " compressStr", false, false, &wasTerminated, 1, true, false, 0, 0, gplog.LOGINFO)
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0].CommandString).To(ContainSubstring(fmt.Sprintf(" --encryption-key-file /data/gpseg0/gpbackup_0_11112233445566_key_%d ", fpInfo.PID)))
+			Expect(cc[1].CommandString).To(ContainSubstring(fmt.Sprintf(" --encryption-key-file /data/gpseg1/gpbackup_1_11112233445566_key_%d ", fpInfo.PID)))
+		})
+		It("does not pass an encryption key file to gpbackup_helper if no encryption key is set", func() {
+			wasTerminated := false
+			utils.StartGpbackupHelpers(testCluster, fpInfo, "operation", "", " compressStr", false, false, &wasTerminated, 1, true, false, 0, 0, gplog.LOGINFO)
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0].CommandString).ToNot(ContainSubstring("--encryption-key-file"))
+		})
+	})
+	Describe("VerifyDataOnSegments", func() {
+		It("runs the verify agent in the foreground on each segment", func() {
+			_ = utils.VerifyDataOnSegments(testCluster, fpInfo, "/tmp/pluginConfigFile.yml", true, gplog.LOGINFO)
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0].CommandString).To(ContainSubstring(fmt.Sprintf("gpbackup_helper --verify-agent --toc-file /data/gpseg0/backups/11112233/11112233445566/gpbackup_0_11112233445566_toc.yaml --oid-file /data/gpseg0/gpbackup_0_11112233445566_oid_%d", fpInfo.PID)))
+			Expect(cc[0].CommandString).To(ContainSubstring(fmt.Sprintf(" --content 0 --plugin-config /tmp/pluginConfigFile.yml --single-data-file --verbosity %d", gplog.LOGINFO)))
+			Expect(cc[0].CommandString).ToNot(ContainSubstring("nohup"))
+			Expect(cc[1].CommandString).To(ContainSubstring(" --content 1 "))
+		})
+		It("parses the results reported by each segment", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{
+				{Content: 0, Stdout: "- oid: 1\n  rowcount: 10\n- oid: 2\n  rowcount: 5\n  problems:\n  - Data file is missing\n"},
+				{Content: 1, Stdout: "- oid: 1\n  rowcount: 12\n- oid: 2\n  rowcount: 0\n"},
+			}
+
+			results := utils.VerifyDataOnSegments(testCluster, fpInfo, "", false, gplog.LOGINFO)
+
+			Expect(results).To(HaveLen(2))
+			Expect(results[0]).To(Equal([]utils.DataVerificationResult{
+				{Oid: 1, RowCount: 10},
+				{Oid: 2, RowCount: 5, Problems: []string{"Data file is missing"}},
+			}))
+			Expect(results[1]).To(Equal([]utils.DataVerificationResult{
+				{Oid: 1, RowCount: 12},
+				{Oid: 2, RowCount: 0},
+			}))
+		})
+		It("panics if the results cannot be parsed", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{{Content: 0, Stdout: "not a list"}}
+
+			defer testhelper.ShouldPanicWithMessage("Unable to parse verification results for segment 0 on host localhost")
+			_ = utils.VerifyDataOnSegments(testCluster, fpInfo, "", false, gplog.LOGINFO)
+		})
 	})
 	Describe("CheckAgentErrorsOnSegments", func() {
 		It("constructs the correct ssh call to check for the existance of an error file on each segment", func() {
@@ -164,6 +218,173 @@ var _ = Describe("agent remote", func() {
 		})
 
 	})
+	Describe("GetChecksumAgentCommand", func() {
+		It("constructs the checksum agent command used during backup", func() {
+			checksumCommand := utils.GetChecksumAgentCommand(fpInfo, "/data/gpseg<SEGID>/gpbackup_<SEGID>_11112233445566_1234_checksum", "/data/gpseg<SEGID>/gpbackup_<SEGID>_11112233445566_1234_size", 1234, false)
+			Expect(checksumCommand).To(HaveSuffix("/bin/gpbackup_helper --checksum-agent --oid 1234 --checksum-file /data/gpseg<SEGID>/gpbackup_<SEGID>_11112233445566_1234_checksum --size-file /data/gpseg<SEGID>/gpbackup_<SEGID>_11112233445566_1234_size --content <SEGID>"))
+		})
+		It("constructs the checksum agent command used during restore", func() {
+			checksumCommand := utils.GetChecksumAgentCommand(fpInfo, "/data/gpseg<SEGID>/gpbackup_<SEGID>_11112233445566_checksums.yaml", "", 1234, true)
+			Expect(checksumCommand).To(HaveSuffix("/bin/gpbackup_helper --checksum-agent --verify-checksum --oid 1234 --checksum-file /data/gpseg<SEGID>/gpbackup_<SEGID>_11112233445566_checksums.yaml --content <SEGID>"))
+		})
+		It("passes the encryption key file to the checksum agent of an encrypted backup", func() {
+			encryptionKey, _ := utils.NewEncryptionKey(strings.Repeat("ab", 32))
+			utils.SetEncryptionKey(encryptionKey)
+			defer utils.SetEncryptionKey(nil)
+			checksumCommand := utils.GetChecksumAgentCommand(fpInfo, "/data/gpseg<SEGID>/gpbackup_<SEGID>_11112233445566_checksums.yaml", "", 1234, true)
+			Expect(checksumCommand).To(HaveSuffix(fmt.Sprintf("/bin/gpbackup_helper --checksum-agent --verify-checksum --oid 1234 --checksum-file /data/gpseg<SEGID>/gpbackup_<SEGID>_11112233445566_checksums.yaml --encryption-key-file <SEG_DATA_DIR>/gpbackup_<SEGID>_11112233445566_key_%d --content <SEGID>", fpInfo.PID)))
+		})
+	})
+	Describe("GetEncryptionAgentCommand", func() {
+		It("constructs the encryption agent command used during backup", func() {
+			encryptionCommand := utils.GetEncryptionAgentCommand(fpInfo, false)
+			Expect(encryptionCommand).To(HaveSuffix(fmt.Sprintf("/bin/gpbackup_helper --encrypt-agent --encryption-key-file <SEG_DATA_DIR>/gpbackup_<SEGID>_11112233445566_key_%d --content <SEGID>", fpInfo.PID)))
+		})
+		It("constructs the decryption agent command used during restore", func() {
+			encryptionCommand := utils.GetEncryptionAgentCommand(fpInfo, true)
+			Expect(encryptionCommand).To(HaveSuffix(fmt.Sprintf("/bin/gpbackup_helper --decrypt-agent --encryption-key-file <SEG_DATA_DIR>/gpbackup_<SEGID>_11112233445566_key_%d --content <SEGID>", fpInfo.PID)))
+		})
+	})
+	Describe("VerifyCompressionProgramOnSegments", func() {
+		It("checks that the compression program is installed on every host", func() {
+			utils.VerifyCompressionProgramOnSegments(testCluster, "pigz -c -1")
+
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc).To(HaveLen(2))
+			Expect(cc[0].CommandString).To(ContainSubstring("command -v pigz"))
+			Expect(cc[1].CommandString).To(ContainSubstring("command -v pigz"))
+		})
+		It("does not check for a program if the data is not compressed", func() {
+			utils.VerifyCompressionProgramOnSegments(testCluster, utils.DefaultPipeThroughProgram)
+
+			Expect(testExecutor.NumExecutions).To(Equal(0))
+		})
+		It("panics if the compression program is missing on any host", func() {
+			remoteOutput.NumErrors = 1
+			remoteOutput.FailedCommands = []*cluster.ShellCommand{{Host: "remotehost1"}}
+			defer testhelper.ShouldPanicWithMessage("The lz4 command used for compression was not found; install it on every segment host or choose a different compression type")
+
+			utils.VerifyCompressionProgramOnSegments(testCluster, "lz4 -d -c")
+		})
+	})
+	Describe("WriteChecksumManifestsOnSegments", func() {
+		It("merges the table checksum files into a manifest on each segment", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{{Content: 0, Stdout: "3\n"}, {Content: 1, Stdout: "2\n"}}
+
+			numChecksums := utils.WriteChecksumManifestsOnSegments(testCluster, fpInfo)
+
+			cc := testExecutor.ClusterCommands[0]
+			findCmd := `find /data/gpseg0/backups/11112233/11112233445566 -maxdepth 1 -name "gpbackup_0_11112233445566_*_checksum"`
+			manifest := "/data/gpseg0/backups/11112233/11112233445566/gpbackup_0_11112233445566_checksums.yaml"
+			Expect(cc[0].CommandString).To(ContainSubstring(fmt.Sprintf("%[1]s -exec cat {} + > %[2]s && %[1]s -delete && chmod 444 %[2]s && wc -l < %[2]s", findCmd, manifest)))
+			Expect(cc[1].CommandString).To(ContainSubstring("gpbackup_1_11112233445566_checksums.yaml"))
+			Expect(numChecksums).To(Equal(map[int]int{0: 3, 1: 2}))
+		})
+	})
+	Describe("ChecksumManifestsExistOnSegments", func() {
+		It("returns true if every segment has a checksum manifest", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{{Content: 0, Stdout: "exists\n"}, {Content: 1, Stdout: "exists\n"}}
+
+			Expect(utils.ChecksumManifestsExistOnSegments(testCluster, fpInfo)).To(BeTrue())
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0].CommandString).To(ContainSubstring("if [[ -f /data/gpseg0/backups/11112233/11112233445566/gpbackup_0_11112233445566_checksums.yaml ]]; then echo 'exists'; fi"))
+		})
+		It("returns false if any segment is missing its checksum manifest", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{{Content: 0, Stdout: "exists\n"}, {Content: 1, Stdout: ""}}
+
+			Expect(utils.ChecksumManifestsExistOnSegments(testCluster, fpInfo)).To(BeFalse())
+		})
+	})
+	Describe("ListBackupFilesOnSegments", func() {
+		It("lists the files in the backup directory of each segment", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{
+				{Content: 0, Stdout: "gpbackup_0_11112233445566_16384.gz\ngpbackup_0_11112233445566_16384_checksum\n"},
+				{Content: 1, Stdout: ""},
+			}
+
+			segmentFiles := utils.ListBackupFilesOnSegments(testCluster, fpInfo)
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0].CommandString).To(ContainSubstring("ls -1 /data/gpseg0/backups/11112233/11112233445566"))
+			Expect(segmentFiles).To(Equal(map[int]map[string]bool{
+				0: {"gpbackup_0_11112233445566_16384.gz": true, "gpbackup_0_11112233445566_16384_checksum": true},
+				1: {},
+			}))
+		})
+	})
+	Describe("GetTableDataFileSizesOnSegments", func() {
+		It("returns the sizes of the data files of each table on each segment", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{
+				{Content: 0, Stdout: "gpbackup_0_11112233445566_16384.gz 100\ngpbackup_0_11112233445566_16385.gz 20\ngpbackup_0_11112233445566_checksums.yaml 300\n"},
+				{Content: 1, Stdout: "gpbackup_1_11112233445566_16384.gz 50\ngpbackup_1_11112233445566_16384_checksum 64\n"},
+			}
+
+			tableSizes := utils.GetTableDataFileSizesOnSegments(testCluster, fpInfo)
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0].CommandString).To(ContainSubstring("find /data/gpseg0/backups/11112233/11112233445566 -maxdepth 1 -type f -name 'gpbackup_0_11112233445566_*'"))
+			Expect(tableSizes).To(Equal(map[int]map[uint32]int64{0: {16384: 100, 16385: 20}, 1: {16384: 50}}))
+		})
+		It("leaves out the segments whose files cannot be listed", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{
+				{Content: 0, Stdout: "gpbackup_0_11112233445566_16384.gz 100\n"},
+				{Content: 1, Error: errors.New("exit status 1"), Stderr: "No such file or directory"},
+			}
+			remoteOutput.NumErrors = 1
+			remoteOutput.FailedCommands = []*cluster.ShellCommand{&remoteOutput.Commands[1]}
+
+			tableSizes := utils.GetTableDataFileSizesOnSegments(testCluster, fpInfo)
+
+			Expect(tableSizes).To(Equal(map[int]map[uint32]int64{0: {16384: 100}}))
+			Expect(string(logfile.Contents())).To(ContainSubstring("Unable to get sizes of data files on segment 1: No such file or directory"))
+		})
+	})
+	Describe("CollectTableSizeFilesOnSegments", func() {
+		It("reads and removes the size files of each table on each segment", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{
+				{Content: 0, Stdout: "16384: 1000\n16385: 200\n"},
+				{Content: 1, Stdout: ""},
+			}
+
+			tableSizes := utils.CollectTableSizeFilesOnSegments(testCluster, fpInfo)
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0].CommandString).To(ContainSubstring(`find /data/gpseg0/backups/11112233/11112233445566 -maxdepth 1 -name "gpbackup_0_11112233445566_*_size" -exec cat {} + && find`))
+			Expect(cc[0].CommandString).To(HaveSuffix("-delete"))
+			Expect(tableSizes).To(Equal(map[int]map[uint32]int64{0: {16384: 1000, 16385: 200}, 1: {}}))
+		})
+	})
+	Describe("ReadSegmentTOCFilesOnSegments", func() {
+		It("returns the contents of the segment TOC of each segment", func() {
+			remoteOutput.Commands = []cluster.ShellCommand{
+				{Content: 0, Stdout: "dataentries: {}\n"},
+				{Content: 1, Stdout: "dataentries: {}\n"},
+			}
+
+			segmentTOCs := utils.ReadSegmentTOCFilesOnSegments(testCluster, fpInfo)
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0].CommandString).To(ContainSubstring(`while ps ux | grep "gpbackup_helper --backup-agent --toc-file /data/gpseg0/backups/11112233/11112233445566/gpbackup_0_11112233445566_toc.yaml" | grep -v grep > /dev/null; do sleep 1; done; cat "/data/gpseg0/backups/11112233/11112233445566/gpbackup_0_11112233445566_toc.yaml"`))
+			Expect(segmentTOCs).To(HaveLen(2))
+			Expect(string(segmentTOCs[1])).To(Equal("dataentries: {}\n"))
+		})
+	})
+	Describe("RemoveBackupFilesOnSegments", func() {
+		It("removes the given files on each segment", func() {
+			utils.RemoveBackupFilesOnSegments(testCluster, fpInfo, map[int][]string{0: {"gpbackup_0_11112233445566_16384_checksum"}})
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0].CommandString).To(ContainSubstring("rm -f /data/gpseg0/backups/11112233/11112233445566/gpbackup_0_11112233445566_16384_checksum"))
+			Expect(cc[1].CommandString).To(ContainSubstring("true"))
+		})
+		It("does nothing if there are no files to remove", func() {
+			utils.RemoveBackupFilesOnSegments(testCluster, fpInfo, map[int][]string{})
+
+			Expect(testExecutor.NumExecutions).To(Equal(0))
+		})
+	})
 })
 
 type testWriter struct {
@@ -1,6 +1,9 @@
 package utils
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 var (
 	pipeThroughProgram PipeThroughProgram
@@ -8,6 +11,12 @@ var (
 
 const DefaultPipeThroughProgram = "cat -"
 
+/*
+ * The extensions of compressed data files.  Both gzip and pgzip write gzip
+ * streams, so they share an extension and are read by the same reader.
+ */
+var compressedFileExtensions = []string{".gz", ".zst", ".lz4"}
+
 type PipeThroughProgram struct {
 	Name          string
 	OutputCommand string
@@ -31,10 +40,41 @@ func InitializePipeThroughParameters(compress bool, compressionType string, comp
 		return
 	}
 
+	if compressionType == "pgzip" {
+		pipeThroughProgram = PipeThroughProgram{Name: "pgzip", OutputCommand: fmt.Sprintf("pigz -c -%d", compressionLevel), InputCommand: "gzip -d -c", Extension: ".gz"}
+		return
+	}
+
 	if compressionType == "zstd" {
 		pipeThroughProgram = PipeThroughProgram{Name: "zstd", OutputCommand: fmt.Sprintf("zstd --compress -%d -c", compressionLevel), InputCommand: "zstd --decompress -c", Extension: ".zst"}
 		return
 	}
+
+	if compressionType == "lz4" {
+		pipeThroughProgram = PipeThroughProgram{Name: "lz4", OutputCommand: fmt.Sprintf("lz4 -c -%d", compressionLevel), InputCommand: "lz4 -d -c", Extension: ".lz4"}
+		return
+	}
+}
+
+/*
+ * Backups record the extension of their data files in the TOC, which restore
+ * uses to choose how to read them, as several compression types can write
+ * files in the same format.
+ */
+func InitializePipeThroughParametersForExtension(extension string) error {
+	switch extension {
+	case "":
+		InitializePipeThroughParameters(false, "", 0)
+	case ".gz":
+		InitializePipeThroughParameters(true, "gzip", 0)
+	case ".zst":
+		InitializePipeThroughParameters(true, "zstd", 0)
+	case ".lz4":
+		InitializePipeThroughParameters(true, "lz4", 0)
+	default:
+		return fmt.Errorf("unknown data file extension '%s'", extension)
+	}
+	return nil
 }
 
 func GetPipeThroughProgram() PipeThroughProgram {
@@ -44,3 +84,21 @@ func GetPipeThroughProgram() PipeThroughProgram {
 func SetPipeThroughProgram(compression PipeThroughProgram) {
 	pipeThroughProgram = compression
 }
+
+func HasCompressedFileExtension(filename string) bool {
+	for _, extension := range compressedFileExtensions {
+		if strings.HasSuffix(filename, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+func TrimCompressedFileExtension(filename string) string {
+	for _, extension := range compressedFileExtensions {
+		if strings.HasSuffix(filename, extension) {
+			return strings.TrimSuffix(filename, extension)
+		}
+	}
+	return filename
+}
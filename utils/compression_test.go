@@ -10,6 +10,7 @@ import (
 	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("utils/compression tests", func() {
@@ -69,5 +70,68 @@ var _ = Describe("utils/compression tests", func() {
 			resultProgram := utils.GetPipeThroughProgram()
 			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
 		})
+		It("initializes to use pigz when passed compression type pgzip and a level", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			expectedProgram := utils.PipeThroughProgram{
+				Name:          "pgzip",
+				OutputCommand: "pigz -c -7",
+				InputCommand:  "gzip -d -c",
+				Extension:     ".gz",
+			}
+			utils.InitializePipeThroughParameters(true, "pgzip", 7)
+			resultProgram := utils.GetPipeThroughProgram()
+			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
+		})
+		It("initializes to use lz4 when passed compression type lz4 and a level", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			expectedProgram := utils.PipeThroughProgram{
+				Name:          "lz4",
+				OutputCommand: "lz4 -c -1",
+				InputCommand:  "lz4 -d -c",
+				Extension:     ".lz4",
+			}
+			utils.InitializePipeThroughParameters(true, "lz4", 1)
+			resultProgram := utils.GetPipeThroughProgram()
+			structmatcher.ExpectStructsToMatch(&expectedProgram, &resultProgram)
+		})
+	})
+	Describe("InitializePipeThroughParametersForExtension", func() {
+		It("initializes to read lz4 data files", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			err := utils.InitializePipeThroughParametersForExtension(".lz4")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(utils.GetPipeThroughProgram().InputCommand).To(Equal("lz4 -d -c"))
+			Expect(utils.GetPipeThroughProgram().Extension).To(Equal(".lz4"))
+		})
+		It("initializes to read uncompressed data files", func() {
+			originalProgram := utils.GetPipeThroughProgram()
+			defer utils.SetPipeThroughProgram(originalProgram)
+			err := utils.InitializePipeThroughParametersForExtension("")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(utils.GetPipeThroughProgram().InputCommand).To(Equal("cat -"))
+		})
+		It("returns an error for an unknown extension", func() {
+			err := utils.InitializePipeThroughParametersForExtension(".bz2")
+			Expect(err).To(MatchError("unknown data file extension '.bz2'"))
+		})
+	})
+	Describe("HasCompressedFileExtension", func() {
+		It("recognizes the extensions of all compression types", func() {
+			Expect(utils.HasCompressedFileExtension("gpbackup_0_20170101010101.gz")).To(BeTrue())
+			Expect(utils.HasCompressedFileExtension("gpbackup_0_20170101010101.zst")).To(BeTrue())
+			Expect(utils.HasCompressedFileExtension("gpbackup_0_20170101010101.lz4")).To(BeTrue())
+			Expect(utils.HasCompressedFileExtension("gpbackup_0_20170101010101")).To(BeFalse())
+		})
+	})
+	Describe("TrimCompressedFileExtension", func() {
+		It("removes the extension of a compressed file", func() {
+			Expect(utils.TrimCompressedFileExtension("gpbackup_0_20170101010101_1234.lz4")).To(Equal("gpbackup_0_20170101010101_1234"))
+		})
+		It("leaves the name of an uncompressed file unchanged", func() {
+			Expect(utils.TrimCompressedFileExtension("gpbackup_0_20170101010101_1234")).To(Equal("gpbackup_0_20170101010101_1234"))
+		})
 	})
 })
@@ -0,0 +1,433 @@
+package utils
+
+/*
+ * This file contains functions for encrypting and decrypting backup files
+ * using AES-256-GCM.
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+)
+
+/*
+ * An encrypted file starts with a header containing the ID of the key it was
+ * encrypted with and a random salt, from which we derive a key unique to the
+ * file so that the chunk counter can be used as the GCM nonce.  The data
+ * follows in chunks, each prefixed with its length; the high bit of the
+ * length marks the final chunk, so that a truncated file fails to decrypt
+ * rather than silently yielding a prefix of the data.
+ */
+const (
+	encryptionMagic      = "GPBKENC1"
+	encryptionKeyIDSize  = 16
+	encryptionSaltSize   = 32
+	encryptionHeaderSize = len(encryptionMagic) + encryptionKeyIDSize + encryptionSaltSize
+	encryptionChunkSize  = 64 * 1024
+	finalChunkFlag       = 1 << 31
+
+	EncryptionKeyIDEnvVar = "GPBACKUP_ENCRYPTION_KEY_ID"
+)
+
+var encryptionKey *EncryptionKey
+
+func SetEncryptionKey(key *EncryptionKey) {
+	encryptionKey = key
+}
+
+func GetEncryptionKey() *EncryptionKey {
+	return encryptionKey
+}
+
+type EncryptionKey struct {
+	ID  string
+	key []byte
+}
+
+/*
+ * Keys are 256-bit keys encoded as hexadecimal.  The key ID is derived from
+ * the key itself, so that we can tell whether we were given the right key
+ * before trying to decrypt anything with it.
+ */
+func NewEncryptionKey(hexKey string) (*EncryptionKey, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(hexKey))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("Encryption key must be a 256-bit key encoded as 64 hexadecimal characters")
+	}
+	fingerprint := sha256.Sum256(key)
+	return &EncryptionKey{ID: hex.EncodeToString(fingerprint[:])[:encryptionKeyIDSize], key: key}, nil
+}
+
+/*
+ * Reads the key from exactly one of a file, an environment variable, or the
+ * output of a command.  The command is passed the ID of the key that is
+ * needed, if known, in the GPBACKUP_ENCRYPTION_KEY_ID environment variable.
+ */
+func ReadEncryptionKey(keyFile string, keyEnvVar string, keyCommand string, keyID string) (*EncryptionKey, error) {
+	var hexKey string
+	switch {
+	case keyFile != "":
+		contents, err := operating.System.ReadFile(keyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read encryption key file %s", keyFile)
+		}
+		hexKey = string(contents)
+	case keyEnvVar != "":
+		hexKey = operating.System.Getenv(keyEnvVar)
+		if hexKey == "" {
+			return nil, errors.Errorf("Environment variable %s containing the encryption key is not set", keyEnvVar)
+		}
+	case keyCommand != "":
+		cmd := exec.Command("bash", "-c", keyCommand)
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", EncryptionKeyIDEnvVar, keyID))
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Encryption key command failed")
+		}
+		hexKey = string(output)
+	default:
+		return nil, nil
+	}
+
+	key, err := NewEncryptionKey(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	if keyID != "" && key.ID != keyID {
+		return nil, errors.Errorf("The backup was encrypted with key %s, but the provided key is %s", keyID, key.ID)
+	}
+	return key, nil
+}
+
+/*
+ * The checksums of the table data of an encrypted backup are stored alongside
+ * the encrypted data, so they are keyed with a key derived from the backup key
+ * to keep them from being used to confirm a guess of the contents of a table.
+ */
+func (k *EncryptionKey) NewChecksumHash() hash.Hash {
+	mac := hmac.New(sha256.New, k.key)
+	mac.Write([]byte("checksum"))
+	return hmac.New(sha256.New, mac.Sum(nil))
+}
+
+func (k *EncryptionKey) newFileCipher(salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, k.key)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(aead cipher.AEAD, counter uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+	return nonce
+}
+
+func chunkAdditionalData(header []byte, final bool) []byte {
+	if final {
+		return append(header, 1)
+	}
+	return append(header, 0)
+}
+
+type encryptingWriter struct {
+	writeHandle io.Writer
+	aead        cipher.AEAD
+	header      []byte
+	buffer      []byte
+	counter     uint64
+}
+
+/*
+ * Returns a writer that encrypts everything written to it.  The final chunk
+ * is only written on Close, which also closes writeHandle if it is a Closer.
+ */
+func (k *EncryptionKey) NewEncryptingWriter(writeHandle io.Writer) (io.WriteCloser, error) {
+	header := make([]byte, 0, encryptionHeaderSize)
+	header = append(header, encryptionMagic...)
+	header = append(header, k.ID...)
+	salt := make([]byte, encryptionSaltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	header = append(header, salt...)
+	aead, err := k.newFileCipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	_, err = writeHandle.Write(header)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{writeHandle: writeHandle, aead: aead, header: header, buffer: make([]byte, 0, encryptionChunkSize)}, nil
+}
+
+func (w *encryptingWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := encryptionChunkSize - len(w.buffer)
+		if n > len(p) {
+			n = len(p)
+		}
+		w.buffer = append(w.buffer, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(w.buffer) == encryptionChunkSize && len(p) > 0 {
+			// We only write a full chunk once there is more data, as the last chunk must be marked as final
+			err := w.writeChunk(false)
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *encryptingWriter) writeChunk(final bool) error {
+	ciphertext := w.aead.Seal(nil, chunkNonce(w.aead, w.counter), w.buffer, chunkAdditionalData(w.header, final))
+	w.counter++
+	w.buffer = w.buffer[:0]
+	length := uint32(len(ciphertext))
+	if final {
+		length |= finalChunkFlag
+	}
+	lengthBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(lengthBytes, length)
+	_, err := w.writeHandle.Write(append(lengthBytes, ciphertext...))
+	return err
+}
+
+func (w *encryptingWriter) Close() error {
+	err := w.writeChunk(true)
+	if closer, ok := w.writeHandle.(io.Closer); ok {
+		closeErr := closer.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+type decryptingReader struct {
+	readHandle io.Reader
+	aead       cipher.AEAD
+	header     []byte
+	plaintext  []byte
+	counter    uint64
+	done       bool
+}
+
+/*
+ * Returns a reader that decrypts the data read from readHandle.  Reading
+ * returns an error if the data was modified or truncated.
+ */
+func (k *EncryptionKey) NewDecryptingReader(readHandle io.Reader) (io.Reader, error) {
+	header := make([]byte, encryptionHeaderSize)
+	_, err := io.ReadFull(readHandle, header)
+	if err != nil || string(header[:len(encryptionMagic)]) != encryptionMagic {
+		return nil, errors.New("Data is not encrypted or its encryption header is corrupt")
+	}
+	keyID := string(header[len(encryptionMagic) : len(encryptionMagic)+encryptionKeyIDSize])
+	if keyID != k.ID {
+		return nil, errors.Errorf("Data was encrypted with key %s, but the provided key is %s", keyID, k.ID)
+	}
+	aead, err := k.newFileCipher(header[len(encryptionMagic)+encryptionKeyIDSize:])
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{readHandle: readHandle, aead: aead, header: header}, nil
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.plaintext) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		err := r.readChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+	return n, nil
+}
+
+func (r *decryptingReader) readChunk() error {
+	lengthBytes := make([]byte, 4)
+	_, err := io.ReadFull(r.readHandle, lengthBytes)
+	if err != nil {
+		return errors.New("Encrypted data is truncated")
+	}
+	length := binary.BigEndian.Uint32(lengthBytes)
+	final := length&finalChunkFlag != 0
+	length &^= finalChunkFlag
+	if length > encryptionChunkSize+uint32(r.aead.Overhead()) {
+		return errors.New("Encrypted data is corrupt")
+	}
+	ciphertext := make([]byte, length)
+	_, err = io.ReadFull(r.readHandle, ciphertext)
+	if err != nil {
+		return errors.New("Encrypted data is truncated")
+	}
+	r.plaintext, err = r.aead.Open(ciphertext[:0], chunkNonce(r.aead, r.counter), ciphertext, chunkAdditionalData(r.header, final))
+	if err != nil {
+		return errors.New("Encrypted data is corrupt or was modified")
+	}
+	r.counter++
+	if final {
+		n, _ := r.readHandle.Read(make([]byte, 1))
+		if n > 0 {
+			return errors.New("Encrypted data has unexpected data after its end")
+		}
+		r.done = true
+	}
+	return nil
+}
+
+/*
+ * Returns the ID of the key a file was encrypted with, or an empty string if
+ * the file is not encrypted.
+ */
+func GetFileEncryptionKeyID(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	header := make([]byte, encryptionHeaderSize)
+	_, err = io.ReadFull(file, header)
+	if err != nil || string(header[:len(encryptionMagic)]) != encryptionMagic {
+		return "", nil
+	}
+	return string(header[len(encryptionMagic) : len(encryptionMagic)+encryptionKeyIDSize]), nil
+}
+
+/*
+ * The coordinator backup files are read and written through these functions,
+ * which decrypt and encrypt them using the key set with SetEncryptionKey.
+ * Files that are not encrypted are read as they are, so that backups taken
+ * without encryption can still be read.
+ */
+func ReadBackupFile(filename string) ([]byte, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(contents, []byte(encryptionMagic)) {
+		return contents, nil
+	}
+	if encryptionKey == nil {
+		return nil, errors.Errorf("File %s is encrypted. Please specify the encryption key.", filename)
+	}
+	reader, err := encryptionKey.NewDecryptingReader(bytes.NewReader(contents))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to decrypt file %s", filename)
+	}
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to decrypt file %s", filename)
+	}
+	return plaintext, nil
+}
+
+func MustOpenBackupFileForReading(filename string) io.ReaderAt {
+	keyID, err := GetFileEncryptionKeyID(filename)
+	gplog.FatalOnError(err)
+	if keyID == "" {
+		return iohelper.MustOpenFileForReading(filename)
+	}
+	contents, err := ReadBackupFile(filename)
+	gplog.FatalOnError(err)
+	return bytes.NewReader(contents)
+}
+
+func WriteBackupFileAndMakeReadOnly(filename string, contents []byte) error {
+	if encryptionKey == nil {
+		return WriteToFileAndMakeReadOnly(filename, contents)
+	}
+	var encrypted bytes.Buffer
+	writer, err := encryptionKey.NewEncryptingWriter(&encrypted)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(contents)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	return WriteToFileAndMakeReadOnly(filename, encrypted.Bytes())
+}
+
+/*
+ * The metadata and statistics files are written a statement at a time, so we
+ * encrypt them once they are complete.  The encrypted file replaces the
+ * original, rather than being written over it, as the original is read-only.
+ */
+func EncryptBackupFile(filename string) error {
+	if encryptionKey == nil {
+		return nil
+	}
+	plaintext, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer plaintext.Close()
+
+	encryptedFilename := filename + ".encrypting"
+	encrypted, err := os.OpenFile(encryptedFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	bufWriter := bufio.NewWriter(encrypted)
+	writer, err := encryptionKey.NewEncryptingWriter(bufWriter)
+	if err == nil {
+		_, err = io.Copy(writer, plaintext)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = bufWriter.Flush()
+	}
+	closeErr := encrypted.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(encryptedFilename, 0444)
+	}
+	if err == nil {
+		err = os.Rename(encryptedFilename, filename)
+	}
+	if err != nil {
+		_ = os.Remove(encryptedFilename)
+		return errors.Wrapf(err, "Unable to encrypt file %s", filename)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package utils_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/encryption tests", func() {
+	const hexKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	const otherHexKey = "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+	var key *utils.EncryptionKey
+
+	encrypt := func(plaintext []byte) []byte {
+		var encrypted bytes.Buffer
+		writer, err := key.NewEncryptingWriter(&encrypted)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = writer.Write(plaintext)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+		return encrypted.Bytes()
+	}
+	decrypt := func(decryptKey *utils.EncryptionKey, encrypted []byte) ([]byte, error) {
+		reader, err := decryptKey.NewDecryptingReader(bytes.NewReader(encrypted))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(reader)
+	}
+
+	BeforeEach(func() {
+		var err error
+		key, err = utils.NewEncryptionKey(hexKey)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		utils.SetEncryptionKey(nil)
+	})
+	Describe("NewEncryptionKey", func() {
+		It("derives the same ID from the same key", func() {
+			sameKey, err := utils.NewEncryptionKey(hexKey + "\n")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sameKey.ID).To(Equal(key.ID))
+			Expect(key.ID).To(HaveLen(16))
+		})
+		It("rejects keys that are not 256-bit hexadecimal keys", func() {
+			_, err := utils.NewEncryptionKey("0011")
+			Expect(err).To(HaveOccurred())
+			_, err = utils.NewEncryptionKey(strings.Repeat("zz", 32))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("ReadEncryptionKey", func() {
+		It("reads the key from a file", func() {
+			keyFile := path.Join(GinkgoT().TempDir(), "key")
+			Expect(os.WriteFile(keyFile, []byte(hexKey), 0600)).To(Succeed())
+			fileKey, err := utils.ReadEncryptionKey(keyFile, "", "", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fileKey.ID).To(Equal(key.ID))
+		})
+		It("reads the key from an environment variable", func() {
+			GinkgoT().Setenv("TEST_GPBACKUP_KEY", hexKey)
+			envKey, err := utils.ReadEncryptionKey("", "TEST_GPBACKUP_KEY", "", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(envKey.ID).To(Equal(key.ID))
+		})
+		It("reads the key from a command, passing it the requested key ID", func() {
+			commandKey, err := utils.ReadEncryptionKey("", "", `test "$GPBACKUP_ENCRYPTION_KEY_ID" = "`+key.ID+`" && echo `+hexKey, key.ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(commandKey.ID).To(Equal(key.ID))
+		})
+		It("returns no key if no key source is given", func() {
+			noKey, err := utils.ReadEncryptionKey("", "", "", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(noKey).To(BeNil())
+		})
+		It("returns an error if the key does not match the requested key ID", func() {
+			_, err := utils.ReadEncryptionKey("", "", "echo "+otherHexKey, key.ID)
+			Expect(err).To(MatchError(ContainSubstring("The backup was encrypted with key " + key.ID)))
+		})
+	})
+	Describe("NewChecksumHash", func() {
+		checksum := func(checksumKey *utils.EncryptionKey, data string) string {
+			hash := checksumKey.NewChecksumHash()
+			hash.Write([]byte(data))
+			return hex.EncodeToString(hash.Sum(nil))
+		}
+		It("computes the same checksum of the same data with the same key", func() {
+			otherKey, _ := utils.NewEncryptionKey(hexKey)
+			Expect(checksum(key, "some data")).To(Equal(checksum(otherKey, "some data")))
+		})
+		It("computes a checksum that cannot be computed without the key", func() {
+			otherKey, _ := utils.NewEncryptionKey(otherHexKey)
+			unkeyedChecksum := sha256.Sum256([]byte("some data"))
+			Expect(checksum(key, "some data")).ToNot(Equal(checksum(otherKey, "some data")))
+			Expect(checksum(key, "some data")).ToNot(Equal(hex.EncodeToString(unkeyedChecksum[:])))
+		})
+	})
+	Describe("encrypting and decrypting", func() {
+		It("round-trips data spanning several chunks", func() {
+			plaintext := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+			encrypted := encrypt(plaintext)
+			Expect(bytes.Contains(encrypted, []byte("0123456789abcdef"))).To(BeFalse())
+			decrypted, err := decrypt(key, encrypted)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decrypted).To(Equal(plaintext))
+		})
+		It("round-trips empty data", func() {
+			decrypted, err := decrypt(key, encrypt([]byte{}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decrypted).To(BeEmpty())
+		})
+		It("fails to decrypt with a different key", func() {
+			otherKey, _ := utils.NewEncryptionKey(otherHexKey)
+			_, err := decrypt(otherKey, encrypt([]byte("data")))
+			Expect(err).To(MatchError(ContainSubstring("Data was encrypted with key " + key.ID)))
+		})
+		It("fails to decrypt truncated data", func() {
+			encrypted := encrypt(bytes.Repeat([]byte("a"), 100000))
+			_, err := decrypt(key, encrypted[:70000])
+			Expect(err).To(MatchError("Encrypted data is truncated"))
+		})
+		It("fails to decrypt modified data", func() {
+			encrypted := encrypt([]byte("some data"))
+			encrypted[len(encrypted)-1] ^= 1
+			_, err := decrypt(key, encrypted)
+			Expect(err).To(MatchError("Encrypted data is corrupt or was modified"))
+		})
+		It("fails to decrypt data with trailing data", func() {
+			encrypted := append(encrypt([]byte("some data")), 'x')
+			_, err := decrypt(key, encrypted)
+			Expect(err).To(MatchError("Encrypted data has unexpected data after its end"))
+		})
+	})
+	Describe("backup files", func() {
+		var filename string
+		BeforeEach(func() {
+			filename = path.Join(GinkgoT().TempDir(), "gpbackup_20170101010101_toc.yaml")
+		})
+		It("writes and reads an encrypted file", func() {
+			utils.SetEncryptionKey(key)
+			Expect(utils.WriteBackupFileAndMakeReadOnly(filename, []byte("contents"))).To(Succeed())
+			keyID, err := utils.GetFileEncryptionKeyID(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keyID).To(Equal(key.ID))
+			contents, err := utils.ReadBackupFile(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("contents"))
+		})
+		It("reads an unencrypted file as it is", func() {
+			Expect(utils.WriteBackupFileAndMakeReadOnly(filename, []byte("contents"))).To(Succeed())
+			keyID, err := utils.GetFileEncryptionKeyID(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(keyID).To(Equal(""))
+			utils.SetEncryptionKey(key)
+			contents, err := utils.ReadBackupFile(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("contents"))
+		})
+		It("fails to read an encrypted file without a key", func() {
+			utils.SetEncryptionKey(key)
+			Expect(utils.WriteBackupFileAndMakeReadOnly(filename, []byte("contents"))).To(Succeed())
+			utils.SetEncryptionKey(nil)
+			_, err := utils.ReadBackupFile(filename)
+			Expect(err).To(MatchError(ContainSubstring("is encrypted. Please specify the encryption key.")))
+		})
+		It("encrypts an existing read-only file in place", func() {
+			Expect(utils.WriteToFileAndMakeReadOnly(filename, []byte("SELECT 1;"))).To(Succeed())
+			utils.SetEncryptionKey(key)
+			Expect(utils.EncryptBackupFile(filename)).To(Succeed())
+			contents, err := utils.ReadBackupFile(filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("SELECT 1;"))
+			info, _ := os.Stat(filename)
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0444)))
+		})
+	})
+})
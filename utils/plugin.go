@@ -20,6 +20,10 @@ import (
 )
 
 const RequiredPluginVersion = "0.3.0"
+
+// Optional plugin commands are only called if the plugin's API version supports them
+const DeleteBackupPluginVersion = "0.4.0"
+const ListDirectoryPluginVersion = "0.5.0"
 const SecretKeyFile = ".encrypt"
 
 type PluginConfig struct {
@@ -27,6 +31,7 @@ type PluginConfig struct {
 	ConfigPath          string            `yaml:"-"`
 	Options             map[string]string `yaml:"options"`
 	backupPluginVersion string            `yaml:"-"`
+	apiVersion          semver.Version    `yaml:"-"`
 }
 
 type PluginScope string
@@ -86,6 +91,43 @@ func (plugin *PluginConfig) MustBackupFile(filenamePath string) {
 	gplog.FatalOnError(err)
 }
 
+func (plugin *PluginConfig) DeleteBackup(timestamp string) error {
+	if !plugin.CanDeleteBackup() {
+		return fmt.Errorf("Plugin %s does not support deleting backups. Plugin API version %s or later is required.",
+			plugin.ExecutablePath, DeleteBackupPluginVersion)
+	}
+	command := fmt.Sprintf("%s delete_backup %s %s", plugin.ExecutablePath, plugin.ConfigPath, timestamp)
+	gplog.Debug("%s", command)
+	output, err := exec.Command("bash", "-c", command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ERROR: Plugin failed to delete backup %s. %s", timestamp, string(output))
+	}
+	return nil
+}
+
+func (plugin *PluginConfig) ListDirectory(relativePath string) ([]string, error) {
+	if !plugin.CanListDirectory() {
+		return nil, fmt.Errorf("Plugin %s does not support listing directories. Plugin API version %s or later is required.",
+			plugin.ExecutablePath, ListDirectoryPluginVersion)
+	}
+	command := fmt.Sprintf("%s list_directory %s %s", plugin.ExecutablePath, plugin.ConfigPath, relativePath)
+	gplog.Debug("%s", command)
+	cmd := exec.Command("bash", "-c", command)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: Plugin failed to list directory %s. %s", relativePath, stderr.String())
+	}
+	entries := make([]string, 0)
+	for _, entry := range strings.Split(string(output), "\n") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
 func (plugin *PluginConfig) MustRestoreFile(filenamePath string) {
 	directory, _ := path.Split(filenamePath)
 	err := operating.System.MkdirAll(directory, 0755)
@@ -156,6 +198,25 @@ func (plugin *PluginConfig) checkPluginAPIVersion(c *cluster.Cluster) {
 		cluster.LogFatalClusterError("Plugin API version incorrect",
 			cluster.ON_HOSTS|cluster.INCLUDE_COORDINATOR, numIncorrect)
 	}
+	plugin.apiVersion = version
+}
+
+func (plugin *PluginConfig) supportsAPIVersion(minimumVersion string) bool {
+	requiredVersion, err := semver.Make(minimumVersion)
+	if err != nil {
+		gplog.Fatal(fmt.Errorf("cannot parse hardcoded internal string of required version: %s",
+			err.Error()), minimumVersion)
+	}
+	return plugin.apiVersion.GE(requiredVersion)
+}
+
+// The API version is only known after CheckPluginExistsOnAllHosts has been called
+func (plugin *PluginConfig) CanDeleteBackup() bool {
+	return plugin.supportsAPIVersion(DeleteBackupPluginVersion)
+}
+
+func (plugin *PluginConfig) CanListDirectory() bool {
+	return plugin.supportsAPIVersion(ListDirectoryPluginVersion)
 }
 
 func (plugin *PluginConfig) getPluginNativeVersion(c *cluster.Cluster) string {
@@ -267,6 +267,87 @@ options:
 			})
 		})
 	})
+	Describe("optional plugin commands", func() {
+		setAPIVersion := func(version string) {
+			for i := range executor.ClusterOutputs[0].Commands {
+				executor.ClusterOutputs[0].Commands[i].Stdout = version
+			}
+		}
+		writeFakePlugin := func(script string) {
+			subject.ExecutablePath = filepath.Join(tempDir, "fake_plugin")
+			err := ioutil.WriteFile(subject.ExecutablePath, []byte("#!/bin/bash\n"+script), 0755)
+			Expect(err).To(Not(HaveOccurred()))
+		}
+		It("does not support deleting backups or listing directories with the required API version", func() {
+			subject.CheckPluginExistsOnAllHosts(testCluster)
+
+			Expect(subject.CanDeleteBackup()).To(BeFalse())
+			Expect(subject.CanListDirectory()).To(BeFalse())
+		})
+		It("supports deleting backups but not listing directories with API version 0.4.0", func() {
+			setAPIVersion("0.4.0")
+			subject.CheckPluginExistsOnAllHosts(testCluster)
+
+			Expect(subject.CanDeleteBackup()).To(BeTrue())
+			Expect(subject.CanListDirectory()).To(BeFalse())
+		})
+		It("supports deleting backups and listing directories with API version 0.5.0", func() {
+			setAPIVersion("0.5.0")
+			subject.CheckPluginExistsOnAllHosts(testCluster)
+
+			Expect(subject.CanDeleteBackup()).To(BeTrue())
+			Expect(subject.CanListDirectory()).To(BeTrue())
+		})
+		It("returns an error when deleting a backup with a plugin that does not support it", func() {
+			subject.CheckPluginExistsOnAllHosts(testCluster)
+
+			err := subject.DeleteBackup("20170101010101")
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("does not support deleting backups. Plugin API version 0.4.0 or later is required."))
+		})
+		It("calls delete_backup with the config path and timestamp", func() {
+			setAPIVersion("0.4.0")
+			subject.CheckPluginExistsOnAllHosts(testCluster)
+			argsFile := filepath.Join(tempDir, "args")
+			writeFakePlugin(fmt.Sprintf(`echo "$@" > %s`, argsFile))
+
+			err := subject.DeleteBackup("20170101010101")
+
+			Expect(err).To(Not(HaveOccurred()))
+			contents, _ := ioutil.ReadFile(argsFile)
+			Expect(string(contents)).To(Equal("delete_backup /tmp/my_plugin_config.yaml 20170101010101\n"))
+		})
+		It("returns an error containing the plugin output when delete_backup fails", func() {
+			setAPIVersion("0.4.0")
+			subject.CheckPluginExistsOnAllHosts(testCluster)
+			writeFakePlugin("echo 'backup not found' >&2; exit 1")
+
+			err := subject.DeleteBackup("20170101010101")
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("ERROR: Plugin failed to delete backup 20170101010101. backup not found\n"))
+		})
+		It("returns the entries printed by list_directory", func() {
+			setAPIVersion("0.5.0")
+			subject.CheckPluginExistsOnAllHosts(testCluster)
+			writeFakePlugin(`if [ "$1" = "list_directory" ] && [ "$3" = "backups/20170101" ]; then printf "20170101010101\n\n20170101020202\n"; fi`)
+
+			entries, err := subject.ListDirectory("backups/20170101")
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(entries).To(Equal([]string{"20170101010101", "20170101020202"}))
+		})
+		It("returns an error when listing a directory with a plugin that does not support it", func() {
+			setAPIVersion("0.4.0")
+			subject.CheckPluginExistsOnAllHosts(testCluster)
+
+			_, err := subject.ListDirectory("backups")
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("does not support listing directories. Plugin API version 0.5.0 or later is required."))
+		})
+	})
 	Describe("UsesEncryption", func() {
 		It("returns false when there is no encryption in config", func() {
 			Expect(subject.UsesEncryption()).To(BeFalse())
@@ -13,6 +13,7 @@ import (
 	"os/signal"
 	path "path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -119,13 +120,149 @@ func MakeFQN(schema string, object string) string {
 func ValidateFQNs(tableList []string) error {
 	validFormat := regexp.MustCompile(`^.+\..+$`)
 	for _, fqn := range tableList {
+		if strings.HasPrefix(fqn, FilterRegexPrefix) {
+			continue
+		}
 		if !validFormat.Match([]byte(fqn)) {
 			return errors.Errorf(`Table "%s" is not correctly fully-qualified.  Please ensure table is in the format "schema.table".`, fqn)
 		}
 	}
+	return ValidateFilterPatterns(tableList)
+}
+
+/*
+ * Schema and table filters may be given as patterns, either as a glob using
+ * "*", "?", and "[...]" prefixed with "glob:" or as a regular expression
+ * prefixed with "re:".  Filters without a prefix are literal names, so names
+ * that contain glob characters can still be filtered on.  A pattern must
+ * match the whole name, and table patterns are matched against the unquoted
+ * name in the format "schema.table".  A glob character may be escaped with a
+ * backslash to match it literally.
+ */
+const (
+	FilterGlobPrefix  = "glob:"
+	FilterRegexPrefix = "re:"
+)
+
+func IsFilterPattern(filter string) bool {
+	return strings.HasPrefix(filter, FilterGlobPrefix) || strings.HasPrefix(filter, FilterRegexPrefix)
+}
+
+func CompileFilterPattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, FilterRegexPrefix) {
+		expression := strings.TrimPrefix(pattern, FilterRegexPrefix)
+		compiled, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", expression))
+		if err != nil {
+			return nil, errors.Errorf(`Invalid regular expression in filter "%s": %v`, pattern, err)
+		}
+		return compiled, nil
+	}
+
+	glob := strings.TrimPrefix(pattern, FilterGlobPrefix)
+	expression := strings.Builder{}
+	expression.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*':
+			expression.WriteString(".*")
+		case '?':
+			expression.WriteString(".")
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			expression.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case '[':
+			// As in the shell, a "]" directly after the "[" is part of the class, and a "[" with no closing "]" is literal
+			start := i + 1
+			if start < len(glob) && glob[start] == '!' {
+				start++
+			}
+			if start < len(glob) && glob[start] == ']' {
+				start++
+			}
+			end := strings.Index(glob[start:], "]")
+			if end == -1 {
+				expression.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := glob[i+1 : start+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			class = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(class)
+			expression.WriteString("[" + class + "]")
+			i = start + end
+		default:
+			expression.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	expression.WriteString("$")
+	compiled, err := regexp.Compile(expression.String())
+	if err != nil {
+		return nil, errors.Errorf(`Invalid glob in filter "%s": %v`, pattern, err)
+	}
+	return compiled, nil
+}
+
+func ValidateFilterPatterns(filters []string) error {
+	for _, filter := range filters {
+		if IsFilterPattern(filter) {
+			if _, err := CompileFilterPattern(filter); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+/*
+ * Replaces each pattern in filters with the names that it matches, keeping
+ * the names that are not patterns as they are.  The keys of names are matched
+ * against the patterns and their values are added to the expanded list, so
+ * that a caller can match unquoted names but filter on quoted ones.  The
+ * patterns that match no names are returned so that the caller can decide
+ * whether that is an error.
+ */
+func ExpandFilterPatterns(filters []string, names map[string]string) ([]string, []string, error) {
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	expanded := make([]string, 0, len(filters))
+	unmatched := make([]string, 0)
+	added := make(map[string]bool, len(filters))
+	for _, filter := range filters {
+		if !IsFilterPattern(filter) {
+			if !added[filter] {
+				expanded = append(expanded, filter)
+				added[filter] = true
+			}
+			continue
+		}
+		pattern, err := CompileFilterPattern(filter)
+		if err != nil {
+			return nil, nil, err
+		}
+		matched := false
+		for _, name := range sortedNames {
+			if pattern.MatchString(name) {
+				matched = true
+				if !added[names[name]] {
+					expanded = append(expanded, names[name])
+					added[names[name]] = true
+				}
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, filter)
+		}
+	}
+	return expanded, unmatched, nil
+}
+
 func ValidateFullPath(path string) error {
 	if len(path) > 0 && !(strings.HasPrefix(path, "/") || strings.HasPrefix(path, "~")) {
 		return errors.Errorf("%s is not an absolute path.", path)
@@ -141,8 +278,10 @@ type CompressionLevelsDescription struct {
 
 func ValidateCompressionTypeAndLevel(compressionType string, compressionLevel int) error {
 	compressionLevelsForType := map[string]CompressionLevelsDescription{
-		"gzip": {Min: 1, Max: 9},
-		"zstd": {Min: 1, Max: 19},
+		"gzip":  {Min: 1, Max: 9},
+		"pgzip": {Min: 1, Max: 9},
+		"zstd":  {Min: 1, Max: 19},
+		"lz4":   {Min: 1, Max: 9},
 	}
 
 	if levelsDescription, ok := compressionLevelsForType[compressionType]; ok {
@@ -156,6 +295,29 @@ func ValidateCompressionTypeAndLevel(compressionType string, compressionLevel in
 	return nil
 }
 
+const (
+	MinCompressionWindow = 10
+	MaxCompressionWindow = 27
+)
+
+/*
+ * The number of compression threads and the size of the compression window
+ * only apply to zstd compression, and 0 leaves either at its default.  Windows
+ * larger than 2^27 cannot be decompressed by the zstd utility without flags.
+ */
+func ValidateCompressionThreadsAndWindow(compressionType string, compressionThreads int, compressionWindow int) error {
+	if compressionThreads < 0 {
+		return fmt.Errorf("compression threads must be at least 1, or 0 for the default, but the provided number is %d", compressionThreads)
+	}
+	if compressionWindow != 0 && (compressionWindow < MinCompressionWindow || compressionWindow > MaxCompressionWindow) {
+		return fmt.Errorf("compression window must be between %d and %d, but the provided window is %d", MinCompressionWindow, MaxCompressionWindow, compressionWindow)
+	}
+	if (compressionThreads != 0 || compressionWindow != 0) && compressionType != "zstd" {
+		return fmt.Errorf("compression threads and window are only supported by compression type 'zstd', but the provided type is '%s'", compressionType)
+	}
+	return nil
+}
+
 func InitializeSignalHandler(cleanupFunc func(bool), procDesc string, termFlag *bool) {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, unix.SIGINT, unix.SIGTERM)
@@ -62,6 +62,50 @@ var _ = Describe("utils/util tests", func() {
 			err := utils.ValidateFQNs(testStrings)
 			Expect(err).To(HaveOccurred())
 		})
+		It("accepts regular expressions without a dot", func() {
+			testStrings := []string{`re:stg_[0-9]+`}
+			Expect(utils.ValidateFQNs(testStrings)).To(Succeed())
+		})
+	})
+	Describe("CompileFilterPattern", func() {
+		DescribeTable("matches names against globs and regular expressions",
+			func(pattern string, name string, matches bool) {
+				compiled, err := utils.CompileFilterPattern(pattern)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(compiled.MatchString(name)).To(Equal(matches))
+			},
+			Entry("star", "glob:stg.load_*", "stg.load_orders", true),
+			Entry("star matching the whole name", "glob:stg.load_*", "stg.preload_orders", false),
+			Entry("question mark", "glob:sales.orders_2023_0?", "sales.orders_2023_01", true),
+			Entry("character class", "glob:sales.orders_[12]", "sales.orders_3", false),
+			Entry("negated character class", "glob:sales.orders_[!12]", "sales.orders_3", true),
+			Entry("regex metacharacters in a glob", "glob:stg.load(1)_*", "stg.load(1)_orders", true),
+			Entry("escaped glob character", `glob:stg.load\*`, "stg.load_orders", false),
+			Entry("unterminated character class", "glob:stg.load[_*", "stg.load[_orders", true),
+			Entry("regular expression", `re:sales\.orders_\d{4}`, "sales.orders_2023", true),
+			Entry("regular expression matching the whole name", `re:sales\.orders`, "sales.orders_2023", false),
+		)
+		It("returns an error for an invalid regular expression", func() {
+			_, err := utils.CompileFilterPattern("re:stg_(")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`Invalid regular expression in filter "re:stg_("`))
+		})
+	})
+	Describe("ExpandFilterPatterns", func() {
+		It("replaces patterns with the names they match and keeps other filters", func() {
+			names := map[string]string{"stg.load_b": "stg.load_b", "stg.load_a": "stg.load_a", "My.Table": `"My"."Table"`}
+			expanded, unmatched, err := utils.ExpandFilterPatterns([]string{"public.foo", "glob:stg.load_*", "stg.load_a", "re:My\\..*", "glob:stg.tmp_*"}, names)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(expanded).To(Equal([]string{"public.foo", "stg.load_a", "stg.load_b", `"My"."Table"`}))
+			Expect(unmatched).To(Equal([]string{"glob:stg.tmp_*"}))
+		})
+		It("keeps names with glob characters that are not prefixed as they are", func() {
+			names := map[string]string{"stg.load_a": "stg.load_a", "stg.load*": "stg.load*"}
+			expanded, unmatched, err := utils.ExpandFilterPatterns([]string{"stg.load*", "stg.load[1]"}, names)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(expanded).To(Equal([]string{"stg.load*", "stg.load[1]"}))
+			Expect(unmatched).To(BeEmpty())
+		})
 	})
 	Context("ValidateFullPath", func() {
 		It("does not return error when the flag is not set", func() {
@@ -149,6 +193,46 @@ var _ = Describe("utils/util tests", func() {
 			err := utils.ValidateCompressionTypeAndLevel(compressType, compressLevel)
 			Expect(err).To(MatchError("compression type 'zstd' only allows compression levels between 1 and 19, but the provided level is 20"))
 		})
+		It("validates a compression type 'pgzip' and a level between 1 and 9", func() {
+			compressType := "pgzip"
+			compressLevel := 9
+			err := utils.ValidateCompressionTypeAndLevel(compressType, compressLevel)
+			Expect(err).To(Not(HaveOccurred()))
+		})
+		It("validates a compression type 'lz4' and a level between 1 and 9", func() {
+			compressType := "lz4"
+			compressLevel := 1
+			err := utils.ValidateCompressionTypeAndLevel(compressType, compressLevel)
+			Expect(err).To(Not(HaveOccurred()))
+		})
+		It("panics if given a compression type 'lz4' and a compression level > 9", func() {
+			compressType := "lz4"
+			compressLevel := 12
+			err := utils.ValidateCompressionTypeAndLevel(compressType, compressLevel)
+			Expect(err).To(MatchError("compression type 'lz4' only allows compression levels between 1 and 9, but the provided level is 12"))
+		})
+	})
+	Describe("ValidateCompressionThreadsAndWindow", func() {
+		It("validates compression threads and a window for compression type 'zstd'", func() {
+			err := utils.ValidateCompressionThreadsAndWindow("zstd", 4, 27)
+			Expect(err).To(Not(HaveOccurred()))
+		})
+		It("validates default compression threads and window for any compression type", func() {
+			err := utils.ValidateCompressionThreadsAndWindow("gzip", 0, 0)
+			Expect(err).To(Not(HaveOccurred()))
+		})
+		It("returns an error if given a negative number of compression threads", func() {
+			err := utils.ValidateCompressionThreadsAndWindow("zstd", -1, 0)
+			Expect(err).To(MatchError("compression threads must be at least 1, or 0 for the default, but the provided number is -1"))
+		})
+		It("returns an error if given a compression window > 27", func() {
+			err := utils.ValidateCompressionThreadsAndWindow("zstd", 0, 28)
+			Expect(err).To(MatchError("compression window must be between 10 and 27, but the provided window is 28"))
+		})
+		It("returns an error if given compression threads for compression type 'gzip'", func() {
+			err := utils.ValidateCompressionThreadsAndWindow("gzip", 4, 0)
+			Expect(err).To(MatchError("compression threads and window are only supported by compression type 'zstd', but the provided type is 'gzip'"))
+		})
 	})
 	Describe("UnquoteIdent", func() {
 		It("returns unchanged ident when passed a single char", func() {